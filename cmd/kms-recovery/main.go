@@ -0,0 +1,122 @@
+// Command kms-recovery takes an offline recovery kit of a KMS's keys: the REK
+// keyring and the store's at-rest key, split k-of-n into Shamir shares, each
+// sealed to a named custodian's age recipient.
+//
+// A kit is the way back from the two losses nothing else recovers. Without the
+// MPC cluster, the REK can never be fetched again. Without
+// KMS_ENCRYPTION_KEY_B64, the store does not open. If either happens, the
+// server boots from a quorum of the kit's shares instead; see
+// KMS_RECOVERY_UNSEAL in cmd/kms.
+//
+// Like kms-rekey it is a separate binary: the server starts serving the moment
+// it runs and takes no subcommand. It reads the keys the way the server does,
+// from the same environment (atrest.KeyFromEnv, mpcrek.KeyringFromEnv):
+//
+//	KMS_ENCRYPTION_KEY_B64                     the at-rest key (required)
+//	MPC_REK_ENDPOINT, MPC_REK_KEY_ID,
+//	  MPC_REK_PREVIOUS_KEY_IDS, MPC_REK_TIMEOUT  the REK keyring from MPC, or
+//	KMS_MASTER_KEY_B64, KMS_REK_EPOCH,
+//	  KMS_MASTER_KEY_PREVIOUS                  the REK keyring from the env
+//
+//	kms-recovery -threshold 3 -out ./kit \
+//	  -custodian alice=age1... -custodian bob=age1pq1... -custodian carol=age1... \
+//	  -custodian dave=age1... -custodian erin=age1...
+//
+// It writes one file per custodian, <out>/<name>.age. Only that custodian's
+// age identity opens it. It prints the kit ID, which is public: record it with
+// the deployment, because a server unsealing from this kit is pinned to it.
+//
+// A kit holds the keys as they are now. Take a new one after every REK
+// rotation or at-rest rekey, and destroy the old files. A kit that predates the
+// current epoch cannot open what was written since.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/luxfi/kms/pkg/atrest"
+	"github.com/luxfi/kms/pkg/recovery"
+	"github.com/luxfi/kms/pkg/store/mpcrek"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kms-recovery: ")
+
+	threshold := flag.Int("threshold", 0, "shares needed to recover the kit (at least 2)")
+	out := flag.String("out", "", "directory to write the sealed shares into")
+	var custodians []recovery.Custodian
+	flag.Func("custodian", "name=age-recipient of a share holder (repeat once per custodian)", func(s string) error {
+		c, err := recovery.ParseCustodian(s)
+		if err != nil {
+			return err
+		}
+		custodians = append(custodians, c)
+		return nil
+	})
+	flag.Parse()
+
+	if *threshold == 0 || *out == "" || len(custodians) == 0 {
+		flag.Usage()
+		log.Fatal("-threshold, -out and -custodian are required")
+	}
+
+	atRest, err := atrest.KeyFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	reks, current, err := mpcrek.KeyringFromEnv(envOr("KMS_NODE_ID", "kms-0") + "-recovery-kit")
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	keys := &recovery.Keys{AtRestKey: atRest, REKEpoch: current, REKs: reks}
+	defer keys.Zero()
+
+	kit, sealed, err := recovery.Split(keys, custodians, *threshold)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := os.MkdirAll(*out, 0o700); err != nil {
+		log.Fatalf("%v", err)
+	}
+	for _, s := range sealed {
+		path := filepath.Join(*out, s.Custodian+".age")
+		// O_EXCL: a kit never overwrites a share of another kit.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if _, err := f.Write(s.Age); err != nil {
+			f.Close()
+			log.Fatalf("%s: %v", path, err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		fmt.Printf("%s\n", path)
+	}
+
+	fmt.Printf("kit %s: %d-of-%d over the at-rest key and REK epochs %v (current %d)\n", kit, *threshold, len(sealed), epochs(reks), current)
+	fmt.Printf("give each custodian their file and nothing else; boot from it with KMS_RECOVERY_UNSEAL=%s\n", kit)
+}
+
+func epochs(reks map[uint32][]byte) []uint32 {
+	out := make([]uint32, 0, len(reks))
+	for epoch := range reks {
+		out = append(out, epoch)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
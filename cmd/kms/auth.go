@@ -121,7 +121,7 @@ func orgAuthorizes(tokenOrg, requested string) bool {
 // state is unreachable in a real deployment: main refuses to boot the secret
 // surface without it (requireHomeOrgConfig).
 func (a *orgJWTAuth) authorizesHome(c *orgClaims) bool {
-	if hasRole(c.Roles, roleKMSAdmin) || hasRole(c.Roles, roleSuperadmin) {
+	if isKMSAdmin(c) {
 		return true
 	}
 	for _, home := range a.homeOrgs {
@@ -134,6 +134,24 @@ func (a *orgJWTAuth) authorizesHome(c *orgClaims) bool {
 	return false
 }
 
+// isKMSAdmin reports whether c carries the kms-admin or superadmin role — the
+// IAM-granted override above, and the gate on every administrative route. A
+// nil c is not an admin.
+func isKMSAdmin(c *orgClaims) bool {
+	return c != nil && (hasRole(c.Roles, roleKMSAdmin) || hasRole(c.Roles, roleSuperadmin))
+}
+
+// denyNonAdmin answers 403 unless c is a KMS admin, and reports whether it
+// did: a handler returns on true. what names the refused operation in the
+// answer ("purge").
+func denyNonAdmin(w http.ResponseWriter, c *orgClaims, what string) bool {
+	if isKMSAdmin(c) {
+		return false
+	}
+	writeJSON(w, http.StatusForbidden, map[string]any{"message": what + " requires the kms-admin role"})
+	return true
+}
+
 // requireHomeOrgConfig returns an error when the secret surface would run with
 // no home org configured. main calls it after wiring auth and refuses to boot on
 // error: an unconfigured gate authorizes any valid IAM token from any org, which
@@ -396,7 +414,7 @@ func (a *orgJWTAuth) requireOrgJWT(next http.HandlerFunc) http.HandlerFunc {
 			})
 			return
 		}
-		next(w, r)
+		next(w, withClaims(r, claims))
 	}
 }
 
@@ -437,7 +455,7 @@ func (a *orgJWTAuth) requireJWT(next http.HandlerFunc) http.HandlerFunc {
 			})
 			return
 		}
-		next(w, r)
+		next(w, withClaims(r, claims))
 	}
 }
 
@@ -485,14 +503,46 @@ func (a *orgJWTAuth) requireKeyAuth(next http.HandlerFunc) http.HandlerFunc {
 			})
 			return
 		}
-		if !hasRole(claims.Roles, roleKMSAdmin) && !hasRole(claims.Roles, roleSuperadmin) {
+		if !isKMSAdmin(claims) {
 			writeJSON(w, http.StatusForbidden, map[string]any{
 				"statusCode": 403, "message": "kms key operations require the kms-admin role",
 			})
 			return
 		}
-		next(w, r)
+		next(w, withClaims(r, claims))
+	}
+}
+
+// claimsKey is the request-context key the auth middleware stores the
+// verified claims under.
+type claimsKey struct{}
+
+// withClaims hands the verified claims to the wrapped handler, for the
+// handlers that record WHO acted (a secret version's writer) or gate an
+// operation on a role. Only the middleware above calls it, after validate.
+func withClaims(r *http.Request, c *orgClaims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, c))
+}
+
+// claimsFrom returns the claims the auth middleware verified for r, or nil
+// when the handler was reached without one (unit tests that call a handler
+// directly).
+func claimsFrom(r *http.Request) *orgClaims {
+	c, _ := r.Context().Value(claimsKey{}).(*orgClaims)
+	return c
+}
+
+// principal names the caller in audit records and version history:
+// "iam:<owner>/<name>" for a named IAM principal, "iam:<sub>" otherwise. It
+// is a label, never an authorization input.
+func (c *orgClaims) principal() string {
+	if c == nil {
+		return ""
+	}
+	if c.Name != "" {
+		return "iam:" + c.Owner + "/" + c.Name
 	}
+	return "iam:" + c.Subject
 }
 
 func bearerToken(r *http.Request) string {
@@ -36,6 +36,11 @@ const (
 	envFile       = "KMS_CONSENSUS_FILE"
 	envTTL        = "KMS_CONSENSUS_TTL"
 
+	// envDetokenizers lists the detokenizer authority: the NodeIDs that
+	// may turn a token back into its value (OpDetokenize). Optional;
+	// unset, nobody may.
+	envDetokenizers = "KMS_CONSENSUS_DETOKENIZERS"
+
 	// Nonce ledger knobs. Both have package-default fallbacks; the env
 	// vars exist so the kms-operator can tune memory pressure in
 	// high-cardinality deployments without a rebuild.
@@ -82,9 +87,10 @@ func buildNonceLedger() (zapserver.NonceLedger, error) {
 // currently-deployed snapshot is in. Decoding it is inert: nothing reads
 // the overlay unless KMS_AUTHZ_MODE selects a mode that does.
 type consensusSnapshot struct {
-	Validators []string           `json:"validators"`
-	Operators  []string           `json:"operators"`
-	Scopes     *consensusScopeSet `json:"scopes"`
+	Validators   []string           `json:"validators"`
+	Operators    []string           `json:"operators"`
+	Detokenizers []string           `json:"detokenizers"`
+	Scopes       *consensusScopeSet `json:"scopes"`
 }
 
 // consensusScopeSet is keyed by IDENTITY, not by authority: membership
@@ -99,10 +105,11 @@ type consensusScopeSet struct {
 // vars; refuses to boot if neither is present, since the ZAP server
 // is fail-closed by construction.
 func buildConsensusAuthorizer() (zapserver.ConsensusAuthorizer, error) {
-	validators, operators, scopes, err := loadConsensusSnapshot()
+	authority, err := loadConsensusSnapshot()
 	if err != nil {
 		return nil, err
 	}
+	validators, operators, detokenizers := authority.validators, authority.operators, authority.detokenizers
 	if len(validators) == 0 {
 		return nil, errors.New("consensus validator authority is empty (refusing to boot fail-open)")
 	}
@@ -117,11 +124,16 @@ func buildConsensusAuthorizer() (zapserver.ConsensusAuthorizer, error) {
 		}
 		ttl = d
 	}
-	az, err := zapserver.NewInProcessAuthorizer(zapserver.InProcessAuthorizerConfig{
+	cfg := zapserver.InProcessAuthorizerConfig{
 		Validators: zapserver.NewStaticAuthorityProvider(validators),
 		Operator:   zapserver.NewStaticAuthorityProvider(operators),
 		CacheTTL:   ttl,
-	})
+	}
+	if len(detokenizers) > 0 {
+		cfg.Detokenizers = zapserver.NewStaticAuthorityProvider(detokenizers)
+		log.Printf("kms: detokenizer authority: %d identities", len(detokenizers))
+	}
+	az, err := zapserver.NewInProcessAuthorizer(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +144,7 @@ func buildConsensusAuthorizer() (zapserver.ConsensusAuthorizer, error) {
 	}, "self-test", zapserver.OpAuthGet); err != nil {
 		return nil, fmt.Errorf("authorizer self-test: %w", err)
 	}
-	return wrapAuthzMode(az, scopes)
+	return wrapAuthzMode(az, authority.scopes)
 }
 
 // wrapAuthzMode installs the scope-observation stage selected by
@@ -164,46 +176,65 @@ func wrapAuthzMode(az zapserver.ConsensusAuthorizer, scopes map[ids.NodeID]zapse
 	})
 }
 
-// loadConsensusSnapshot returns the (validators, operators) NodeID sets
-// plus the optional per-identity scope overlay, sourcing from
+// consensusAuthority is what loadConsensusSnapshot reads: the validator,
+// operator and detokenizer NodeID sets, and the optional per-identity
+// scope overlay.
+type consensusAuthority struct {
+	validators   []ids.NodeID
+	operators    []ids.NodeID
+	detokenizers []ids.NodeID
+	scopes       map[ids.NodeID]zapserver.Grants
+}
+
+// loadConsensusSnapshot returns the (validators, operators, detokenizers)
+// NodeID sets plus the optional per-identity scope overlay, sourcing from
 // KMS_CONSENSUS_FILE first then falling back to KMS_CONSENSUS_VALIDATORS
-// + KMS_CONSENSUS_OPERATORS env vars.
+// + KMS_CONSENSUS_OPERATORS + KMS_CONSENSUS_DETOKENIZERS env vars.
 //
-// The env-var delivery carries no overlay (it is two NodeID lists); a nil
-// scope map there is correct, not a gap.
-func loadConsensusSnapshot() ([]ids.NodeID, []ids.NodeID, map[ids.NodeID]zapserver.Grants, error) {
+// The env-var delivery carries no overlay (it is NodeID lists); a nil
+// scope map there is correct, not a gap. No detokenizers is not an error
+// either — it is the default, under which no identity detokenizes.
+func loadConsensusSnapshot() (*consensusAuthority, error) {
 	if path := strings.TrimSpace(os.Getenv(envFile)); path != "" {
 		data, err := os.ReadFile(path)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("%s: %w", envFile, err)
+			return nil, fmt.Errorf("%s: %w", envFile, err)
 		}
 		var snap consensusSnapshot
 		if err := json.Unmarshal(data, &snap); err != nil {
-			return nil, nil, nil, fmt.Errorf("%s: %w", envFile, err)
+			return nil, fmt.Errorf("%s: %w", envFile, err)
 		}
 		validators, err := parseNodeIDs(snap.Validators)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("%s validators: %w", envFile, err)
+			return nil, fmt.Errorf("%s validators: %w", envFile, err)
 		}
 		operators, err := parseNodeIDs(snap.Operators)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("%s operators: %w", envFile, err)
+			return nil, fmt.Errorf("%s operators: %w", envFile, err)
+		}
+		detokenizers, err := parseNodeIDs(snap.Detokenizers)
+		if err != nil {
+			return nil, fmt.Errorf("%s detokenizers: %w", envFile, err)
 		}
 		scopes, err := parseScopes(snap.Scopes)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("%s scopes: %w", envFile, err)
+			return nil, fmt.Errorf("%s scopes: %w", envFile, err)
 		}
-		return validators, operators, scopes, nil
+		return &consensusAuthority{validators, operators, detokenizers, scopes}, nil
 	}
 	validators, err := parseNodeIDs(splitLines(os.Getenv(envValidators)))
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("%s: %w", envValidators, err)
+		return nil, fmt.Errorf("%s: %w", envValidators, err)
 	}
 	operators, err := parseNodeIDs(splitLines(os.Getenv(envOperators)))
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("%s: %w", envOperators, err)
+		return nil, fmt.Errorf("%s: %w", envOperators, err)
+	}
+	detokenizers, err := parseNodeIDs(splitLines(os.Getenv(envDetokenizers)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", envDetokenizers, err)
 	}
-	return validators, operators, nil, nil
+	return &consensusAuthority{validators, operators, detokenizers, nil}, nil
 }
 
 // parseScopes converts the snapshot's identity→grants block into the
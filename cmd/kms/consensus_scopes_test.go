@@ -46,15 +46,15 @@ const (
 func TestLoadConsensusSnapshot_LegacyFileHasNoOverlay(t *testing.T) {
 	writeSnapshot(t, `{"validators":["`+nodeA+`"],"operators":["`+nodeB+`"]}`)
 
-	validators, operators, scopes, err := loadConsensusSnapshot()
+	auth, err := loadConsensusSnapshot()
 	if err != nil {
 		t.Fatalf("legacy snapshot failed to load: %v", err)
 	}
-	if len(validators) != 1 || len(operators) != 1 {
-		t.Fatalf("authority sets misread: %v / %v", validators, operators)
+	if len(auth.validators) != 1 || len(auth.operators) != 1 || len(auth.detokenizers) != 0 {
+		t.Fatalf("authority sets misread: %v / %v / %v", auth.validators, auth.operators, auth.detokenizers)
 	}
-	if scopes != nil {
-		t.Fatalf("legacy snapshot produced a non-nil overlay (%v) — absent must mean absent", scopes)
+	if auth.scopes != nil {
+		t.Fatalf("legacy snapshot produced a non-nil overlay (%v) — absent must mean absent", auth.scopes)
 	}
 }
 
@@ -63,7 +63,7 @@ func TestLoadConsensusSnapshot_LegacyFileHasNoOverlay(t *testing.T) {
 // lets the operator ship the overlay before any kmsd consumes it.
 func TestLoadConsensusSnapshot_UnknownKeysIgnored(t *testing.T) {
 	writeSnapshot(t, `{"validators":["`+nodeA+`"],"operators":["`+nodeB+`"],"somethingNew":{"a":1}}`)
-	if _, _, _, err := loadConsensusSnapshot(); err != nil {
+	if _, err := loadConsensusSnapshot(); err != nil {
 		t.Fatalf("unknown key broke the decode: %v", err)
 	}
 }
@@ -83,10 +83,11 @@ func TestLoadConsensusSnapshot_ParsesIdentityScopes(t *testing.T) {
 	  }}
 	}`)
 
-	_, _, scopes, err := loadConsensusSnapshot()
+	auth, err := loadConsensusSnapshot()
 	if err != nil {
 		t.Fatalf("scoped snapshot failed to load: %v", err)
 	}
+	scopes := auth.scopes
 	if len(scopes) != 2 {
 		t.Fatalf("expected 2 identity entries, got %d: %v", len(scopes), scopes)
 	}
@@ -115,7 +116,7 @@ func TestLoadConsensusSnapshot_ParsesIdentityScopes(t *testing.T) {
 func TestLoadConsensusSnapshot_MalformedScopeNodeIDIsFatal(t *testing.T) {
 	writeSnapshot(t, `{"validators":["`+nodeA+`"],"operators":["`+nodeB+`"],
 	  "scopes":{"identities":{"not-a-node-id":{"grants":[]}}}}`)
-	if _, _, _, err := loadConsensusSnapshot(); err == nil {
+	if _, err := loadConsensusSnapshot(); err == nil {
 		t.Fatal("a malformed NodeID in the overlay must be a hard failure")
 	}
 }
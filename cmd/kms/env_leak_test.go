@@ -42,7 +42,7 @@ func TestSecretRoutes_NoEnvVarLeak(t *testing.T) {
 
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 
 	// The SAME registrar main() calls — this is the real route set, not a mock.
 	mux := http.NewServeMux()
@@ -108,11 +108,9 @@ func TestSecretRoutes_NoEnvVarLeak(t *testing.T) {
 func TestSecretRoutes_OrgScopedReadStillWorks(t *testing.T) {
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 
-	if err := secStore.Put(&store.Secret{
-		Name: "API_KEY", Path: "svc", Env: "prod", Ciphertext: []byte("stored-value-ok"),
-	}); err != nil {
+	if _, err := secStore.Put("svc", "API_KEY", "prod", []byte("stored-value-ok"), store.PutOptions{}); err != nil {
 		t.Fatalf("seed: %v", err)
 	}
 
@@ -145,7 +143,7 @@ func TestSecretRoutes_OrgScopedReadStillWorks(t *testing.T) {
 func TestSecretRoutes_UnauthOrgReadRejected(t *testing.T) {
 	auth, _, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 
 	mux := http.NewServeMux()
 	registerSecretRoutes(mux, auth, secStore)
@@ -172,11 +170,9 @@ func TestSecretRoutes_UnauthOrgReadRejected(t *testing.T) {
 func TestSecretRoutes_ListAndGetDoNotShadow(t *testing.T) {
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 
-	if err := secStore.Put(&store.Secret{
-		Path: "gateway", Name: "routes", Env: "default", Ciphertext: []byte("yaml: here"),
-	}); err != nil {
+	if _, err := secStore.Put("gateway", "routes", "default", []byte("yaml: here"), store.PutOptions{}); err != nil {
 		t.Fatalf("seed: %v", err)
 	}
 
@@ -237,11 +233,9 @@ func TestSecretRoutes_ListAndGetDoNotShadow(t *testing.T) {
 func TestSecretRoutes_RootLevelSecretIsAddressable(t *testing.T) {
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 
-	if err := secStore.Put(&store.Secret{
-		Path: "", Name: "DATABASE_URL", Env: "prod", Ciphertext: []byte("postgres://x"),
-	}); err != nil {
+	if _, err := secStore.Put("", "DATABASE_URL", "prod", []byte("postgres://x"), store.PutOptions{}); err != nil {
 		t.Fatalf("seed: %v", err)
 	}
 
@@ -11,6 +11,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -23,14 +24,22 @@ import (
 	badger "github.com/luxfi/zapdb"
 )
 
-func newTestSecretStore(t *testing.T) *store.SecretStore {
+func newTestSealedStore(t *testing.T) *store.SealedStore {
 	t.Helper()
 	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
 	if err != nil {
 		t.Fatalf("open zapdb: %v", err)
 	}
 	t.Cleanup(func() { _ = db.Close() })
-	return store.NewSecretStore(db)
+	mk := make([]byte, 32)
+	if _, err := rand.Read(mk); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := store.NewSealedStore(store.NewSecretStore(db), mk)
+	if err != nil {
+		t.Fatalf("sealed store: %v", err)
+	}
+	return sealed
 }
 
 func sha256hex(s string) string {
@@ -50,7 +59,7 @@ func postJSON(t *testing.T, url string, body map[string]string) *http.Response {
 
 // A write that omits env fails loud (400) and lands nowhere.
 func TestPutSecret_WithoutEnv_400(t *testing.T) {
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 	srv := httptest.NewServer(putSecretHandler(secStore))
 	defer srv.Close()
 
@@ -76,7 +85,7 @@ func TestPutSecret_WithoutEnv_400(t *testing.T) {
 // A write with an explicit env is readable through the exact project/env/path
 // resolution the kms-operator uses, and is not visible in any other bucket.
 func TestPutSecret_WithEnvProd_StoredUnderProd(t *testing.T) {
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 	srv := httptest.NewServer(putSecretHandler(secStore))
 	defer srv.Close()
 
@@ -96,7 +105,7 @@ func TestPutSecret_WithEnvProd_StoredUnderProd(t *testing.T) {
 	if err != nil {
 		t.Fatalf("project/env/path read (prod): %v", err)
 	}
-	if h := sha256hex(string(got.Ciphertext)); h != want {
+	if h := sha256hex(string(got)); h != want {
 		t.Fatalf("round-trip value digest mismatch: got %s want %s", h, want)
 	}
 
@@ -105,3 +114,18 @@ func TestPutSecret_WithEnvProd_StoredUnderProd(t *testing.T) {
 		t.Fatal("prod write must not be visible in env=default")
 	}
 }
+
+// Without a REK the store cannot seal, so a write is refused (503) rather than
+// stored raw — a raw record is exactly what the ZAP wire could never open.
+func TestPutSecret_WithoutREK_503(t *testing.T) {
+	srv := httptest.NewServer(putSecretHandler(nil))
+	defer srv.Close()
+
+	resp := postJSON(t, srv.URL, map[string]string{
+		"path": "iam-passwords", "name": "Z_PASSWORD", "env": "prod", "value": "irrelevant",
+	})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("write with no REK: want 503, got %d", resp.StatusCode)
+	}
+}
@@ -19,6 +19,10 @@ import (
 // body, whatever the handler underneath tried to write. Status and Location are
 // untouched, so redirects still redirect — they just stop explaining themselves
 // in HTML.
+//
+// The one other framing is text/event-stream, for the change feed (see
+// secrets_watch.go): it is passed through as written, and every event it
+// carries is JSON.
 func jsonOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		next.ServeHTTP(&jsonGuard{ResponseWriter: w}, r)
@@ -36,7 +40,8 @@ func (g *jsonGuard) WriteHeader(code int) {
 		return
 	}
 	g.wroteHeader = true
-	g.passthrough = strings.HasPrefix(g.Header().Get("Content-Type"), "application/json")
+	ct := g.Header().Get("Content-Type")
+	g.passthrough = strings.HasPrefix(ct, "application/json") || strings.HasPrefix(ct, "text/event-stream")
 	if !g.passthrough {
 		g.Header().Set("Content-Type", "application/json")
 		g.Header().Del("Content-Length") // the replacement body is a different size
@@ -61,6 +66,10 @@ func (g *jsonGuard) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// Unwrap lets http.ResponseController reach the connection underneath, to
+// flush a stream and lift its write deadline.
+func (g *jsonGuard) Unwrap() http.ResponseWriter { return g.ResponseWriter }
+
 // statusFromHeader recovers a usable message for a body we are discarding.
 // Location present means a redirect; otherwise fall back to a generic error.
 func statusFromHeader(h http.Header) int {
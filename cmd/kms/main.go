@@ -19,11 +19,25 @@
 //	                       MPC cluster returns a 32-byte REK. Takes precedence
 //	                       over KMS_MASTER_KEY_B64.
 //	  MPC_REK_KEY_ID     - MPC-side identifier of the wrapped REK record
-//	                       (default "kms/rek/v1"). Bump alongside reshare.
+//	                       (default "kms/rek/v1"). Bump alongside reshare;
+//	                       the "/v<N>" suffix is the REK epoch.
+//	  MPC_REK_PREVIOUS_KEY_IDS - CSV of older epochs' key IDs to hold while
+//	                       their records are re-wrapped (default none).
 //	  MPC_REK_TIMEOUT    - REK bootstrap timeout (Go duration, default "10s").
 //	  KMS_MASTER_KEY_B64 - LEGACY 32-byte master key (base64). Used only when
 //	                       MPC_REK_ENDPOINT is unset. Slated for removal once
 //	                       every KMS deployment ships with MPC-rooted REK.
+//	  KMS_REK_EPOCH      - epoch of KMS_MASTER_KEY_B64 (default 1).
+//	  KMS_MASTER_KEY_PREVIOUS - older REKs to hold with it, as
+//	                       "epoch:base64[,epoch:base64...]" (default none).
+//	  KMS_RECOVERY_UNSEAL - LAST RESORT: a recovery kit ID (cmd/kms-recovery).
+//	                       When set, the server boots from a quorum of that
+//	                       kit's shares POSTed to /v1/kms/unseal instead of
+//	                       KMS_ENCRYPTION_KEY_B64 and the REK sources above,
+//	                       and serves nothing else until they are in. Every
+//	                       share and the unseal itself are audit-logged.
+//	  KMS_REWRAP_PAUSE   - pause between batches of the background DEK
+//	                       re-wrap (Go duration, default "100ms").
 //	  KMS_DATA_DIR       - ZapDB data directory (default "/data/kms")
 //	  KMS_LISTEN         - HTTP listen address (default ":8080")
 //	  IAM_ENDPOINT       - Hanzo IAM endpoint for auth (default "https://hanzo.id")
@@ -66,7 +80,6 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -84,8 +97,11 @@ import (
 	badger "github.com/luxfi/zapdb"
 
 	"github.com/luxfi/kms/pkg/atrest"
+	"github.com/luxfi/kms/pkg/generate"
 	"github.com/luxfi/kms/pkg/keys"
 	"github.com/luxfi/kms/pkg/mpc"
+	"github.com/luxfi/kms/pkg/recovery"
+	"github.com/luxfi/kms/pkg/schema"
 	"github.com/luxfi/kms/pkg/sdksign"
 	"github.com/luxfi/kms/pkg/secret"
 	"github.com/luxfi/kms/pkg/store"
@@ -115,7 +131,19 @@ func main() {
 	// cleartext on the PVC and in the S3 replica, and no gate in front of it
 	// changes that. So a missing or malformed key stops the boot here rather
 	// than degrading to a plaintext store behind one scrolled-past log line.
+	//
+	// The last-resort boot (KMS_RECOVERY_UNSEAL, see unseal.go) takes the
+	// at-rest key and the REK keyring from a quorum of recovery-kit shares
+	// instead, and serves nothing else until they are in.
+	var recovered *recovery.Keys
+	if kit := envOr("KMS_RECOVERY_UNSEAL", ""); kit != "" {
+		recovered = awaitUnseal(listen, kit)
+		defer recovered.Zero()
+	}
 	atRest, err := atrest.KeyFromEnv()
+	if recovered != nil {
+		atRest, err = recovered.AtRestKey, nil
+	}
 	if err != nil {
 		log.Fatalf("kms: %v", err)
 	}
@@ -189,6 +217,40 @@ func main() {
 	// Secret store — ZapDB-backed, encrypted at rest.
 	secStore := store.NewSecretStore(db)
 
+	// Deletes are tombstones, recoverable for KMS_DELETE_RETENTION (default
+	// 30 days) and then purged by a background sweep every
+	// KMS_PURGE_INTERVAL (default 1h). A malformed retention stops the boot:
+	// guessing a window here decides when a deleted credential is gone for
+	// good.
+	if v := os.Getenv("KMS_DELETE_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("kms: KMS_DELETE_RETENTION=%q: want a positive duration (e.g. 720h)", v)
+		}
+		secStore.SetRetention(d)
+	}
+	purgeEvery := time.Hour
+	if v := os.Getenv("KMS_PURGE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			purgeEvery = d
+		}
+	}
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go secStore.RunPurger(purgeCtx, purgeEvery, log.Printf)
+	log.Printf("kms: deleted secrets recoverable for %s (purge sweep every %s)", secStore.Retention(), purgeEvery)
+
+	// Secrets past their metadata expires_at read as not-found from that
+	// instant; a sweep every KMS_EXPIRE_INTERVAL (default 5m) moves them to
+	// the deleted set, where the retention clock above takes over.
+	expireEvery := 5 * time.Minute
+	if v := os.Getenv("KMS_EXPIRE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			expireEvery = d
+		}
+	}
+	go secStore.RunExpirer(purgeCtx, expireEvery, log.Printf)
+
 	// JWT-backed authorization for the secrets surface. Every request to
 	// /v1/kms/orgs/{org}/secrets/* must carry an IAM-signed bearer token
 	// whose `owner` claim equals {org} (or whose roles include
@@ -216,6 +278,58 @@ func main() {
 		log.Fatalf("kms: %v", err)
 	}
 
+	// The master key (Root Encryption Key) protecting every per-secret DEK is
+	// resolved by loadKeyring below, as a keyring of REKs by epoch. Preferred source is a luxfi/mpc threshold
+	// cluster (MPC_REK_ENDPOINT); fallback is KMS_MASTER_KEY_B64 for the
+	// migration window. If MPC_REK_ENDPOINT is set, kmsd FAILS CLOSED on any
+	// fetch error — there is no env-var fallback in MPC mode, since the
+	// whole point of MPC-rooting the REK is that it must not be derivable
+	// from anything on the pod.
+	//
+	// It is loaded before any secret route is registered because BOTH
+	// transports seal under it: the HTTP surface and the ZAP wire share one
+	// SealedStore, so a value written on either reads back on the other.
+	var keyring *store.Keyring
+	if recovered != nil {
+		keyring, err = store.NewKeyring(recovered.REKEpoch, recovered.REKs)
+		if err != nil {
+			log.Fatalf("kms: recovered REK keyring: %v", err)
+		}
+		log.Printf("kms: audit: REK keyring recovered from kit (current epoch %d, epochs %v); MPC_REK_ENDPOINT and KMS_MASTER_KEY_B64 are not read", keyring.Current(), keyring.Epochs())
+	} else {
+		keyring = loadKeyring()
+	}
+	defer keyring.Zero()
+	var sealed *store.SealedStore
+	if keyring != nil {
+		sealed, err = store.NewSealedStoreWithKeyring(secStore, keyring)
+		if err != nil {
+			log.Fatalf("kms: sealed secret store: %v", err)
+		}
+		// Records the HTTP surface wrote before it sealed are raw values with
+		// no WrappedDEK. Re-seal them in place once, before anything serves,
+		// so no reader on either transport ever meets one. Idempotent.
+		n, err := sealed.SealLegacy()
+		if err != nil {
+			log.Fatalf("kms: re-sealing legacy secret records: %v", err)
+		}
+		if n > 0 {
+			log.Printf("kms: re-sealed %d legacy unsealed secret record(s) under the REK", n)
+		}
+		// Records whose DEK is wrapped under an older REK epoch, or in an
+		// older envelope, are re-wrapped onto the current epoch in the
+		// background; only the DEK wrap changes, and the job pauses between
+		// batches so it never starves live traffic. GET /v1/kms/rek reports
+		// its progress: an old epoch can be dropped once none remain.
+		rewrapPause := 100 * time.Millisecond
+		if v := os.Getenv("KMS_REWRAP_PAUSE"); v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+				rewrapPause = d
+			}
+		}
+		go sealed.RunRewrap(purgeCtx, rewrapPause, log.Printf)
+	}
+
 	// Secret CRUD surface — org-scoped, JWT-gated, ZapDB-backed. Extracted
 	// into one named registrar (mirrors registerKMSRoutes / registerOIDCRoutes
 	// ) so the exact route set the server exposes is testable
@@ -223,7 +337,7 @@ func main() {
 	// process environment (KMS_MASTER_KEY_B64 root REK, MPC_TOKEN, S3 keys) is
 	// never reachable over HTTP. Secrets flow ONLY through these org-scoped
 	// routes and the ZAP wire. Regression: TestSecretRoutes_NoEnvVarLeak.
-	registerSecretRoutes(mux, auth, secStore)
+	registerSecretRoutes(mux, auth, sealed)
 
 	// MPC key management (only when MPC_VAULT_ID is set).
 	//
@@ -239,6 +353,10 @@ func main() {
 	// no full key material. nil ⇒ sign/verify return "signing not
 	// configured".
 	var signBackend zapserver.SignBackend
+	// thresholdReveal, when non-nil, is the T-Chain key "tfhe"-mode secrets
+	// are encrypted under (KMS_TFHE_KEY_ID); it needs the MPC client below.
+	// nil ⇒ such writes and reads answer 503 on HTTP and an error on ZAP.
+	var thresholdReveal *store.ThresholdReveal
 	if vaultID != "" {
 		// Trust at the network boundary (NetworkPolicy + ZAP wire).
 		zapClient, err := mpc.NewZapClient(nodeID, mpcAddr)
@@ -278,6 +396,13 @@ func main() {
 			mgr := keys.NewManager(zapClient, keyStore, vaultID)
 			// Enable /v1/sdk sign/verify over the same MPC-backed manager.
 			signBackend = sdksign.New(mgr)
+			if keyID := os.Getenv("KMS_TFHE_KEY_ID"); keyID != "" {
+				thresholdReveal = &store.ThresholdReveal{Encryptor: zapClient, KeyID: keyID, Logf: log.Printf}
+				if sealed != nil {
+					sealed.SetThresholdReveal(thresholdReveal)
+				}
+				log.Printf("kms: threshold-reveal secrets enabled (tfhe key %s)", keyID)
+			}
 			registerKMSRoutes(mux, auth, mgr, zapClient, &mpcAvailable)
 		}
 	}
@@ -286,20 +411,11 @@ func main() {
 	}
 
 	// ZAP secrets server — exposes the SecretStore over luxfi/zap on its own
-	// port so in-cluster callers can fetch with zero REST round-trip.
-	//
-	// The master key (Root Encryption Key) protecting every per-secret DEK is
-	// resolved by loadREK below. Preferred source is a luxfi/mpc threshold
-	// cluster (MPC_REK_ENDPOINT); fallback is KMS_MASTER_KEY_B64 for the
-	// migration window. If MPC_REK_ENDPOINT is set, kmsd FAILS CLOSED on any
-	// fetch error — there is no env-var fallback in MPC mode, since the
-	// whole point of MPC-rooting the REK is that it must not be derivable
-	// from anything on the pod.
+	// port so in-cluster callers can fetch with zero REST round-trip. It seals
+	// under the same REK loaded above for the HTTP surface.
 	zapPortStr := envOr("ZAP_PORT", "9999")
 	zapPort, _ := strconv.Atoi(zapPortStr)
-	masterKey := loadREK()
-	defer mpcrek.Zero(masterKey)
-	if masterKey != nil {
+	if keyring != nil {
 		// One authorizer + one nonce ledger back BOTH transports (the
 		// in-cluster ZAP wire and the HTTP /v1/sdk surface) — one
 		// verify→authorize→dispatch core, two framings. Both fail closed:
@@ -316,12 +432,13 @@ func main() {
 			log.Fatalf("kms: nonce ledger init failed: %v", err)
 		}
 		srv := zapserver.New(zapserver.Config{
-			Store:       secStore,
-			MasterKey:   masterKey,
-			Authorizer:  authorizer,
-			NonceLedger: nonceLedger,
-			Signer:      signBackend,
-			Logger:      luxlog.New("component", "kms-sdk"),
+			Store:           secStore,
+			Keyring:         keyring,
+			Authorizer:      authorizer,
+			NonceLedger:     nonceLedger,
+			Signer:          signBackend,
+			ThresholdReveal: thresholdReveal,
+			Logger:          luxlog.New("component", "kms-sdk"),
 		})
 
 		// HTTP /v1/sdk — the SDK-facing enveloped secret + threshold-sign
@@ -351,7 +468,7 @@ func main() {
 			log.Printf("kms: ZAP wire transport disabled (ZAP_PORT=0); /v1/sdk HTTP surface still active")
 		}
 	} else {
-		log.Printf("kms: secrets plane disabled (set MPC_REK_ENDPOINT or KMS_MASTER_KEY_B64 to enable /v1/sdk + ZAP)")
+		log.Printf("kms: secrets plane disabled (set MPC_REK_ENDPOINT or KMS_MASTER_KEY_B64 to enable /v1/kms/secrets, /v1/sdk + ZAP)")
 	}
 
 	// IAM OIDC SSO — /v1/sso/oidc/{login,callback}, /v1/sso/whoami, /v1/sso/logout.
@@ -414,14 +531,23 @@ func main() {
 // kms-operator and in-cluster clients read via the org-scoped path or ZAP) and
 // process env is never a secret-fetch source. Regression that keeps it gone:
 // TestSecretRoutes_NoEnvVarLeak.
-func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.SecretStore) {
+//
+// Values are sealed and opened by the SAME store.SealedStore the ZAP wire and
+// /v1/sdk use, so a record written on any transport reads back on every other.
+// A nil sealed store (no REK loaded) leaves the routes registered but answering
+// 503: a value this process cannot seal is never stored in the clear.
+func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
 	listHandler := func(w http.ResponseWriter, r *http.Request) {
 		q, err := parseListQuery(r.URL.Query())
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
 			return
 		}
-		refs, truncated, err := secStore.Find(q)
+		refs, next, err := sealed.FindPage(q)
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "cursor is not one this server issued: pass back next_cursor unchanged"})
+			return
+		}
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "list failed"})
 			return
@@ -435,14 +561,19 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 		// the caller can see which path and env were actually searched instead
 		// of reading "[]" as "this store is empty". `names` is the shape the
 		// existing HTTP clients read and stays. `truncated` warns when the answer
-		// was capped, so a caller narrows rather than trusting a partial list.
-		writeJSON(w, http.StatusOK, map[string]any{
+		// is one page of more, so a caller follows `next_cursor` (or narrows)
+		// rather than trusting a partial list; `total` counts this page.
+		body := map[string]any{
 			"names":     names,
 			"secrets":   refs,
 			"total":     len(refs),
-			"truncated": truncated,
-			"query":     map[string]string{"path": q.Path, "env": q.Env},
-		})
+			"truncated": next != "",
+			"query":     map[string]any{"path": q.Path, "env": q.Env, "labels": q.Labels},
+		}
+		if next != "" {
+			body["next_cursor"] = next
+		}
+		writeJSON(w, http.StatusOK, body)
 	}
 	getHandler := func(w http.ResponseWriter, r *http.Request) {
 		rest := r.PathValue("rest")
@@ -463,13 +594,55 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 		if env == "" {
 			env = "default"
 		}
-		sec, err := secStore.Get(path, name, env)
+		// ?version=N pins the read to one version; omitted reads the latest.
+		version, err := parseVersionParam(r.URL.Query().Get("version"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		// ?raw=true answers the value with its ${ref:...} references unexpanded.
+		raw, err := parseRawParam(r.URL.Query().Get("raw"))
 		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		pt, version, err := sealed.GetVersionContext(storeContext(r), path, name, env, version)
+		if errors.Is(err, store.ErrSecretExpired) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": err.Error(), "reason": "expired"})
+			return
+		}
+		if errors.Is(err, store.ErrSecretNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
 			return
 		}
+		if errors.Is(err, store.ErrVersionNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "version not found"})
+			return
+		}
+		if errors.Is(err, store.ErrThresholdUnavailable) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"message": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("kms: secret read failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "read failed"})
+			return
+		}
+		defer clear(pt)
+		if !raw {
+			expanded, ok := expandForRead(w, r, auth, sealed, secret.Ref{Path: path, Env: env, Name: name}, pt)
+			if !ok {
+				return
+			}
+			defer clear(expanded)
+			pt = expanded
+		}
+		value := string(pt)
+		// The version read rides in the ETag, not the body: shipped clients
+		// decode `secret` as a string map, and a number in it breaks them.
+		setVersionETag(w, version)
 		writeJSON(w, http.StatusOK, map[string]any{
-			"secret": map[string]any{"value": string(sec.Ciphertext)},
+			"secret": map[string]any{"value": value},
 		})
 	}
 	deleteHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -491,7 +664,17 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 		if env == "" {
 			env = "default"
 		}
-		if err := secStore.Delete(path, name, env); err != nil {
+		cond, err := parsePrecondition(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		opts := store.DeleteOptions{Deleter: claimsFrom(r).principal(), If: cond}
+		if err := sealed.Delete(path, name, env, opts); err != nil {
+			if errors.Is(err, store.ErrPreconditionFailed) {
+				writePreconditionFailed(w, err)
+				return
+			}
 			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
 			return
 		}
@@ -523,6 +706,9 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 	// Distinct from the {rest...} pattern below: this one has no trailing
 	// segment, so ServeMux routes the bare collection here and any path under it
 	// there. Pinned by TestSecretRoutes_ListAndGetDoNotShadow.
+	if sealed == nil {
+		listHandler, getHandler, deleteHandler = secretsDisabled, secretsDisabled, secretsDisabled
+	}
 	mux.HandleFunc("GET /v1/kms/orgs/{org}/secrets", auth.requireOrgJWT(listHandler))
 
 	// GET /v1/kms/orgs/{org}/secrets/{path...}/{name}
@@ -532,7 +718,7 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 	// POST /v1/kms/orgs/{org}/secrets — create a secret. The handler is a
 	// named func (putSecretHandler) so the env-required contract is unit
 	// testable without standing up the full server.
-	mux.HandleFunc("POST /v1/kms/orgs/{org}/secrets", auth.requireOrgJWT(putSecretHandler(secStore)))
+	mux.HandleFunc("POST /v1/kms/orgs/{org}/secrets", auth.requireOrgJWT(putSecretHandler(sealed)))
 
 	// DELETE /v1/kms/orgs/{org}/secrets/{rest...}/{name}
 	mux.HandleFunc("DELETE /v1/kms/orgs/{org}/secrets/{rest...}", auth.requireOrgJWT(deleteHandler))
@@ -548,8 +734,31 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 	// the release after those sweep; new callers use these.
 	mux.HandleFunc("GET /v1/kms/secrets", auth.requireJWT(listHandler))
 	mux.HandleFunc("GET /v1/kms/secrets/{rest...}", auth.requireJWT(getHandler))
-	mux.HandleFunc("POST /v1/kms/secrets", auth.requireJWT(putSecretHandler(secStore)))
+	mux.HandleFunc("POST /v1/kms/secrets", auth.requireJWT(putSecretHandler(sealed)))
 	mux.HandleFunc("DELETE /v1/kms/secrets/{rest...}", auth.requireJWT(deleteHandler))
+
+	registerVersionRoutes(mux, auth, sealed)
+	registerDeletedRoutes(mux, auth, sealed)
+	registerMetaRoutes(mux, auth, sealed)
+	registerPromoteRoutes(mux, auth, sealed)
+	registerDiffRoutes(mux, auth, sealed)
+	registerImportRoutes(mux, auth, sealed)
+	registerWatchRoutes(mux, auth, sealed)
+	registerSchemaRoutes(mux, auth, sealed)
+	registerLockRoutes(mux, auth, sealed)
+	registerREKRoutes(mux, auth, sealed)
+	registerTransitRoutes(mux, auth, sealed)
+	registerTokenizeRoutes(mux, auth, sealed)
+}
+
+// secretsDisabled answers every secret route when no REK is loaded. The store
+// cannot seal a value without one, and storing it raw is the split between the
+// transports that SealedStore exists to close — so the surface says why it is
+// unavailable instead of accepting a write no reader could open.
+func secretsDisabled(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+		"message": "secrets plane disabled: no REK loaded (set MPC_REK_ENDPOINT or KMS_MASTER_KEY_B64)",
+	})
 }
 
 // listParams maps every accepted list query parameter to the field it sets.
@@ -563,6 +772,11 @@ func registerSecretRoutes(mux *http.ServeMux, auth *orgJWTAuth, secStore *store.
 // their silently-empty answer into the right one, and the response echoes the
 // canonical name back so there is still only one name for the value.
 //
+// `label=key=value` narrows to secrets carrying that label; it is the one
+// parameter that repeats, every occurrence narrowing further. `cursor` and
+// `limit` page the answer: `limit` is a page size the server bounds, and
+// `cursor` is the `next_cursor` of the previous page.
+//
 // Nothing else is accepted. `secretPath`/`environment` belong to the Infisical
 // /api/v3 shape, which this server does not serve — a client sending those is
 // addressing a different API and is better told so than answered.
@@ -570,6 +784,9 @@ var listParams = map[string]string{
 	"path":   "path",
 	"prefix": "path",
 	"env":    "env",
+	"label":  "label",
+	"cursor": "cursor",
+	"limit":  "limit",
 }
 
 // parseListQuery turns a list request's query string into a secret.Query, and
@@ -591,7 +808,15 @@ func parseListQuery(v url.Values) (secret.Query, error) {
 	for key, vals := range v {
 		field, ok := listParams[key]
 		if !ok {
-			return q, fmt.Errorf("unknown query parameter %q: this endpoint takes path (also spelled prefix) and env; omit path to list every path, omit env to list every environment", key)
+			return q, fmt.Errorf("unknown query parameter %q: this endpoint takes path (also spelled prefix), env, label, cursor and limit; omit path to list every path, omit env to list every environment", key)
+		}
+		if field == "label" {
+			labels, err := parseLabelParams(vals)
+			if err != nil {
+				return q, err
+			}
+			q.Labels = labels
+			continue
 		}
 		val := ""
 		if len(vals) > 0 {
@@ -605,7 +830,14 @@ func parseListQuery(v url.Values) (secret.Query, error) {
 		}
 		set[field] = val
 	}
-	q.Path, q.Env = set["path"], set["env"]
+	q.Path, q.Env, q.Cursor = set["path"], set["env"], set["cursor"]
+	if raw := set["limit"]; raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return secret.Query{}, fmt.Errorf("limit must be a positive integer, got %q", raw)
+		}
+		q.Limit = n
+	}
 	// env is one key segment; a '/' in it can never match a stored record, so
 	// say so instead of returning an empty list that looks like an empty store.
 	if q.Env != "" && !store.ValidCoord(q.Env, "x") {
@@ -624,42 +856,122 @@ func parseListQuery(v url.Values) (secret.Query, error) {
 // value. So a write with no env fails loud (400). Reads (GET) keep a
 // backward-compatible default: a read cannot plant a value another reader
 // later trusts, and legacy readers that omit env must keep working.
-func putSecretHandler(secStore *store.SecretStore) http.HandlerFunc {
+//
+// The value is sealed under the REK by the shared SealedStore — the same path
+// OpSecretPut takes — so it is readable over ZAP the moment this answers 201.
+//
+// The body is {path, name, env, value, meta?, lock?, mode?}. In place of
+// value it may carry {generate: {type, length?, charset?}, reveal?}: the KMS
+// makes the value from crypto/rand and seals it, so it never passes through a
+// shell or a clipboard on the way in, and the 201 answers the coordinate, the
+// version and a keypair's public key — the value too only when reveal is set,
+// and never again after.
+func putSecretHandler(sealed *store.SealedStore) http.HandlerFunc {
+	if sealed == nil {
+		return secretsDisabled
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Path  string `json:"path"`
 			Name  string `json:"name"`
 			Env   string `json:"env"`
 			Value string `json:"value"`
+			// Meta, when present, replaces the secret's labels, description,
+			// owner and expiry with this write; omitted keeps them.
+			Meta *secret.Meta `json:"meta"`
+			// Lock, when present, creates the secret locked (write-once):
+			// the write fails if it exists; see secrets_lock.go.
+			Lock *lockRequest `json:"lock"`
+			// Generate, in place of value, has the KMS make the value by
+			// this policy (pkg/generate). The answer carries it only when
+			// Reveal is set — the one time it is ever shown.
+			Generate *generate.Policy `json:"generate"`
+			Reveal   bool             `json:"reveal"`
+			// Mode "tfhe" stores the value under the T-Chain threshold
+			// key, so every read is a t-of-n decrypt; omitted keeps the
+			// secret's mode (store.PutOptions.Mode).
+			Mode string `json:"mode"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "name and value required"})
 			return
 		}
+		if req.Generate != nil && req.Value != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "value and generate are exclusive: send one"})
+			return
+		}
 		if strings.TrimSpace(req.Env) == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]any{
 				"message": `env is required — set "env" in the request body; there is no default. A silent default would split this write from the project/env/path record readers resolve.`,
 			})
 			return
 		}
-		sec := &store.Secret{
-			Name:       req.Name,
-			Path:       req.Path,
-			Env:        req.Env,
-			Ciphertext: []byte(req.Value),
+		cond, err := parsePrecondition(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
 		}
-		if err := secStore.Put(sec); err != nil {
+		by := claimsFrom(r).principal()
+		opts := store.PutOptions{Writer: by, If: cond, Meta: req.Meta, Lock: req.Lock.lock(by), Mode: req.Mode}
+		var (
+			version int
+			gen     *generate.Value
+		)
+		if req.Generate != nil {
+			version, gen, err = sealed.GenerateContext(storeContext(r), req.Path, req.Name, req.Env, *req.Generate, opts)
+		} else {
+			version, err = sealed.PutContext(storeContext(r), req.Path, req.Name, req.Env, []byte(req.Value), opts)
+		}
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			writePreconditionFailed(w, err)
+			return
+		}
+		var ruleErr *schema.RuleError
+		if errors.As(err, &ruleErr) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"message": err.Error(), "rule": ruleErr.Rule, "schema_path": ruleErr.Path,
+			})
+			return
+		}
+		if err != nil {
 			// A coordinate the key cannot encode unambiguously is the caller's
 			// error, not the store's: report 400 so it is fixed at the source
 			// rather than retried forever against a 500.
 			code := http.StatusInternalServerError
-			if errors.Is(err, store.ErrInvalidCoord) {
+			if errors.Is(err, store.ErrInvalidCoord) || errors.Is(err, store.ErrInvalidMeta) || errors.Is(err, store.ErrInvalidLock) || errors.Is(err, generate.ErrInvalidPolicy) || errors.Is(err, store.ErrUnsupportedMode) {
 				code = http.StatusBadRequest
 			}
+			if errors.Is(err, store.ErrThresholdUnavailable) {
+				code = http.StatusServiceUnavailable
+			}
 			writeJSON(w, code, map[string]any{"message": err.Error()})
 			return
 		}
-		writeJSON(w, http.StatusCreated, map[string]any{"ok": true})
+		if req.Lock != nil {
+			log.Printf("kms: audit: lock path=%s name=%s env=%s two_person=%t by=%s reason=%q (write-once create)",
+				req.Path, req.Name, req.Env, req.Lock.TwoPerson, by, req.Lock.Reason)
+		}
+		setVersionETag(w, version)
+		if gen == nil {
+			writeJSON(w, http.StatusCreated, map[string]any{"ok": true})
+			return
+		}
+		defer clear(gen.Secret)
+		log.Printf("kms: generate path=%s name=%s env=%s type=%s version=%d reveal=%t by=%s",
+			req.Path, req.Name, req.Env, req.Generate.Type, version, req.Reveal, by)
+		resp := map[string]any{
+			"ok":      true,
+			"secret":  secret.Ref{Path: req.Path, Env: req.Env, Name: req.Name},
+			"version": version,
+		}
+		if gen.PublicKey != "" {
+			resp["public_key"] = gen.PublicKey
+		}
+		if req.Reveal {
+			w.Header().Set("Cache-Control", "no-store")
+			resp["value"] = string(gen.Secret)
+		}
+		writeJSON(w, http.StatusCreated, resp)
 	}
 }
 
@@ -972,64 +1284,58 @@ func startReplicator(db *badger.DB, nodeID string) *badger.Replicator {
 	return replicator
 }
 
-// loadREK returns the 32-byte Root Encryption Key used by the ZAP secrets
-// server to seal every per-secret DEK.
+// loadKeyring returns the keyring of Root Encryption Keys, by epoch, used
+// to seal every per-secret DEK: the current epoch seals, older ones are held
+// so their records stay readable until the background re-wrap moves them.
 //
 // Preference order:
-//  1. MPC_REK_ENDPOINT set → fetch via mpcrek.Bootstrap. FAIL-CLOSED on
+//  1. MPC_REK_ENDPOINT set → fetch MPC_REK_KEY_ID and every
+//     MPC_REK_PREVIOUS_KEY_IDS via mpcrek.BootstrapKeyring. FAIL-CLOSED on
 //     any error: log.Fatalf rather than silently falling back to the
 //     env-var path. This is the point of MPC-rooting the REK — if the
 //     pod can shrug off MPC unavailability and still come up with a
 //     key, we have re-introduced the static-secret weakness we set out
 //     to remove.
-//  2. KMS_MASTER_KEY_B64 set → decode and return. Logged WARN so the
-//     deployment knows it's still on the legacy path.
-//  3. Neither set → nil (ZAP secrets-server stays disabled).
+//  2. KMS_MASTER_KEY_B64 set → decode it as epoch KMS_REK_EPOCH, with
+//     KMS_MASTER_KEY_PREVIOUS. Logged WARN so the deployment knows it's
+//     still on the legacy path.
+//  3. Neither set, or KMS_MASTER_KEY_B64 malformed → nil (ZAP
+//     secrets-server stays disabled).
 //
-// The returned slice is the live REK for the process lifetime. The
-// caller MUST keep it alive until shutdown and arrange to zero it via
-// mpcrek.Zero on the way out (see the defer in main).
-func loadREK() []byte {
-	if endpoint := envOr("MPC_REK_ENDPOINT", ""); endpoint != "" {
-		keyID := envOr("MPC_REK_KEY_ID", "kms/rek/v1")
-		timeoutStr := envOr("MPC_REK_TIMEOUT", "10s")
-		timeout, perr := time.ParseDuration(timeoutStr)
-		if perr != nil {
-			log.Fatalf("kms: MPC_REK_TIMEOUT %q invalid: %v", timeoutStr, perr)
-		}
-		nodeID := envOr("KMS_NODE_ID", "kms-0") + "-rek-bootstrap"
-
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
-
-		log.Printf("kms: bootstrapping REK from MPC endpoint=%q keyID=%q", endpoint, keyID)
-		rek, err := mpcrek.Bootstrap(ctx, mpcrek.Config{
-			Endpoint: endpoint,
-			KeyID:    keyID,
-			NodeID:   nodeID,
-			Timeout:  timeout,
-		})
-		if err != nil {
-			// Fail-closed. The deployment asked for MPC-rooted REK and
-			// MPC said no — refuse to start with a static key, that's
-			// the split-brain we are escaping.
-			log.Fatalf("kms: MPC REK bootstrap failed: %v", err)
-		}
-		log.Printf("kms: REK bootstrapped from MPC (32 bytes)")
-		return rek
+// mpcrek.KeyringFromEnv reads the env; cmd/kms-recovery reads it the same
+// way.
+//
+// The REKs are live for the process lifetime. The caller MUST keep the
+// keyring alive until shutdown and zero it on the way out (see the defer
+// in main).
+func loadKeyring() *store.Keyring {
+	endpoint := os.Getenv(mpcrek.EnvEndpoint)
+	if endpoint != "" {
+		log.Printf("kms: bootstrapping REK keyring from MPC endpoint=%q", endpoint)
 	}
-
-	b64 := envOr("KMS_MASTER_KEY_B64", "")
-	if b64 == "" {
+	reks, current, err := mpcrek.KeyringFromEnv(envOr("KMS_NODE_ID", "kms-0") + "-rek-bootstrap")
+	if errors.Is(err, mpcrek.ErrNoREK) {
+		if os.Getenv(mpcrek.EnvMasterKey) != "" {
+			log.Printf("kms: %v; ZAP secrets-server disabled", err)
+		}
 		return nil
 	}
-	mk, err := base64.StdEncoding.DecodeString(b64)
-	if err != nil || len(mk) != 32 {
-		log.Printf("kms: KMS_MASTER_KEY_B64 invalid (need 32 bytes base64); ZAP secrets-server disabled")
-		return nil
+	if err != nil {
+		// Fail-closed. The deployment asked for MPC-rooted REK and
+		// MPC said no — refuse to start with a static key, that's
+		// the split-brain we are escaping.
+		log.Fatalf("kms: %v", err)
+	}
+	keyring, err := store.NewKeyring(current, reks)
+	if err != nil {
+		log.Fatalf("kms: REK keyring: %v", err)
+	}
+	if endpoint != "" {
+		log.Printf("kms: REK keyring bootstrapped from MPC (current epoch %d, epochs %v)", current, keyring.Epochs())
+	} else {
+		log.Printf("kms: WARNING: using legacy KMS_MASTER_KEY_B64 env-var REK; set MPC_REK_ENDPOINT to migrate to MPC-rooted REK")
 	}
-	log.Printf("kms: WARNING: using legacy KMS_MASTER_KEY_B64 env-var REK; set MPC_REK_ENDPOINT to migrate to MPC-rooted REK")
-	return mk
+	return keyring
 }
 
 func writeJSON(w http.ResponseWriter, code int, v any) {
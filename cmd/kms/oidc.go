@@ -72,6 +72,10 @@ const (
 	roleSuperadmin = "superadmin"
 )
 
+// roleKMSDetokenize may turn a token back into its value. No other role
+// implies it, kms-admin and superadmin included.
+const roleKMSDetokenize = "kms-detokenize"
+
 // oidcConfig captures the static OIDC settings for KMS. The clientID is
 // safe to bake into env (it's public per OAuth2 spec); clientSecret stays
 // in env-only and is supplied via KMS_OIDC_CLIENT_SECRET (KMSSecret CRD).
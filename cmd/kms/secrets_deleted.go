@@ -0,0 +1,128 @@
+// Recovery of deleted secrets on the org-less secret surface.
+//
+// DELETE /v1/kms/secrets/... tombstones a record rather than destroying it
+// (store.SecretStore.Delete); it stays recoverable until the retention window
+// (KMS_DELETE_RETENTION, default 30 days) runs out and the purger removes it.
+//
+//	GET  /v1/kms/deleted[?path=&env=]      list deleted, still recoverable secrets
+//	POST /v1/kms/undelete {path,name,env}  restore one
+//	POST /v1/kms/purge    {path,name,env}  destroy one now (kms-admin only)
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerDeletedRoutes wires the tombstone routes next to the version routes.
+func registerDeletedRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/deleted", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("POST /v1/kms/undelete", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("POST /v1/kms/purge", auth.requireJWT(secretsDisabled))
+		return
+	}
+	secrets := sealed.Secrets()
+	mux.HandleFunc("GET /v1/kms/deleted", auth.requireJWT(listDeletedHandler(secrets)))
+	mux.HandleFunc("POST /v1/kms/undelete", auth.requireJWT(undeleteHandler(secrets)))
+	mux.HandleFunc("POST /v1/kms/purge", auth.requireJWT(purgeHandler(secrets)))
+}
+
+// listDeletedHandler enumerates tombstones under the same path/env filter
+// vocabulary as the live list (parseListQuery), so a misspelled filter fails
+// loudly here too.
+func listDeletedHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseListQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		deleted, truncated, err := secrets.Deleted(q)
+		if err != nil {
+			log.Printf("kms: deleted list failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "list failed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"deleted":   deleted,
+			"total":     len(deleted),
+			"truncated": truncated,
+			"retention": secrets.Retention().String(),
+			"query":     map[string]string{"path": q.Path, "env": q.Env},
+		})
+	}
+}
+
+// coordRequest is the {path, name, env} body undelete and purge take.
+type coordRequest struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Env  string `json:"env"`
+}
+
+func decodeCoord(w http.ResponseWriter, r *http.Request) (coordRequest, bool) {
+	var req coordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Env == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "name and env required"})
+		return req, false
+	}
+	return req, true
+}
+
+// undeleteHandler restores a deleted secret as it was deleted. Any caller who
+// may delete may undelete: it puts back exactly what a delete took away.
+func undeleteHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeCoord(w, r)
+		if !ok {
+			return
+		}
+		version, err := secrets.Undelete(req.Path, req.Name, req.Env)
+		if errors.Is(err, store.ErrNotDeleted) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not deleted (or already purged)"})
+			return
+		}
+		if err != nil {
+			log.Printf("kms: undelete failed path=%s name=%s env=%s: %v", req.Path, req.Name, req.Env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "undelete failed"})
+			return
+		}
+		log.Printf("kms: undelete path=%s name=%s env=%s version=%d by=%s",
+			req.Path, req.Name, req.Env, version, claimsFrom(r).principal())
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "version": version})
+	}
+}
+
+// purgeHandler destroys a deleted secret and its history before the retention
+// window closes. It is the one irreversible operation on this surface, so it
+// takes the kms-admin role (superadmin is the break-glass override), not just
+// a token that authorizes this store.
+func purgeHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "purge") {
+			return
+		}
+		req, ok := decodeCoord(w, r)
+		if !ok {
+			return
+		}
+		if err := secrets.Purge(req.Path, req.Name, req.Env); err != nil {
+			if errors.Is(err, store.ErrNotDeleted) {
+				writeJSON(w, http.StatusNotFound, map[string]any{"message": "not deleted: delete the secret before purging it"})
+				return
+			}
+			log.Printf("kms: purge failed path=%s name=%s env=%s: %v", req.Path, req.Name, req.Env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "purge failed"})
+			return
+		}
+		log.Printf("kms: purge path=%s name=%s env=%s by=%s", req.Path, req.Name, req.Env, claims.principal())
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}
+}
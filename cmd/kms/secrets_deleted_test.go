@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSecretDelete_UndeleteAndAdminPurge: a DELETE through the real routes is
+// recoverable, the deleted listing names it, and only a kms-admin may purge.
+func TestSecretDelete_UndeleteAndAdminPurge(t *testing.T) {
+	f := newListFixture(t)
+	f.put("svc", "TOKEN", "prod")
+	if code, b := f.do("DELETE", "/v1/kms/secrets/svc/TOKEN?env=prod", ""); code != http.StatusOK {
+		t.Fatalf("delete = %d: %s", code, b)
+	}
+	if code, _ := f.do("GET", "/v1/kms/secrets/svc/TOKEN?env=prod", ""); code != http.StatusNotFound {
+		t.Fatalf("get after delete = %d, want 404", code)
+	}
+
+	code, raw := f.do("GET", "/v1/kms/deleted?env=prod", "")
+	var listed struct {
+		Deleted []struct {
+			Path      string `json:"path"`
+			Name      string `json:"name"`
+			DeletedBy string `json:"deleted_by"`
+		} `json:"deleted"`
+	}
+	if err := json.Unmarshal([]byte(raw), &listed); err != nil || code != http.StatusOK {
+		t.Fatalf("deleted list = %d %q: %v", code, raw, err)
+	}
+	if len(listed.Deleted) != 1 || listed.Deleted[0].Name != "TOKEN" || listed.Deleted[0].DeletedBy != "iam:ops" {
+		t.Fatalf("deleted list = %+v", listed.Deleted)
+	}
+
+	if code, b := f.do("POST", "/v1/kms/undelete", `{"path":"svc","name":"TOKEN","env":"prod"}`); code != http.StatusOK {
+		t.Fatalf("undelete = %d: %s", code, b)
+	}
+	if code, b := f.do("GET", "/v1/kms/secrets/svc/TOKEN?env=prod", ""); code != http.StatusOK {
+		t.Fatalf("get after undelete = %d: %s", code, b)
+	}
+
+	// Purge refuses a live secret, then destroys a deleted one.
+	body := `{"path":"svc","name":"TOKEN","env":"prod"}`
+	if code, _ := f.do("POST", "/v1/kms/purge", body); code != http.StatusNotFound {
+		t.Fatalf("purge of live secret = %d, want 404", code)
+	}
+	f.do("DELETE", "/v1/kms/secrets/svc/TOKEN?env=prod", "")
+	if code, b := f.do("POST", "/v1/kms/purge", body); code != http.StatusOK {
+		t.Fatalf("purge = %d: %s", code, b)
+	}
+	if code, _ := f.do("POST", "/v1/kms/undelete", body); code != http.StatusNotFound {
+		t.Fatalf("undelete after purge = %d, want 404", code)
+	}
+}
+
+// TestSecretPurge_RequiresAdmin: a token that may read and write this store
+// but lacks kms-admin cannot purge.
+func TestSecretPurge_RequiresAdmin(t *testing.T) {
+	auth, bearer, cleanup := newTestKeyAuth(t)
+	t.Cleanup(cleanup)
+	mux := http.NewServeMux()
+	registerSecretRoutes(mux, auth, newTestSealedStore(t))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	f := &listFixture{t: t, srv: srv, tok: bearer}
+
+	f.put("svc", "TOKEN", "prod")
+	f.do("DELETE", "/v1/kms/secrets/svc/TOKEN?env=prod", "")
+	if code, _ := f.do("POST", "/v1/kms/purge", `{"path":"svc","name":"TOKEN","env":"prod"}`); code != http.StatusForbidden {
+		t.Fatalf("non-admin purge = %d, want 403", code)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// TestSecretDiff_NamesOnly: the diff names what is missing and what differs
+// and carries no value.
+func TestSecretDiff_NamesOnly(t *testing.T) {
+	f := newListFixture(t)
+	f.putValue("svc", "A", "test", "shared-value")
+	f.putValue("svc", "A", "main", "shared-value")
+	f.putValue("svc", "B", "test", "test-only-value")
+	f.putValue("svc", "C", "test", "c-test")
+	f.putValue("svc", "C", "main", "c-main")
+
+	code, raw := f.do("GET", "/v1/kms/diff?path=svc&a=test&b=main", "")
+	if code != http.StatusOK {
+		t.Fatalf("diff = %d %s", code, raw)
+	}
+	var d secret.EnvDiff
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	if len(d.OnlyInA) != 1 || d.OnlyInA[0].Name != "B" || len(d.OnlyInB) != 0 || len(d.Differ) != 1 || d.Differ[0].Name != "C" || d.Same != 1 {
+		t.Fatalf("diff = %+v", d)
+	}
+	for _, v := range []string{"shared-value", "test-only-value", "c-test", "c-main"} {
+		if strings.Contains(raw, v) {
+			t.Fatalf("diff body carries value %q: %s", v, raw)
+		}
+	}
+
+	for _, q := range []string{"?path=svc&a=test", "?path=svc&a=test&b=main&env=prod"} {
+		if code, raw := f.do("GET", "/v1/kms/diff"+q, ""); code != http.StatusBadRequest {
+			t.Fatalf("GET /v1/kms/diff%s = %d %s, want 400", q, code, raw)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretGenerate_ValueMadeServerSide: a generate put answers the
+// coordinate and version but not the value unless asked to reveal it, and
+// what it stored reads back like any other secret.
+func TestSecretGenerate_ValueMadeServerSide(t *testing.T) {
+	f := newListFixture(t)
+	code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"svc","name":"DB_PASSWORD","env":"main","generate":{"type":"password","length":40,"charset":"digits"}}`)
+	var out struct {
+		Version int    `json:"version"`
+		Value   string `json:"value"`
+	}
+	_ = json.Unmarshal([]byte(raw), &out)
+	if code != http.StatusCreated || out.Version != 1 || out.Value != "" {
+		t.Fatalf("generate = %d %s", code, raw)
+	}
+	code, raw = f.do("GET", "/v1/kms/secrets/svc/DB_PASSWORD?env=main", "")
+	if v := secretValue(t, raw); code != http.StatusOK || len(v) != 40 || strings.Trim(v, "0123456789") != "" {
+		t.Fatalf("stored value = %d %q", code, v)
+	}
+
+	code, raw = f.do("POST", "/v1/kms/secrets", `{"path":"svc","name":"SIGNER","env":"main","generate":{"type":"secp256k1"},"reveal":true}`)
+	var revealed struct {
+		Value     string `json:"value"`
+		PublicKey string `json:"public_key"`
+	}
+	_ = json.Unmarshal([]byte(raw), &revealed)
+	if code != http.StatusCreated || len(revealed.Value) != 64 || len(revealed.PublicKey) != 66 {
+		t.Fatalf("revealed generate = %d %s", code, raw)
+	}
+	if _, raw = f.do("GET", "/v1/kms/secrets/svc/SIGNER?env=main", ""); secretValue(t, raw) != revealed.Value {
+		t.Fatal("revealed value is not the stored one")
+	}
+
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"svc","name":"X","env":"main","value":"v","generate":{"type":"uuid"}}`); code != http.StatusBadRequest {
+		t.Fatalf("value with generate = %d %s", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"svc","name":"X","env":"main","generate":{"type":"password","length":4}}`); code != http.StatusBadRequest || !strings.Contains(raw, "length") {
+		t.Fatalf("weak policy = %d %s", code, raw)
+	}
+}
@@ -0,0 +1,105 @@
+// Bulk import of a .env, JSON or YAML bundle into one path and env.
+//
+//	POST /v1/kms/import {path, env, format, document, conflict?}
+//
+// format is dotenv, json or yaml (pkg/bundle); document is the file's text.
+// Every name is validated before anything is written, and one bad entry
+// rejects the whole bundle (400, naming every bad entry). The rest is written
+// in one store transaction (store.SealedStore.Import). conflict decides what
+// happens to a name that already exists: fail (the default — 409 naming
+// them, nothing written), skip, or overwrite. Overwriting a locked secret
+// is refused like any write of it (409, nothing written).
+//
+// An import writes what a POST /v1/kms/secrets per entry would, so it takes
+// the same authority.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/luxfi/kms/pkg/bundle"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerImportRoutes wires the import route next to the version routes.
+func registerImportRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("POST /v1/kms/import", auth.requireJWT(secretsDisabled))
+		return
+	}
+	mux.HandleFunc("POST /v1/kms/import", auth.requireJWT(importHandler(sealed)))
+}
+
+type importRequest struct {
+	Path     string `json:"path"`
+	Env      string `json:"env"`
+	Format   string `json:"format"`
+	Document string `json:"document"`
+	Conflict string `json:"conflict"`
+}
+
+// importEntries turns a parsed bundle into store entries. The caller zeroes
+// the values once the import returns.
+func importEntries(parsed []bundle.Entry) []store.ImportEntry {
+	entries := make([]store.ImportEntry, len(parsed))
+	for i, e := range parsed {
+		entries[i] = store.ImportEntry{Name: e.Name, Value: []byte(e.Value)}
+	}
+	return entries
+}
+
+func importHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req importRequest
+		// The document rides inside the JSON body: allow it its own cap plus
+		// room for the envelope around it.
+		body := http.MaxBytesReader(w, r.Body, bundle.MaxBytes+64<<10)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid import request: " + err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Env) == "" || req.Format == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "env and format are required; there is no default env"})
+			return
+		}
+		parsed, err := bundle.Parse(req.Format, []byte(req.Document))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		entries := importEntries(parsed)
+		defer func() {
+			for _, e := range entries {
+				clear(e.Value)
+			}
+		}()
+		imported, err := sealed.Import(entries, store.ImportOptions{
+			Path: req.Path, Env: req.Env, Conflict: req.Conflict, Writer: claimsFrom(r).principal(),
+		})
+		if errors.Is(err, store.ErrInvalidImport) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			writePreconditionFailed(w, err)
+			return
+		}
+		if err != nil {
+			log.Printf("kms: import failed path=%s env=%s: %v", req.Path, req.Env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "import failed"})
+			return
+		}
+		counts := map[string]int{store.ImportCreated: 0, store.ImportUpdated: 0, store.ImportSkipped: 0}
+		for _, im := range imported {
+			counts[im.Action]++
+		}
+		log.Printf("kms: import path=%s env=%s format=%s created=%d updated=%d skipped=%d by=%s",
+			req.Path, req.Env, req.Format, counts[store.ImportCreated], counts[store.ImportUpdated], counts[store.ImportSkipped], claimsFrom(r).principal())
+		writeJSON(w, http.StatusOK, map[string]any{"imported": imported, "counts": counts})
+	}
+}
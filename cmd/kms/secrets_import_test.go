@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretImport_Dotenv: a .env imports in one request, and each value
+// reads back through the ordinary GET.
+func TestSecretImport_Dotenv(t *testing.T) {
+	f := newListFixture(t)
+	doc := "DB_HOST=db.internal\nexport TOKEN=\"s3cr3t\"\n"
+	body, _ := json.Marshal(map[string]string{"path": "svc", "env": "dev", "format": "dotenv", "document": doc})
+	code, raw := f.do("POST", "/v1/kms/import", string(body))
+	if code != http.StatusOK || !strings.Contains(raw, `"created":2`) {
+		t.Fatalf("import = %d %s", code, raw)
+	}
+	code, raw = f.do("GET", "/v1/kms/secrets/svc/TOKEN?env=dev", "")
+	if code != http.StatusOK || secretValue(t, raw) != "s3cr3t" {
+		t.Fatalf("GET TOKEN = %d %s", code, raw)
+	}
+
+	// Importing again conflicts by default, and nothing is written.
+	if code, raw = f.do("POST", "/v1/kms/import", string(body)); code != http.StatusConflict || !strings.Contains(raw, "TOKEN") {
+		t.Fatalf("re-import = %d %s, want 409 naming TOKEN", code, raw)
+	}
+}
+
+// TestSecretImport_RejectsBadBundles: an invalid name or a malformed document
+// is 400 and writes nothing.
+func TestSecretImport_RejectsBadBundles(t *testing.T) {
+	f := newListFixture(t)
+	for _, req := range []map[string]string{
+		{"path": "svc", "env": "dev", "format": "json", "document": `{"OK":"1","bad/name":"2"}`},
+		{"path": "svc", "env": "dev", "format": "yaml", "document": "A:\n  nested: x\n"},
+		{"path": "svc", "env": "dev", "format": "ini", "document": "A=1"},
+		{"path": "svc", "format": "dotenv", "document": "A=1"},
+	} {
+		body, _ := json.Marshal(req)
+		if code, raw := f.do("POST", "/v1/kms/import", string(body)); code != http.StatusBadRequest {
+			t.Fatalf("import %v = %d %s, want 400", req, code, raw)
+		}
+	}
+	if code, _ := f.do("GET", "/v1/kms/secrets/svc/OK?env=dev", ""); code != http.StatusNotFound {
+		t.Fatalf("rejected bundle wrote OK: GET = %d", code)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -63,7 +64,7 @@ func newListFixture(t *testing.T) *listFixture {
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	t.Cleanup(cleanup)
 	mux := http.NewServeMux()
-	registerSecretRoutes(mux, auth, newTestSecretStore(t))
+	registerSecretRoutes(mux, auth, newTestSealedStore(t))
 	srv := httptest.NewServer(mux)
 	t.Cleanup(srv.Close)
 	return &listFixture{t: t, srv: srv, tok: bearer}
@@ -344,3 +345,45 @@ func TestList_PrefixIsTheSameQuestionAsPath(t *testing.T) {
 		t.Fatalf("query echo = %q, want the canonical spelling %q", byPrefix.Query.Path, "deploy")
 	}
 }
+
+// TestSecretList_PagesWithCursor: ?limit pages the list, next_cursor resumes
+// it, the last page carries no cursor, and a forged cursor is 400.
+func TestSecretList_PagesWithCursor(t *testing.T) {
+	f := newListFixture(t)
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		f.put("svc", name, "prod")
+	}
+	var seen []string
+	query := "?path=svc&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor did not terminate")
+		}
+		code, raw := f.do("GET", "/v1/kms/secrets"+query, "")
+		var page struct {
+			Names      []string `json:"names"`
+			Truncated  bool     `json:"truncated"`
+			NextCursor string   `json:"next_cursor"`
+		}
+		if err := json.Unmarshal([]byte(raw), &page); err != nil || code != http.StatusOK {
+			t.Fatalf("page = %d %s", code, raw)
+		}
+		seen = append(seen, page.Names...)
+		if page.Truncated != (page.NextCursor != "") {
+			t.Fatalf("truncated=%v with next_cursor=%q", page.Truncated, page.NextCursor)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query = "?path=svc&limit=2&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+	if strings.Join(seen, ",") != "A,B,C,D,E" {
+		t.Fatalf("paged names = %v, want A..E once each", seen)
+	}
+	if code, b := f.do("GET", "/v1/kms/secrets?cursor=forged", ""); code != http.StatusBadRequest {
+		t.Fatalf("forged cursor = %d %s, want 400", code, b)
+	}
+	if code, b := f.do("GET", "/v1/kms/secrets?limit=0", ""); code != http.StatusBadRequest {
+		t.Fatalf("limit=0 = %d %s, want 400", code, b)
+	}
+}
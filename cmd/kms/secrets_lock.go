@@ -0,0 +1,153 @@
+// Locked (write-once) secrets on the org-less secret surface.
+//
+// A locked secret — a root deploy mnemonic, genesis material — refuses every
+// write, delete and metadata change, whichever transport asks: the check is
+// in the store's write path (store.ErrLocked, answered 409). A secret is
+// locked either as it is created, by a POST /v1/kms/secrets carrying
+// {"lock": {...}} (which is then create-only), or afterwards by an admin:
+//
+//	GET  /v1/kms/lock/{path...}/{name}?env=     the lock, if any
+//	POST /v1/kms/lock/{path...}/{name}?env=     lock it {reason?, two_person?}   (kms-admin)
+//	POST /v1/kms/unlock/{path...}/{name}?env=   unlock it                        (kms-admin)
+//
+// A two_person lock takes two unlocks by different admins within
+// store.UnlockApprovalWindow: the first answers 202 with the pending
+// request, the second 200. Every lock and unlock attempt is audit-logged.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerLockRoutes wires the lock routes next to the version routes.
+func registerLockRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/lock/{rest...}", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("POST /v1/kms/lock/{rest...}", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("POST /v1/kms/unlock/{rest...}", auth.requireJWT(secretsDisabled))
+		return
+	}
+	secrets := sealed.Secrets()
+	mux.HandleFunc("GET /v1/kms/lock/{rest...}", auth.requireJWT(getLockHandler(secrets)))
+	mux.HandleFunc("POST /v1/kms/lock/{rest...}", auth.requireJWT(lockHandler(secrets)))
+	mux.HandleFunc("POST /v1/kms/unlock/{rest...}", auth.requireJWT(unlockHandler(secrets)))
+}
+
+// lockRequest is what a caller may say about a lock. Who locked it and when
+// are the server's to record.
+type lockRequest struct {
+	Reason    string `json:"reason"`
+	TwoPerson bool   `json:"two_person"`
+}
+
+// lock turns the request into the lock by records.
+func (l *lockRequest) lock(by string) *secret.Lock {
+	if l == nil {
+		return nil
+	}
+	return &secret.Lock{LockedBy: by, Reason: l.Reason, TwoPerson: l.TwoPerson}
+}
+
+func getLockHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, name, env, ok := metaCoord(w, r)
+		if !ok {
+			return
+		}
+		l, err := secrets.Locked(path, name, env)
+		if err != nil {
+			log.Printf("kms: lock read failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "read failed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"secret": secret.Ref{Path: path, Env: env, Name: name},
+			"locked": l != nil,
+			"lock":   l,
+		})
+	}
+}
+
+// lockHandler locks a live secret. Locking takes away every writer's ability
+// to rotate it, so it is an admin act, as unlocking is.
+func lockHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "lock") {
+			return
+		}
+		path, name, env, ok := metaCoord(w, r)
+		if !ok {
+			return
+		}
+		var req lockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {reason?, two_person?}"})
+			return
+		}
+		l := req.lock(claims.principal())
+		err := secrets.Lock(path, name, env, *l)
+		switch {
+		case errors.Is(err, store.ErrSecretNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
+		case errors.Is(err, store.ErrInvalidLock):
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+		case errors.Is(err, store.ErrLocked):
+			writePreconditionFailed(w, err)
+		case err != nil:
+			log.Printf("kms: lock failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "lock failed"})
+		default:
+			log.Printf("kms: audit: lock path=%s name=%s env=%s two_person=%t by=%s reason=%q",
+				path, name, env, l.TwoPerson, claims.principal(), l.Reason)
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		}
+	}
+}
+
+// unlockHandler removes a lock, or records or approves the request half of a
+// two-person unlock. Each attempt is audited, refused ones included.
+func unlockHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		path, name, env, ok := metaCoord(w, r)
+		if !ok {
+			return
+		}
+		if denyNonAdmin(w, claims, "unlock") {
+			log.Printf("kms: audit: unlock path=%s name=%s env=%s by=%s ok=false reason=role", path, name, env, claims.principal())
+			return
+		}
+		by := claims.principal()
+		left, err := secrets.Unlock(path, name, env, by, time.Now())
+		switch {
+		case errors.Is(err, store.ErrNotLocked):
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": err.Error()})
+		case errors.Is(err, store.ErrSameApprover):
+			log.Printf("kms: audit: unlock path=%s name=%s env=%s by=%s ok=false reason=same-approver", path, name, env, by)
+			writeJSON(w, http.StatusForbidden, map[string]any{"message": err.Error()})
+		case err != nil:
+			log.Printf("kms: unlock failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "unlock failed"})
+		case left != nil:
+			log.Printf("kms: audit: unlock path=%s name=%s env=%s by=%s ok=pending", path, name, env, by)
+			writeJSON(w, http.StatusAccepted, map[string]any{
+				"unlocked": false,
+				"lock":     left,
+				"message":  "two-person lock: a second admin must unlock it too",
+			})
+		default:
+			log.Printf("kms: audit: unlock path=%s name=%s env=%s by=%s ok=true", path, name, env, by)
+			writeJSON(w, http.StatusOK, map[string]any{"unlocked": true})
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretLock_WriteOnceThenAdminUnlock: a secret created with a lock
+// refuses every overwrite and delete with 409 until an admin unlocks it; a
+// two-person lock is not unlocked by the admin who asked.
+func TestSecretLock_WriteOnceThenAdminUnlock(t *testing.T) {
+	f := newListFixture(t)
+	create := `{"path":"providers/lux","name":"deploy-mnemonic","env":"main","value":"seed","lock":{"reason":"root deploy key"}}`
+	if code, raw := f.do("POST", "/v1/kms/secrets", create); code != http.StatusCreated {
+		t.Fatalf("write-once create = %d %s", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/secrets", create); code != http.StatusConflict {
+		t.Fatalf("second write-once create = %d %s, want 409", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"providers/lux","name":"deploy-mnemonic","env":"main","value":"other"}`); code != http.StatusConflict || !strings.Contains(raw, "locked") {
+		t.Fatalf("overwrite = %d %s, want 409 locked", code, raw)
+	}
+	if code, raw := f.do("DELETE", "/v1/kms/secrets/providers/lux/deploy-mnemonic?env=main", ""); code != http.StatusConflict {
+		t.Fatalf("delete = %d %s, want 409", code, raw)
+	}
+	if code, raw := f.do("GET", "/v1/kms/lock/providers/lux/deploy-mnemonic?env=main", ""); code != http.StatusOK || !strings.Contains(raw, `"locked":true`) || !strings.Contains(raw, "root deploy key") {
+		t.Fatalf("lock state = %d %s", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/unlock/providers/lux/deploy-mnemonic?env=main", ""); code != http.StatusOK {
+		t.Fatalf("unlock = %d %s", code, raw)
+	}
+	f.putValue("providers/lux", "deploy-mnemonic", "main", "rotated")
+
+	f.putValue("chain", "genesis", "main", "g")
+	if code, raw := f.do("POST", "/v1/kms/lock/chain/genesis?env=main", `{"two_person":true}`); code != http.StatusOK {
+		t.Fatalf("lock = %d %s", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/unlock/chain/genesis?env=main", ""); code != http.StatusAccepted {
+		t.Fatalf("unlock request = %d %s, want 202", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/unlock/chain/genesis?env=main", ""); code != http.StatusForbidden {
+		t.Fatalf("self-approval = %d %s, want 403", code, raw)
+	}
+}
@@ -0,0 +1,138 @@
+// Secret metadata on the org-less secret surface.
+//
+// Labels, a description, an owning team and an optional expiry belong to a
+// secret's coordinate, not to one version (store.SecretStore.SetMeta). A POST
+// of a value may carry {"meta": {...}} to set them with the write; these
+// routes read and change them without writing a new version. The list routes
+// return each secret's meta and filter on ?label=key=value.
+//
+//	GET /v1/kms/meta/{path...}/{name}?env=   read a secret's metadata
+//	PUT /v1/kms/meta/{path...}/{name}?env=   replace it ({} clears it)
+//
+// A secret past its expires_at answers 404 with reason "expired" on every
+// read; a PUT here with a later expires_at renews it.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/luxfi/kms/pkg/secret"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerMetaRoutes wires the metadata routes next to the version routes.
+func registerMetaRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/meta/{rest...}", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("PUT /v1/kms/meta/{rest...}", auth.requireJWT(secretsDisabled))
+		return
+	}
+	mux.HandleFunc("GET /v1/kms/meta/{rest...}", auth.requireJWT(getMetaHandler(sealed)))
+	mux.HandleFunc("PUT /v1/kms/meta/{rest...}", auth.requireJWT(setMetaHandler(sealed)))
+}
+
+// metaCoord reads the coordinate of a metadata route. env is required, as on
+// the version routes.
+func metaCoord(w http.ResponseWriter, r *http.Request) (path, name, env string, ok bool) {
+	path, name = splitRest(r.PathValue("rest"))
+	env = r.URL.Query().Get("env")
+	if name == "" || env == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "name and env required"})
+		return "", "", "", false
+	}
+	return path, name, env, true
+}
+
+func getMetaHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, name, env, ok := metaCoord(w, r)
+		if !ok {
+			return
+		}
+		meta, err := sealed.Meta(path, name, env)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("kms: meta read failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "read failed"})
+			return
+		}
+		if meta == nil {
+			meta = &secret.Meta{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"secret": secret.Ref{Path: path, Env: env, Name: name},
+			"meta":   meta,
+		})
+	}
+}
+
+// setMetaHandler replaces a secret's metadata. It honours If-Match like the
+// value routes, so two editors of the same labels do not overwrite each other
+// unknowingly.
+func setMetaHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, name, env, ok := metaCoord(w, r)
+		if !ok {
+			return
+		}
+		var meta secret.Meta
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {labels, description, owner, expires_at}"})
+			return
+		}
+		cond, err := parsePrecondition(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		err = sealed.SetMeta(path, name, env, &meta, cond)
+		switch {
+		case errors.Is(err, store.ErrSecretNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
+		case errors.Is(err, store.ErrInvalidMeta):
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+		case errors.Is(err, store.ErrPreconditionFailed):
+			writePreconditionFailed(w, err)
+		case err != nil:
+			log.Printf("kms: meta write failed path=%s name=%s env=%s: %v", path, name, env, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "write failed"})
+		default:
+			log.Printf("kms: meta path=%s name=%s env=%s by=%s", path, name, env, claimsFrom(r).principal())
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		}
+	}
+}
+
+// parseLabelParams reads repeated ?label=key=value into a label selector. A
+// label without "=value" is refused: selecting on presence alone is not
+// supported, and silently matching everything would be worse.
+func parseLabelParams(vals []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, raw := range vals {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(raw, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("label must be key=value, got %q", raw)
+		}
+		if prev, dup := labels[k]; dup && prev != v {
+			return nil, fmt.Errorf("conflicting values for label %s", k)
+		}
+		labels[k] = v
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
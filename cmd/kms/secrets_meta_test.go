@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretMeta_WriteListFilterAndExpire drives metadata through the real
+// routes: set with a write, returned and filtered by list, edited in place,
+// and an expiry in the past turning reads into 404 with reason "expired".
+func TestSecretMeta_WriteListFilterAndExpire(t *testing.T) {
+	f := newListFixture(t)
+	body := `{"path":"svc","name":"STRIPE","env":"prod","value":"sk","meta":{"labels":{"team":"payments"},"owner":"payments"}}`
+	if code, b := f.do("POST", "/v1/kms/secrets", body); code != http.StatusCreated {
+		t.Fatalf("put with meta = %d: %s", code, b)
+	}
+	f.put("svc", "OTHER", "prod")
+
+	code, raw := f.do("GET", "/v1/kms/secrets?label=team=payments", "")
+	var listed struct {
+		Secrets []struct {
+			Name string `json:"name"`
+			Meta struct {
+				Owner string `json:"owner"`
+			} `json:"meta"`
+		} `json:"secrets"`
+	}
+	_ = json.Unmarshal([]byte(raw), &listed)
+	if code != http.StatusOK || len(listed.Secrets) != 1 || listed.Secrets[0].Name != "STRIPE" || listed.Secrets[0].Meta.Owner != "payments" {
+		t.Fatalf("list by label = %d %s, want STRIPE with owner payments", code, raw)
+	}
+	if code, b := f.do("GET", "/v1/kms/secrets?label=team", ""); code != http.StatusBadRequest {
+		t.Fatalf("label without value = %d %s, want 400", code, b)
+	}
+
+	if code, b := f.do("PUT", "/v1/kms/meta/svc/STRIPE?env=prod", `{"description":"rotated quarterly","expires_at":"2001-01-01T00:00:00Z"}`); code != http.StatusOK {
+		t.Fatalf("set meta = %d: %s", code, b)
+	}
+	code, raw = f.do("GET", "/v1/kms/secrets/svc/STRIPE?env=prod", "")
+	if code != http.StatusNotFound || !strings.Contains(raw, `"reason":"expired"`) {
+		t.Fatalf("read expired = %d %s, want 404 reason expired", code, raw)
+	}
+	if code, b := f.do("PUT", "/v1/kms/meta/svc/STRIPE?env=prod", `{"expires_at":"2999-01-01T00:00:00Z"}`); code != http.StatusOK {
+		t.Fatalf("renew = %d: %s", code, b)
+	}
+	if code, b := f.do("GET", "/v1/kms/secrets/svc/STRIPE?env=prod", ""); code != http.StatusOK {
+		t.Fatalf("read renewed = %d %s, want 200", code, b)
+	}
+	code, raw = f.do("GET", "/v1/kms/meta/svc/STRIPE?env=prod", "")
+	if code != http.StatusOK || !strings.Contains(raw, "2999-01-01") {
+		t.Fatalf("get meta = %d %s", code, raw)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretPrecondition_IfMatch drives the conditional headers through the
+// real routes: the ETag a write returns is what the next write must present,
+// a stale one is 409, and If-None-Match: * is create-only.
+func TestSecretPrecondition_IfMatch(t *testing.T) {
+	f := newListFixture(t)
+	send := func(method, path, body string, header ...string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, f.srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+f.tok)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("ETag") + " " + string(b)
+	}
+	body := func(v string) string {
+		return `{"path":"svc","name":"TOKEN","env":"prod","value":"` + v + `"}`
+	}
+
+	if code, b := send("POST", "/v1/kms/secrets", body("one"), "If-None-Match", "*"); code != http.StatusCreated || !strings.HasPrefix(b, `"1"`) {
+		t.Fatalf("create-only = %d %s, want 201 with ETag \"1\"", code, b)
+	}
+	if code, b := send("POST", "/v1/kms/secrets", body("dup"), "If-None-Match", "*"); code != http.StatusConflict {
+		t.Fatalf("create-only over existing = %d %s, want 409", code, b)
+	}
+	if code, b := send("POST", "/v1/kms/secrets", body("two"), "If-Match", `"1"`); code != http.StatusCreated || !strings.HasPrefix(b, `"2"`) {
+		t.Fatalf("If-Match current = %d %s, want 201 with ETag \"2\"", code, b)
+	}
+	if code, b := send("POST", "/v1/kms/secrets", body("lost"), "If-Match", `"1"`); code != http.StatusConflict || !strings.Contains(b, "version 2") {
+		t.Fatalf("If-Match stale = %d %s, want 409 naming version 2", code, b)
+	}
+	if code, b := send("POST", "/v1/kms/secrets", body("x"), "If-Match", "latest"); code != http.StatusBadRequest {
+		t.Fatalf("malformed If-Match = %d %s, want 400", code, b)
+	}
+	if code, b := send("DELETE", "/v1/kms/secrets/svc/TOKEN?env=prod", "", "If-Match", `W/"1"`); code != http.StatusConflict {
+		t.Fatalf("stale delete = %d %s, want 409", code, b)
+	}
+	if code, b := send("DELETE", "/v1/kms/secrets/svc/TOKEN?env=prod", "", "If-Match", `"2"`); code != http.StatusOK {
+		t.Fatalf("delete at current = %d %s, want 200", code, b)
+	}
+}
@@ -0,0 +1,84 @@
+// Promotion of a secret subtree from one env to another.
+//
+// Env is part of every storage key, so promoting a tested config from test to
+// main used to be a list followed by one re-put per secret. One request now
+// does it, in one store transaction (store.SealedStore.Promote):
+//
+//	POST /v1/kms/promote {path, from, to, dry_run?}   (kms-admin only)
+//
+// The answer lists every source secret with its action — create, update or
+// unchanged — and the versions involved; never a value. dry_run answers the
+// same list and writes nothing, which is the diff to review before promoting.
+// A locked secret in the target env refuses the whole promote (409).
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerPromoteRoutes wires the promote route next to the version routes.
+func registerPromoteRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("POST /v1/kms/promote", auth.requireJWT(secretsDisabled))
+		return
+	}
+	mux.HandleFunc("POST /v1/kms/promote", auth.requireJWT(promoteHandler(sealed)))
+}
+
+type promoteRequest struct {
+	Path   string `json:"path"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// promoteHandler promotes one subtree. It rewrites a whole env at once, so it
+// takes the kms-admin role, as purge does, not just a token for this store.
+func promoteHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "promote") {
+			return
+		}
+		var req promoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "from and to env required"})
+			return
+		}
+		changes, err := sealed.PromoteContext(storeContext(r), store.PromoteOptions{
+			Path: req.Path, From: req.From, To: req.To, DryRun: req.DryRun, Writer: claims.principal(),
+		})
+		if errors.Is(err, store.ErrInvalidCoord) || errors.Is(err, store.ErrPromoteSameEnv) || errors.Is(err, store.ErrBatchTooLarge) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			writePreconditionFailed(w, err)
+			return
+		}
+		if err != nil {
+			log.Printf("kms: promote failed path=%s from=%s to=%s: %v", req.Path, req.From, req.To, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "promote failed"})
+			return
+		}
+		counts := map[string]int{store.PromoteCreate: 0, store.PromoteUpdate: 0, store.PromoteUnchanged: 0}
+		for _, c := range changes {
+			counts[c.Action]++
+		}
+		if !req.DryRun {
+			log.Printf("kms: promote path=%s from=%s to=%s created=%d updated=%d unchanged=%d by=%s",
+				req.Path, req.From, req.To, counts[store.PromoteCreate], counts[store.PromoteUpdate], counts[store.PromoteUnchanged], claims.principal())
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"changes": changes,
+			"counts":  counts,
+			"dry_run": req.DryRun,
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type promoteBody struct {
+	Changes []struct {
+		Path    string `json:"path"`
+		Name    string `json:"name"`
+		Action  string `json:"action"`
+		Version int    `json:"version"`
+	} `json:"changes"`
+	Counts map[string]int `json:"counts"`
+	DryRun bool           `json:"dry_run"`
+}
+
+// TestSecretPromote_DryRunThenApply: a dry run answers the diff and writes
+// nothing; the same request without it writes the destination env, readable
+// straight back.
+func TestSecretPromote_DryRunThenApply(t *testing.T) {
+	f := newListFixture(t)
+	f.put("svc", "A", "test")
+	f.put("svc", "B", "test")
+	f.putValue("svc", "B", "main", "stale")
+
+	code, raw := f.do("POST", "/v1/kms/promote", `{"path":"svc","from":"test","to":"main","dry_run":true}`)
+	var plan promoteBody
+	_ = json.Unmarshal([]byte(raw), &plan)
+	if code != http.StatusOK || !plan.DryRun || plan.Counts["create"] != 1 || plan.Counts["update"] != 1 {
+		t.Fatalf("dry run = %d %s", code, raw)
+	}
+	if code, _ := f.do("GET", "/v1/kms/secrets/svc/A?env=main", ""); code != http.StatusNotFound {
+		t.Fatalf("dry run wrote svc/A@main: GET = %d", code)
+	}
+
+	code, raw = f.do("POST", "/v1/kms/promote", `{"path":"svc","from":"test","to":"main"}`)
+	var done promoteBody
+	_ = json.Unmarshal([]byte(raw), &done)
+	if code != http.StatusOK || done.DryRun || len(done.Changes) != 2 {
+		t.Fatalf("promote = %d %s", code, raw)
+	}
+	code, raw = f.do("GET", "/v1/kms/secrets/svc/B?env=main", "")
+	if code != http.StatusOK || secretValue(t, raw) != "v-B" {
+		t.Fatalf("svc/B@main after promote = %d %s", code, raw)
+	}
+
+	if code, raw := f.do("POST", "/v1/kms/promote", `{"path":"svc","from":"main","to":"main"}`); code != http.StatusBadRequest {
+		t.Fatalf("same env = %d %s, want 400", code, raw)
+	}
+}
+
+// TestSecretPromote_RequiresAdmin: promote rewrites a whole env; a token that
+// may only read and write single secrets cannot run it, not even as a dry run.
+func TestSecretPromote_RequiresAdmin(t *testing.T) {
+	auth, bearer, cleanup := newTestKeyAuth(t)
+	t.Cleanup(cleanup)
+	mux := http.NewServeMux()
+	registerSecretRoutes(mux, auth, newTestSealedStore(t))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	f := &listFixture{t: t, srv: srv, tok: bearer}
+
+	f.put("svc", "A", "test")
+	if code, _ := f.do("POST", "/v1/kms/promote", `{"path":"svc","from":"test","to":"main","dry_run":true}`); code != http.StatusForbidden {
+		t.Fatalf("non-admin promote = %d, want 403", code)
+	}
+}
@@ -0,0 +1,81 @@
+// Secret references on the HTTP read path.
+//
+// A value may embed another secret as ${ref:path/name@env}; GET
+// /v1/kms/secrets/{path...}/{name} (and the org route) answers it expanded
+// (store.SealedStore.Expand). ?raw=true answers the value as stored, which is
+// what an editor reads before writing it back.
+//
+// Every reference is authorized on its own, as a direct GET of it by the same
+// token would be. A refused reference is 403 naming it; one that is missing,
+// expired, cyclic or nested past store.MaxRefDepth is 422 — the stored value
+// is what is wrong, not the request for it.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/luxfi/kms/pkg/secret"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// refAuthorizer returns the gate each reference a read of r expands must
+// pass: the one requireJWT put r itself through. The HTTP surface decides
+// per store, not per path (see authorizesHome), so today every reference a
+// caller reaches is one it could GET; asking per reference keeps that true
+// when the gate learns paths.
+func (a *orgJWTAuth) refAuthorizer(r *http.Request) store.RefAuthorizer {
+	claims := claimsFrom(r)
+	return func(ref secret.Ref) error {
+		if claims == nil {
+			return errors.New("no verified token")
+		}
+		if len(a.homeOrgs) > 0 && !a.authorizesHome(claims) {
+			return errors.New("token does not authorize this KMS")
+		}
+		return nil
+	}
+}
+
+// parseRawParam reads ?raw=; only an unambiguous boolean is accepted.
+func parseRawParam(raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("raw must be true or false, got %q", raw)
+	}
+	return b, nil
+}
+
+// storeContext is r's context naming its caller to the store, so a threshold
+// reveal a read runs is audited as theirs, and a threshold round run for r
+// stops when it is cancelled.
+func storeContext(r *http.Request) context.Context {
+	return store.WithPrincipal(r.Context(), claimsFrom(r).principal())
+}
+
+// expandForRead expands value, read at ref, for the caller of r. On failure
+// it answers the request and returns ok=false; the caller zeroes value.
+func expandForRead(w http.ResponseWriter, r *http.Request, auth *orgJWTAuth, sealed *store.SealedStore, ref secret.Ref, value []byte) (out []byte, ok bool) {
+	out, err := sealed.ExpandContext(storeContext(r), ref, value, auth.refAuthorizer(r))
+	switch {
+	case err == nil:
+		return out, true
+	case errors.Is(err, store.ErrRefForbidden):
+		log.Printf("kms: reference refused path=%s name=%s env=%s: %v", ref.Path, ref.Name, ref.Env, err)
+		writeJSON(w, http.StatusForbidden, map[string]any{"message": err.Error(), "reason": "reference"})
+	case errors.Is(err, store.ErrRef):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": err.Error(), "reason": "reference"})
+	default:
+		log.Printf("kms: reference expansion failed path=%s name=%s env=%s: %v", ref.Path, ref.Name, ref.Env, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "read failed"})
+	}
+	return nil, false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func (f *listFixture) putValue(path, name, env, value string) {
+	f.t.Helper()
+	body := fmt.Sprintf(`{"path":%q,"name":%q,"env":%q,"value":%q}`, path, name, env, value)
+	if code, b := f.do("POST", "/v1/kms/secrets", body); code != http.StatusCreated {
+		f.t.Fatalf("PUT %s/%s env=%s = %d, want 201: %s", path, name, env, code, b)
+	}
+}
+
+func secretValue(t *testing.T, body string) string {
+	t.Helper()
+	var out struct {
+		Secret map[string]string `json:"secret"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	return out.Secret["value"]
+}
+
+// TestSecret_Get_ExpandsReferences: a GET answers the value with its
+// references resolved, ?raw=true answers it as stored, and a value whose
+// reference cannot resolve is 422 rather than half-expanded.
+func TestSecret_Get_ExpandsReferences(t *testing.T) {
+	f := newListFixture(t)
+	f.putValue("db", "host", "prod", "db.internal")
+	f.putValue("app", "dsn", "prod", "postgres://${ref:db/host}:5432")
+	f.putValue("app", "loop", "prod", "${ref:app/loop}")
+	f.putValue("app", "dangling", "prod", "${ref:db/gone}")
+
+	code, body := f.do("GET", "/v1/kms/secrets/app/dsn?env=prod", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET dsn = %d: %s", code, body)
+	}
+	if got := secretValue(t, body); got != "postgres://db.internal:5432" {
+		t.Fatalf("dsn = %q", got)
+	}
+
+	code, body = f.do("GET", "/v1/kms/secrets/app/dsn?env=prod&raw=true", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET dsn raw = %d: %s", code, body)
+	}
+	if got := secretValue(t, body); got != "postgres://${ref:db/host}:5432" {
+		t.Fatalf("raw dsn = %q", got)
+	}
+
+	for _, name := range []string{"loop", "dangling"} {
+		code, body = f.do("GET", "/v1/kms/secrets/app/"+name+"?env=prod", "")
+		if code != http.StatusUnprocessableEntity || !strings.Contains(body, "reference") {
+			t.Fatalf("GET %s = %d %s, want 422 naming the reference", name, code, body)
+		}
+	}
+
+	if code, body = f.do("GET", "/v1/kms/secrets/app/dsn?env=prod&raw=maybe", ""); code != http.StatusBadRequest {
+		t.Fatalf("raw=maybe = %d %s, want 400", code, body)
+	}
+}
@@ -0,0 +1,45 @@
+// The REK keyring and its background re-wrap, on the org-less secret surface.
+//
+// Every DEK is wrapped under one epoch of the Root Encryption Key
+// (store.Keyring). The current epoch seals new writes; older epochs are held
+// only while the background re-wrap (store.SealedStore.RunRewrap) moves their
+// records onto it.
+//
+//	GET /v1/kms/rek   {current_epoch, epochs, rewrap}   (kms-admin)
+//
+// rewrap.remaining counts the records still under each epoch. An epoch other
+// than the current one may be dropped from the deployment once a finished run
+// (rewrap.finished_at set, rewrap.running false) no longer lists it. The
+// response names epochs, never keys.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerREKRoutes wires the keyring status route next to the lock routes.
+func registerREKRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/rek", auth.requireJWT(secretsDisabled))
+		return
+	}
+	mux.HandleFunc("GET /v1/kms/rek", auth.requireJWT(rekStatusHandler(sealed)))
+}
+
+func rekStatusHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "the REK keyring") {
+			return
+		}
+		k := sealed.Keyring()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"current_epoch": k.Current(),
+			"epochs":        k.Epochs(),
+			"rewrap":        sealed.RewrapStatus(),
+		})
+	}
+}
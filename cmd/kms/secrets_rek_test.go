@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestREKStatus_ReportsEpochsNotKeys: the keyring status names the epochs
+// and the re-wrap progress and never a key.
+func TestREKStatus_ReportsEpochsNotKeys(t *testing.T) {
+	f := newListFixture(t)
+	f.putValue("svc", "K", "dev", "v")
+	code, raw := f.do("GET", "/v1/kms/rek", "")
+	if code != http.StatusOK || !strings.Contains(raw, `"current_epoch":1`) || !strings.Contains(raw, `"epochs":[1]`) || !strings.Contains(raw, `"rewrap"`) {
+		t.Fatalf("rek status = %d %s", code, raw)
+	}
+}
@@ -0,0 +1,116 @@
+// Value schemas on the org-less secret surface.
+//
+// A path may carry a schema (pkg/schema): rules every value written under it
+// must pass — a PEM certificate, a URL, a BIP-39 mnemonic, JSON matching a
+// JSON Schema, a length range. The schema of a path and of each of its
+// ancestors applies; a write that fails a rule answers 400 naming it, with
+// "rule" and "schema_path" beside the message.
+//
+//	GET    /v1/kms/schemas/{path...}   the schema set at path, and every schema that applies there
+//	PUT    /v1/kms/schemas/{path...}   set it ({"rules": [...]}; kms-admin only)
+//	DELETE /v1/kms/schemas/{path...}   remove it (kms-admin only)
+//
+// The root's schema is at /v1/kms/schemas/. A schema holds no value, so any
+// token may read one; changing what a path accepts takes kms-admin.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/luxfi/kms/pkg/schema"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// registerSchemaRoutes wires the schema routes next to the version routes.
+func registerSchemaRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/schemas/{path...}", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("PUT /v1/kms/schemas/{path...}", auth.requireJWT(secretsDisabled))
+		mux.HandleFunc("DELETE /v1/kms/schemas/{path...}", auth.requireJWT(secretsDisabled))
+		return
+	}
+	secrets := sealed.Secrets()
+	mux.HandleFunc("GET /v1/kms/schemas/{path...}", auth.requireJWT(getSchemaHandler(secrets)))
+	mux.HandleFunc("PUT /v1/kms/schemas/{path...}", auth.requireJWT(setSchemaHandler(secrets)))
+	mux.HandleFunc("DELETE /v1/kms/schemas/{path...}", auth.requireJWT(deleteSchemaHandler(secrets)))
+}
+
+func getSchemaHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.PathValue("path")
+		own, err := secrets.Schema(path)
+		if errors.Is(err, store.ErrSchemaNotFound) {
+			err = nil
+		}
+		var applies []store.PathSchema
+		if err == nil {
+			applies, err = secrets.Schemas(path)
+		}
+		if err != nil {
+			log.Printf("kms: schema read failed path=%s: %v", path, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "schema read failed"})
+			return
+		}
+		if applies == nil {
+			applies = []store.PathSchema{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"path": path, "schema": own, "applies": applies})
+	}
+}
+
+// setSchemaHandler replaces a path's schema. What a path accepts is policy
+// for everyone who writes there, so it takes the kms-admin role.
+func setSchemaHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "setting a schema") {
+			return
+		}
+		path := r.PathValue("path")
+		doc, err := io.ReadAll(http.MaxBytesReader(w, r.Body, schema.MaxBytes+1))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "schema larger than the limit"})
+			return
+		}
+		sc, err := schema.Parse(doc)
+		if err == nil {
+			err = secrets.SetSchema(path, sc)
+		}
+		if errors.Is(err, schema.ErrInvalidSchema) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("kms: schema set failed path=%s: %v", path, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "schema set failed"})
+			return
+		}
+		log.Printf("kms: schema set path=%s rules=%d by=%s", path, len(sc.Rules), claims.principal())
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "path": path, "schema": sc})
+	}
+}
+
+func deleteSchemaHandler(secrets *store.SecretStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "deleting a schema") {
+			return
+		}
+		path := r.PathValue("path")
+		if err := secrets.DeleteSchema(path); err != nil {
+			if errors.Is(err, store.ErrSchemaNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]any{"message": err.Error()})
+				return
+			}
+			log.Printf("kms: schema delete failed path=%s: %v", path, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "schema delete failed"})
+			return
+		}
+		log.Printf("kms: schema delete path=%s by=%s", path, claims.principal())
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSecretSchema_PutAnswers400NamingTheRule: once a path has a schema, a
+// write it refuses answers 400 with the rule and the schema's path, and the
+// schema reads back with what applies beneath it.
+func TestSecretSchema_PutAnswers400NamingTheRule(t *testing.T) {
+	f := newListFixture(t)
+	schemaDoc := `{"rules":[{"id":"wallet-seed","name":"*_MNEMONIC","type":"bip39-mnemonic"},{"type":"length","max_length":256}]}`
+	if code, raw := f.do("PUT", "/v1/kms/schemas/wallets", schemaDoc); code != http.StatusOK {
+		t.Fatalf("set schema = %d %s", code, raw)
+	}
+	if code, raw := f.do("PUT", "/v1/kms/schemas/wallets", `{"rules":[{"type":"uuid"}]}`); code != http.StatusBadRequest || !strings.Contains(raw, "uuid") {
+		t.Fatalf("bad schema = %d %s", code, raw)
+	}
+
+	code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"wallets/hot","name":"SIGNER_MNEMONIC","env":"main","value":"twelve words that are not a mnemonic"}`)
+	var refused struct {
+		Message    string `json:"message"`
+		Rule       string `json:"rule"`
+		SchemaPath string `json:"schema_path"`
+	}
+	_ = json.Unmarshal([]byte(raw), &refused)
+	if code != http.StatusBadRequest || refused.Rule != `"wallet-seed"` || refused.SchemaPath != "/wallets" || strings.Contains(raw, "not a mnemonic") {
+		t.Fatalf("refused put = %d %s", code, raw)
+	}
+	f.putValue("wallets/hot", "SIGNER_MNEMONIC", "main", strings.Repeat("abandon ", 11)+"about")
+	f.putValue("elsewhere", "SIGNER_MNEMONIC", "main", "not checked outside wallets")
+
+	code, raw = f.do("GET", "/v1/kms/schemas/wallets/hot", "")
+	var got struct {
+		Schema  json.RawMessage `json:"schema"`
+		Applies []struct {
+			Path string `json:"path"`
+		} `json:"applies"`
+	}
+	_ = json.Unmarshal([]byte(raw), &got)
+	if code != http.StatusOK || string(got.Schema) != "null" || len(got.Applies) != 1 || got.Applies[0].Path != "wallets" {
+		t.Fatalf("get schema = %d %s", code, raw)
+	}
+
+	if code, raw := f.do("DELETE", "/v1/kms/schemas/wallets", ""); code != http.StatusOK {
+		t.Fatalf("delete schema = %d %s", code, raw)
+	}
+	if code, _ := f.do("DELETE", "/v1/kms/schemas/wallets", ""); code != http.StatusNotFound {
+		t.Fatalf("second delete = %d, want 404", code)
+	}
+}
@@ -16,7 +16,7 @@ import (
 func TestSecretRoutes_TenantSurface(t *testing.T) {
 	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
 	defer cleanup()
-	secStore := newTestSecretStore(t)
+	secStore := newTestSealedStore(t)
 	mux := http.NewServeMux()
 	registerSecretRoutes(mux, auth, secStore)
 	srv := httptest.NewServer(mux)
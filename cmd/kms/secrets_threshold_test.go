@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestSecret_Put_Mode: a threshold-reveal write on a KMS with no T-Chain key
+// is unavailable, never stored as a standard secret; a mode the store does
+// not write is the caller's mistake.
+func TestSecret_Put_Mode(t *testing.T) {
+	f := newListFixture(t)
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"vault","name":"ROOT","env":"main","value":"v","mode":"tfhe"}`); code != http.StatusServiceUnavailable {
+		t.Fatalf("tfhe put = %d %s, want 503", code, raw)
+	}
+	if code, _ := f.do("GET", "/v1/kms/secrets/vault/ROOT?env=main", ""); code != http.StatusNotFound {
+		t.Fatalf("refused tfhe put left a secret: GET = %d", code)
+	}
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"vault","name":"ROOT","env":"main","value":"v","mode":"ckks"}`); code != http.StatusBadRequest {
+		t.Fatalf("ckks put = %d %s, want 400", code, raw)
+	}
+	if code, raw := f.do("POST", "/v1/kms/secrets", `{"path":"vault","name":"ROOT","env":"main","value":"v","mode":"aead+mlkem"}`); code != http.StatusCreated {
+		t.Fatalf("standard put = %d %s", code, raw)
+	}
+}
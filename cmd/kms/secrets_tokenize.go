@@ -0,0 +1,192 @@
+// The tokenization engine on the org-less secret surface: format-preserving
+// tokens (FF1 / FF3-1) under named keys that never leave the KMS
+// (pkg/tokenize, stored sealed by store.SealedStore like any secret).
+//
+//	GET  /v1/kms/tokenize/keys          key names
+//	POST /v1/kms/tokenize/keys          create {name, mode?, alphabet?}  (kms-admin)
+//	GET  /v1/kms/tokenize/keys/{name}   the key's mode and alphabet, never its material
+//	POST /v1/kms/tokenize/{name}        {value, tweak?} → {token}
+//	POST /v1/kms/detokenize/{name}      {token, tweak?} → {value}      (kms-detokenize)
+//
+// A token keeps the value's length and every character outside the key's
+// alphabet. tweak is base64. Detokenizing needs the kms-detokenize role,
+// which no other role implies: the services that make tokens and the few
+// that may see the values behind them are separate. Every detokenize is
+// audit-logged with the key, never the token or value.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/luxfi/kms/pkg/store"
+	"github.com/luxfi/kms/pkg/tokenize"
+)
+
+// registerTokenizeRoutes wires the tokenization routes next to transit.
+func registerTokenizeRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	routes := []string{
+		"GET /v1/kms/tokenize/keys",
+		"POST /v1/kms/tokenize/keys",
+		"GET /v1/kms/tokenize/keys/{name}",
+		"POST /v1/kms/tokenize/{name}",
+		"POST /v1/kms/detokenize/{name}",
+	}
+	if sealed == nil {
+		for _, route := range routes {
+			mux.HandleFunc(route, auth.requireJWT(secretsDisabled))
+		}
+		return
+	}
+	handlers := []http.HandlerFunc{
+		listTokenizeKeysHandler(sealed),
+		createTokenizeKeyHandler(sealed),
+		getTokenizeKeyHandler(sealed),
+		tokenizeHandler(sealed),
+		detokenizeHandler(sealed),
+	}
+	for i, route := range routes {
+		mux.HandleFunc(route, auth.requireJWT(handlers[i]))
+	}
+}
+
+// tokenizeRequest is the body of a tokenize or detokenize.
+type tokenizeRequest struct {
+	Value string `json:"value"`
+	Token string `json:"token"`
+	Tweak string `json:"tweak"`
+}
+
+// readTokenizeRequest decodes the body and the tweak in it.
+func readTokenizeRequest(w http.ResponseWriter, r *http.Request) (req tokenizeRequest, tweak []byte, ok bool) {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid tokenize request: " + err.Error()})
+		return req, nil, false
+	}
+	tweak, err := base64.StdEncoding.DecodeString(req.Tweak)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "tweak must be base64"})
+		return req, nil, false
+	}
+	return req, tweak, true
+}
+
+// writeTokenizeError answers a tokenization failure: a caller's mistake by
+// what it was, anything else as a logged 500.
+func writeTokenizeError(w http.ResponseWriter, op, name string, err error) {
+	switch {
+	case errors.Is(err, store.ErrTokenizeKeyNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "tokenization key not found"})
+	case errors.Is(err, store.ErrTokenizeKeyExists):
+		writeJSON(w, http.StatusConflict, map[string]any{"message": err.Error()})
+	case errors.Is(err, tokenize.ErrInvalidKey), errors.Is(err, tokenize.ErrInvalidValue),
+		errors.Is(err, tokenize.ErrInvalidTweak):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+	default:
+		log.Printf("kms: %s failed key=%s: %v", op, name, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"message": op + " failed"})
+	}
+}
+
+func listTokenizeKeysHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := sealed.TokenizeKeys()
+		if err != nil {
+			writeTokenizeError(w, "tokenize list", "", err)
+			return
+		}
+		if names == nil {
+			names = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"keys": names})
+	}
+}
+
+func createTokenizeKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "creating a tokenization key") {
+			return
+		}
+		var req struct {
+			Name     string `json:"name"`
+			Mode     string `json:"mode"`
+			Alphabet string `json:"alphabet"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {name, mode?, alphabet?}"})
+			return
+		}
+		info, err := sealed.CreateTokenizeKey(req.Name, tokenize.KeyOptions{Mode: req.Mode, Alphabet: req.Alphabet})
+		if err != nil {
+			writeTokenizeError(w, "tokenize create", req.Name, err)
+			return
+		}
+		log.Printf("kms: audit: tokenize create key=%s mode=%s by=%s", info.Name, info.Mode, claims.principal())
+		writeJSON(w, http.StatusCreated, info)
+	}
+}
+
+func getTokenizeKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		info, err := sealed.TokenizeKeyInfo(name)
+		if err != nil {
+			writeTokenizeError(w, "tokenize read", name, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	}
+}
+
+func tokenizeHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		req, tweak, ok := readTokenizeRequest(w, r)
+		if !ok {
+			return
+		}
+		var token string
+		err := sealed.UseTokenizeKey(name, func(k *tokenize.Key) error {
+			var err error
+			token, err = k.Tokenize(req.Value, tweak)
+			return err
+		})
+		if err != nil {
+			writeTokenizeError(w, "tokenize", name, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"token": token})
+	}
+}
+
+func detokenizeHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if claims == nil || !hasRole(claims.Roles, roleKMSDetokenize) {
+			writeJSON(w, http.StatusForbidden, map[string]any{"message": "detokenizing requires the kms-detokenize role"})
+			return
+		}
+		name := r.PathValue("name")
+		req, tweak, ok := readTokenizeRequest(w, r)
+		if !ok {
+			return
+		}
+		var value string
+		err := sealed.UseTokenizeKey(name, func(k *tokenize.Key) error {
+			var err error
+			value, err = k.Detokenize(req.Token, tweak)
+			return err
+		})
+		if err != nil {
+			writeTokenizeError(w, "detokenize", name, err)
+			return
+		}
+		log.Printf("kms: audit: detokenize key=%s by=%s", name, claims.principal())
+		writeJSON(w, http.StatusOK, map[string]any{"value": value})
+	}
+}
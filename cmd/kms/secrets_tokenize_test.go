@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTokenize_DetokenizeNeedsItsOwnRole: a kms-admin creates a key and
+// tokenizes under it, but only a kms-detokenize caller gets the value back.
+func TestTokenize_DetokenizeNeedsItsOwnRole(t *testing.T) {
+	sealed := newTestSealedStore(t)
+	fixture := func(roles ...string) *listFixture {
+		auth, bearer, cleanup := newTestKeyAuth(t, roles...)
+		t.Cleanup(cleanup)
+		mux := http.NewServeMux()
+		registerSecretRoutes(mux, auth, sealed)
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		return &listFixture{t: t, srv: srv, tok: bearer}
+	}
+	admin, detok := fixture(roleKMSAdmin, roleSuperadmin), fixture(roleKMSDetokenize)
+
+	if code, raw := admin.do("POST", "/v1/kms/tokenize/keys", `{"name":"phone","alphabet":"numeric"}`); code != http.StatusCreated || !strings.Contains(raw, `"mode":"ff1"`) {
+		t.Fatalf("create = %d %s", code, raw)
+	}
+	if code, raw := detok.do("POST", "/v1/kms/tokenize/keys", `{"name":"other"}`); code != http.StatusForbidden {
+		t.Fatalf("create without kms-admin = %d %s", code, raw)
+	}
+	const phone = "+1 (555) 010-1234"
+	code, raw := admin.do("POST", "/v1/kms/tokenize/phone", fmt.Sprintf(`{"value":%q}`, phone))
+	var tok struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal([]byte(raw), &tok)
+	if code != http.StatusOK || len(tok.Token) != len(phone) || tok.Token[0] != '+' || tok.Token[2:4] != " (" {
+		t.Fatalf("tokenize = %d %s", code, raw)
+	}
+
+	if code, _ := admin.do("POST", "/v1/kms/detokenize/phone", fmt.Sprintf(`{"token":%q}`, tok.Token)); code != http.StatusForbidden {
+		t.Fatalf("detokenize as kms-admin and superadmin = %d, want 403", code)
+	}
+	code, raw = detok.do("POST", "/v1/kms/detokenize/phone", fmt.Sprintf(`{"token":%q}`, tok.Token))
+	if code != http.StatusOK || !strings.Contains(raw, fmt.Sprintf(`"value":%q`, phone)) {
+		t.Fatalf("detokenize = %d %s", code, raw)
+	}
+	if code, _ := admin.do("POST", "/v1/kms/tokenize/phone", `{"value":"12"}`); code != http.StatusBadRequest {
+		t.Fatalf("too short a value = %d, want 400", code)
+	}
+	if code, _ := admin.do("POST", "/v1/kms/tokenize/missing", `{"value":"4111111111111111"}`); code != http.StatusNotFound {
+		t.Fatalf("unknown key = %d, want 404", code)
+	}
+}
@@ -0,0 +1,381 @@
+// The transit engine on the org-less secret surface: encryption as a service
+// under named, versioned keys that never leave the KMS (pkg/transit, stored
+// sealed by store.SealedStore like any secret).
+//
+//	GET  /v1/kms/transit/keys                     key names
+//	POST /v1/kms/transit/keys                     create {name, type?, deterministic?} (kms-admin)
+//	GET  /v1/kms/transit/keys/{name}              the key's versions, never its material
+//	POST /v1/kms/transit/keys/{name}/rotate       add a version; it encrypts from now  (kms-admin)
+//	POST /v1/kms/transit/keys/{name}/import-token {ttl_seconds?} → one-time import public keys (kms-admin)
+//	POST /v1/kms/transit/keys/{name}/import       {token, algorithm?, wrapped_key, type?, deterministic?}  (kms-admin)
+//	POST /v1/kms/transit/encrypt/{name}           {plaintext, associated_data?, context?}  → {ciphertext, key_version}
+//	POST /v1/kms/transit/decrypt/{name}           {ciphertext, associated_data?, context?} → {plaintext}
+//	POST /v1/kms/transit/rewrap/{name}            {ciphertext, associated_data?, context?} → {ciphertext, key_version}
+//	POST /v1/kms/transit/datakey/plaintext/{name} {bits?} → {ciphertext, key_version, plaintext}
+//	POST /v1/kms/transit/datakey/wrapped/{name}   {bits?} → {ciphertext, key_version}
+//
+// plaintext, associated_data and context are base64. A ciphertext is
+// kms:v<N>:..., naming the key version that made it; rewrap moves it to the
+// latest without the plaintext leaving the server. Every decrypt and data key
+// is audit-logged with the key and version, never the data.
+//
+// A key created with deterministic: true encrypts equal plaintexts equal, for
+// lookups by an encrypted field. Every call on it names a context — the table
+// and column, say — and equal values under two contexts do not match. It
+// makes no data keys.
+//
+// A key of type hmac-sha256 or hmac-sha3-256 is created and rotated here but
+// used only on the signed envelope (OpTransitHMAC, OpTransitVerify,
+// OpTransitDerive), where the consensus authorizer gates every use; it does
+// not encrypt.
+//
+// Import is bring-your-own-key (pkg/byok): import-token answers a one-time
+// ML-KEM-768 and RSA-3072 public key for the named key, the partner wraps
+// its material to one (algorithm mlkem768, the default, or rsa-oaep-3072),
+// and import unwraps it in the server as version 1 of a new key. A token
+// expires after ttl_seconds (an hour by default) and is spent by its first
+// import, whether the wrap opens or not.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luxfi/kms/pkg/byok"
+	"github.com/luxfi/kms/pkg/store"
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+// maxTransitBody bounds a transit request: MaxPlaintext as base64, and room
+// for the JSON around it.
+const maxTransitBody = transit.MaxPlaintext/3*4 + 64<<10
+
+// registerTransitRoutes wires the transit routes next to the REK route.
+func registerTransitRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	routes := []string{
+		"GET /v1/kms/transit/keys",
+		"POST /v1/kms/transit/keys",
+		"GET /v1/kms/transit/keys/{name}",
+		"POST /v1/kms/transit/keys/{name}/rotate",
+		"POST /v1/kms/transit/keys/{name}/import-token",
+		"POST /v1/kms/transit/keys/{name}/import",
+		"POST /v1/kms/transit/encrypt/{name}",
+		"POST /v1/kms/transit/decrypt/{name}",
+		"POST /v1/kms/transit/rewrap/{name}",
+		"POST /v1/kms/transit/datakey/{kind}/{name}",
+	}
+	if sealed == nil {
+		for _, route := range routes {
+			mux.HandleFunc(route, auth.requireJWT(secretsDisabled))
+		}
+		return
+	}
+	handlers := []http.HandlerFunc{
+		listTransitKeysHandler(sealed),
+		createTransitKeyHandler(sealed),
+		getTransitKeyHandler(sealed),
+		rotateTransitKeyHandler(sealed),
+		transitImportTokenHandler(sealed),
+		transitImportHandler(sealed),
+		transitEncryptHandler(sealed),
+		transitDecryptHandler(sealed),
+		transitRewrapHandler(sealed),
+		transitDataKeyHandler(sealed),
+	}
+	for i, route := range routes {
+		mux.HandleFunc(route, auth.requireJWT(handlers[i]))
+	}
+}
+
+// transitRequest is the body of every transit data operation; each reads the
+// fields it needs.
+type transitRequest struct {
+	Plaintext      string `json:"plaintext"`
+	Ciphertext     string `json:"ciphertext"`
+	AssociatedData string `json:"associated_data"`
+	Context        string `json:"context"`
+	Bits           int    `json:"bits"`
+}
+
+// readTransitRequest decodes the body (an empty one is all defaults) and the
+// associated data and context in it.
+func readTransitRequest(w http.ResponseWriter, r *http.Request) (req transitRequest, aad, keyContext []byte, ok bool) {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTransitBody)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid transit request: " + err.Error()})
+		return req, nil, nil, false
+	}
+	if aad, err = base64.StdEncoding.DecodeString(req.AssociatedData); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "associated_data must be base64"})
+		return req, nil, nil, false
+	}
+	if keyContext, err = base64.StdEncoding.DecodeString(req.Context); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "context must be base64"})
+		return req, nil, nil, false
+	}
+	return req, aad, keyContext, true
+}
+
+// writeTransitError answers a transit failure: a caller's mistake by what it
+// was, anything else as a logged 500.
+func writeTransitError(w http.ResponseWriter, op, name string, err error) {
+	switch {
+	case errors.Is(err, store.ErrTransitKeyNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "transit key not found"})
+	case errors.Is(err, store.ErrTransitKeyExists):
+		writeJSON(w, http.StatusConflict, map[string]any{"message": err.Error()})
+	case errors.Is(err, transit.ErrInvalidKey), errors.Is(err, transit.ErrInvalidCiphertext),
+		errors.Is(err, transit.ErrDecrypt), errors.Is(err, transit.ErrInvalidContext),
+		errors.Is(err, transit.ErrTooLarge), errors.Is(err, store.ErrImportToken),
+		errors.Is(err, byok.ErrInvalidWrap), errors.Is(err, byok.ErrInvalidTTL):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+	default:
+		log.Printf("kms: transit %s failed key=%s: %v", op, name, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"message": "transit " + op + " failed"})
+	}
+}
+
+func listTransitKeysHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := sealed.TransitKeys()
+		if err != nil {
+			writeTransitError(w, "list", "", err)
+			return
+		}
+		if names == nil {
+			names = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"keys": names})
+	}
+}
+
+func createTransitKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "creating a transit key") {
+			return
+		}
+		var req struct {
+			Name          string `json:"name"`
+			Type          string `json:"type"`
+			Deterministic bool   `json:"deterministic"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {name, type?, deterministic?}"})
+			return
+		}
+		info, err := sealed.CreateTransitKey(req.Name, transit.KeyOptions{Type: req.Type, Deterministic: req.Deterministic})
+		if err != nil {
+			writeTransitError(w, "create", req.Name, err)
+			return
+		}
+		log.Printf("kms: audit: transit create key=%s type=%s deterministic=%t by=%s", info.Name, info.Type, info.Deterministic, claims.principal())
+		writeJSON(w, http.StatusCreated, info)
+	}
+}
+
+func getTransitKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		info, err := sealed.TransitKeyInfo(name)
+		if err != nil {
+			writeTransitError(w, "read", name, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	}
+}
+
+func rotateTransitKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "rotating a transit key") {
+			return
+		}
+		name := r.PathValue("name")
+		info, err := sealed.RotateTransitKey(name)
+		if err != nil {
+			writeTransitError(w, "rotate", name, err)
+			return
+		}
+		log.Printf("kms: audit: transit rotate key=%s version=%d by=%s", name, info.LatestVersion, claims.principal())
+		writeJSON(w, http.StatusOK, info)
+	}
+}
+
+func transitImportTokenHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "importing a transit key") {
+			return
+		}
+		var req struct {
+			TTLSeconds int `json:"ttl_seconds"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {ttl_seconds?}"})
+			return
+		}
+		name := r.PathValue("name")
+		pub, err := sealed.CreateImportToken(name, time.Duration(req.TTLSeconds)*time.Second)
+		if err != nil {
+			writeTransitError(w, "import-token", name, err)
+			return
+		}
+		log.Printf("kms: audit: transit import-token key=%s expires=%s by=%s", name, pub.ExpiresAt.Format(time.RFC3339), claims.principal())
+		writeJSON(w, http.StatusCreated, pub)
+	}
+}
+
+func transitImportHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFrom(r)
+		if denyNonAdmin(w, claims, "importing a transit key") {
+			return
+		}
+		var req struct {
+			Token         string `json:"token"`
+			Algorithm     string `json:"algorithm"`
+			WrappedKey    string `json:"wrapped_key"`
+			Type          string `json:"type"`
+			Deterministic bool   `json:"deterministic"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be {token, algorithm?, wrapped_key, type?, deterministic?}"})
+			return
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(req.WrappedKey)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "wrapped_key must be base64"})
+			return
+		}
+		name := r.PathValue("name")
+		info, err := sealed.ImportTransitKey(req.Token, req.Algorithm, wrapped, name, transit.KeyOptions{Type: req.Type, Deterministic: req.Deterministic})
+		if err != nil {
+			log.Printf("kms: audit: transit import refused key=%s by=%s: %v", name, claims.principal(), err)
+			writeTransitError(w, "import", name, err)
+			return
+		}
+		log.Printf("kms: audit: transit import key=%s type=%s by=%s", name, info.Type, claims.principal())
+		writeJSON(w, http.StatusCreated, info)
+	}
+}
+
+func transitEncryptHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		req, aad, keyContext, ok := readTransitRequest(w, r)
+		if !ok {
+			return
+		}
+		pt, err := base64.StdEncoding.DecodeString(req.Plaintext)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "plaintext must be base64"})
+			return
+		}
+		defer clear(pt)
+		var ct string
+		var version int
+		err = sealed.UseTransitKey(name, func(k *transit.Key) error {
+			ct, err = k.Encrypt(pt, aad, keyContext)
+			version = k.Latest()
+			return err
+		})
+		if err != nil {
+			writeTransitError(w, "encrypt", name, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ciphertext": ct, "key_version": version})
+	}
+}
+
+func transitDecryptHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		req, aad, keyContext, ok := readTransitRequest(w, r)
+		if !ok {
+			return
+		}
+		var pt []byte
+		err := sealed.UseTransitKey(name, func(k *transit.Key) error {
+			var err error
+			pt, err = k.Decrypt(req.Ciphertext, aad, keyContext)
+			return err
+		})
+		if err != nil {
+			writeTransitError(w, "decrypt", name, err)
+			return
+		}
+		defer clear(pt)
+		version, _ := transit.CiphertextVersion(req.Ciphertext)
+		log.Printf("kms: audit: transit decrypt key=%s version=%d by=%s", name, version, claimsFrom(r).principal())
+		writeJSON(w, http.StatusOK, map[string]any{"plaintext": base64.StdEncoding.EncodeToString(pt)})
+	}
+}
+
+func transitRewrapHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		req, aad, keyContext, ok := readTransitRequest(w, r)
+		if !ok {
+			return
+		}
+		var ct string
+		var version int
+		err := sealed.UseTransitKey(name, func(k *transit.Key) error {
+			var err error
+			ct, err = k.Rewrap(req.Ciphertext, aad, keyContext)
+			version = k.Latest()
+			return err
+		})
+		if err != nil {
+			writeTransitError(w, "rewrap", name, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ciphertext": ct, "key_version": version})
+	}
+}
+
+// transitDataKeyHandler makes a data key. kind "plaintext" answers the key
+// itself beside its ciphertext, for a caller about to encrypt with it;
+// "wrapped" answers only the ciphertext, for a caller provisioning one to
+// decrypt later.
+func transitDataKeyHandler(sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, kind := r.PathValue("name"), r.PathValue("kind")
+		if kind != "plaintext" && kind != "wrapped" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "data key kind is plaintext or wrapped"})
+			return
+		}
+		req, _, _, ok := readTransitRequest(w, r)
+		if !ok {
+			return
+		}
+		var pt []byte
+		var ct string
+		var version int
+		err := sealed.UseTransitKey(name, func(k *transit.Key) error {
+			var err error
+			pt, ct, err = k.DataKey(req.Bits)
+			version = k.Latest()
+			return err
+		})
+		if err != nil {
+			writeTransitError(w, "datakey", name, err)
+			return
+		}
+		defer clear(pt)
+		log.Printf("kms: audit: transit datakey key=%s version=%d kind=%s by=%s", name, version, kind, claimsFrom(r).principal())
+		resp := map[string]any{"ciphertext": ct, "key_version": version}
+		if kind == "plaintext" {
+			resp["plaintext"] = base64.StdEncoding.EncodeToString(pt)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
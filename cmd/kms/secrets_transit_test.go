@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/byok"
+)
+
+// TestTransit_EncryptRotateDecryptRewrap drives a key through its life over
+// HTTP: the ciphertext names its version, survives a rotation, and rewrap
+// moves it forward.
+func TestTransit_EncryptRotateDecryptRewrap(t *testing.T) {
+	f := newListFixture(t)
+	if code, raw := f.do("POST", "/v1/kms/transit/keys", `{"name":"orders"}`); code != http.StatusCreated || !strings.Contains(raw, `"latest_version":1`) {
+		t.Fatalf("create = %d %s", code, raw)
+	}
+	if code, _ := f.do("POST", "/v1/kms/transit/keys", `{"name":"orders"}`); code != http.StatusConflict {
+		t.Fatalf("second create = %d, want 409", code)
+	}
+	if code, raw := f.do("GET", "/v1/kms/transit/keys/orders", ""); code != http.StatusOK || strings.Contains(raw, "material") {
+		t.Fatalf("info = %d %s", code, raw)
+	}
+
+	pt := base64.StdEncoding.EncodeToString([]byte("4111 1111 1111 1111"))
+	aad := base64.StdEncoding.EncodeToString([]byte("row-7"))
+	ct := transitCall(t, f, "encrypt/orders", fmt.Sprintf(`{"plaintext":%q,"associated_data":%q}`, pt, aad))["ciphertext"]
+	if !strings.HasPrefix(ct, "kms:v1:") {
+		t.Fatalf("ciphertext %q", ct)
+	}
+	if code, raw := f.do("POST", "/v1/kms/transit/keys/orders/rotate", ""); code != http.StatusOK || !strings.Contains(raw, `"latest_version":2`) {
+		t.Fatalf("rotate = %d %s", code, raw)
+	}
+	got := transitCall(t, f, "decrypt/orders", fmt.Sprintf(`{"ciphertext":%q,"associated_data":%q}`, ct, aad))
+	if got["plaintext"] != pt {
+		t.Fatalf("decrypt after rotation = %v", got)
+	}
+	if code, _ := f.do("POST", "/v1/kms/transit/decrypt/orders", fmt.Sprintf(`{"ciphertext":%q}`, ct)); code != http.StatusBadRequest {
+		t.Fatalf("decrypt without the associated data = %d, want 400", code)
+	}
+	moved := transitCall(t, f, "rewrap/orders", fmt.Sprintf(`{"ciphertext":%q,"associated_data":%q}`, ct, aad))["ciphertext"]
+	if !strings.HasPrefix(moved, "kms:v2:") {
+		t.Fatalf("rewrapped %q", moved)
+	}
+
+	dk := transitCall(t, f, "datakey/plaintext/orders", `{"bits":128}`)
+	if raw, _ := base64.StdEncoding.DecodeString(dk["plaintext"]); len(raw) != 16 {
+		t.Fatalf("data key = %v", dk)
+	}
+	if back := transitCall(t, f, "decrypt/orders", fmt.Sprintf(`{"ciphertext":%q}`, dk["ciphertext"])); back["plaintext"] != dk["plaintext"] {
+		t.Fatal("the data key's ciphertext does not decrypt to it")
+	}
+	if wrapped := transitCall(t, f, "datakey/wrapped/orders", ""); wrapped["plaintext"] != "" || wrapped["ciphertext"] == "" {
+		t.Fatalf("wrapped data key = %v", wrapped)
+	}
+
+	if code, _ := f.do("POST", "/v1/kms/transit/encrypt/missing", `{"plaintext":""}`); code != http.StatusNotFound {
+		t.Fatalf("unknown key = %d, want 404", code)
+	}
+	if code, raw := f.do("GET", "/v1/kms/transit/keys", ""); code != http.StatusOK || raw != `{"keys":["orders"]}`+"\n" {
+		t.Fatalf("list = %d %q", code, raw)
+	}
+}
+
+// TestTransit_Deterministic: a deterministic key answers one ciphertext for
+// one email in one table, another in a second, and needs the context named.
+func TestTransit_Deterministic(t *testing.T) {
+	f := newListFixture(t)
+	if code, raw := f.do("POST", "/v1/kms/transit/keys", `{"name":"emails","deterministic":true}`); code != http.StatusCreated || !strings.Contains(raw, `"deterministic":true`) {
+		t.Fatalf("create = %d %s", code, raw)
+	}
+	email := base64.StdEncoding.EncodeToString([]byte("a@lux.network"))
+	users := base64.StdEncoding.EncodeToString([]byte("users.email"))
+	leads := base64.StdEncoding.EncodeToString([]byte("leads.email"))
+	body := func(ctx string) string { return fmt.Sprintf(`{"plaintext":%q,"context":%q}`, email, ctx) }
+	ct := transitCall(t, f, "encrypt/emails", body(users))["ciphertext"]
+	if again := transitCall(t, f, "encrypt/emails", body(users))["ciphertext"]; again != ct {
+		t.Fatalf("one email encrypted %q then %q", ct, again)
+	}
+	if other := transitCall(t, f, "encrypt/emails", body(leads))["ciphertext"]; other == ct {
+		t.Fatal("one email in two tables encrypted equal")
+	}
+	if got := transitCall(t, f, "decrypt/emails", fmt.Sprintf(`{"ciphertext":%q,"context":%q}`, ct, users)); got["plaintext"] != email {
+		t.Fatalf("decrypt = %v", got)
+	}
+	if code, _ := f.do("POST", "/v1/kms/transit/encrypt/emails", fmt.Sprintf(`{"plaintext":%q}`, email)); code != http.StatusBadRequest {
+		t.Fatalf("encrypt without a context = %d, want 400", code)
+	}
+	if code, _ := f.do("POST", "/v1/kms/transit/datakey/plaintext/emails", ""); code != http.StatusBadRequest {
+		t.Fatalf("deterministic data key = %d, want 400", code)
+	}
+}
+
+// TestTransit_Import: a partner wraps its own key to the one-time RSA import
+// key, the import makes it a transit key, and the token is spent by its
+// first use, good or bad.
+func TestTransit_Import(t *testing.T) {
+	f := newListFixture(t)
+	code, raw := f.do("POST", "/v1/kms/transit/keys/partner/import-token", `{"ttl_seconds":600}`)
+	var pub byok.PublicKeys
+	if err := json.Unmarshal([]byte(raw), &pub); err != nil || code != http.StatusCreated || pub.Name != "partner" {
+		t.Fatalf("import-token = %d %s", code, raw)
+	}
+	rsaPub, _ := base64.StdEncoding.DecodeString(pub.RSAOAEP3072)
+	material := make([]byte, 32)
+	material[0] = 1
+	wrapped, err := byok.WrapRSAOAEP(rsaPub, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"token":%q,"algorithm":"rsa-oaep-3072","wrapped_key":%q}`, pub.Token, base64.StdEncoding.EncodeToString(wrapped))
+	if code, raw := f.do("POST", "/v1/kms/transit/keys/partner/import", body); code != http.StatusCreated || !strings.Contains(raw, `"imported":true`) {
+		t.Fatalf("import = %d %s", code, raw)
+	}
+	pt := base64.StdEncoding.EncodeToString([]byte("settlement"))
+	ct := transitCall(t, f, "encrypt/partner", fmt.Sprintf(`{"plaintext":%q}`, pt))["ciphertext"]
+	if got := transitCall(t, f, "decrypt/partner", fmt.Sprintf(`{"ciphertext":%q}`, ct)); got["plaintext"] != pt {
+		t.Fatalf("decrypt under the imported key = %v", got)
+	}
+
+	code, raw = f.do("POST", "/v1/kms/transit/keys/other/import-token", "")
+	if err := json.Unmarshal([]byte(raw), &pub); err != nil || code != http.StatusCreated {
+		t.Fatalf("second import-token = %d %s", code, raw)
+	}
+	for i, wrap := range []string{"AAAA", base64.StdEncoding.EncodeToString(wrapped)} {
+		body := fmt.Sprintf(`{"token":%q,"algorithm":"rsa-oaep-3072","wrapped_key":%q}`, pub.Token, wrap)
+		if code, _ := f.do("POST", "/v1/kms/transit/keys/other/import", body); code != http.StatusBadRequest {
+			t.Fatalf("import %d with a spent or bad wrap = %d, want 400", i, code)
+		}
+	}
+	if code, _ := f.do("POST", "/v1/kms/transit/keys/partner/import-token", ""); code != http.StatusConflict {
+		t.Fatalf("import-token for a taken name = %d, want 409", code)
+	}
+}
+
+// transitCall posts body to /v1/kms/transit/{op}, requires a 200, and returns
+// the string fields of the answer.
+func transitCall(t *testing.T, f *listFixture, op, body string) map[string]string {
+	t.Helper()
+	code, raw := f.do("POST", "/v1/kms/transit/"+op, body)
+	if code != http.StatusOK {
+		t.Fatalf("%s = %d %s", op, code, raw)
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		t.Fatalf("%s: %v", op, err)
+	}
+	fields := map[string]string{}
+	for k, v := range out {
+		if s, ok := v.(string); ok {
+			fields[k] = s
+		}
+	}
+	return fields
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestSecretVersions_PinnedReadListAndRollback drives the version history
+// through the real org-less routes: two writes, a pinned read of the first,
+// a listing that names the writer, and a rollback that makes v1 current again
+// as a new v3.
+func TestSecretVersions_PinnedReadListAndRollback(t *testing.T) {
+	f := newListFixture(t)
+	for _, v := range []string{"first", "second"} {
+		body := `{"path":"svc","name":"TOKEN","env":"prod","value":"` + v + `"}`
+		if code, b := f.do("POST", "/v1/kms/secrets", body); code != http.StatusCreated {
+			t.Fatalf("put %s = %d: %s", v, code, b)
+		}
+	}
+
+	value := func(query string) (int, string) {
+		t.Helper()
+		code, raw := f.do("GET", "/v1/kms/secrets/svc/TOKEN"+query, "")
+		var out struct {
+			Secret struct {
+				Value string `json:"value"`
+			} `json:"secret"`
+		}
+		_ = json.Unmarshal([]byte(raw), &out)
+		return code, out.Secret.Value
+	}
+	if code, v := value("?env=prod"); code != http.StatusOK || v != "second" {
+		t.Fatalf("latest = %d %q, want 200 second", code, v)
+	}
+	if code, v := value("?env=prod&version=1"); code != http.StatusOK || v != "first" {
+		t.Fatalf("pinned v1 = %d %q, want 200 first", code, v)
+	}
+	if code, _ := value("?env=prod&version=7"); code != http.StatusNotFound {
+		t.Fatalf("pinned v7 = %d, want 404", code)
+	}
+	if code, _ := value("?env=prod&version=latest"); code != http.StatusBadRequest {
+		t.Fatalf("malformed version = %d, want 400", code)
+	}
+
+	code, raw := f.do("GET", "/v1/kms/versions/svc/TOKEN?env=prod", "")
+	if code != http.StatusOK {
+		t.Fatalf("versions = %d: %s", code, raw)
+	}
+	var listed struct {
+		Versions []struct {
+			Version   int    `json:"version"`
+			CreatedBy string `json:"created_by"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal([]byte(raw), &listed); err != nil {
+		t.Fatalf("decode versions %q: %v", raw, err)
+	}
+	if len(listed.Versions) != 2 || listed.Versions[1].Version != 2 || listed.Versions[1].CreatedBy != "iam:ops" {
+		t.Fatalf("versions = %+v, want two with writer iam:ops", listed.Versions)
+	}
+
+	code, raw = f.do("POST", "/v1/kms/rollback", `{"path":"svc","name":"TOKEN","env":"prod","version":1}`)
+	if code != http.StatusOK {
+		t.Fatalf("rollback = %d: %s", code, raw)
+	}
+	if code, v := value("?env=prod"); code != http.StatusOK || v != "first" {
+		t.Fatalf("after rollback latest = %d %q, want 200 first", code, v)
+	}
+	if code, v := value("?env=prod&version=2"); code != http.StatusOK || v != "second" {
+		t.Fatalf("after rollback v2 = %d %q, want second kept in history", code, v)
+	}
+}
@@ -0,0 +1,131 @@
+// Change feed on the org-less secret surface, as server-sent events.
+//
+//	GET /v1/kms/watch?path=&env=&label=k=v&cursor=   (Accept: text/event-stream)
+//
+// streams what is written under path (store.ChangeLog): one "change" event
+// per put, delete or purge, carrying the coordinate, the op and the version —
+// never the value; a watcher that wants it GETs it like any other read. Every
+// event's id is the cursor that resumes after it, so an EventSource that
+// reconnects with Last-Event-ID picks up where it left off.
+//
+// Besides "change" the stream sends:
+//
+//	ready    first, with the cursor the stream starts from
+//	lost     changes were missed (the server restarted, or the watcher fell
+//	         more than store.ChangeLogSize behind): re-read, then carry on
+//	expired  the token expired; reconnect with a fresh one
+//
+// and a comment line every watchKeepAlive so proxies keep the connection.
+//
+// A watch is a read of path: it takes the authority a GET of the secrets
+// there would (refAuthorizer), and holds it no longer than the token does.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+	"github.com/luxfi/kms/pkg/store"
+)
+
+// watchKeepAlive is how often an idle stream sends a comment line.
+var watchKeepAlive = 15 * time.Second
+
+// registerWatchRoutes wires the watch route next to the version routes.
+func registerWatchRoutes(mux *http.ServeMux, auth *orgJWTAuth, sealed *store.SealedStore) {
+	if sealed == nil {
+		mux.HandleFunc("GET /v1/kms/watch", auth.requireJWT(secretsDisabled))
+		return
+	}
+	mux.HandleFunc("GET /v1/kms/watch", auth.requireJWT(watchHandler(auth, sealed)))
+}
+
+func watchHandler(auth *orgJWTAuth, sealed *store.SealedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseListQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if q.Cursor == "" {
+			q.Cursor = strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+		}
+		if err := auth.refAuthorizer(r)(secret.Ref{Path: q.Path, Env: q.Env}); err != nil {
+			writeJSON(w, http.StatusForbidden, map[string]any{"message": err.Error()})
+			return
+		}
+		feed := sealed.Secrets().Changes()
+		changes, next, err := feed.Since(q)
+		if errors.Is(err, store.ErrInvalidChangeCursor) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "cursor is not one this server issued: pass back an event id unchanged"})
+			return
+		}
+		lost := errors.Is(err, store.ErrChangesLost)
+
+		ctx := r.Context()
+		if c := claimsFrom(r); c != nil && c.Expiry != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, c.Expiry.Time())
+			defer cancel()
+		}
+		rc := http.NewResponseController(w)
+		// The server's write timeout is for requests, not for a stream.
+		_ = rc.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(event, id string, data any) bool {
+			b, _ := json.Marshal(data)
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, b); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+		// ready names where the stream starts: before any changes a resumed
+		// watch is about to replay, so a reconnect after it loses none.
+		start := next
+		if len(changes) > 0 {
+			start = q.Cursor
+		}
+		if !send("ready", start, map[string]string{"cursor": start}) {
+			return
+		}
+		log.Printf("kms: watch start path=%s env=%s by=%s", q.Path, q.Env, claimsFrom(r).principal())
+		for {
+			if lost && !send("lost", next, map[string]string{"cursor": next}) {
+				return
+			}
+			for _, c := range changes {
+				if !send("change", c.Cursor, c) {
+					return
+				}
+			}
+			q.Cursor = next
+			wait, cancel := context.WithTimeout(ctx, watchKeepAlive)
+			changes, next, err = feed.Wait(wait, q)
+			cancel()
+			if ctx.Err() != nil {
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					send("expired", q.Cursor, map[string]string{"cursor": q.Cursor})
+				}
+				return
+			}
+			lost = errors.Is(err, store.ErrChangesLost)
+			if err == nil && len(changes) == 0 {
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || rc.Flush() != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// sseEvent is one server-sent event as a client reads it.
+type sseEvent struct {
+	id, event, data string
+}
+
+// openWatch opens GET /v1/kms/watch?query, with lastID as Last-Event-ID when
+// set, and returns a reader of its events.
+func (f *listFixture) openWatch(query, lastID string) (*http.Response, func() sseEvent) {
+	f.t.Helper()
+	req, err := http.NewRequest("GET", f.srv.URL+"/v1/kms/watch?"+query, nil)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+f.tok)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.t.Cleanup(func() { _ = resp.Body.Close() })
+	lines := bufio.NewScanner(resp.Body)
+	next := func() sseEvent {
+		f.t.Helper()
+		var ev sseEvent
+		for lines.Scan() {
+			line := lines.Text()
+			switch {
+			case line == "":
+				if ev.event != "" {
+					return ev
+				}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		f.t.Fatalf("stream ended: %v", lines.Err())
+		return ev
+	}
+	return resp, next
+}
+
+// TestSecretWatch_StreamsChangesWithoutValues: the stream reports each write
+// under the watched path as a coordinate and version, carries no value, and
+// resumes from an event id.
+func TestSecretWatch_StreamsChangesWithoutValues(t *testing.T) {
+	auth, bearer, cleanup := newTestKeyAuth(t, roleKMSAdmin)
+	t.Cleanup(cleanup)
+	mux := http.NewServeMux()
+	registerSecretRoutes(mux, auth, newTestSealedStore(t))
+	// Served through jsonOnly, as in production: the stream must pass it.
+	srv := httptest.NewServer(jsonOnly(mux))
+	t.Cleanup(srv.Close)
+	f := &listFixture{t: t, srv: srv, tok: bearer}
+
+	resp, next := f.openWatch("path=svc&env=dev", "")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	ready := next()
+	if ready.event != "ready" || ready.id == "" {
+		t.Fatalf("first event = %+v, want ready with a cursor", ready)
+	}
+
+	f.putValue("other", "X", "dev", "not-watched")
+	f.putValue("svc", "A", "dev", "watched-secret-value")
+	if code, b := f.do("DELETE", "/v1/kms/secrets/svc/A?env=dev", ""); code != http.StatusOK && code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", code, b)
+	}
+
+	var got []secret.Change
+	for len(got) < 2 {
+		ev := next()
+		if ev.event != "change" {
+			t.Fatalf("event = %+v, want change", ev)
+		}
+		if strings.Contains(ev.data, "watched-secret-value") {
+			t.Fatalf("change event carries the value: %s", ev.data)
+		}
+		var c secret.Change
+		if err := json.Unmarshal([]byte(ev.data), &c); err != nil || c.Cursor != ev.id {
+			t.Fatalf("change %s: %v (id %q)", ev.data, err, ev.id)
+		}
+		got = append(got, c)
+	}
+	if got[0].Op != "put" || got[0].Path != "svc" || got[0].Name != "A" || got[0].Version != 1 || got[1].Op != "delete" {
+		t.Fatalf("changes = %+v", got)
+	}
+
+	// An EventSource reconnecting with the ready id replays both.
+	_, replay := f.openWatch("path=svc&env=dev", ready.id)
+	if ev := replay(); ev.event != "ready" || ev.id != ready.id {
+		t.Fatalf("resumed ready = %+v, want id %q", ev, ready.id)
+	}
+	if ev := replay(); ev.event != "change" || ev.id != got[0].Cursor {
+		t.Fatalf("replayed %+v, want the put", ev)
+	}
+
+	if code, raw := f.do("GET", "/v1/kms/watch?cursor=nonsense", ""); code != http.StatusBadRequest || !strings.Contains(raw, "cursor") {
+		t.Fatalf("bad cursor = %d %s, want 400", code, raw)
+	}
+	if code, raw := f.do("GET", "/v1/kms/watch?path=svc&since=1", ""); code != http.StatusBadRequest {
+		t.Fatalf("unknown parameter = %d %s, want 400", code, raw)
+	}
+}
+
+// TestSecretWatch_LostCursorIsReported: a cursor from before a restart is not
+// an error but a "lost" event, so the watcher re-reads.
+func TestSecretWatch_LostCursorIsReported(t *testing.T) {
+	f := newListFixture(t)
+	_, next := f.openWatch("path=svc", "0000000000000000.7")
+	if ev := next(); ev.event != "ready" {
+		t.Fatalf("first event = %+v", ev)
+	}
+	if ev := next(); ev.event != "lost" || !strings.Contains(ev.data, ev.id) {
+		t.Fatalf("second event = %+v, want lost with the cursor to resume from", ev)
+	}
+}
@@ -0,0 +1,120 @@
+// Last-resort boot from a recovery kit (pkg/recovery, cmd/kms-recovery).
+//
+// With KMS_RECOVERY_UNSEAL set to a kit ID, the server does not read its keys
+// from the env or MPC. Before the store is opened, KMS_LISTEN serves only:
+//
+//	GET  /healthz (and /health, /v1/kms/healthz, /v1/kms/health)  {"status":"sealed"}
+//	GET  /v1/kms/unseal   {kit, threshold, received}   custodians whose shares are in
+//	POST /v1/kms/unseal   one share, as the custodian's file decrypts (age -d)
+//
+// Once a quorum of that kit's shares is in, they recover the at-rest key and
+// the REK keyring. The unseal listener closes and the boot goes on with those
+// keys in place of KMS_ENCRYPTION_KEY_B64 and MPC_REK_ENDPOINT /
+// KMS_MASTER_KEY_B64.
+//
+// The shares are the credential. There is no JWT, because a custodian holds a
+// share, not an IAM account. A share of any other kit is refused, and so is
+// one that does not match the pinned kit's commitments (a forged or corrupt
+// share); it is refused as it comes in, and the shares already in stay.
+// Every submission, accepted or refused, is an audit line, and so is the
+// unseal itself. A boot from the kit means
+// both keys have left their custody, so rotate them and take a new kit.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luxfi/kms/pkg/recovery"
+)
+
+// awaitUnseal serves the unseal surface on listen until a quorum of the kit's
+// shares recovers its keys, and returns them. It does not return otherwise.
+func awaitUnseal(listen, kit string) *recovery.Keys {
+	u, err := recovery.NewUnsealer(kit)
+	if err != nil {
+		log.Fatalf("kms: KMS_RECOVERY_UNSEAL: %v", err)
+	}
+	unsealed := make(chan *recovery.Keys, 1)
+	mux := http.NewServeMux()
+	registerUnsealRoutes(mux, u, unsealed)
+	mux.HandleFunc("/", notFoundJSON)
+	srv := &http.Server{
+		Addr:         listen,
+		Handler:      jsonOnly(mux),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("kms: unseal http: %v", err)
+		}
+	}()
+	log.Printf("kms: audit: SEALED: KMS_RECOVERY_UNSEAL is set; booting from recovery kit %s, the last-resort path. Waiting on %s for custodian shares at POST /v1/kms/unseal", kit, listen)
+
+	keys := <-unsealed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	return keys
+}
+
+// registerUnsealRoutes wires the unseal surface. The keys the quorum recovers
+// are sent on unsealed, once.
+func registerUnsealRoutes(mux *http.ServeMux, u *recovery.Unsealer, unsealed chan<- *recovery.Keys) {
+	sealedHealth := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":  "sealed",
+			"service": "kms",
+			"detail":  "waiting for recovery shares at /v1/kms/unseal",
+		})
+	}
+	mux.HandleFunc("GET /healthz", sealedHealth)
+	mux.HandleFunc("GET /health", sealedHealth)
+	mux.HandleFunc("GET /v1/kms/healthz", sealedHealth)
+	mux.HandleFunc("GET /v1/kms/health", sealedHealth)
+	mux.HandleFunc("GET /v1/kms/unseal", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, u.Status())
+	})
+	mux.HandleFunc("POST /v1/kms/unseal", unsealHandler(u, unsealed))
+}
+
+func unsealHandler(u *recovery.Unsealer, unsealed chan<- *recovery.Keys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sh recovery.Share
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&sh); err != nil {
+			log.Printf("kms: audit: unseal refused from=%s: body is not a share", r.RemoteAddr)
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": "body must be one share, as its file decrypts"})
+			return
+		}
+		keys, err := u.Add(sh)
+		clear(sh.Value)
+		if err != nil {
+			log.Printf("kms: audit: unseal refused custodian=%q index=%d from=%s: %v", sh.Custodian, sh.Index, r.RemoteAddr, err)
+			code := http.StatusBadRequest
+			if errors.Is(err, recovery.ErrDuplicateShare) || errors.Is(err, recovery.ErrQuorum) {
+				code = http.StatusConflict
+			}
+			writeJSON(w, code, map[string]any{"message": err.Error()})
+			return
+		}
+		st := u.Status()
+		if keys == nil {
+			log.Printf("kms: audit: unseal share accepted custodian=%q index=%d from=%s kit=%s (%d of %d)", sh.Custodian, sh.Index, r.RemoteAddr, st.Kit, len(st.Received), st.Threshold)
+			writeJSON(w, http.StatusAccepted, st)
+			return
+		}
+		log.Printf("kms: audit: UNSEALED from recovery kit %s: quorum completed by custodian=%q from=%s; booting on the recovered at-rest key and REK epochs (current %d). Rotate both and take a new kit.", st.Kit, sh.Custodian, r.RemoteAddr, keys.REKEpoch)
+		select {
+		case unsealed <- keys:
+		default:
+			keys.Zero()
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"unsealed": true, "kit": st.Kit})
+	}
+}
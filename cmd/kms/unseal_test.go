@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luxfi/age"
+
+	"github.com/luxfi/kms/pkg/recovery"
+)
+
+// TestUnseal_BootsFromAQuorum walks the last-resort boot: shares of the
+// pinned kit come in one at a time, a share of another kit and a forged one
+// are refused, and the quorum hands over the keys the kit was taken from.
+func TestUnseal_BootsFromAQuorum(t *testing.T) {
+	keys := &recovery.Keys{
+		AtRestKey: bytes.Repeat([]byte{0xa1}, 32),
+		REKEpoch:  1,
+		REKs:      map[uint32][]byte{1: bytes.Repeat([]byte{0xb2}, 32)},
+	}
+	kit, shares := takeKit(t, keys)
+	other, otherShares := takeKit(t, keys)
+
+	u, err := recovery.NewUnsealer(kit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsealed := make(chan *recovery.Keys, 1)
+	mux := http.NewServeMux()
+	registerUnsealRoutes(mux, u, unsealed)
+	post := func(share []byte) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/kms/unseal", bytes.NewReader(share)))
+		var body map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"sealed"`)) {
+		t.Fatalf("healthz while sealed: %d %s", rec.Code, rec.Body)
+	}
+
+	if code, body := post(otherShares[0]); code != http.StatusBadRequest {
+		t.Fatalf("share of kit %s: %d %v", other, code, body)
+	}
+	if code, body := post([]byte("not a share")); code != http.StatusBadRequest {
+		t.Fatalf("junk: %d %v", code, body)
+	}
+	if code, body := post(shares[1]); code != http.StatusAccepted || body["threshold"] != float64(2) {
+		t.Fatalf("first share: %d %v", code, body)
+	}
+	if code, _ := post(shares[1]); code != http.StatusConflict {
+		t.Fatalf("same share again: %d", code)
+	}
+	var forged recovery.Share
+	if err := json.Unmarshal(shares[2], &forged); err != nil {
+		t.Fatal(err)
+	}
+	forged.Value[0] ^= 1
+	raw, _ := json.Marshal(forged)
+	if code, body := post(raw); code != http.StatusBadRequest {
+		t.Fatalf("forged share: %d %v", code, body)
+	}
+	select {
+	case <-unsealed:
+		t.Fatal("unsealed below the threshold")
+	default:
+	}
+	if code, body := post(shares[0]); code != http.StatusOK || body["unsealed"] != true {
+		t.Fatalf("quorum: %d %v", code, body)
+	}
+	got := <-unsealed
+	if !bytes.Equal(got.AtRestKey, keys.AtRestKey) || !bytes.Equal(got.REKs[1], keys.REKs[1]) || got.REKEpoch != 1 {
+		t.Fatalf("recovered %+v", got)
+	}
+}
+
+// takeKit splits keys 2-of-3 and returns the kit ID and each share as its
+// custodian's file decrypts.
+func takeKit(t *testing.T, keys *recovery.Keys) (string, [][]byte) {
+	t.Helper()
+	var custodians []recovery.Custodian
+	var identities []age.Identity
+	for _, name := range []string{"alice", "bob", "carol"} {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		custodians = append(custodians, recovery.Custodian{Name: name, Recipient: id.Recipient().String()})
+		identities = append(identities, id)
+	}
+	kit, sealed, err := recovery.Split(keys, custodians, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shares [][]byte
+	for i, s := range sealed {
+		r, err := age.Decrypt(bytes.NewReader(s.Age), identities[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(r)
+		shares = append(shares, raw)
+	}
+	return kit, shares
+}
@@ -100,6 +100,12 @@ func GetSecrets(ctx context.Context) (map[string]string, error) {
 // have no distinct answer, and this returns an error naming both coordinates
 // rather than picking one. Choosing silently is how a process boots with the
 // wrong DATABASE_URL and never learns.
+//
+// The whole set is one batch read (OpSecretBatchGet): one signed envelope
+// and one response however many secrets the service has. Values come back
+// with their ${ref:...} references expanded by the server. A secret that could
+// not be read — its reference included — and a set too large for one batch,
+// are errors: a service must not boot with part of its configuration.
 func GetSecretsWith(ctx context.Context, cfg Config) (map[string]string, error) {
 	cfg = cfg.resolve()
 	c, err := zapclient.Dial(ctx, cfg.Addr, cfg.Path)
@@ -108,24 +114,31 @@ func GetSecretsWith(ctx context.Context, cfg Config) (map[string]string, error)
 	}
 	defer c.Close()
 
-	refs, err := c.ListAt(ctx, cfg.Path, cfg.Env)
+	items, truncated, err := c.GetMatching(ctx, secret.Query{Path: cfg.Path, Env: cfg.Env})
 	if err != nil {
-		return nil, fmt.Errorf("kms: list %s@%s: %w", cfg.Path, cfg.Env, err)
+		return nil, fmt.Errorf("kms: read %s@%s: %w", cfg.Path, cfg.Env, err)
+	}
+	if truncated {
+		return nil, fmt.Errorf("kms: %s@%s holds more secrets than one batch read returns: narrow the path", cfg.Path, cfg.Env)
 	}
-	out := make(map[string]string, len(refs))
-	seen := make(map[string]secret.Ref, len(refs))
-	for _, ref := range refs {
+	out := make(map[string]string, len(items))
+	seen := make(map[string]secret.Ref, len(items))
+	for _, it := range items {
+		ref := it.Ref
 		if prev, dup := seen[ref.Name]; dup {
 			return nil, fmt.Errorf("kms: %s is defined twice under %s@%s (%s/%s@%s and %s/%s@%s): an environment cannot hold both",
 				ref.Name, cfg.Path, cfg.Env,
 				prev.Path, prev.Name, prev.Env, ref.Path, ref.Name, ref.Env)
 		}
-		v, err := c.GetAt(ctx, ref.Path, ref.Name, ref.Env)
-		if err != nil {
-			return nil, fmt.Errorf("kms: get %s/%s@%s: %w", ref.Path, ref.Name, ref.Env, err)
+		if !it.Found() {
+			reason := it.Status
+			if it.Error != "" {
+				reason = it.Error
+			}
+			return nil, fmt.Errorf("kms: get %s/%s@%s: %s", ref.Path, ref.Name, ref.Env, reason)
 		}
 		seen[ref.Name] = ref
-		out[ref.Name] = v
+		out[ref.Name] = it.Value
 	}
 	return out, nil
 }
@@ -0,0 +1,244 @@
+// Package bundle reads the documents secrets arrive in when a team moves
+// into the KMS — a .env file, a flat JSON object, a flat YAML mapping — into
+// one ordered list of name/value pairs.
+//
+// It only parses. Whether a name is a valid coordinate, and what happens
+// when it already exists, is the store's business (store.SealedStore.Import);
+// a bundle that parses is not yet a bundle that imports.
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	yaml "go.yaml.in/yaml/v3"
+)
+
+// Formats.
+const (
+	FormatDotenv = "dotenv"
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+)
+
+// MaxBytes bounds one document. It is the ZAP envelope cap: a bundle is
+// meant to move a service's configuration, not a database.
+const MaxBytes = 4 << 20
+
+// ErrFormat rejects a document that is not the format it claims to be, or
+// is not flat.
+var ErrFormat = errors.New("bundle: invalid document")
+
+// Entry is one secret of a bundle.
+type Entry struct {
+	Name  string
+	Value string
+}
+
+// Parse reads doc as format. Entries come back in document order for dotenv
+// and YAML and sorted by name for JSON, whose objects have none. A name given
+// twice is an error rather than last-one-wins: which of two values a file
+// meant is not something to guess about a secret.
+func Parse(format string, doc []byte) ([]Entry, error) {
+	if len(doc) > MaxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrFormat, MaxBytes)
+	}
+	var (
+		entries []Entry
+		err     error
+	)
+	switch format {
+	case FormatDotenv:
+		entries, err = parseDotenv(doc)
+	case FormatJSON:
+		entries, err = parseJSON(doc)
+	case FormatYAML:
+		entries, err = parseYAML(doc)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q (want dotenv, json or yaml)", ErrFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.Name] {
+			return nil, fmt.Errorf("%w: %s is defined twice", ErrFormat, e.Name)
+		}
+		seen[e.Name] = true
+	}
+	return entries, nil
+}
+
+// parseDotenv reads KEY=VALUE lines. It takes what .env files in the wild
+// hold: blank lines and # comments, an optional "export " prefix, unquoted
+// values (trimmed, with a trailing " #comment" dropped), 'single-quoted'
+// values taken literally, and "double-quoted" values with \n, \t, \", \\
+// escapes that may span lines — which is how a PEM block is written.
+func parseDotenv(doc []byte) ([]Entry, error) {
+	var out []Entry
+	lines := strings.Split(strings.ReplaceAll(string(doc), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("%w: line %d: want KEY=VALUE", ErrFormat, lineNo)
+		}
+		name, rest := strings.TrimSpace(line[:eq]), strings.TrimLeft(line[eq+1:], " \t")
+		var value string
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			// May continue over following lines until the closing quote.
+			body := rest[1:]
+			for {
+				v, ok, err := unquoteDouble(body)
+				if err != nil {
+					return nil, fmt.Errorf("%w: line %d: %v", ErrFormat, lineNo, err)
+				}
+				if ok {
+					value = v
+					break
+				}
+				if i+1 >= len(lines) {
+					return nil, fmt.Errorf("%w: line %d: unterminated double quote", ErrFormat, lineNo)
+				}
+				i++
+				body += "\n" + lines[i]
+			}
+		case strings.HasPrefix(rest, "'"):
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: line %d: unterminated single quote", ErrFormat, lineNo)
+			}
+			value = rest[1 : 1+end]
+		default:
+			if c := strings.Index(rest, " #"); c >= 0 {
+				rest = rest[:c]
+			}
+			value = strings.TrimSpace(rest)
+		}
+		out = append(out, Entry{Name: name, Value: value})
+	}
+	return out, nil
+}
+
+// unquoteDouble decodes a double-quoted dotenv value whose opening quote has
+// been consumed. ok is false when s ends before the closing quote; anything
+// after the closing quote but a comment is an error.
+func unquoteDouble(s string) (value string, ok bool, err error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		case c == '"':
+			tail := strings.TrimSpace(s[i+1:])
+			if tail != "" && !strings.HasPrefix(tail, "#") {
+				return "", false, fmt.Errorf("unexpected %q after closing quote", tail)
+			}
+			return b.String(), true, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false, nil
+}
+
+// parseJSON reads one flat object. Strings are taken as they are; numbers
+// and booleans as their literal text, since env-style config often writes
+// PORT as 5432. Anything nested, and null, is refused: there is no one
+// obvious string for it. The object is walked token by token rather than
+// decoded into a map, which would keep the last of a repeated key silently;
+// every pair comes back, so Parse sees the repeat.
+func parseJSON(doc []byte) ([]Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("%w: want one flat JSON object", ErrFormat)
+	}
+	out := []Entry{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: want one flat JSON object: %v", ErrFormat, err)
+		}
+		k, _ := tok.(string)
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%w: want one flat JSON object: %v", ErrFormat, err)
+		}
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		case bool:
+			s = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("%w: %s is not a string, number or boolean", ErrFormat, k)
+		}
+		out = append(out, Entry{Name: k, Value: s})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%w: want one flat JSON object: %v", ErrFormat, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data after the JSON object", ErrFormat)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// parseYAML reads one flat mapping of scalars, by the same rules as JSON. A
+// scalar is taken as written, so 0755 stays "0755" rather than becoming 493.
+// YAML merges a repeated key silently; here it is an error like anywhere else.
+func parseYAML(doc []byte) ([]Entry, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if root.Kind == 0 {
+		return nil, nil // empty document
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: want one flat YAML mapping", ErrFormat)
+	}
+	m := root.Content[0]
+	out := make([]Entry, 0, len(m.Content)/2)
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%w: line %d: key is not a scalar", ErrFormat, k.Line)
+		}
+		if v.Kind != yaml.ScalarNode || v.Tag == "!!null" {
+			return nil, fmt.Errorf("%w: line %d: %s is not a string, number or boolean", ErrFormat, v.Line, k.Value)
+		}
+		out = append(out, Entry{Name: k.Value, Value: v.Value})
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package bundle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	doc := `# service config
+export DB_HOST=db.internal
+DB_PORT = 5432 # default port
+EMPTY=
+SINGLE='literal $HOME # not a comment'
+DOUBLE="line1\nline2 \"quoted\""
+PEM="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+URL=postgres://u:p@h/db?x=1
+`
+	got, err := Parse(FormatDotenv, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{"DB_HOST", "db.internal"},
+		{"DB_PORT", "5432"},
+		{"EMPTY", ""},
+		{"SINGLE", "literal $HOME # not a comment"},
+		{"DOUBLE", "line1\nline2 \"quoted\""},
+		{"PEM", "-----BEGIN KEY-----\nabc\n-----END KEY-----"},
+		{"URL", "postgres://u:p@h/db?x=1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestParseJSONAndYAML(t *testing.T) {
+	want := []Entry{{"A", "x"}, {"MODE", "0755"}, {"ON", "true"}, {"PORT", "5432"}}
+	got, err := Parse(FormatJSON, []byte(`{"PORT": 5432, "A": "x", "ON": true, "MODE": "0755"}`))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("json = %q, %v", got, err)
+	}
+	got, err = Parse(FormatYAML, []byte("A: x\nMODE: 0755\nON: true\nPORT: 5432\n"))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("yaml = %q, %v", got, err)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, c := range []struct{ format, doc string }{
+		{FormatDotenv, "NOEQUALS\n"},
+		{FormatDotenv, "A=\"unterminated\n"},
+		{FormatDotenv, "A=1\nA=2\n"},
+		{FormatJSON, `{"A": {"nested": "x"}}`},
+		{FormatJSON, `{"A": null}`},
+		{FormatJSON, `["A"]`},
+		{FormatJSON, `{"A":"1","A":"2"}`},
+		{FormatJSON, `{"A":"1"} {"B":"2"}`},
+		{FormatYAML, "A:\n  nested: x\n"},
+		{FormatYAML, "A: ~\n"},
+		{FormatYAML, "- A\n"},
+		{"toml", "A = 1"},
+	} {
+		if _, err := Parse(c.format, []byte(c.doc)); !errors.Is(err, ErrFormat) {
+			t.Errorf("%s %q: err = %v, want ErrFormat", c.format, c.doc, err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package byok is the bring-your-own-key ceremony: how a partner that
+// generates key material itself gets it into the KMS without it ever being
+// in the clear outside the partner and the server.
+//
+// The KMS makes an import key for a named key — a one-time ML-KEM-768
+// keypair and, for tooling that only speaks RSA, a one-time RSA-3072
+// keypair — and publishes the public halves under a token. The partner
+// wraps its material to one of them:
+//
+//	mlkem768       kem_ct(1088) || nonce(12) || AES-256-GCM(material)
+//	               under the ML-KEM shared secret, AAD "kms/byok/v1\x00" + token
+//	rsa-oaep-3072  RSA-OAEP(SHA-256, no label)(material)
+//
+// The server unwraps it with the private half and keeps it, sealed, as a key
+// of its own. An import key answers one Unwrap and is then dropped, used or
+// not; it expires at ExpiresAt either way.
+//
+// It only does the cryptography. Storing an import key sealed under the REK,
+// consuming it once and keeping what it unwraps is the store's business
+// (store.SealedStore.ImportTransitKey).
+package byok
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+)
+
+// Wrapping algorithms.
+const (
+	// WrapMLKEM768: ML-KEM-768 encapsulation, AES-256-GCM under the shared
+	// secret. The default, and the one to use.
+	WrapMLKEM768 = "mlkem768"
+	// WrapRSAOAEP3072: RSA-OAEP with SHA-256 under a 3072-bit key, for
+	// tooling that cannot do ML-KEM (openssl pkeyutl, HSM export).
+	WrapRSAOAEP3072 = "rsa-oaep-3072"
+)
+
+// Bounds on an import key's life.
+const (
+	// DefaultTTL is how long an import key made without a TTL stays usable.
+	DefaultTTL = time.Hour
+	// MaxTTL bounds any TTL: an import key is for one ceremony.
+	MaxTTL = 24 * time.Hour
+	// MaxMaterial bounds what an import key unwraps.
+	MaxMaterial = 64
+)
+
+// rsaBits is the size of an import key's RSA half.
+const rsaBits = 3072
+
+// aadLabel prefixes the AES-GCM AAD of an ML-KEM wrap, which binds it to the
+// token it was made for.
+const aadLabel = "kms/byok/v1\x00"
+
+var (
+	// ErrInvalidWrap rejects a wrap that does not unwrap under the import
+	// key: a wrong algorithm, a wrong token, a corrupt or forged wrap.
+	ErrInvalidWrap = errors.New("byok: wrapped key does not unwrap under the import key")
+	// ErrInvalidTTL rejects a TTL outside (0, MaxTTL].
+	ErrInvalidTTL = errors.New("byok: invalid ttl")
+)
+
+// ImportKey is a one-time import keypair and the token it is published
+// under. It holds private keys in the clear and is zeroed after use.
+type ImportKey struct {
+	Token string `json:"token"`
+	// Name is the key the import is for; the material goes nowhere else.
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MLKEM768 is the packed ML-KEM-768 decapsulation key.
+	MLKEM768 []byte `json:"mlkem768"`
+	// RSA is the RSA-3072 private key, PKCS #8 DER.
+	RSA []byte `json:"rsa"`
+}
+
+// PublicKeys is what is published of an import key: the token and the
+// public halves a partner wraps to.
+type PublicKeys struct {
+	Token     string    `json:"token"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MLKEM768 is the packed ML-KEM-768 encapsulation key, base64.
+	MLKEM768 string `json:"mlkem768_public_key"`
+	// RSAOAEP3072 is the RSA-3072 public key, base64 PKIX (SubjectPublicKeyInfo) DER.
+	RSAOAEP3072 string `json:"rsa_oaep_3072_public_key"`
+}
+
+// New makes an import key for the key name, usable for ttl from now; 0 is
+// DefaultTTL.
+func New(name string, ttl time.Duration, now time.Time) (*ImportKey, error) {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return nil, fmt.Errorf("%w: %s (at most %s)", ErrInvalidTTL, ttl, MaxTTL)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("byok: rand: %w", err)
+	}
+	_, kemPriv, err := mlkem768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("byok: ml-kem keypair: %w", err)
+	}
+	kemPacked, err := kemPriv.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	if err != nil {
+		return nil, fmt.Errorf("byok: rsa keypair: %w", err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaPriv)
+	if err != nil {
+		return nil, err
+	}
+	return &ImportKey{
+		Token:     hex.EncodeToString(id),
+		Name:      name,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(ttl).UTC(),
+		MLKEM768:  kemPacked,
+		RSA:       rsaDER,
+	}, nil
+}
+
+// Expired reports whether k can no longer be used at now.
+func (k *ImportKey) Expired(now time.Time) bool { return !now.Before(k.ExpiresAt) }
+
+// Public is what may be published of k.
+func (k *ImportKey) Public() (*PublicKeys, error) {
+	kemPriv, rsaPriv, err := k.private()
+	if err != nil {
+		return nil, err
+	}
+	kemPub, err := kemPriv.Public().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, err := x509.MarshalPKIXPublicKey(&rsaPriv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKeys{
+		Token:       k.Token,
+		Name:        k.Name,
+		ExpiresAt:   k.ExpiresAt,
+		MLKEM768:    base64.StdEncoding.EncodeToString(kemPub),
+		RSAOAEP3072: base64.StdEncoding.EncodeToString(rsaPub),
+	}, nil
+}
+
+// Unwrap recovers the material wrapped to k with alg. Every failure is
+// ErrInvalidWrap, so a caller learns nothing from which step refused it.
+// The caller zeroes the material.
+func (k *ImportKey) Unwrap(alg string, wrapped []byte) ([]byte, error) {
+	kemPriv, rsaPriv, err := k.private()
+	if err != nil {
+		return nil, err
+	}
+	var material []byte
+	switch alg {
+	case WrapMLKEM768, "":
+		if len(wrapped) < mlkem768.CiphertextSize {
+			return nil, ErrInvalidWrap
+		}
+		ss, err := mlkem768.Scheme().Decapsulate(kemPriv, wrapped[:mlkem768.CiphertextSize])
+		if err != nil {
+			return nil, ErrInvalidWrap
+		}
+		defer clear(ss)
+		material, err = gcmOpen(ss, []byte(aadLabel+k.Token), wrapped[mlkem768.CiphertextSize:])
+		if err != nil {
+			return nil, ErrInvalidWrap
+		}
+	case WrapRSAOAEP3072:
+		material, err = rsa.DecryptOAEP(sha256.New(), nil, rsaPriv, wrapped, nil)
+		if err != nil {
+			return nil, ErrInvalidWrap
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidWrap, alg)
+	}
+	if len(material) == 0 || len(material) > MaxMaterial {
+		clear(material)
+		return nil, fmt.Errorf("%w: material is 1 to %d bytes", ErrInvalidWrap, MaxMaterial)
+	}
+	return material, nil
+}
+
+// Zero wipes k's private keys (best effort).
+func (k *ImportKey) Zero() {
+	if k == nil {
+		return
+	}
+	clear(k.MLKEM768)
+	clear(k.RSA)
+}
+
+func (k *ImportKey) private() (*mlkem768.PrivateKey, *rsa.PrivateKey, error) {
+	var kemPriv mlkem768.PrivateKey
+	if err := kemPriv.Unpack(k.MLKEM768); err != nil {
+		return nil, nil, fmt.Errorf("byok: ml-kem private key: %w", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(k.RSA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("byok: rsa private key: %w", err)
+	}
+	rsaPriv, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("byok: rsa private key is not RSA")
+	}
+	return &kemPriv, rsaPriv, nil
+}
+
+// WrapMLKEM is the partner's side of an mlkem768 wrap: material wrapped to
+// the published pub (PublicKeys.MLKEM768, decoded) for token.
+func WrapMLKEM(pub []byte, token string, material []byte) ([]byte, error) {
+	pk, err := mlkem768.Scheme().UnmarshalBinaryPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("byok: ml-kem public key: %w", err)
+	}
+	ct, ss, err := mlkem768.Scheme().Encapsulate(pk)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(ss)
+	sealed, err := gcmSeal(ss, []byte(aadLabel+token), material)
+	if err != nil {
+		return nil, err
+	}
+	return append(ct, sealed...), nil
+}
+
+// WrapRSAOAEP is the partner's side of an rsa-oaep-3072 wrap: material
+// wrapped to the published pub (PublicKeys.RSAOAEP3072, decoded).
+func WrapRSAOAEP(pub []byte, material []byte) ([]byte, error) {
+	parsed, err := x509.ParsePKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("byok: rsa public key: %w", err)
+	}
+	pk, ok := parsed.(*rsa.PublicKey)
+	if !ok || pk.N.BitLen() != rsaBits {
+		return nil, fmt.Errorf("byok: rsa public key is not RSA-%d", rsaBits)
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, pk, material, nil)
+}
+
+// gcmSeal is nonce(12) || AES-256-GCM(plaintext) under key.
+func gcmSeal(key, aad, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, aad, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrInvalidWrap
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
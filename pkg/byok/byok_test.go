@@ -0,0 +1,67 @@
+package byok
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWrapUnwrap(t *testing.T) {
+	now := time.Now()
+	k, err := New("partner", 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.ExpiresAt.Equal(now.Add(DefaultTTL).UTC()) || k.Expired(now) || !k.Expired(now.Add(DefaultTTL)) {
+		t.Fatalf("expiry %s from %s", k.ExpiresAt, now)
+	}
+	pub, err := k.Public()
+	if err != nil || pub.Token != k.Token || pub.Name != "partner" {
+		t.Fatalf("Public = %+v, %v", pub, err)
+	}
+	kemPub, _ := base64.StdEncoding.DecodeString(pub.MLKEM768)
+	rsaPub, _ := base64.StdEncoding.DecodeString(pub.RSAOAEP3072)
+	material := bytes.Repeat([]byte{0x42}, 32)
+
+	wrapped, err := WrapMLKEM(kemPub, k.Token, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Unwrap(WrapMLKEM768, wrapped); err != nil || !bytes.Equal(got, material) {
+		t.Fatalf("ml-kem unwrap = %x, %v", got, err)
+	}
+	// The wrap is bound to its token and to its bytes.
+	other, _ := WrapMLKEM(kemPub, "another-token", material)
+	if _, err := k.Unwrap(WrapMLKEM768, other); !errors.Is(err, ErrInvalidWrap) {
+		t.Fatalf("wrap for another token: %v", err)
+	}
+	wrapped[len(wrapped)-1] ^= 1
+	if _, err := k.Unwrap(WrapMLKEM768, wrapped); !errors.Is(err, ErrInvalidWrap) {
+		t.Fatalf("tampered wrap: %v", err)
+	}
+
+	legacy, err := WrapRSAOAEP(rsaPub, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Unwrap(WrapRSAOAEP3072, legacy); err != nil || !bytes.Equal(got, material) {
+		t.Fatalf("rsa unwrap = %x, %v", got, err)
+	}
+	if _, err := k.Unwrap(WrapMLKEM768, legacy); !errors.Is(err, ErrInvalidWrap) {
+		t.Fatalf("rsa wrap as ml-kem: %v", err)
+	}
+	long, _ := WrapRSAOAEP(rsaPub, make([]byte, MaxMaterial+1))
+	if _, err := k.Unwrap(WrapRSAOAEP3072, long); !errors.Is(err, ErrInvalidWrap) {
+		t.Fatalf("over-long material: %v", err)
+	}
+
+	if _, err := New("partner", MaxTTL+time.Second, now); !errors.Is(err, ErrInvalidTTL) {
+		t.Fatalf("ttl over MaxTTL: %v", err)
+	}
+	k.Zero()
+	if _, err := k.Unwrap(WrapMLKEM768, wrapped); err == nil {
+		t.Fatal("a zeroed import key still unwraps")
+	}
+}
@@ -0,0 +1,196 @@
+// Package generate makes secret values inside the KMS, from crypto/rand, so a
+// password or an API key never has to be typed, pasted or piped on an
+// operator's laptop to reach the store.
+//
+// It only generates. Sealing and storing the value is the store's business
+// (store.SealedStore.Generate); the value a Policy produces is written like
+// any other, schemas and locks included.
+package generate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/google/uuid"
+)
+
+// Policy types.
+const (
+	// TypePassword: Length characters drawn uniformly from Charset.
+	TypePassword = "password"
+	// TypeHex: Length random bytes, hex-encoded.
+	TypeHex = "hex"
+	// TypeBase64: Length random bytes, standard padded base64.
+	TypeBase64 = "base64"
+	// TypeEd25519: an Ed25519 private key as PKCS #8 PEM.
+	TypeEd25519 = "ed25519"
+	// TypeSecp256k1: a secp256k1 private key as 64 hex characters — the
+	// 32-byte big-endian scalar Ethereum and Bitcoin tooling take.
+	TypeSecp256k1 = "secp256k1"
+	// TypeUUID: a random (version 4) UUID.
+	TypeUUID = "uuid"
+)
+
+// Charsets of a password policy.
+var charsets = map[string]string{
+	"alnum": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	// lower is lowercase letters and digits, for systems that fold case.
+	"lower":   "abcdefghijklmnopqrstuvwxyz0123456789",
+	"digits":  "0123456789",
+	"symbols": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+// Defaults and bounds. A password shorter than 16 characters or a key of
+// fewer than 16 bytes is not something the KMS should mint.
+const (
+	DefaultCharset = "alnum"
+	DefaultLength  = 32
+	MinLength      = 16
+	MaxLength      = 4096
+)
+
+// ErrInvalidPolicy rejects a policy this package cannot follow.
+var ErrInvalidPolicy = errors.New("generate: invalid policy")
+
+// Policy says what value to generate. Length counts characters for a
+// password and bytes for hex and base64; keypairs and UUIDs take neither
+// Length nor Charset.
+type Policy struct {
+	Type    string `json:"type"`
+	Length  int    `json:"length,omitempty"`
+	Charset string `json:"charset,omitempty"`
+}
+
+// Value is what Generate made. PublicKey is set for keypairs, hex-encoded
+// (Ed25519: 32 bytes; secp256k1: 33-byte compressed point); it is not
+// secret and is safe to return to the caller.
+type Value struct {
+	Secret    []byte
+	PublicKey string
+}
+
+// Check reports whether p is a policy Generate can follow.
+func (p Policy) Check() error {
+	switch p.Type {
+	case TypePassword:
+		if _, ok := charsets[p.charset()]; !ok {
+			return fmt.Errorf("%w: unknown charset %q (alnum, alpha, lower, digits or symbols)", ErrInvalidPolicy, p.Charset)
+		}
+	case TypeHex, TypeBase64:
+		if p.Charset != "" {
+			return fmt.Errorf("%w: charset is only for a %s policy", ErrInvalidPolicy, TypePassword)
+		}
+	case TypeEd25519, TypeSecp256k1, TypeUUID:
+		if p.Length != 0 || p.Charset != "" {
+			return fmt.Errorf("%w: a %s policy takes no length or charset", ErrInvalidPolicy, p.Type)
+		}
+		return nil
+	case "":
+		return fmt.Errorf("%w: type required", ErrInvalidPolicy)
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPolicy, p.Type)
+	}
+	if n := p.length(); n < MinLength || n > MaxLength {
+		return fmt.Errorf("%w: length must be %d-%d", ErrInvalidPolicy, MinLength, MaxLength)
+	}
+	return nil
+}
+
+func (p Policy) length() int {
+	if p.Length == 0 {
+		return DefaultLength
+	}
+	return p.Length
+}
+
+func (p Policy) charset() string {
+	if p.Charset == "" {
+		return DefaultCharset
+	}
+	return p.Charset
+}
+
+// Generate makes a value by p. The caller zeroes Value.Secret once it is
+// sealed (and, if asked for, revealed).
+func Generate(p Policy) (*Value, error) {
+	if err := p.Check(); err != nil {
+		return nil, err
+	}
+	switch p.Type {
+	case TypePassword:
+		s, err := password(p.length(), charsets[p.charset()])
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Secret: s}, nil
+	case TypeHex, TypeBase64:
+		raw := make([]byte, p.length())
+		defer clear(raw)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		if p.Type == TypeHex {
+			out := make([]byte, hex.EncodedLen(len(raw)))
+			hex.Encode(out, raw)
+			return &Value{Secret: out}, nil
+		}
+		out := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+		base64.StdEncoding.Encode(out, raw)
+		return &Value{Secret: out}, nil
+	case TypeEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(priv)
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(der)
+		return &Value{Secret: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), PublicKey: hex.EncodeToString(pub)}, nil
+	case TypeSecp256k1:
+		priv, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		defer priv.Zero()
+		raw := priv.Serialize()
+		defer clear(raw)
+		out := make([]byte, hex.EncodedLen(len(raw)))
+		hex.Encode(out, raw)
+		return &Value{Secret: out, PublicKey: hex.EncodeToString(priv.PubKey().SerializeCompressed())}, nil
+	case TypeUUID:
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Secret: []byte(id.String())}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidPolicy, p.Type)
+}
+
+// password draws n characters uniformly from set: rand.Int rejects the
+// values that would bias a modulo.
+func password(n int, set string) ([]byte, error) {
+	out := make([]byte, n)
+	size := big.NewInt(int64(len(set)))
+	for i := range out {
+		k, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			clear(out)
+			return nil, err
+		}
+		out[i] = set[k.Int64()]
+	}
+	return out, nil
+}
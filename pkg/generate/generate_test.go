@@ -0,0 +1,88 @@
+package generate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/google/uuid"
+)
+
+func TestGenerateShapes(t *testing.T) {
+	v, err := Generate(Policy{Type: TypePassword})
+	if err != nil || len(v.Secret) != DefaultLength || strings.Trim(string(v.Secret), charsets["alnum"]) != "" {
+		t.Fatalf("default password %q: %v", v.Secret, err)
+	}
+	v, err = Generate(Policy{Type: TypePassword, Length: 64, Charset: "digits"})
+	if err != nil || len(v.Secret) != 64 || strings.Trim(string(v.Secret), "0123456789") != "" {
+		t.Fatalf("digits password %q: %v", v.Secret, err)
+	}
+	v, err = Generate(Policy{Type: TypeHex, Length: 16})
+	if raw, derr := hex.DecodeString(string(v.Secret)); err != nil || derr != nil || len(raw) != 16 {
+		t.Fatalf("hex %q: %v %v", v.Secret, err, derr)
+	}
+	v, err = Generate(Policy{Type: TypeBase64})
+	if raw, derr := base64.StdEncoding.DecodeString(string(v.Secret)); err != nil || derr != nil || len(raw) != DefaultLength {
+		t.Fatalf("base64 %q: %v %v", v.Secret, err, derr)
+	}
+	v, err = Generate(Policy{Type: TypeUUID})
+	if id, perr := uuid.Parse(string(v.Secret)); err != nil || perr != nil || id.Version() != 4 {
+		t.Fatalf("uuid %q: %v %v", v.Secret, err, perr)
+	}
+
+	v, err = Generate(Policy{Type: TypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(v.Secret)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	priv, ok := key.(ed25519.PrivateKey)
+	if err != nil || !ok || hex.EncodeToString(priv.Public().(ed25519.PublicKey)) != v.PublicKey {
+		t.Fatalf("ed25519: %v, public key %s", err, v.PublicKey)
+	}
+
+	v, err = Generate(Policy{Type: TypeSecp256k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := hex.DecodeString(string(v.Secret))
+	if err != nil || len(raw) != 32 {
+		t.Fatalf("secp256k1 %d bytes: %v", len(raw), err)
+	}
+	pub := secp256k1.PrivKeyFromBytes(raw).PubKey().SerializeCompressed()
+	if hex.EncodeToString(pub) != v.PublicKey {
+		t.Fatalf("secp256k1 public key %s, want %x", v.PublicKey, pub)
+	}
+}
+
+func TestGenerateIsRandom(t *testing.T) {
+	a, _ := Generate(Policy{Type: TypeHex})
+	b, _ := Generate(Policy{Type: TypeHex})
+	if bytes.Equal(a.Secret, b.Secret) {
+		t.Fatal("two generated values are equal")
+	}
+}
+
+func TestCheckRejectsBadPolicies(t *testing.T) {
+	for _, p := range []Policy{
+		{},
+		{Type: "rsa"},
+		{Type: TypePassword, Length: 8},
+		{Type: TypePassword, Length: MaxLength + 1},
+		{Type: TypePassword, Charset: "emoji"},
+		{Type: TypeHex, Charset: "alnum"},
+		{Type: TypeUUID, Length: 32},
+		{Type: TypeEd25519, Charset: "alnum"},
+	} {
+		if _, err := Generate(p); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%+v: err = %v, want ErrInvalidPolicy", p, err)
+		}
+	}
+}
@@ -143,6 +143,23 @@ const (
 	SchemeCKKS = "ckks"
 )
 
+type schemeKey struct{}
+
+// WithScheme returns a context that asks Encrypt and Decrypt for scheme
+// instead of their default. It rides the context so the Encryptor interface
+// (keys.Encryptor) stays one method per operation.
+func WithScheme(ctx context.Context, scheme string) context.Context {
+	return context.WithValue(ctx, schemeKey{}, scheme)
+}
+
+// SchemeFrom returns the scheme WithScheme put on ctx, or def.
+func SchemeFrom(ctx context.Context, def string) string {
+	if s, ok := ctx.Value(schemeKey{}).(string); ok && s != "" {
+		return s
+	}
+	return def
+}
+
 // Wallet is the response from GET /v1/wallets/{id}.
 //
 // EVMAddress is the canonical 20-byte EVM-runtime account address —
@@ -322,7 +339,7 @@ func (c *Client) do(ctx context.Context, method, url string, body []byte) (*http
 // Encrypt sends a threshold encrypt request via HTTP (T-Chain API).
 func (c *Client) Encrypt(ctx context.Context, keyID string, plaintext []byte) (*EncryptResult, error) {
 	url := fmt.Sprintf("%s/v1/fhe/encrypt", c.BaseURL)
-	body, err := json.Marshal(map[string]interface{}{"key_id": keyID, "plaintext": plaintext, "scheme": SchemeAESGCM})
+	body, err := json.Marshal(map[string]interface{}{"key_id": keyID, "plaintext": plaintext, "scheme": SchemeFrom(ctx, SchemeAESGCM)})
 	if err != nil {
 		return nil, fmt.Errorf("mpc: marshal encrypt request: %w", err)
 	}
@@ -344,7 +361,7 @@ func (c *Client) Encrypt(ctx context.Context, keyID string, plaintext []byte) (*
 // Decrypt sends a threshold decrypt request via HTTP (T-Chain API).
 func (c *Client) Decrypt(ctx context.Context, keyID string, ciphertext []byte) (*DecryptResult, error) {
 	url := fmt.Sprintf("%s/v1/fhe/decrypt", c.BaseURL)
-	body, err := json.Marshal(map[string]interface{}{"key_id": keyID, "ciphertext": ciphertext, "scheme": SchemeAESGCM})
+	body, err := json.Marshal(map[string]interface{}{"key_id": keyID, "ciphertext": ciphertext, "scheme": SchemeFrom(ctx, SchemeAESGCM)})
 	if err != nil {
 		return nil, fmt.Errorf("mpc: marshal decrypt request: %w", err)
 	}
@@ -182,6 +182,30 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestEncryptSchemeFromContext(t *testing.T) {
+	var schemes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Scheme string `json:"scheme"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		schemes = append(schemes, body.Scheme)
+		json.NewEncoder(w).Encode(EncryptResult{Scheme: body.Scheme})
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, "test-token")
+	if _, err := c.Encrypt(context.Background(), "k", []byte("x")); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := c.Encrypt(WithScheme(context.Background(), SchemeTFHE), "k", []byte("x")); err != nil {
+		t.Fatalf("encrypt tfhe: %v", err)
+	}
+	if len(schemes) != 2 || schemes[0] != SchemeAESGCM || schemes[1] != SchemeTFHE {
+		t.Errorf("schemes sent = %v, want [%s %s]", schemes, SchemeAESGCM, SchemeTFHE)
+	}
+}
+
 func TestAPIError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -233,13 +233,13 @@ func (c *ZapClient) Status(ctx context.Context) (*ClusterStatus, error) {
 }
 
 // Encrypt encrypts plaintext. Default: AES-256-GCM with ML-KEM wrapped DEK (fast, PQ-safe).
-// For threshold-gated reveal, use EncryptThreshold which uses TFHE.
+// For threshold-gated reveal, pass a context from WithScheme(ctx, SchemeTFHE).
 func (c *ZapClient) Encrypt(ctx context.Context, keyID string, plaintext []byte) (*EncryptResult, error) {
 	payload := struct {
 		KeyID     string `json:"key_id"`
 		Plaintext []byte `json:"plaintext"`
 		Scheme    string `json:"scheme"`
-	}{keyID, plaintext, SchemeAESGCM}
+	}{keyID, plaintext, SchemeFrom(ctx, SchemeAESGCM)}
 
 	data, err := c.call(ctx, OpEncrypt, payload)
 	if err != nil {
@@ -260,7 +260,7 @@ func (c *ZapClient) Decrypt(ctx context.Context, keyID string, ciphertext []byte
 		KeyID      string `json:"key_id"`
 		Ciphertext []byte `json:"ciphertext"`
 		Scheme     string `json:"scheme"`
-	}{keyID, ciphertext, ""} // empty = auto-detect from ciphertext
+	}{keyID, ciphertext, SchemeFrom(ctx, "")} // empty = auto-detect from ciphertext
 
 	data, err := c.call(ctx, OpDecrypt, payload)
 	if err != nil {
@@ -0,0 +1,382 @@
+// Package recovery is the last way back to a KMS whose keys are gone: an
+// offline kit that splits the REK keyring and the store's at-rest key into
+// k-of-n Shamir shares, each sealed to one named custodian's age recipient.
+//
+// Two losses end a KMS with no other way back. Without the MPC cluster,
+// mpcrek can never hand out the REK, so no sealed record opens again. Without
+// KMS_ENCRYPTION_KEY_B64 the store itself does not open. So while both keys are
+// still at hand, kms-recovery takes a kit. Each custodian keeps one file
+// offline, and any k-1 of them learn nothing about either key.
+//
+// A custodian's file is an age file. It decrypts (age -d) to one Share:
+//
+//	{"kit":"<64 hex>","custodian":"alice","index":1,"threshold":3,"shares":5,
+//	 "commitments":["<base64>",...],"share":"<base64>"}
+//
+// Every share commits to its value: commitment i is SHA-256 over a label, i
+// and share i. Every file carries the whole list, and the kit ID is SHA-256
+// over a label, the threshold and that list. The shares are random, so every
+// kit has its own ID even over the same keys. The ID is public.
+//
+// A server booting from shares is pinned to one kit ID (KMS_RECOVERY_UNSEAL)
+// and takes no other. Each share is checked on arrival: its commitment list
+// must hash to the pinned ID and its value must match its commitment. A
+// forged share is refused then, before it is stored, so it can neither hand
+// the server keys someone else chose nor spoil the honest shares already in.
+//
+// A kit is a copy of the keys as they were when it was taken. Take a new one
+// after every REK rotation and at-rest rekey, and destroy the old one.
+package recovery
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/luxfi/age"
+)
+
+// kitLabel prefixes what the kit ID hashes; shareLabel what a share's
+// commitment hashes.
+const (
+	kitLabel   = "kms/recovery/v1\x00"
+	shareLabel = "kms/recovery/v1/share\x00"
+)
+
+// keyLen is the size of the at-rest key and of each REK.
+const keyLen = 32
+
+var (
+	// ErrInvalidKit rejects a kit that cannot be taken as asked: a bad
+	// threshold, a custodian without a usable name or recipient, or keys that
+	// are not a keyring and an at-rest key.
+	ErrInvalidKit = errors.New("recovery: invalid kit")
+	// ErrWrongKit rejects a share from a kit other than the one being
+	// unsealed.
+	ErrWrongKit = errors.New("recovery: share is from another kit")
+	// ErrBadShare rejects a share that cannot be part of the kit: malformed,
+	// with commitments that are not the kit's, or with a value that does not
+	// match its commitment (forged or corrupted).
+	ErrBadShare = errors.New("recovery: malformed or forged share")
+	// ErrDuplicateShare rejects a share whose index or custodian is already
+	// in.
+	ErrDuplicateShare = errors.New("recovery: share already submitted")
+	// ErrQuorum is a quorum of checked shares that did not combine to a set
+	// of keys: the kit itself was damaged when it was taken. No share can
+	// cause it, and the shares are kept.
+	ErrQuorum = errors.New("recovery: shares do not recover the kit")
+)
+
+// Keys is what a kit recovers: the at-rest key, and the REK keyring as
+// store.NewKeyring takes it. It holds keys in the clear and is zeroed after
+// use.
+type Keys struct {
+	AtRestKey []byte            `json:"at_rest_key"`
+	REKEpoch  uint32            `json:"rek_epoch"`
+	REKs      map[uint32][]byte `json:"reks"`
+}
+
+// Zero wipes k's keys (best effort).
+func (k *Keys) Zero() {
+	if k == nil {
+		return
+	}
+	clear(k.AtRestKey)
+	for _, rek := range k.REKs {
+		clear(rek)
+	}
+}
+
+func (k *Keys) validate() error {
+	if len(k.AtRestKey) != keyLen {
+		return fmt.Errorf("%w: at-rest key is %d bytes, want %d", ErrInvalidKit, len(k.AtRestKey), keyLen)
+	}
+	if _, ok := k.REKs[k.REKEpoch]; !ok || k.REKEpoch == 0 {
+		return fmt.Errorf("%w: no REK for the current epoch %d", ErrInvalidKit, k.REKEpoch)
+	}
+	for epoch, rek := range k.REKs {
+		if epoch == 0 || len(rek) != keyLen {
+			return fmt.Errorf("%w: REK epoch %d is not %d bytes at a positive epoch", ErrInvalidKit, epoch, keyLen)
+		}
+	}
+	return nil
+}
+
+// secret is what a kit splits. Nonce keeps two kits of the same keys from
+// splitting the same bytes.
+type secret struct {
+	Nonce []byte `json:"nonce"`
+	Keys
+}
+
+// commitment is the public commitment to the share value at index.
+func commitment(index int, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(shareLabel))
+	h.Write([]byte{byte(index)})
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// kitID is the public name of the kit whose k-of-n shares have commitments,
+// in index order.
+func kitID(threshold int, commitments [][]byte) string {
+	h := sha256.New()
+	h.Write([]byte(kitLabel))
+	h.Write([]byte{byte(threshold), byte(len(commitments))})
+	for _, c := range commitments {
+		h.Write(c)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Custodian is a named holder of one share and the age recipient it is sealed
+// to: an X25519 (age1...) or post-quantum hybrid (age1pq1..., age1xw1...)
+// public key.
+type Custodian struct {
+	Name      string
+	Recipient string
+}
+
+// ParseCustodian reads a custodian spelled name=recipient.
+func ParseCustodian(s string) (Custodian, error) {
+	name, recipient, ok := strings.Cut(s, "=")
+	if !ok {
+		return Custodian{}, fmt.Errorf("%w: custodian %q is not name=recipient", ErrInvalidKit, s)
+	}
+	return Custodian{Name: strings.TrimSpace(name), Recipient: strings.TrimSpace(recipient)}, nil
+}
+
+// validName is what a custodian may be called. The name is also the share's
+// file name, so it is a plain path element.
+func validName(name string) bool {
+	if name == "" || len(name) > 64 || name[0] == '.' || name[0] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Share is one custodian's part of a kit, as their file decrypts.
+type Share struct {
+	Kit       string `json:"kit"`
+	Custodian string `json:"custodian"`
+	// Index is the share's point, 1..Shares.
+	Index     int `json:"index"`
+	Threshold int `json:"threshold"`
+	Shares    int `json:"shares"`
+	// Commitments is every share's commitment, in index order; the kit ID
+	// is their hash.
+	Commitments [][]byte `json:"commitments"`
+	Value       []byte   `json:"share"`
+}
+
+// check reports whether sh is a share of kit: its commitments hash to the
+// kit ID and its value matches its own.
+func (sh *Share) check(kit string) error {
+	if sh.Threshold < 2 || sh.Threshold > sh.Shares || sh.Shares > 255 || sh.Index < 1 || sh.Index > sh.Shares ||
+		len(sh.Value) == 0 || len(sh.Commitments) != sh.Shares {
+		return ErrBadShare
+	}
+	if kitID(sh.Threshold, sh.Commitments) != kit {
+		return fmt.Errorf("%w: its commitments are not the kit's", ErrBadShare)
+	}
+	if subtle.ConstantTimeCompare(commitment(sh.Index, sh.Value), sh.Commitments[sh.Index-1]) != 1 {
+		return fmt.Errorf("%w: its value does not match its commitment", ErrBadShare)
+	}
+	return nil
+}
+
+// SealedShare is a share sealed to its custodian's recipient: the bytes of
+// an age file.
+type SealedShare struct {
+	Custodian string
+	Age       []byte
+}
+
+// Split takes a kit of keys for custodians, any threshold of whom recover it.
+// It returns the kit ID and one sealed share per custodian, in their order.
+// Nothing of the keys leaves it unsealed.
+func Split(keys *Keys, custodians []Custodian, threshold int) (string, []SealedShare, error) {
+	if err := keys.validate(); err != nil {
+		return "", nil, err
+	}
+	n := len(custodians)
+	if threshold < 2 || threshold > n || n > 255 {
+		return "", nil, fmt.Errorf("%w: %d-of-%d is not a threshold (2 <= k <= n <= 255)", ErrInvalidKit, threshold, n)
+	}
+	recipients := make([]age.Recipient, n)
+	seen := make(map[string]bool, n)
+	for i, c := range custodians {
+		if !validName(c.Name) || seen[c.Name] {
+			return "", nil, fmt.Errorf("%w: custodian name %q is empty, repeated or not [A-Za-z0-9._-]", ErrInvalidKit, c.Name)
+		}
+		seen[c.Name] = true
+		if strings.ContainsAny(c.Recipient, "\r\n") {
+			return "", nil, fmt.Errorf("%w: custodian %s: one recipient per custodian", ErrInvalidKit, c.Name)
+		}
+		rs, err := age.ParseRecipients(strings.NewReader(c.Recipient))
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: custodian %s: %v", ErrInvalidKit, c.Name, err)
+		}
+		recipients[i] = rs[0]
+	}
+
+	s := secret{Nonce: make([]byte, 16), Keys: *keys}
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return "", nil, fmt.Errorf("recovery: rand: %w", err)
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", nil, err
+	}
+	defer clear(payload)
+	parts, err := split(payload, n, threshold)
+	if err != nil {
+		return "", nil, err
+	}
+	commitments := make([][]byte, n)
+	for i, part := range parts {
+		commitments[i] = commitment(i+1, part)
+	}
+	kit := kitID(threshold, commitments)
+
+	sealed := make([]SealedShare, n)
+	for i, c := range custodians {
+		share, err := json.Marshal(Share{
+			Kit:         kit,
+			Custodian:   c.Name,
+			Index:       i + 1,
+			Threshold:   threshold,
+			Shares:      n,
+			Commitments: commitments,
+			Value:       parts[i],
+		})
+		clear(parts[i])
+		if err != nil {
+			return "", nil, err
+		}
+		var out bytes.Buffer
+		w, err := age.Encrypt(&out, recipients[i])
+		if err == nil {
+			_, err = w.Write(share)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		clear(share)
+		if err != nil {
+			return "", nil, fmt.Errorf("recovery: sealing to %s: %w", c.Name, err)
+		}
+		sealed[i] = SealedShare{Custodian: c.Name, Age: out.Bytes()}
+	}
+	return kit, sealed, nil
+}
+
+// Unsealer gathers shares of one kit until a quorum is in. It is safe for
+// concurrent use.
+type Unsealer struct {
+	kit string
+
+	mu        sync.Mutex
+	threshold int
+	shares    map[int]Share
+}
+
+// NewUnsealer gathers shares of the kit with ID kit, and of no other.
+func NewUnsealer(kit string) (*Unsealer, error) {
+	if id, err := hex.DecodeString(kit); err != nil || len(id) != sha256.Size {
+		return nil, fmt.Errorf("%w: kit ID %q is not %d hex bytes", ErrInvalidKit, kit, sha256.Size)
+	}
+	return &Unsealer{kit: kit, shares: make(map[int]Share)}, nil
+}
+
+// Status is what an Unsealer has gathered: never the shares themselves.
+type Status struct {
+	Kit string `json:"kit"`
+	// Threshold is how many shares the kit needs; 0 until the first is in.
+	Threshold int      `json:"threshold"`
+	Received  []string `json:"received"`
+}
+
+// Status reports the custodians whose shares are in.
+func (u *Unsealer) Status() Status {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st := Status{Kit: u.kit, Threshold: u.threshold, Received: []string{}}
+	for _, sh := range u.shares {
+		st.Received = append(st.Received, sh.Custodian)
+	}
+	sort.Strings(st.Received)
+	return st
+}
+
+// Add takes one share. Until the quorum is in it returns nil keys. The share
+// that completes the quorum returns the keys the kit recovers; the caller
+// zeroes them. A share that does not check against the kit (Share.check) is
+// refused with ErrBadShare and leaves the shares already in as they are.
+func (u *Unsealer) Add(sh Share) (*Keys, error) {
+	if sh.Kit != u.kit {
+		return nil, ErrWrongKit
+	}
+	if err := sh.check(u.kit); err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, in := range u.shares {
+		if in.Index == sh.Index || in.Custodian == sh.Custodian {
+			return nil, ErrDuplicateShare
+		}
+	}
+	// The threshold is bound into the kit ID, so a checked share's is the
+	// kit's.
+	u.threshold = sh.Threshold
+	u.shares[sh.Index] = Share{Kit: sh.Kit, Custodian: sh.Custodian, Index: sh.Index, Threshold: sh.Threshold, Shares: sh.Shares, Value: bytes.Clone(sh.Value)}
+	if len(u.shares) < u.threshold {
+		return nil, nil
+	}
+
+	xs := make([]byte, 0, len(u.shares))
+	ys := make([][]byte, 0, len(u.shares))
+	for _, in := range u.shares {
+		xs = append(xs, byte(in.Index))
+		ys = append(ys, in.Value)
+	}
+	payload, err := combine(xs, ys)
+	if err != nil {
+		return nil, ErrQuorum
+	}
+	defer clear(payload)
+	var s secret
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, ErrQuorum
+	}
+	if err := s.Keys.validate(); err != nil {
+		s.Keys.Zero()
+		return nil, err
+	}
+	u.reset()
+	return &s.Keys, nil
+}
+
+// reset drops every share gathered. Called with u.mu held.
+func (u *Unsealer) reset() {
+	for _, sh := range u.shares {
+		clear(sh.Value)
+	}
+	u.shares = make(map[int]Share)
+	u.threshold = 0
+}
@@ -0,0 +1,203 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/luxfi/age"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("thirty-two bytes of secret value")
+	shares, err := split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every 3 of the 5 recover it; 2 do not.
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got, err := combine([]byte{byte(a + 1), byte(b + 1), byte(c + 1)}, [][]byte{shares[a], shares[b], shares[c]})
+				if err != nil || !bytes.Equal(got, secret) {
+					t.Fatalf("shares %d,%d,%d = %q, %v", a+1, b+1, c+1, got, err)
+				}
+			}
+		}
+	}
+	if got, _ := combine([]byte{1, 2}, shares[:2]); bytes.Equal(got, secret) {
+		t.Fatal("two shares of a 3-of-5 recovered the secret")
+	}
+	if _, err := combine([]byte{1, 1}, [][]byte{shares[0], shares[0]}); err == nil {
+		t.Fatal("combined the same point twice")
+	}
+	if _, err := split(secret, 3, 1); err == nil {
+		t.Fatal("split 1-of-3")
+	}
+	for a := 1; a < 256; a++ {
+		if mul(byte(a), inverse(byte(a))) != 1 {
+			t.Fatalf("inverse(%d) is not an inverse", a)
+		}
+	}
+}
+
+// kit splits fresh keys 2-of-3 for alice, bob and carol and returns the kit
+// ID, the keys, and each custodian's share as it decrypts.
+func kit(t *testing.T) (string, *Keys, []Share) {
+	t.Helper()
+	keys := &Keys{
+		AtRestKey: bytes.Repeat([]byte{1}, 32),
+		REKEpoch:  2,
+		REKs:      map[uint32][]byte{1: bytes.Repeat([]byte{2}, 32), 2: bytes.Repeat([]byte{3}, 32)},
+	}
+	var custodians []Custodian
+	var identities []age.Identity
+	for _, name := range []string{"alice", "bob", "carol"} {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := ParseCustodian(name + "=" + id.Recipient().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		custodians = append(custodians, c)
+		identities = append(identities, id)
+	}
+	id, sealed, err := Split(keys, custodians, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares := make([]Share, len(sealed))
+	for i, s := range sealed {
+		if s.Custodian != custodians[i].Name || bytes.Contains(s.Age, []byte(id)) {
+			t.Fatalf("sealed share %d for %s", i, s.Custodian)
+		}
+		// Only the custodian's own identity opens their file.
+		if _, err := age.Decrypt(bytes.NewReader(s.Age), identities[(i+1)%3]); err == nil {
+			t.Fatalf("%s's share opens under another custodian's identity", s.Custodian)
+		}
+		r, err := age.Decrypt(bytes.NewReader(s.Age), identities[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(r)
+		if err := json.Unmarshal(raw, &shares[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id, keys, shares
+}
+
+func TestUnsealFromQuorum(t *testing.T) {
+	id, keys, shares := kit(t)
+	u, err := NewUnsealer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := u.Add(shares[2]); got != nil || err != nil {
+		t.Fatalf("first share = %v, %v", got, err)
+	}
+	if _, err := u.Add(shares[2]); !errors.Is(err, ErrDuplicateShare) {
+		t.Fatalf("same share twice: %v", err)
+	}
+	if st := u.Status(); st.Threshold != 2 || len(st.Received) != 1 || st.Received[0] != "carol" {
+		t.Fatalf("status %+v", st)
+	}
+	got, err := u.Add(shares[0])
+	if err != nil || got == nil {
+		t.Fatalf("quorum = %v, %v", got, err)
+	}
+	if !bytes.Equal(got.AtRestKey, keys.AtRestKey) || got.REKEpoch != 2 || !bytes.Equal(got.REKs[1], keys.REKs[1]) || !bytes.Equal(got.REKs[2], keys.REKs[2]) {
+		t.Fatalf("recovered %+v", got)
+	}
+	if st := u.Status(); len(st.Received) != 0 {
+		t.Fatalf("shares kept after unseal: %+v", st)
+	}
+
+	// Another kit, even over the same keys, has its own ID and is refused.
+	other, _, _ := kit(t)
+	if other == id {
+		t.Fatal("two kits share an ID")
+	}
+	o, _ := NewUnsealer(other)
+	if _, err := o.Add(shares[0]); !errors.Is(err, ErrWrongKit) {
+		t.Fatalf("share from another kit: %v", err)
+	}
+
+	bad := shares[1]
+	bad.Index = 9
+	if _, err := u.Add(bad); !errors.Is(err, ErrBadShare) {
+		t.Fatalf("index past the kit: %v", err)
+	}
+}
+
+// TestUnsealOutlastsAForgedShare: a forged share arriving between honest
+// ones is refused as it comes in, and the unseal still succeeds.
+func TestUnsealOutlastsAForgedShare(t *testing.T) {
+	id, keys, shares := kit(t)
+	u, err := NewUnsealer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Add(shares[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupted value, a forged threshold, and commitments rewritten to
+	// fit the forged value are all refused, and leave alice's share in.
+	forged := shares[1]
+	forged.Value = bytes.Clone(forged.Value)
+	forged.Value[0] ^= 1
+	if _, err := u.Add(forged); !errors.Is(err, ErrBadShare) {
+		t.Fatalf("forged value: %v", err)
+	}
+	lying := shares[1]
+	lying.Threshold = 3
+	if _, err := u.Add(lying); !errors.Is(err, ErrBadShare) {
+		t.Fatalf("forged threshold: %v", err)
+	}
+	recommitted := forged
+	recommitted.Commitments = slices.Clone(forged.Commitments)
+	recommitted.Commitments[1] = commitment(2, forged.Value)
+	if _, err := u.Add(recommitted); !errors.Is(err, ErrBadShare) {
+		t.Fatalf("forged commitments: %v", err)
+	}
+	if st := u.Status(); len(st.Received) != 1 || st.Received[0] != "alice" {
+		t.Fatalf("status after forgeries = %+v", st)
+	}
+
+	got, err := u.Add(shares[2])
+	if err != nil || got == nil {
+		t.Fatalf("quorum after forgeries = %v, %v", got, err)
+	}
+	if !bytes.Equal(got.AtRestKey, keys.AtRestKey) || !bytes.Equal(got.REKs[2], keys.REKs[2]) {
+		t.Fatalf("recovered %+v", got)
+	}
+}
+
+func TestSplitRefusesABadKit(t *testing.T) {
+	id, _ := age.GenerateX25519Identity()
+	rcpt := id.Recipient().String()
+	keys := &Keys{AtRestKey: make([]byte, 32), REKEpoch: 1, REKs: map[uint32][]byte{1: make([]byte, 32)}}
+	for name, tc := range map[string]struct {
+		keys       *Keys
+		custodians []Custodian
+		threshold  int
+	}{
+		"threshold 1":      {keys, []Custodian{{"a", rcpt}, {"b", rcpt}}, 1},
+		"threshold over n": {keys, []Custodian{{"a", rcpt}, {"b", rcpt}}, 3},
+		"repeated name":    {keys, []Custodian{{"a", rcpt}, {"a", rcpt}}, 2},
+		"path name":        {keys, []Custodian{{"../a", rcpt}, {"b", rcpt}}, 2},
+		"bad recipient":    {keys, []Custodian{{"a", "age1nope"}, {"b", rcpt}}, 2},
+		"no current rek":   {&Keys{AtRestKey: make([]byte, 32), REKEpoch: 2, REKs: keys.REKs}, []Custodian{{"a", rcpt}, {"b", rcpt}}, 2},
+		"short at-rest":    {&Keys{AtRestKey: make([]byte, 16), REKEpoch: 1, REKs: keys.REKs}, []Custodian{{"a", rcpt}, {"b", rcpt}}, 2},
+	} {
+		if _, _, err := Split(tc.keys, tc.custodians, tc.threshold); !errors.Is(err, ErrInvalidKit) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
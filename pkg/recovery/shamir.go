@@ -0,0 +1,103 @@
+package recovery
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Shamir's secret sharing over GF(2^8) with the AES polynomial
+// x^8 + x^4 + x^3 + x + 1, one independent polynomial per secret byte. Share
+// i is the evaluation at x = i (1..n); the secret is the value at x = 0.
+//
+// The field arithmetic is branch- and table-free so that the time it takes
+// does not depend on the bytes it handles.
+
+// split cuts secret into n shares, any k of which recover it. shares[i] is
+// the share at x = i+1.
+func split(secret []byte, n, k int) ([][]byte, error) {
+	if k < 2 || k > n || n > 255 {
+		return nil, fmt.Errorf("recovery: %d-of-%d is not a threshold (2 <= k <= n <= 255)", k, n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("recovery: empty secret")
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	coeffs := make([]byte, k)
+	defer clear(coeffs)
+	for b, s := range secret {
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("recovery: rand: %w", err)
+		}
+		for i := range shares {
+			shares[i][b] = evaluate(coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// combine recovers the secret from shares ys taken at the distinct, non-zero
+// points xs. With fewer shares than the threshold it returns a value that is
+// not the secret; the caller has to check what it gets.
+func combine(xs []byte, ys [][]byte) ([]byte, error) {
+	if len(xs) == 0 || len(xs) != len(ys) {
+		return nil, errors.New("recovery: no shares to combine")
+	}
+	seen := make(map[byte]bool, len(xs))
+	for i, x := range xs {
+		if x == 0 || seen[x] || len(ys[i]) != len(ys[0]) {
+			return nil, errors.New("recovery: shares are not distinct points of one secret")
+		}
+		seen[x] = true
+	}
+	// Lagrange interpolation at 0: sum of y_j * prod_{m != j} x_m / (x_m - x_j).
+	secret := make([]byte, len(ys[0]))
+	for j := range xs {
+		basis := byte(1)
+		for m := range xs {
+			if m != j {
+				basis = mul(basis, mul(xs[m], inverse(xs[m]^xs[j])))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(ys[j][b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate is the polynomial with coefficients coeffs (constant first) at x.
+func evaluate(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// mul multiplies in GF(2^8).
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// inverse is a^254, the multiplicative inverse of a non-zero a in GF(2^8).
+func inverse(a byte) byte {
+	// a^254 = a^(2+4+8+16+32+64+128)
+	r := byte(1)
+	sq := a
+	for i := 1; i < 8; i++ {
+		sq = mul(sq, sq)
+		r = mul(r, sq)
+	}
+	return r
+}
@@ -0,0 +1,366 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A json-schema rule understands the part of JSON Schema that says what a
+// config document looks like:
+//
+//	type                       string, or an array of them
+//	enum, const
+//	properties, required, additionalProperties (a boolean or a schema)
+//	items (one schema), minItems, maxItems
+//	minLength, maxLength, pattern (RE2, unanchored, as JSON Schema has it)
+//	minimum, maximum
+//
+// and ignores the annotations $schema, $id, title, description, default and
+// examples. Any other keyword — $ref, oneOf, format and the rest — makes the
+// schema invalid rather than silently unchecked: a rule that looks stricter
+// than it is would be worse than none.
+
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+var jsonSchemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+// jsonSchema is one compiled (sub)schema. A nil *jsonSchema accepts anything.
+type jsonSchema struct {
+	types      []string
+	enum       []any
+	hasConst   bool
+	constant   any
+	properties map[string]*jsonSchema
+	required   []string
+	// additional is additionalProperties: nil allows any, noAdditional
+	// allows none, otherwise each extra property must match it.
+	additional   *jsonSchema
+	noAdditional bool
+	items        *jsonSchema
+	minItems     *int
+	maxItems     *int
+	minLength    *int
+	maxLength    *int
+	pattern      *regexp.Regexp
+	minimum      *float64
+	maximum      *float64
+}
+
+func compileJSONSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("schema is not JSON: %v", err)
+	}
+	return compileNode(doc, "")
+}
+
+func compileNode(doc any, at string) (*jsonSchema, error) {
+	if b, ok := doc.(bool); ok {
+		if b {
+			return nil, nil
+		}
+		// false: nothing is valid. An empty enum says the same.
+		return &jsonSchema{enum: []any{}}, nil
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema%s is not an object", where(at))
+	}
+	js := &jsonSchema{}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := obj[k]
+		bad := func() error { return fmt.Errorf("schema%s: %s has the wrong form", where(at), k) }
+		switch k {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				js.types = []string{t}
+			case []any:
+				for _, e := range t {
+					s, ok := e.(string)
+					if !ok {
+						return nil, bad()
+					}
+					js.types = append(js.types, s)
+				}
+			default:
+				return nil, bad()
+			}
+			for _, t := range js.types {
+				if !jsonSchemaTypes[t] {
+					return nil, fmt.Errorf("schema%s: unknown type %q", where(at), t)
+				}
+			}
+		case "enum":
+			e, ok := v.([]any)
+			if !ok {
+				return nil, bad()
+			}
+			js.enum = e
+		case "const":
+			js.hasConst, js.constant = true, v
+		case "properties":
+			props, ok := v.(map[string]any)
+			if !ok {
+				return nil, bad()
+			}
+			js.properties = make(map[string]*jsonSchema, len(props))
+			for name, sub := range props {
+				c, err := compileNode(sub, at+"/properties/"+name)
+				if err != nil {
+					return nil, err
+				}
+				js.properties[name] = c
+			}
+		case "required":
+			req, ok := v.([]any)
+			if !ok {
+				return nil, bad()
+			}
+			for _, e := range req {
+				s, ok := e.(string)
+				if !ok {
+					return nil, bad()
+				}
+				js.required = append(js.required, s)
+			}
+		case "additionalProperties":
+			if b, ok := v.(bool); ok {
+				js.noAdditional = !b
+				continue
+			}
+			c, err := compileNode(v, at+"/additionalProperties")
+			if err != nil {
+				return nil, err
+			}
+			js.additional = c
+		case "items":
+			if _, ok := v.([]any); ok {
+				return nil, fmt.Errorf("schema%s: items must be one schema, not a list", where(at))
+			}
+			c, err := compileNode(v, at+"/items")
+			if err != nil {
+				return nil, err
+			}
+			js.items = c
+		case "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := v.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+				return nil, bad()
+			}
+			i := int(n)
+			switch k {
+			case "minItems":
+				js.minItems = &i
+			case "maxItems":
+				js.maxItems = &i
+			case "minLength":
+				js.minLength = &i
+			case "maxLength":
+				js.maxLength = &i
+			}
+		case "pattern":
+			s, ok := v.(string)
+			if !ok || len(s) > maxPattern {
+				return nil, bad()
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("schema%s: pattern: %v", where(at), err)
+			}
+			js.pattern = re
+		case "minimum", "maximum":
+			n, ok := v.(float64)
+			if !ok {
+				return nil, bad()
+			}
+			if k == "minimum" {
+				js.minimum = &n
+			} else {
+				js.maximum = &n
+			}
+		default:
+			if !jsonSchemaAnnotations[k] {
+				return nil, fmt.Errorf("schema%s: keyword %q is not supported", where(at), k)
+			}
+		}
+	}
+	return js, nil
+}
+
+// validate returns why the JSON document value fails js, or "".
+func (js *jsonSchema) validate(value []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	var doc any
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return "not well-formed JSON"
+	}
+	if err := js.check(doc, ""); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// check reports the first way v, found at the JSON pointer at, fails js. It
+// names where and which keyword, never the offending value: the document is
+// a secret.
+func (js *jsonSchema) check(v any, at string) error {
+	if js == nil {
+		return nil
+	}
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("at %s: %s", pointer(at), fmt.Sprintf(format, args...))
+	}
+	if len(js.types) > 0 && !hasType(v, js.types) {
+		return fail("not of type %s", strings.Join(js.types, " or "))
+	}
+	if js.enum != nil && !containsJSON(js.enum, v) {
+		return fail("not one of the enum values")
+	}
+	if js.hasConst && !equalJSON(js.constant, v) {
+		return fail("not the const value")
+	}
+	switch t := v.(type) {
+	case string:
+		n := len([]rune(t))
+		if js.minLength != nil && n < *js.minLength {
+			return fail("shorter than minLength %d", *js.minLength)
+		}
+		if js.maxLength != nil && n > *js.maxLength {
+			return fail("longer than maxLength %d", *js.maxLength)
+		}
+		if js.pattern != nil && !js.pattern.MatchString(t) {
+			return fail("does not match pattern")
+		}
+	case float64:
+		if js.minimum != nil && t < *js.minimum {
+			return fail("less than minimum %s", formatNumber(*js.minimum))
+		}
+		if js.maximum != nil && t > *js.maximum {
+			return fail("greater than maximum %s", formatNumber(*js.maximum))
+		}
+	case []any:
+		if js.minItems != nil && len(t) < *js.minItems {
+			return fail("fewer than minItems %d", *js.minItems)
+		}
+		if js.maxItems != nil && len(t) > *js.maxItems {
+			return fail("more than maxItems %d", *js.maxItems)
+		}
+		for i, e := range t {
+			if err := js.items.check(e, at+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range js.required {
+			if _, ok := t[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub, known := js.properties[name]
+			switch {
+			case known:
+			case js.noAdditional:
+				return fail("property %q is not allowed", name)
+			default:
+				sub = js.additional
+			}
+			if err := sub.check(t[name], at+"/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v any, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]any); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := v.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsJSON(set []any, v any) bool {
+	for _, e := range set {
+		if equalJSON(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares two decoded JSON values. Numbers decode to float64, so
+// 1 and 1.0 are equal, as JSON Schema has it.
+func equalJSON(a, b any) bool { return reflect.DeepEqual(a, b) }
+
+func formatNumber(n float64) string { return strconv.FormatFloat(n, 'g', -1, 64) }
+
+func where(at string) string {
+	if at == "" {
+		return ""
+	}
+	return " " + at
+}
+
+func pointer(at string) string {
+	if at == "" {
+		return "/"
+	}
+	return at
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,341 @@
+// Package schema checks a secret value against the rules an operator set for
+// its path: that a TLS cert is a PEM certificate chain, an endpoint a URL, a
+// wallet seed a valid BIP-39 mnemonic, a config blob JSON matching a JSON
+// Schema, a token no shorter than 32 bytes.
+//
+// It only validates. Where schemas are kept and which apply to a write is the
+// store's business (store.SecretStore.SetSchema); a value that validates here
+// is not yet a value the store has accepted.
+package schema
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	bip39 "github.com/luxfi/go-bip39"
+)
+
+// Rule types.
+const (
+	// TypePEMCertificate: one or more PEM CERTIFICATE blocks (a chain), each
+	// a parseable X.509 certificate, and nothing else.
+	TypePEMCertificate = "pem-certificate"
+	// TypePEMPrivateKey: one unencrypted PEM private key — PKCS #8, PKCS #1
+	// or SEC 1 — and nothing else.
+	TypePEMPrivateKey = "pem-private-key"
+	// TypeURL: an absolute URL with a scheme and a host.
+	TypeURL = "url"
+	// TypeJSON: any well-formed JSON document.
+	TypeJSON = "json"
+	// TypeJSONSchema: a JSON document valid against the rule's schema; see
+	// jsonschema.go for the keywords understood.
+	TypeJSONSchema = "json-schema"
+	// TypeRegex: text the rule's pattern matches in full.
+	TypeRegex = "regex"
+	// TypeBIP39Mnemonic: a BIP-39 mnemonic with a valid checksum.
+	TypeBIP39Mnemonic = "bip39-mnemonic"
+	// TypeLength: only the rule's min_length and max_length, which any
+	// other type may carry too.
+	TypeLength = "length"
+)
+
+// Bounds on one schema. A schema says what a value must look like; it is not
+// a place to keep documents.
+const (
+	MaxBytes   = 64 << 10
+	MaxRules   = 64
+	maxPattern = 4096
+)
+
+// ErrInvalidSchema rejects a schema that is malformed or names something
+// this package does not know: an unknown type or JSON Schema keyword, a bad
+// pattern or glob, an impossible length range.
+var ErrInvalidSchema = errors.New("schema: invalid schema")
+
+// ErrInvalidValue is what every RuleError wraps, for callers that only need
+// to know a value was refused.
+var ErrInvalidValue = errors.New("schema: value rejected")
+
+// Schema is the rules for the secrets under one path.
+type Schema struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is one check. It applies to the secrets whose name matches Name, a
+// path.Match glob ("" and "*" match every name), and checks the value is of
+// Type and, when set, between MinLength and MaxLength bytes long.
+type Rule struct {
+	// ID names the rule in errors. Without one it is named by its position.
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// Pattern is the regular expression (RE2 syntax) of a regex rule. It
+	// must match the whole value.
+	Pattern string `json:"pattern,omitempty"`
+	// JSONSchema is the schema of a json-schema rule.
+	JSONSchema json.RawMessage `json:"schema,omitempty"`
+	MinLength  int             `json:"min_length,omitempty"`
+	MaxLength  int             `json:"max_length,omitempty"`
+}
+
+// RuleError is a value a rule refused. It names the rule, so the writer can
+// tell which of a path's rules to satisfy, and never quotes the value.
+type RuleError struct {
+	// Path is the path of the schema the rule belongs to; the store sets it.
+	Path string
+	// Rule is the rule's ID, or "#n" for the n-th rule (from 1) when it has
+	// none.
+	Rule   string
+	Type   string
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	where := ""
+	if e.Path != "" {
+		where = fmt.Sprintf(" of the schema at %q", e.Path)
+	}
+	return fmt.Sprintf("schema: value rejected by rule %s (%s)%s: %s", e.Rule, e.Type, where, e.Reason)
+}
+
+func (e *RuleError) Unwrap() error { return ErrInvalidValue }
+
+// Parse reads a schema document strictly — an unknown field is an error, not
+// something silently ignored — and checks it.
+func Parse(doc []byte) (*Schema, error) {
+	if len(doc) > MaxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidSchema, MaxBytes)
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	var s Schema
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data after the schema", ErrInvalidSchema)
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Check reports whether s is well formed, naming every bad rule.
+func (s *Schema) Check() error {
+	if len(s.Rules) == 0 {
+		return fmt.Errorf("%w: no rules", ErrInvalidSchema)
+	}
+	if len(s.Rules) > MaxRules {
+		return fmt.Errorf("%w: %d rules, at most %d", ErrInvalidSchema, len(s.Rules), MaxRules)
+	}
+	var bad []string
+	ids := make(map[string]bool, len(s.Rules))
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.ID != "" {
+			if ids[r.ID] {
+				bad = append(bad, fmt.Sprintf("rule %s: id given twice", r.label(i)))
+			}
+			ids[r.ID] = true
+		}
+		if err := r.check(); err != nil {
+			bad = append(bad, fmt.Sprintf("rule %s: %v", r.label(i), err))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, strings.Join(bad, "; "))
+	}
+	return nil
+}
+
+func (r *Rule) check() error {
+	if _, err := path.Match(r.Name, ""); err != nil {
+		return fmt.Errorf("name %q is not a valid glob", r.Name)
+	}
+	if r.MinLength < 0 || r.MaxLength < 0 || (r.MaxLength > 0 && r.MinLength > r.MaxLength) {
+		return fmt.Errorf("min_length %d and max_length %d are not a range", r.MinLength, r.MaxLength)
+	}
+	if r.Type != TypeRegex && r.Pattern != "" {
+		return fmt.Errorf("pattern is only for a %s rule", TypeRegex)
+	}
+	if r.Type != TypeJSONSchema && len(r.JSONSchema) > 0 {
+		return fmt.Errorf("schema is only for a %s rule", TypeJSONSchema)
+	}
+	switch r.Type {
+	case TypePEMCertificate, TypePEMPrivateKey, TypeURL, TypeJSON, TypeBIP39Mnemonic:
+	case TypeLength:
+		if r.MinLength == 0 && r.MaxLength == 0 {
+			return errors.New("a length rule needs min_length or max_length")
+		}
+	case TypeRegex:
+		if r.Pattern == "" || len(r.Pattern) > maxPattern {
+			return fmt.Errorf("a regex rule needs a pattern of 1-%d bytes", maxPattern)
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return err
+		}
+	case TypeJSONSchema:
+		if len(r.JSONSchema) == 0 {
+			return errors.New("a json-schema rule needs a schema")
+		}
+		if _, err := compileJSONSchema(r.JSONSchema); err != nil {
+			return err
+		}
+	case "":
+		return errors.New("type required")
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+	return nil
+}
+
+// label names rule i in errors.
+func (r *Rule) label(i int) string {
+	if r.ID != "" {
+		return strconv.Quote(r.ID)
+	}
+	return "#" + strconv.Itoa(i+1)
+}
+
+// Applies reports whether the rule checks the secret called name.
+func (r *Rule) Applies(name string) bool {
+	if r.Name == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Name, name)
+	return ok
+}
+
+// Validate checks value, the value of the secret called name, against every
+// rule that applies to it, in order, and returns a *RuleError for the first
+// it fails. s must have passed Check.
+func (s *Schema) Validate(name string, value []byte) error {
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if !r.Applies(name) {
+			continue
+		}
+		if reason := r.validate(value); reason != "" {
+			return &RuleError{Rule: r.label(i), Type: r.Type, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// validate returns why value fails the rule, or "".
+func (r *Rule) validate(value []byte) string {
+	if r.MinLength > 0 && len(value) < r.MinLength {
+		return fmt.Sprintf("shorter than %d bytes", r.MinLength)
+	}
+	if r.MaxLength > 0 && len(value) > r.MaxLength {
+		return fmt.Sprintf("longer than %d bytes", r.MaxLength)
+	}
+	switch r.Type {
+	case TypePEMCertificate:
+		return checkCertificates(value)
+	case TypePEMPrivateKey:
+		return checkPrivateKey(value)
+	case TypeURL:
+		return checkURL(value)
+	case TypeJSON:
+		if !json.Valid(value) {
+			return "not well-formed JSON"
+		}
+	case TypeJSONSchema:
+		js, err := compileJSONSchema(r.JSONSchema)
+		if err != nil {
+			return err.Error()
+		}
+		return js.validate(value)
+	case TypeRegex:
+		re, err := regexp.Compile(`^(?:` + r.Pattern + `)$`)
+		if err != nil {
+			return err.Error()
+		}
+		if !utf8.Valid(value) || !re.Match(value) {
+			return "does not match the pattern"
+		}
+	case TypeBIP39Mnemonic:
+		if !bip39.IsMnemonicValid(strings.Join(strings.Fields(string(value)), " ")) {
+			return "not a BIP-39 mnemonic with a valid checksum"
+		}
+	}
+	return ""
+}
+
+func checkCertificates(value []byte) string {
+	rest := value
+	n := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		n++
+		if block.Type != "CERTIFICATE" {
+			return fmt.Sprintf("PEM block %d is %q, not CERTIFICATE", n, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Sprintf("certificate %d does not parse: %v", n, err)
+		}
+	}
+	if n == 0 {
+		return "no PEM certificate"
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return "data after the last certificate"
+	}
+	return ""
+}
+
+func checkPrivateKey(value []byte) string {
+	block, rest := pem.Decode(value)
+	if block == nil {
+		return "no PEM private key"
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return "data after the private key"
+	}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return fmt.Sprintf("PEM block is %q, not an unencrypted PKCS #8, PKCS #1 or SEC 1 private key", block.Type)
+	}
+	if err != nil {
+		return fmt.Sprintf("private key does not parse: %v", err)
+	}
+	return ""
+}
+
+func checkURL(value []byte) string {
+	s := string(value)
+	if strings.TrimSpace(s) != s || strings.ContainsAny(s, " \t\r\n") {
+		return "a URL has no whitespace"
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "not a URL"
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "not an absolute URL with a scheme and a host"
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCertAndKey(t *testing.T) (cert, key string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "svc.internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pk}))
+}
+
+func TestBuiltInTypes(t *testing.T) {
+	cert, key := testCertAndKey(t)
+	mnemonic := strings.Repeat("abandon ", 11) + "about"
+	cases := []struct {
+		rule      Rule
+		good, bad []string
+	}{
+		{Rule{Type: TypePEMCertificate}, []string{cert, cert + cert + "\n"}, []string{"", key, cert + "trailing", "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"}},
+		{Rule{Type: TypePEMPrivateKey}, []string{key}, []string{cert, key + key, "not pem"}},
+		{Rule{Type: TypeURL}, []string{"https://api.example.com/v1", "postgres://u:p@db:5432/app"}, []string{"/relative", "example.com", "https://a b", " https://x"}},
+		{Rule{Type: TypeJSON}, []string{`{"a":1}`, `[]`, `"s"`}, []string{`{`, `{"a":1} x`}},
+		{Rule{Type: TypeRegex, Pattern: `[A-Z0-9]{8}`}, []string{"AB12CD34"}, []string{"AB12CD345", "xAB12CD34", "ab12cd34"}},
+		{Rule{Type: TypeBIP39Mnemonic}, []string{mnemonic, "  " + strings.ReplaceAll(mnemonic, " ", "\n") + "\n"}, []string{strings.Repeat("abandon ", 12), "not a mnemonic"}},
+		{Rule{Type: TypeLength, MinLength: 4, MaxLength: 6}, []string{"abcd", "abcdef"}, []string{"abc", "abcdefg"}},
+		{Rule{Type: TypeURL, MaxLength: 20}, []string{"https://a.example"}, []string{"https://a-much-longer-host.example"}},
+	}
+	for _, c := range cases {
+		s := &Schema{Rules: []Rule{c.rule}}
+		if err := s.Check(); err != nil {
+			t.Fatalf("%s: %v", c.rule.Type, err)
+		}
+		for _, v := range c.good {
+			if err := s.Validate("X", []byte(v)); err != nil {
+				t.Errorf("%s: %q rejected: %v", c.rule.Type, v, err)
+			}
+		}
+		for _, v := range c.bad {
+			err := s.Validate("X", []byte(v))
+			var re *RuleError
+			if !errors.As(err, &re) || !errors.Is(err, ErrInvalidValue) || re.Rule != "#1" || re.Type != c.rule.Type {
+				t.Errorf("%s: %q: err = %v, want a RuleError for rule #1", c.rule.Type, v, err)
+			}
+		}
+	}
+}
+
+func TestRulesSelectByNameAndNameTheRule(t *testing.T) {
+	s, err := Parse([]byte(`{"rules": [
+		{"id": "tls-cert", "name": "*_CERT", "type": "pem-certificate"},
+		{"name": "*_URL", "type": "url"},
+		{"type": "length", "max_length": 64}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate("API_URL", []byte("https://x.example")); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Validate("TLS_CERT", []byte("secret-not-a-cert"))
+	var re *RuleError
+	if !errors.As(err, &re) || re.Rule != `"tls-cert"` || strings.Contains(err.Error(), "secret-not-a-cert") {
+		t.Fatalf("cert rule: %v", err)
+	}
+	if err := s.Validate("DB_URL", []byte("nope")); !errors.As(err, &re) || re.Rule != "#2" {
+		t.Fatalf("url rule: %v", err)
+	}
+	if err := s.Validate("OTHER", []byte(strings.Repeat("x", 65))); !errors.As(err, &re) || re.Rule != "#3" {
+		t.Fatalf("length rule: %v", err)
+	}
+}
+
+func TestParseRejectsBadSchemas(t *testing.T) {
+	for _, doc := range []string{
+		`{"rules": []}`,
+		`{"rules": [{"type": "uuid"}]}`,
+		`{"rules": [{"type": ""}]}`,
+		`{"rules": [{"type": "url", "extra": 1}]}`,
+		`{"rules": [{"type": "regex"}]}`,
+		`{"rules": [{"type": "regex", "pattern": "("}]}`,
+		`{"rules": [{"type": "url", "pattern": "x"}]}`,
+		`{"rules": [{"type": "length"}]}`,
+		`{"rules": [{"type": "length", "min_length": 5, "max_length": 2}]}`,
+		`{"rules": [{"type": "url", "name": "["}]}`,
+		`{"rules": [{"id": "a", "type": "url"}, {"id": "a", "type": "json"}]}`,
+		`{"rules": [{"type": "json-schema"}]}`,
+		`{"rules": [{"type": "json-schema", "schema": {"oneOf": []}}]}`,
+		`{"rules": [{"type": "json-schema", "schema": {"type": "text"}}]}`,
+		`{"rules": [{"type": "url"}]} {}`,
+	} {
+		if _, err := Parse([]byte(doc)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: err = %v, want ErrInvalidSchema", doc, err)
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	s, err := Parse([]byte(`{"rules": [{"id": "db", "type": "json-schema", "schema": {
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["host", "port"],
+		"additionalProperties": false,
+		"properties": {
+			"host": {"type": "string", "minLength": 1, "pattern": "^[a-z0-9.-]+$"},
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"mode": {"enum": ["ro", "rw"]},
+			"replicas": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		}
+	}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate("DB", []byte(`{"host":"db.internal","port":5432,"mode":"ro","replicas":["a","b"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	for doc, want := range map[string]string{
+		`{"host":"db"}`:                                   `missing required property "port"`,
+		`{"host":"db","port":5432.5}`:                     "at /port: not of type integer",
+		`{"host":"db","port":70000}`:                      "at /port: greater than maximum 65535",
+		`{"host":"DB!","port":1}`:                         "at /host: does not match pattern",
+		`{"host":"db","port":1,"mode":"x"}`:               "at /mode: not one of the enum values",
+		`{"host":"db","port":1,"replicas":[1]}`:           "at /replicas/0: not of type string",
+		`{"host":"db","port":1,"replicas":["a","b","c"]}`: "at /replicas: more than maxItems 2",
+		`{"host":"db","port":1,"user":"root"}`:            `property "user" is not allowed`,
+		`[]`:                                              "at /: not of type object",
+		`{`:                                               "not well-formed JSON",
+	} {
+		err := s.Validate("DB", []byte(doc))
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), `"db"`) {
+			t.Errorf("%s: err = %v, want %q", doc, err, want)
+		}
+	}
+}
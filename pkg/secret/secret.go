@@ -14,6 +14,8 @@
 // listing from ever returning plaintext.
 package secret
 
+import "time"
+
 // Ref is a stored secret's full coordinate — the complete answer to "what is in
 // this store". It has no value field, so an enumeration is structurally
 // incapable of returning a secret, and it carries the path and env alongside
@@ -24,10 +26,64 @@ package secret
 // invariant: whatever a listing names, a read of that same coordinate must
 // find. A list that answers with bare names cannot honor it, because a name
 // alone does not say which path or which environment it came from.
+//
+// Meta, when the record has any, rides along in a listing. It describes the
+// record; it is not part of the coordinate, and a read ignores it.
 type Ref struct {
 	Path string `json:"path"`
 	Env  string `json:"env"`
 	Name string `json:"name"`
+	Meta *Meta  `json:"meta,omitempty"`
+}
+
+// Meta is what a human attaches to a secret to organise it: free-form labels,
+// a description, the owning team, and an optional expiry. It belongs to the
+// coordinate, not to one version — changing it writes no new version, and a
+// rollback does not bring back an old expiry. Like Ref it never carries the
+// value.
+type Meta struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	// ExpiresAt, when set, is when the secret stops being readable: from then
+	// on it reads as not-found (reason: expired) and the expiry sweeper moves
+	// it to the deleted set.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether m carries an expiry that is at or before now.
+func (m *Meta) Expired(now time.Time) bool {
+	return m != nil && m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// HasLabels reports whether m carries every label in want, with the same
+// value. An empty want matches everything.
+func (m *Meta) HasLabels(want map[string]string) bool {
+	for k, v := range want {
+		if m == nil {
+			return false
+		}
+		got, ok := m.Labels[k]
+		if !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Lock marks a secret immutable: while it is set the store refuses every
+// write, delete and metadata change of the coordinate, on every transport.
+// Only an admin unlock removes it; with TwoPerson set that takes a request
+// and an approval by two different identities.
+type Lock struct {
+	LockedBy  string    `json:"locked_by,omitempty"`
+	LockedAt  time.Time `json:"locked_at"`
+	Reason    string    `json:"reason,omitempty"`
+	TwoPerson bool      `json:"two_person,omitempty"`
+	// UnlockRequestedBy and UnlockRequestedAt record the first half of a
+	// two-person unlock, awaiting a second identity's approval.
+	UnlockRequestedBy string     `json:"unlock_requested_by,omitempty"`
+	UnlockRequestedAt *time.Time `json:"unlock_requested_at,omitempty"`
 }
 
 // Query selects a set of stored secrets. The ZERO Query selects every record:
@@ -45,4 +101,107 @@ type Query struct {
 	// store while another env held every record — indistinguishable, from the
 	// outside, from a store that is genuinely empty.
 	Env string
+
+	// Labels narrows the result to secrets carrying every one of these labels
+	// with exactly these values. Empty means no label filter.
+	Labels map[string]string
+
+	// Cursor resumes an enumeration after the last Ref of a previous page. It
+	// is opaque: pass back exactly what the previous page returned, with the
+	// same filters. "" starts at the beginning.
+	Cursor string
+
+	// Limit is the page size the caller wants. The server bounds it; 0 asks
+	// for the largest page it allows.
+	Limit int
+}
+
+// Version describes one stored version of a secret: its number, when it was
+// written and by whom. Like Ref it has no value field — a version listing
+// answers "what changed, when, and who did it" without ever reaching a secret.
+type Version struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// Deleted is a tombstoned secret: gone from listings and reads, but
+// recoverable until PurgeAt, when the purger removes it and its history for
+// good.
+type Deleted struct {
+	Ref
+	Version   int       `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by,omitempty"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// Promotion is one secret of a promote from one env to another, named by its
+// path and name (the envs are the request's). Action says what the promote
+// does to the destination: "create" when it has no such secret, "update" when
+// its value differs, "unchanged" when it already holds the same value.
+type Promotion struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// SourceVersion is the version copied from the source env.
+	SourceVersion int `json:"source_version"`
+	// TargetVersion is the destination's version before the promote; 0 when
+	// it had none.
+	TargetVersion int `json:"target_version,omitempty"`
+	// Version is the destination version the promote wrote; 0 on a dry run
+	// and for an unchanged secret.
+	Version int `json:"version,omitempty"`
+}
+
+// EnvDiff compares the secrets under one path in two envs, A and B. It names
+// secrets by path and name only — the env of each list is implied — and never
+// carries a value: "differ" is decided on the server.
+type EnvDiff struct {
+	Path string `json:"path"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+	// OnlyInA and OnlyInB are the secrets present in one env and not the
+	// other; Differ those in both whose values are not equal.
+	OnlyInA []DiffEntry `json:"only_in_a"`
+	OnlyInB []DiffEntry `json:"only_in_b"`
+	Differ  []DiffEntry `json:"differ"`
+	// Same counts the secrets in both envs with equal values.
+	Same int `json:"same"`
+}
+
+// DiffEntry is one secret of an EnvDiff.
+type DiffEntry struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// Imported is one secret of a bulk import and what the import did with it:
+// "created", "updated" (it existed and was overwritten) or "skipped" (it
+// existed and was left alone).
+type Imported struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// PreviousVersion is the version the name held before; 0 when it had
+	// none.
+	PreviousVersion int `json:"previous_version,omitempty"`
+	// Version is the version the import wrote; 0 when skipped.
+	Version int `json:"version,omitempty"`
+}
+
+// Change is one write as the change feed reports it: which coordinate, what
+// happened to it ("put", "delete" or "purge") and the version involved — the
+// version a put left live, or the one a delete or purge removed. Like Ref it
+// has no value field; a watcher that wants the new value reads it, under its
+// own authority, like any other read.
+//
+// Cursor resumes the feed just after this change. It is opaque.
+type Change struct {
+	Path    string    `json:"path"`
+	Env     string    `json:"env"`
+	Name    string    `json:"name"`
+	Op      string    `json:"op"`
+	Version int       `json:"version,omitempty"`
+	At      time.Time `json:"at"`
+	Cursor  string    `json:"cursor"`
 }
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// MaxBatch bounds one batch read. A service boots with tens of secrets, not
+// thousands; the cap keeps one request from opening the whole store into a
+// single response.
+const MaxBatch = 1000
+
+// ErrBatchTooLarge rejects a batch read of more than MaxBatch coordinates.
+var ErrBatchTooLarge = fmt.Errorf("store: batch larger than %d", MaxBatch)
+
+// GetMany reads the latest record of every ref in one read transaction, so
+// the answer is a consistent snapshot. A coordinate that cannot be read gets
+// its error at the same index (ErrSecretNotFound, ErrSecretExpired); only a
+// store failure fails the whole call.
+func (s *SecretStore) GetMany(refs []secret.Ref) ([]*Secret, []error, error) {
+	if len(refs) > MaxBatch {
+		return nil, nil, ErrBatchTooLarge
+	}
+	recs := make([]*Secret, len(refs))
+	errs := make([]error, len(refs))
+	now := time.Now()
+	err := s.db.View(func(txn *badger.Txn) error {
+		for i, ref := range refs {
+			rec, err := readVersion(txn, ref.Path, ref.Name, ref.Env, 0, now)
+			switch {
+			case err == nil:
+				recs[i] = rec
+			case errors.Is(err, ErrSecretNotFound):
+				errs[i] = err
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recs, errs, nil
+}
+
+// BatchItem is one answer of a SealedStore batch read. Err is set instead of
+// Value when that coordinate could not be read; the caller must zero Value.
+type BatchItem struct {
+	Ref     secret.Ref
+	Value   []byte
+	Version int
+	Err     error
+}
+
+// GetMany reads and opens the latest value of every ref; see
+// SecretStore.GetMany. A record that fails to open is reported on its item,
+// not as a failure of the batch.
+func (s *SealedStore) GetMany(refs []secret.Ref) ([]BatchItem, error) {
+	return s.GetManyContext(context.Background(), refs)
+}
+
+// GetManyContext is GetMany for a read on behalf of the principal on ctx
+// (WithPrincipal).
+func (s *SealedStore) GetManyContext(ctx context.Context, refs []secret.Ref) ([]BatchItem, error) {
+	recs, errs, err := s.secrets.GetMany(refs)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]BatchItem, len(refs))
+	for i, ref := range refs {
+		items[i] = BatchItem{Ref: secret.Ref{Path: ref.Path, Env: ref.Env, Name: ref.Name}, Err: errs[i]}
+		if errs[i] != nil {
+			continue
+		}
+		value, err := s.openRecord(ctx, recs[i])
+		if err != nil {
+			items[i].Err = err
+			continue
+		}
+		items[i].Value, items[i].Version = value, recs[i].Version
+	}
+	return items, nil
+}
+
+// GetMatching reads every secret q selects, as Find lists them. truncated is
+// true when more than MaxBatch matched; the items are then the first
+// MaxBatch and the caller should narrow q.
+func (s *SealedStore) GetMatching(q secret.Query) (items []BatchItem, truncated bool, err error) {
+	return s.GetMatchingContext(context.Background(), q)
+}
+
+// GetMatchingContext is GetMatching for a read on behalf of the principal on
+// ctx (WithPrincipal).
+func (s *SealedStore) GetMatchingContext(ctx context.Context, q secret.Query) (items []BatchItem, truncated bool, err error) {
+	q.Cursor, q.Limit = "", MaxBatch
+	refs, next, err := s.secrets.FindPage(q)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated = next != ""
+	items, err = s.GetManyContext(ctx, refs)
+	if err != nil {
+		return nil, false, err
+	}
+	return items, truncated, nil
+}
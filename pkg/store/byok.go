@@ -0,0 +1,157 @@
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/byok"
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+// ErrImportToken is a BYOK import token the store cannot use: never made,
+// made for another key, expired, or already used. They are not told apart.
+var ErrImportToken = errors.New("store: import token not found, expired or already used")
+
+// byokPrefix holds outstanding import keys: kms/byok/{token}. Each is sealed
+// as a transit key is, at the coordinate (byokPath, token, "") and version 1,
+// and re-wrapped with the rest (rewrapPrefixes). An import key is deleted
+// when it is used, whether or not its wrap opens, and when it is found
+// expired.
+var byokPrefix = []byte("kms/byok/")
+
+const byokPath = "byok"
+
+func byokKey(token string) []byte {
+	return []byte(string(byokPrefix) + token)
+}
+
+// CreateImportToken makes a one-time import key for the transit key name,
+// usable for ttl (0 is byok.DefaultTTL), and returns its public halves for a
+// partner to wrap key material to. Expired import keys are dropped on the
+// way.
+func (s *SealedStore) CreateImportToken(name string, ttl time.Duration) (*byok.PublicKeys, error) {
+	if !transit.ValidName(name) {
+		return nil, transit.ErrInvalidKey
+	}
+	now := time.Now()
+	k, err := byok.New(name, ttl, now)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Zero()
+	pub, err := k.Public()
+	if err != nil {
+		return nil, err
+	}
+	err = s.secrets.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(transitKey(name)); err == nil {
+			return ErrTransitKeyExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err := s.dropExpiredImportKeys(txn, now); err != nil {
+			return err
+		}
+		return s.putSealedJSON(txn, byokKey(k.Token), byokPath, k.Token, 1, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// ImportTransitKey consumes the import token made for name, unwraps the
+// material wrapped to it with alg, and keeps it as version 1 of the transit
+// key name as opts says. The token is spent by the attempt: a wrap that
+// does not open, or material the key type cannot take, needs a new token. A
+// name already taken, or a token made for another name, is refused before
+// the token is touched.
+func (s *SealedStore) ImportTransitKey(token, alg string, wrapped []byte, name string, opts transit.KeyOptions) (*transit.Info, error) {
+	if !transit.ValidName(name) {
+		return nil, transit.ErrInvalidKey
+	}
+	if id, err := hex.DecodeString(token); err != nil || len(id) != 16 {
+		return nil, ErrImportToken
+	}
+	var ik byok.ImportKey
+	var found bool
+	err := s.secrets.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(transitKey(name)); err == nil {
+			return ErrTransitKeyExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		err := s.getSealedJSON(txn, byokKey(token), &ik)
+		if errors.Is(err, ErrSecretNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ik.Name != name {
+			return nil
+		}
+		found = true
+		return txn.Delete(byokKey(token))
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer ik.Zero()
+	now := time.Now()
+	if !found || ik.Expired(now) {
+		return nil, ErrImportToken
+	}
+	material, err := ik.Unwrap(alg, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(material)
+	k, err := transit.ImportKey(name, opts, material, now)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Zero()
+	err = s.secrets.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(transitKey(name)); err == nil {
+			return ErrTransitKeyExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return s.putTransitKey(txn, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.Info(), nil
+}
+
+// dropExpiredImportKeys deletes, in txn, every import key expired at now.
+// One that does not open under the keyring is left for Rewrap to report.
+func (s *SealedStore) dropExpiredImportKeys(txn *badger.Txn, now time.Time) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = byokPrefix
+	it := txn.NewIterator(opts)
+	var expired [][]byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		var ik byok.ImportKey
+		if err := s.getSealedJSON(txn, key, &ik); err != nil {
+			continue
+		}
+		if ik.Expired(now) {
+			expired = append(expired, key)
+		}
+		ik.Zero()
+	}
+	it.Close()
+	for _, key := range expired {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/byok"
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+func TestImportTransitKeyIsSingleUse(t *testing.T) {
+	s := keyringStore(t, findTestStore(t), 1, map[uint32][]byte{1: newREK(t)})
+	if _, err := s.CreateTransitKey("taken", transit.KeyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateImportToken("taken", 0); !errors.Is(err, ErrTransitKeyExists) {
+		t.Fatalf("token for a taken name: %v", err)
+	}
+	pub, err := s.CreateImportToken("partner", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kemPub, _ := base64.StdEncoding.DecodeString(pub.MLKEM768)
+	material := bytes.Repeat([]byte{7}, 32)
+	wrapped, err := byok.WrapMLKEM(kemPub, pub.Token, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token made for another name is refused before it is spent.
+	if _, err := s.ImportTransitKey(pub.Token, byok.WrapMLKEM768, wrapped, "elsewhere", transit.KeyOptions{}); !errors.Is(err, ErrImportToken) {
+		t.Fatalf("import under another name: %v", err)
+	}
+
+	info, err := s.ImportTransitKey(pub.Token, byok.WrapMLKEM768, wrapped, "partner", transit.KeyOptions{})
+	if err != nil || info.LatestVersion != 1 || !info.Versions[0].Imported {
+		t.Fatalf("import = %+v, %v", info, err)
+	}
+	if err := s.UseTransitKey("partner", func(k *transit.Key) error {
+		if !bytes.Equal(k.Versions[0].Material, material) {
+			return errors.New("imported material differs")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.secrets.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(byokKey(pub.Token))
+		return err
+	}); !errors.Is(err, badger.ErrKeyNotFound) {
+		t.Fatalf("import key after use: %v", err)
+	}
+
+	// A wrap that does not open spends the token all the same.
+	pub2, _ := s.CreateImportToken("partner-3", 0)
+	if _, err := s.ImportTransitKey(pub2.Token, byok.WrapMLKEM768, wrapped, "partner-3", transit.KeyOptions{}); !errors.Is(err, byok.ErrInvalidWrap) {
+		t.Fatalf("wrap for another token: %v", err)
+	}
+	kemPub2, _ := base64.StdEncoding.DecodeString(pub2.MLKEM768)
+	good, _ := byok.WrapMLKEM(kemPub2, pub2.Token, material)
+	if _, err := s.ImportTransitKey(pub2.Token, byok.WrapMLKEM768, good, "partner-3", transit.KeyOptions{}); !errors.Is(err, ErrImportToken) {
+		t.Fatalf("token after a failed unwrap: %v", err)
+	}
+	if names, _ := s.TransitKeys(); len(names) != 2 {
+		t.Fatalf("transit keys %v, want taken and partner", names)
+	}
+}
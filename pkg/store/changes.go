@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// Change ops; see secret.Change.
+const (
+	// ChangePut: a new version is live — a put, rollback, undelete, promote
+	// or import.
+	ChangePut = "put"
+	// ChangeDelete: the secret was deleted, or swept after it expired;
+	// nothing is live at the coordinate.
+	ChangeDelete = "delete"
+	// ChangePurge: a deleted secret and its history are gone for good.
+	ChangePurge = "purge"
+)
+
+// ChangeLogSize is how many changes the log holds. A watcher that falls
+// further behind than this is told so (ErrChangesLost) rather than handed a
+// feed with a hole in it.
+const ChangeLogSize = 4096
+
+// MaxChanges bounds the changes one read of the log returns, whatever
+// Query.Limit asks for.
+const MaxChanges = 1000
+
+// ErrChangesLost is returned for a change cursor the log can no longer
+// continue: it is older than the oldest change still held, or was issued
+// before this process started. Changes were missed, so re-read what you
+// watch and resume from the cursor returned with the error.
+var ErrChangesLost = errors.New("store: changes since the cursor are no longer held; re-read and resume from the returned cursor")
+
+// ErrInvalidChangeCursor rejects a change cursor this log did not issue.
+var ErrInvalidChangeCursor = errors.New("store: invalid change cursor")
+
+// changeEntry is a change as the log holds it: the change, and the labels
+// the secret carried when it was written, which is what a watch's label
+// filter matches.
+type changeEntry struct {
+	change secret.Change
+	meta   *secret.Meta
+}
+
+// changeBatch collects the changes one transaction makes; see
+// SecretStore.update.
+type changeBatch struct {
+	entries []changeEntry
+}
+
+func (b *changeBatch) add(op, path, name, env string, version int) {
+	b.entries = append(b.entries, changeEntry{change: secret.Change{
+		Path: normalizePath(path), Env: env, Name: name, Op: op, Version: version,
+	}})
+}
+
+// label reads, inside the writing txn, the metadata each change leaves
+// behind. A purge has removed it, so a purge never matches a label filter;
+// the delete before it did.
+func (b *changeBatch) label(txn *badger.Txn) error {
+	for i := range b.entries {
+		c := b.entries[i].change
+		m, err := getMeta(txn, c.Path, c.Name, c.Env)
+		if err != nil {
+			return err
+		}
+		b.entries[i].meta = m
+	}
+	return nil
+}
+
+// update runs fn in one read-write transaction and, once it has committed,
+// publishes the changes fn recorded to the change log. Every write that
+// changes what is live — putVersion, tombstone, purge and undelete — records
+// itself in the batch it is handed, so no write can reach the store without
+// reaching the feed.
+func (s *SecretStore) update(fn func(txn *badger.Txn, feed *changeBatch) error) error {
+	var feed changeBatch
+	err := s.db.Update(func(txn *badger.Txn) error {
+		feed.entries = feed.entries[:0]
+		if err := fn(txn, &feed); err != nil {
+			return err
+		}
+		return feed.label(txn)
+	})
+	if err != nil {
+		return err
+	}
+	s.changes.publish(feed.entries, time.Now().UTC())
+	return nil
+}
+
+// Changes returns the store's change log.
+func (s *SecretStore) Changes() *ChangeLog { return s.changes }
+
+// ChangeLog is the feed of writes to a SecretStore: every put and delete, in
+// commit order, as coordinates and versions — never values. It lives in
+// memory and holds the last ChangeLogSize changes; a cursor names a change in
+// this process's log, so after a restart every old cursor is ErrChangesLost
+// and a watcher re-reads once, which is what it must do after any gap.
+//
+// Changes to different secrets committed at the same moment may be published
+// in either order; changes to one secret are published in version order, as
+// its writes conflict and commit one at a time.
+type ChangeLog struct {
+	mu sync.Mutex
+	// epoch tells this process's cursors from another's.
+	epoch string
+	// head is the sequence number of the latest change; 0 before the first.
+	head uint64
+	ring []changeEntry
+	// wake is closed, and replaced, whenever changes are published.
+	wake chan struct{}
+}
+
+func newChangeLog(size int) *ChangeLog {
+	epoch := make([]byte, 8)
+	if _, err := rand.Read(epoch); err != nil {
+		// A fixed epoch only weakens the restart check; the log still works.
+		epoch = []byte(strconv.FormatInt(time.Now().UnixNano(), 16))
+	}
+	return &ChangeLog{epoch: hex.EncodeToString(epoch), ring: make([]changeEntry, size), wake: make(chan struct{})}
+}
+
+func (l *ChangeLog) publish(entries []changeEntry, now time.Time) {
+	if len(entries) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range entries {
+		l.head++
+		e.change.At = now
+		e.change.Cursor = l.cursor(l.head)
+		l.ring[l.head%uint64(len(l.ring))] = e
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *ChangeLog) cursor(seq uint64) string {
+	return l.epoch + "." + strconv.FormatUint(seq, 10)
+}
+
+// Head returns the cursor of the latest change: a watch from it sees only
+// what is written next.
+func (l *ChangeLog) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cursor(l.head)
+}
+
+// Since returns the changes after q.Cursor that q selects by path, env and
+// labels, oldest first — at most q.Limit, bounded by MaxChanges — and the
+// cursor to continue from. An empty q.Cursor is the head: nothing yet. The
+// returned cursor moves past changes q does not select too, so a quiet
+// watch on a busy store does not re-scan them.
+func (l *ChangeLog) Since(q secret.Query) ([]secret.Change, string, error) {
+	changes, next, _, err := l.since(q)
+	return changes, next, err
+}
+
+// Wait is Since that blocks, until ctx is done, while there is nothing to
+// return. It returns no changes and the cursor to continue from when ctx ends
+// first.
+func (l *ChangeLog) Wait(ctx context.Context, q secret.Query) ([]secret.Change, string, error) {
+	for {
+		changes, next, wake, err := l.since(q)
+		if err != nil || len(changes) > 0 {
+			return changes, next, err
+		}
+		q.Cursor = next
+		select {
+		case <-ctx.Done():
+			return nil, next, nil
+		case <-wake:
+		}
+	}
+}
+
+// since is Since, also returning the channel that is closed when the next
+// changes are published, taken under the same lock so none is missed.
+func (l *ChangeLog) since(q secret.Query) ([]secret.Change, string, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	after := l.head
+	if q.Cursor != "" {
+		epoch, seqStr, ok := strings.Cut(q.Cursor, ".")
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if !ok || err != nil {
+			return nil, "", l.wake, ErrInvalidChangeCursor
+		}
+		if epoch != l.epoch {
+			return nil, l.cursor(l.head), l.wake, ErrChangesLost
+		}
+		if seq > l.head {
+			return nil, "", l.wake, ErrInvalidChangeCursor
+		}
+		after = seq
+	}
+	size := uint64(len(l.ring))
+	if l.head > size && after < l.head-size {
+		return nil, l.cursor(l.head), l.wake, ErrChangesLost
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > MaxChanges {
+		limit = MaxChanges
+	}
+	root := normalizePath(q.Path)
+	var changes []secret.Change
+	seq := after
+	for seq < l.head && len(changes) < limit {
+		seq++
+		e := l.ring[seq%size]
+		if q.Env != "" && e.change.Env != q.Env {
+			continue
+		}
+		if !underPath(root, e.change.Path) || !e.meta.HasLabels(q.Labels) {
+			continue
+		}
+		changes = append(changes, e.change)
+	}
+	return changes, l.cursor(seq), l.wake, nil
+}
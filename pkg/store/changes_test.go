@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+func TestChangesRecordEveryWrite(t *testing.T) {
+	s := sealedTestStore(t)
+	log := s.Secrets().Changes()
+	start := log.Head()
+
+	putValue(t, s, "svc", "A", "dev", "1")
+	putValue(t, s, "svc", "A", "dev", "2")
+	if _, err := s.Rollback("svc", "A", "dev", 1, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("svc", "A", "dev", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Secrets().Undelete("svc", "A", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("svc", "A", "dev", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Secrets().Purge("svc", "A", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Import(importEntries("B", "b"), ImportOptions{Path: "svc", Env: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Promote(PromoteOptions{Path: "svc", From: "dev", To: "main"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, next, err := log.Since(secret.Query{Cursor: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		op, env, name string
+		version       int
+	}{
+		{ChangePut, "dev", "A", 1},
+		{ChangePut, "dev", "A", 2},
+		{ChangePut, "dev", "A", 3},
+		{ChangeDelete, "dev", "A", 3},
+		{ChangePut, "dev", "A", 3},
+		{ChangeDelete, "dev", "A", 3},
+		{ChangePurge, "dev", "A", 3},
+		{ChangePut, "dev", "B", 1},
+		{ChangePut, "main", "B", 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		c := got[i]
+		if c.Op != w.op || c.Env != w.env || c.Name != w.name || c.Version != w.version || c.Path != "svc" {
+			t.Errorf("change %d = %+v, want %+v", i, c, w)
+		}
+	}
+	if next != got[len(got)-1].Cursor || next != log.Head() {
+		t.Fatalf("next = %q, last cursor %q, head %q", next, got[len(got)-1].Cursor, log.Head())
+	}
+	if more, _, _ := log.Since(secret.Query{Cursor: next}); len(more) != 0 {
+		t.Fatalf("changes after the head: %+v", more)
+	}
+}
+
+func TestChangesFilterByQuery(t *testing.T) {
+	s := sealedTestStore(t)
+	log := s.Secrets().Changes()
+	start := log.Head()
+	putValue(t, s, "svc/api", "A", "dev", "1")
+	putValue(t, s, "svc/api", "A", "main", "1")
+	putValue(t, s, "svcfoo", "A", "dev", "1")
+	if _, err := s.Put("svc", "TAGGED", "dev", []byte("1"), PutOptions{
+		Meta: &secret.Meta{Labels: map[string]string{"team": "pay"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := log.Since(secret.Query{Path: "svc", Env: "dev", Cursor: start})
+	if err != nil || len(got) != 2 || got[0].Path != "svc/api" || got[1].Name != "TAGGED" {
+		t.Fatalf("path+env filter: %+v, %v", got, err)
+	}
+	got, _, err = log.Since(secret.Query{Labels: map[string]string{"team": "pay"}, Cursor: start})
+	if err != nil || len(got) != 1 || got[0].Name != "TAGGED" {
+		t.Fatalf("label filter: %+v, %v", got, err)
+	}
+	got, next, err := log.Since(secret.Query{Cursor: start, Limit: 3})
+	if err != nil || len(got) != 3 || next != got[2].Cursor {
+		t.Fatalf("limit: %d changes, next %q, %v", len(got), next, err)
+	}
+}
+
+func TestChangesCursorErrors(t *testing.T) {
+	s := sealedTestStore(t)
+	log := s.Secrets().Changes()
+	start := log.Head()
+	for _, bad := range []string{"nonsense", log.cursor(log.head + 5)} {
+		if _, _, err := log.Since(secret.Query{Cursor: bad}); !errors.Is(err, ErrInvalidChangeCursor) {
+			t.Errorf("cursor %q: err = %v, want ErrInvalidChangeCursor", bad, err)
+		}
+	}
+	// A cursor from another process — the log restarted — lost changes.
+	if _, next, err := log.Since(secret.Query{Cursor: "0000000000000000.1"}); !errors.Is(err, ErrChangesLost) || next != log.Head() {
+		t.Fatalf("foreign cursor: next %q, err %v", next, err)
+	}
+	for i := 0; i < ChangeLogSize+1; i++ {
+		log.publish([]changeEntry{{change: secret.Change{Path: "svc", Env: "dev", Name: "N", Op: ChangePut}}}, time.Now())
+	}
+	if _, next, err := log.Since(secret.Query{Cursor: start}); !errors.Is(err, ErrChangesLost) || next != log.Head() {
+		t.Fatalf("overrun cursor: next %q, err %v", next, err)
+	}
+}
+
+func TestChangesWaitWakesOnAWrite(t *testing.T) {
+	s := sealedTestStore(t)
+	log := s.Secrets().Changes()
+	head := log.Head()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, next, err := log.Wait(ctx, secret.Query{Cursor: head})
+	if err != nil || len(got) != 0 || next != head {
+		t.Fatalf("quiet wait: %+v, %q, %v", got, next, err)
+	}
+
+	done := make(chan []secret.Change, 1)
+	go func() {
+		got, _, _ := log.Wait(context.Background(), secret.Query{Path: "svc", Cursor: head})
+		done <- got
+	}()
+	time.Sleep(10 * time.Millisecond)
+	putValue(t, s, "other", "X", "dev", "1") // not selected: keeps waiting
+	putValue(t, s, "svc", "A", "dev", "1")
+	select {
+	case got := <-done:
+		if len(got) != 1 || got[0].Path != "svc" || got[0].Name != "A" {
+			t.Fatalf("woke with %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not wake on a matching write")
+	}
+}
@@ -2,13 +2,28 @@ package store
 
 // AES-256-GCM Seal/Open helpers wrapping the generic SecretStore.
 //
-// This is the v1 envelope: master key (32 bytes, unsealed at boot) seals
-// every Secret's DEK with AES-256-GCM. The DEK seals the plaintext.
+// Every record's plaintext is sealed under a fresh per-secret DEK with
+// AES-256-GCM. What protects the DEK is the envelope version, the first byte
+// of WrappedDEK:
 //
-// v2 (tracked upstream in luxfi/crypto/xwing): replace the master→DEK wrap
-// with an ML-KEM-768 recipient-public-key encapsulation (`ModeStandard`
-// "aead+mlkem"), so the master key is PQ-wrapped at rest. The struct field
-// `WrappedDEK` is already shaped for that.
+//	v1 (0x01): AES-GCM(DEK) under the 32-byte master key (REK). Read, never
+//	           written by the store any more.
+//	v2 (0x02): the DEK encapsulated to an ML-KEM-768 recipient public key
+//	           (`ModeStandard` "aead+mlkem"). The recipient's decapsulation
+//	           key is itself sealed under the REK (see recipient.go), so the
+//	           REK alone still opens everything, and a record at rest is
+//	           PQ-wrapped. Read, never written.
+//	v3 (0x03): v2 with the REK epoch of its recipient in the header, so a
+//	           keyring holding several REKs (keyring.go) knows which one
+//	           opens it. Written by SealFor.
+//	v4 (0x04): v3 whose DEK wrap is bound to the record's path, env, name
+//	           and version (dekAAD), not its name alone: a wrapped DEK moved
+//	           to another coordinate or version no longer opens. Written by
+//	           the store.
+//
+// v1 and v2 name no epoch; they belong to LegacyEpoch. OpenWith and the
+// keyring read all four; SealedStore.Rewrap moves older records to v4 under
+// the current epoch without touching their payload ciphertext.
 //
 // Plaintext never leaves memory. The caller is responsible for zeroing
 // the returned byte slice when done.
@@ -17,39 +32,91 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
 )
 
-// envelopeVersion is the on-disk format version. Increment for breaking changes.
+// envelopeVersion is the on-disk format version of an AES-GCM envelope: the
+// payload of every record, and a v1 DEK wrap. Increment for breaking changes.
 const envelopeVersion byte = 0x01
 
+// wrapVersionMLKEM is the first byte of a v2 WrappedDEK:
+//
+//	0x02 || ML-KEM-768 ciphertext(1088) || AES-GCM envelope of the DEK
+//
+// The inner envelope is keyed by the encapsulated shared secret, AAD = name.
+const wrapVersionMLKEM byte = 0x02
+
+// wrapVersionEpoch is the first byte of a v3 WrappedDEK:
+//
+//	0x03 || epoch(4, big-endian) || ML-KEM-768 ciphertext(1088) || AES-GCM envelope of the DEK
+//
+// epoch names the REK epoch whose recipient the DEK is encapsulated to.
+const wrapVersionEpoch byte = 0x03
+
+// wrapVersionBound is the first byte of a v4 WrappedDEK, laid out as v3. The
+// inner envelope's AAD is dekAAD of the record instead of its name.
+const wrapVersionBound byte = 0x04
+
+// LegacyEpoch is the REK epoch of a record whose wrap names none (v1, v2):
+// the single REK a store was sealed under before keyrings.
+const LegacyEpoch uint32 = 1
+
 // ErrBadKey is returned when the master key is the wrong size.
 var ErrBadKey = errors.New("crypto: master key must be 32 bytes")
 
 // ErrBadEnvelope is returned when ciphertext layout is invalid.
 var ErrBadEnvelope = errors.New("crypto: invalid envelope")
 
+// ErrNoRecipient is returned when an ML-KEM envelope is sealed or opened
+// without its recipient key.
+var ErrNoRecipient = errors.New("crypto: envelope needs the ML-KEM recipient key")
+
 // Seal encrypts plaintext under a fresh per-secret DEK, then wraps the DEK
-// under the master key. Returns a Secret ready to Put into the store.
+// under the master key: the v1 envelope. The store writes v4; Seal remains
+// for records that must be readable by Open alone.
 //
 // Envelope layout for Ciphertext:
 //
 //	version(1) || nonce(12) || ciphertext_with_tag(variable)
 //	AAD = path + "/" + name + "/" + env
 //
-// WrappedDEK is AES-GCM(DEK, masterKey), same envelope shape, AAD=name.
+// WrappedDEK is AES-GCM(DEK, masterKey), same envelope shape, AAD=name: a v1
+// DEK can be moved between records of one name. The store writes v4, which
+// binds the whole coordinate.
 func Seal(masterKey []byte, path, name, env string, plaintext []byte) (*Secret, error) {
 	if len(masterKey) != 32 {
 		return nil, ErrBadKey
 	}
+	return seal(path, name, env, plaintext, func(dek []byte) ([]byte, error) {
+		return aeadSeal(masterKey, []byte(name), dek)
+	})
+}
+
+// SealFor encrypts plaintext under a fresh per-secret DEK and encapsulates
+// the DEK to r: the v3 envelope, tagged with r's epoch. Ciphertext is laid
+// out as in Seal.
+func SealFor(r *Recipient, path, name, env string, plaintext []byte) (*Secret, error) {
+	if r == nil {
+		return nil, ErrNoRecipient
+	}
+	return seal(path, name, env, plaintext, func(dek []byte) ([]byte, error) {
+		return r.wrap(wrapVersionEpoch, []byte(name), dek)
+	})
+}
 
+// seal is Seal and SealFor: wrap protects the DEK.
+func seal(path, name, env string, plaintext []byte, wrap func(dek []byte) ([]byte, error)) (*Secret, error) {
 	// Fresh 256-bit DEK per secret.
 	dek := make([]byte, 32)
 	if _, err := rand.Read(dek); err != nil {
 		return nil, fmt.Errorf("crypto: rand dek: %w", err)
 	}
+	defer clear(dek)
 
 	// Seal plaintext under DEK with AAD binding path/name/env.
 	aad := []byte(path + "/" + name + "/" + env)
@@ -58,56 +125,135 @@ func Seal(masterKey []byte, path, name, env string, plaintext []byte) (*Secret,
 		return nil, fmt.Errorf("crypto: seal plaintext: %w", err)
 	}
 
-	// Wrap DEK under master key, AAD binds the secret name (prevents swap).
-	wrap, err := aeadSeal(masterKey, []byte(name), dek)
+	wrapped, err := wrap(dek)
 	if err != nil {
 		return nil, fmt.Errorf("crypto: wrap dek: %w", err)
 	}
 
-	// Zero the DEK.
-	for i := range dek {
-		dek[i] = 0
-	}
-
 	now := time.Now().UTC()
 	return &Secret{
 		Name:       name,
 		Path:       path,
 		Env:        env,
 		Ciphertext: ct,
-		WrappedDEK: wrap,
+		WrappedDEK: wrapped,
 		Scheme:     ModeStandard,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}, nil
 }
 
-// Open inverts Seal. Returns plaintext on success.
+// Open inverts Seal. Returns plaintext on success; an ML-KEM record is
+// ErrNoRecipient (use OpenWith).
 // The caller must zero the returned slice after use.
 func Open(masterKey []byte, secret *Secret) ([]byte, error) {
+	return OpenWith(masterKey, nil, secret)
+}
+
+// OpenWith opens a record of any envelope version with one REK: v1 under
+// masterKey, v2, v3 and v4 with r, the recipient of their epoch. The caller
+// must zero the returned slice after use.
+func OpenWith(masterKey []byte, r *Recipient, secret *Secret) ([]byte, error) {
 	if len(masterKey) != 32 {
 		return nil, ErrBadKey
 	}
-	if secret == nil {
-		return nil, ErrBadEnvelope
+	k := &Keyring{reks: map[uint32][]byte{LegacyEpoch: masterKey}, recipients: map[uint32]*Recipient{}}
+	if r != nil {
+		k.reks[r.epoch] = masterKey
+		k.recipients[r.epoch] = r
+	}
+	return k.open(secret)
+}
+
+// wrapVersion reports the envelope version of a record's WrappedDEK; 0 for
+// a record with none.
+func wrapVersion(secret *Secret) byte {
+	if len(secret.WrappedDEK) == 0 {
+		return 0
 	}
+	return secret.WrappedDEK[0]
+}
 
-	dek, err := aeadOpen(masterKey, []byte(secret.Name), secret.WrappedDEK)
+// wrapEpoch reports the REK epoch a record's DEK is wrapped under.
+func wrapEpoch(secret *Secret) (uint32, error) {
+	if v := wrapVersion(secret); v != wrapVersionEpoch && v != wrapVersionBound {
+		return LegacyEpoch, nil
+	}
+	if len(secret.WrappedDEK) < 5 {
+		return 0, ErrBadEnvelope
+	}
+	return binary.BigEndian.Uint32(secret.WrappedDEK[1:5]), nil
+}
+
+// dekAAD is the AAD of a v4 DEK wrap: the record's normalized path, env and
+// name, each length-prefixed so no two coordinates encode alike, then its
+// version.
+func dekAAD(secret *Secret) []byte {
+	aad := []byte("kms/dek/v4")
+	for _, f := range []string{normalizePath(secret.Path), secret.Env, secret.Name} {
+		aad = binary.BigEndian.AppendUint32(aad, uint32(len(f)))
+		aad = append(aad, f...)
+	}
+	return binary.BigEndian.AppendUint64(aad, uint64(recordVersion(secret)))
+}
+
+// Recipient is the ML-KEM-768 keypair an epoch's envelopes encapsulate DEKs
+// to.
+type Recipient struct {
+	epoch uint32
+	pub   *mlkem768.PublicKey
+	priv  *mlkem768.PrivateKey
+}
+
+// GenerateRecipient makes a fresh recipient keypair for epoch from
+// crypto/rand.
+func GenerateRecipient(epoch uint32) (*Recipient, error) {
+	pub, priv, err := mlkem768.GenerateKeyPair(rand.Reader)
 	if err != nil {
-		return nil, fmt.Errorf("crypto: unwrap dek: %w", err)
+		return nil, fmt.Errorf("crypto: ml-kem keypair: %w", err)
 	}
-	defer func() {
-		for i := range dek {
-			dek[i] = 0
-		}
-	}()
+	return &Recipient{epoch: epoch, pub: pub, priv: priv}, nil
+}
 
-	aad := []byte(secret.Path + "/" + secret.Name + "/" + secret.Env)
-	pt, err := aeadOpen(dek, aad, secret.Ciphertext)
+// wrap encapsulates a shared secret to r and seals dek under it with aad, as
+// version v (v3 or v4).
+func (r *Recipient) wrap(v byte, aad, dek []byte) ([]byte, error) {
+	kemCT, ss, err := mlkem768.Scheme().Encapsulate(r.pub)
 	if err != nil {
-		return nil, fmt.Errorf("crypto: open plaintext: %w", err)
+		return nil, err
+	}
+	defer clear(ss)
+	inner, err := aeadSeal(ss, aad, dek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 5, 5+len(kemCT)+len(inner))
+	out[0] = v
+	binary.BigEndian.PutUint32(out[1:5], r.epoch)
+	out = append(out, kemCT...)
+	return append(out, inner...), nil
+}
+
+// unwrap inverts wrap, for a v2, v3 or v4 wrap. ML-KEM decapsulation never
+// fails on a bad ciphertext (it yields a pseudorandom secret); the AES-GCM
+// tag is what rejects one, or a wrong aad.
+func (r *Recipient) unwrap(aad, wrapped []byte) ([]byte, error) {
+	if r.priv == nil {
+		return nil, ErrNoRecipient
+	}
+	header := 1
+	if len(wrapped) > 0 && wrapped[0] != wrapVersionMLKEM {
+		header = 5
+	}
+	if len(wrapped) < header+mlkem768.CiphertextSize {
+		return nil, ErrBadEnvelope
+	}
+	ss, err := mlkem768.Scheme().Decapsulate(r.priv, wrapped[header:header+mlkem768.CiphertextSize])
+	if err != nil {
+		return nil, err
 	}
-	return pt, nil
+	defer clear(ss)
+	return aeadOpen(ss, aad, wrapped[header+mlkem768.CiphertextSize:])
 }
 
 // aeadSeal produces: version(1) || nonce(12) || ct||tag
@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"testing"
 )
 
@@ -81,3 +82,93 @@ func TestBadKeySize(t *testing.T) {
 		t.Errorf("open 16-byte key: got %v, want ErrBadKey", err)
 	}
 }
+
+func TestSealForOpenWithRoundTrip(t *testing.T) {
+	mk := make([]byte, 32)
+	rand.Read(mk)
+	r, err := GenerateRecipient(LegacyEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := SealFor(r, "/x", "K", "dev", []byte("v2 value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.WrappedDEK[0] != wrapVersionEpoch || secret.Scheme != ModeStandard {
+		t.Fatalf("envelope 0x%02x scheme %q", secret.WrappedDEK[0], secret.Scheme)
+	}
+	got, err := OpenWith(mk, r, secret)
+	if err != nil || string(got) != "v2 value" {
+		t.Fatalf("open v2 = %q, %v", got, err)
+	}
+	if _, err := Open(mk, secret); !errors.Is(err, ErrNoRecipient) {
+		t.Fatalf("Open of v2 without the recipient: %v", err)
+	}
+
+	// v1 records keep opening beside v2 ones.
+	v1, _ := Seal(mk, "/x", "K", "dev", []byte("v1 value"))
+	if got, err := OpenWith(mk, r, v1); err != nil || string(got) != "v1 value" {
+		t.Fatalf("open v1 = %q, %v", got, err)
+	}
+
+	other, _ := GenerateRecipient(LegacyEpoch)
+	if _, err := OpenWith(mk, other, secret); err == nil {
+		t.Fatal("a v2 record opened under another recipient")
+	}
+	b, _ := SealFor(r, "/x", "K2", "dev", []byte("v"))
+	b.WrappedDEK = secret.WrappedDEK
+	if _, err := OpenWith(mk, r, b); err == nil {
+		t.Fatal("expected cross-secret v2 DEK swap to fail, got nil")
+	}
+	secret.WrappedDEK[5] ^= 0xFF // inside the ML-KEM ciphertext
+	if _, err := OpenWith(mk, r, secret); err == nil {
+		t.Fatal("expected a tampered KEM ciphertext to fail, got nil")
+	}
+}
+
+// TestBoundDEKRefusesASplice: a v4 wrap opens only for the path, env, name
+// and version it was written for. A v3 wrap, bound to the name alone, moves.
+func TestBoundDEKRefusesASplice(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "svc/a", "API_KEY", "prod", "a1")
+	putValue(t, s, "svc/a", "API_KEY", "prod", "a2")
+	putValue(t, s, "svc/b", "API_KEY", "prod", "b")
+	putValue(t, s, "svc/a", "API_KEY", "dev", "dev")
+	record := func(path, env string, version int) *Secret {
+		t.Helper()
+		rec, err := s.Secrets().GetVersion(path, "API_KEY", env, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	src := record("svc/a", "prod", 1)
+	for what, dst := range map[string]*Secret{
+		"path":    record("svc/b", "prod", 0),
+		"env":     record("svc/a", "dev", 0),
+		"version": record("svc/a", "prod", 2),
+	} {
+		dst.WrappedDEK = src.WrappedDEK
+		if _, err := s.keys.unwrapDEK(dst); err == nil {
+			t.Errorf("a DEK spliced across %s unwrapped", what)
+		}
+	}
+	replayed := record("svc/a", "prod", 1)
+	replayed.Version = 2
+	if _, err := s.keys.open(replayed); err == nil {
+		t.Error("version 1 replayed as version 2 opened")
+	}
+
+	r := s.keys.recipients[LegacyEpoch]
+	a, _ := SealFor(r, "svc/a", "API_KEY", "prod", []byte("a"))
+	b, _ := SealFor(r, "svc/b", "API_KEY", "prod", []byte("b"))
+	b.WrappedDEK = a.WrappedDEK
+	if _, err := s.keys.unwrapDEK(b); err != nil {
+		t.Fatalf("v3 splice across paths: %v (v3 binds the name only)", err)
+	}
+
+	if _, err := s.Secrets().Rollback("svc/a", "API_KEY", "prod", 1, "", Precondition{}); !errors.Is(err, ErrNoRecipient) {
+		t.Fatalf("keyless rollback of a v4 record: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// ErrDiffTooLarge rejects a diff where one env holds more than a page of
+// secrets under the path: a partial diff would report secrets as missing
+// that are merely past the page. Narrow the path.
+var ErrDiffTooLarge = fmt.Errorf("store: more than %d secrets in one env of a diff", MaxPageSize)
+
+// Diff compares the live secrets under path in env a with those in env b.
+// Which secrets exist is answered by Find; whether two values differ by
+// comparing keyed digests of them, computed under a key drawn for this call
+// and discarded with it, so neither a value nor a digest that could be
+// matched against another call leaves the store. The values are compared in
+// one read transaction; a secret deleted between the listing and it counts as
+// differing. A threshold-reveal value is compared by Origin, never revealed:
+// it is the same only as a promoted copy of itself.
+func (s *SealedStore) Diff(path, a, b string) (*secret.EnvDiff, error) {
+	if !ValidCoord(a, "x") || !ValidCoord(b, "x") {
+		return nil, ErrInvalidCoord
+	}
+	inA, err := s.diffSide(path, a)
+	if err != nil {
+		return nil, err
+	}
+	inB, err := s.diffSide(path, b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &secret.EnvDiff{Path: path, A: a, B: b, OnlyInA: []secret.DiffEntry{}, OnlyInB: []secret.DiffEntry{}, Differ: []secret.DiffEntry{}}
+	var both []secret.DiffEntry
+	for _, e := range inA.order {
+		if inB.has[e] {
+			both = append(both, e)
+		} else {
+			d.OnlyInA = append(d.OnlyInA, e)
+		}
+	}
+	for _, e := range inB.order {
+		if !inA.has[e] {
+			d.OnlyInB = append(d.OnlyInB, e)
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("store: diff key: %w", err)
+	}
+	defer clear(key)
+	now := time.Now()
+	err = s.secrets.db.View(func(txn *badger.Txn) error {
+		for _, e := range both {
+			da, err := s.digestAt(txn, key, e, a, now)
+			if err != nil {
+				return err
+			}
+			db, err := s.digestAt(txn, key, e, b, now)
+			if err != nil {
+				return err
+			}
+			if hmac.Equal(da, db) {
+				d.Same++
+			} else {
+				d.Differ = append(d.Differ, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// diffSet is the secrets of one env of a diff, in listing order.
+type diffSet struct {
+	order []secret.DiffEntry
+	has   map[secret.DiffEntry]bool
+}
+
+func (s *SealedStore) diffSide(path, env string) (diffSet, error) {
+	refs, next, err := s.secrets.FindPage(secret.Query{Path: path, Env: env, Limit: MaxPageSize})
+	if err != nil {
+		return diffSet{}, err
+	}
+	if next != "" {
+		return diffSet{}, ErrDiffTooLarge
+	}
+	set := diffSet{order: make([]secret.DiffEntry, len(refs)), has: make(map[secret.DiffEntry]bool, len(refs))}
+	for i, ref := range refs {
+		e := secret.DiffEntry{Path: ref.Path, Name: ref.Name}
+		set.order[i], set.has[e] = e, true
+	}
+	return set, nil
+}
+
+// digestAt is the keyed digest of the latest value of e in env, read inside
+// txn. A secret deleted or expired since the listing digests as empty, which
+// differs from any value it had.
+func (s *SealedStore) digestAt(txn *badger.Txn, key []byte, e secret.DiffEntry, env string, now time.Time) ([]byte, error) {
+	mac := hmac.New(sha256.New, key)
+	rec, err := readVersion(txn, e.Path, e.Name, env, 0, now)
+	if errors.Is(err, ErrSecretNotFound) {
+		return mac.Sum(nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rec.Scheme == ModeThresholdReveal {
+		// Not revealed for a comparison: a threshold-reveal value is the
+		// same only as a copy of the same put (a promote), by Origin; a
+		// record from before Origin only as its own ciphertext.
+		mac.Write([]byte{2})
+		if rec.Origin != "" {
+			mac.Write([]byte(rec.Origin))
+		} else {
+			mac.Write(rec.Ciphertext)
+		}
+		return mac.Sum(nil), nil
+	}
+	value, err := s.openRecord(context.Background(), rec)
+	if err != nil {
+		return nil, err
+	}
+	mac.Write([]byte{1}) // present, so distinct from the absent digest even for ""
+	mac.Write(value)
+	clear(value)
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+func TestDiffReportsPresenceAndValueDifferences(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "svc", "SAME", "test", "v")
+	putValue(t, s, "svc", "SAME", "main", "v")
+	putValue(t, s, "svc", "CHANGED", "test", "new")
+	putValue(t, s, "svc", "CHANGED", "main", "old")
+	putValue(t, s, "svc/sub", "NEW", "test", "x")
+	putValue(t, s, "svc", "GONE", "main", "y")
+	putValue(t, s, "svc", "EMPTY", "test", "")
+	putValue(t, s, "svc", "EMPTY", "main", "")
+	putValue(t, s, "elsewhere", "NEW", "test", "not under svc")
+
+	d, err := s.Diff("svc", "test", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func(path, name string) []secret.DiffEntry { return []secret.DiffEntry{{Path: path, Name: name}} }
+	if !reflect.DeepEqual(d.OnlyInA, entry("svc/sub", "NEW")) {
+		t.Errorf("only in test = %v", d.OnlyInA)
+	}
+	if !reflect.DeepEqual(d.OnlyInB, entry("svc", "GONE")) {
+		t.Errorf("only in main = %v", d.OnlyInB)
+	}
+	if !reflect.DeepEqual(d.Differ, entry("svc", "CHANGED")) {
+		t.Errorf("differ = %v", d.Differ)
+	}
+	if d.Same != 2 {
+		t.Errorf("same = %d, want 2", d.Same)
+	}
+
+	if _, err := s.Diff("svc", "test", "a/b"); !errors.Is(err, ErrInvalidCoord) {
+		t.Fatalf("bad env: err = %v", err)
+	}
+}
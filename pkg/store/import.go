@@ -0,0 +1,172 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// Conflict modes of an import: what to do with a name that already holds a
+// live secret at the target path and env.
+const (
+	// ConflictFail refuses the whole import if any name exists. The default.
+	ConflictFail = "fail"
+	// ConflictSkip leaves existing secrets as they are and imports the rest.
+	ConflictSkip = "skip"
+	// ConflictOverwrite writes every name, existing ones as a new version.
+	ConflictOverwrite = "overwrite"
+)
+
+// Import actions; see secret.Imported.
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+)
+
+// ErrInvalidImport rejects an import before anything is read: a bad name, a
+// duplicate, an unknown conflict mode, or too many entries. The message names
+// every offending entry, so one round of fixes is enough.
+var ErrInvalidImport = errors.New("store: invalid import")
+
+// ErrImportConflict is returned, with nothing written, by a ConflictFail
+// import that meets names which already exist; it names them. It wraps
+// ErrPreconditionFailed, so transports answer it as a conflict.
+var ErrImportConflict = fmt.Errorf("%w: import names already exist", ErrPreconditionFailed)
+
+// ImportEntry is one secret to import.
+type ImportEntry struct {
+	Name  string
+	Value []byte
+}
+
+// ImportOptions is the target and policy of an import.
+type ImportOptions struct {
+	Path, Env string
+	// Conflict is ConflictFail (also ""), ConflictSkip or ConflictOverwrite.
+	Conflict string
+	// Writer is recorded on every version the import writes.
+	Writer string
+}
+
+// Import writes entries to opts.Path and opts.Env in one transaction. Every
+// name is checked with ValidCoord, and every value against the schemas at
+// opts.Path, first; one bad entry rejects the whole batch with
+// ErrInvalidImport before anything is written: a half-imported .env
+// is a service that boots with some of its configuration. Existing names are
+// handled by opts.Conflict. It returns what happened to each entry, in the
+// order given; the caller zeroes the values.
+func (s *SealedStore) Import(entries []ImportEntry, opts ImportOptions) ([]secret.Imported, error) {
+	if err := validateImport(entries, opts); err != nil {
+		return nil, err
+	}
+	if err := s.validateImportValues(entries, opts.Path); err != nil {
+		return nil, err
+	}
+	out := make([]secret.Imported, len(entries))
+	err := s.secrets.update(func(txn *badger.Txn, feed *changeBatch) error {
+		now := time.Now()
+		var conflicts []string
+		for i, e := range entries {
+			out[i] = secret.Imported{Name: e.Name, Action: ImportCreated}
+			cur, err := readVersion(txn, opts.Path, e.Name, opts.Env, 0, now)
+			switch {
+			case errors.Is(err, ErrSecretNotFound):
+				continue
+			case err != nil:
+				return err
+			}
+			out[i].PreviousVersion = recordVersion(cur)
+			switch opts.Conflict {
+			case ConflictSkip:
+				out[i].Action = ImportSkipped
+			case ConflictOverwrite:
+				// An import writes standard records; it does not quietly
+				// take a threshold-reveal secret out of its mode.
+				if cur.Scheme == ModeThresholdReveal {
+					return fmt.Errorf("%w: %q is a threshold-reveal secret; write it with a put", ErrInvalidImport, e.Name)
+				}
+				out[i].Action = ImportUpdated
+			default:
+				conflicts = append(conflicts, e.Name)
+			}
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: %s (use conflict=skip or conflict=overwrite)", ErrImportConflict, strings.Join(conflicts, ", "))
+		}
+		for i, e := range entries {
+			if out[i].Action == ImportSkipped {
+				continue
+			}
+			rec, err := s.sealRecord(opts.Path, e.Name, opts.Env, e.Value)
+			if err != nil {
+				return err
+			}
+			rec.CreatedBy = opts.Writer
+			err = putVersion(txn, feed, rec, Precondition{})
+			rec.dropDEK()
+			if err != nil {
+				return err
+			}
+			out[i].Version = rec.Version
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func validateImport(entries []ImportEntry, opts ImportOptions) error {
+	switch opts.Conflict {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite:
+	default:
+		return fmt.Errorf("%w: conflict must be fail, skip or overwrite, got %q", ErrInvalidImport, opts.Conflict)
+	}
+	if !ValidCoord(opts.Env, "x") {
+		return fmt.Errorf("%w: env %q is not a valid env", ErrInvalidImport, opts.Env)
+	}
+	if len(entries) > MaxBatch {
+		return fmt.Errorf("%w: %d entries, at most %d in one import", ErrInvalidImport, len(entries), MaxBatch)
+	}
+	var bad []string
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		switch {
+		case !ValidCoord(opts.Env, e.Name):
+			bad = append(bad, fmt.Sprintf("%q (not a valid name)", e.Name))
+		case seen[e.Name]:
+			bad = append(bad, fmt.Sprintf("%q (given twice)", e.Name))
+		}
+		seen[e.Name] = true
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidImport, strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// validateImportValues checks every value against the schemas at path and
+// names each entry that fails, with the rule it fails.
+func (s *SealedStore) validateImportValues(entries []ImportEntry, path string) error {
+	schemas, err := s.secrets.Schemas(path)
+	if err != nil || len(schemas) == 0 {
+		return err
+	}
+	var bad []string
+	for _, e := range entries {
+		if err := validateValue(schemas, e.Name, e.Value); err != nil {
+			bad = append(bad, fmt.Sprintf("%q: %v", e.Name, err))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidImport, strings.Join(bad, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func importEntries(kv ...string) []ImportEntry {
+	var out []ImportEntry
+	for i := 0; i+1 < len(kv); i += 2 {
+		out = append(out, ImportEntry{Name: kv[i], Value: []byte(kv[i+1])})
+	}
+	return out
+}
+
+func TestImportConflictModes(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "svc", "EXISTING", "dev", "old")
+	batch := importEntries("NEW", "n", "EXISTING", "new")
+
+	_, err := s.Import(batch, ImportOptions{Path: "svc", Env: "dev"})
+	if !errors.Is(err, ErrImportConflict) || !errors.Is(err, ErrPreconditionFailed) || !strings.Contains(err.Error(), "EXISTING") {
+		t.Fatalf("fail mode: err = %v", err)
+	}
+	if _, err := s.Get("svc", "NEW", "dev"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("a failed import wrote NEW: %v", err)
+	}
+
+	got, err := s.Import(batch, ImportOptions{Path: "svc", Env: "dev", Conflict: ConflictSkip})
+	if err != nil || got[0].Action != ImportCreated || got[1].Action != ImportSkipped || got[1].PreviousVersion != 1 {
+		t.Fatalf("skip mode: %+v, %v", got, err)
+	}
+	if v, _ := s.Get("svc", "EXISTING", "dev"); string(v) != "old" {
+		t.Fatalf("skip overwrote EXISTING: %q", v)
+	}
+
+	got, err = s.Import(batch, ImportOptions{Path: "svc", Env: "dev", Conflict: ConflictOverwrite, Writer: "iam:ops"})
+	if err != nil || got[0].Action != ImportUpdated || got[1].Action != ImportUpdated || got[1].Version != 2 {
+		t.Fatalf("overwrite mode: %+v, %v", got, err)
+	}
+	if v, _ := s.Get("svc", "EXISTING", "dev"); string(v) != "new" {
+		t.Fatalf("overwrite left EXISTING = %q", v)
+	}
+}
+
+func TestImportRejectsWholeBatchOnABadName(t *testing.T) {
+	s := sealedTestStore(t)
+	batch := importEntries("GOOD", "g", "bad/name", "x", " padded", "y")
+	_, err := s.Import(batch, ImportOptions{Path: "svc", Env: "dev", Conflict: ConflictOverwrite})
+	if !errors.Is(err, ErrInvalidImport) || !strings.Contains(err.Error(), "bad/name") || !strings.Contains(err.Error(), "padded") {
+		t.Fatalf("err = %v, want ErrInvalidImport naming both bad entries", err)
+	}
+	if _, err := s.Get("svc", "GOOD", "dev"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("the valid entry of a rejected batch was written: %v", err)
+	}
+	if _, err := s.Import(importEntries("A", "1"), ImportOptions{Env: "dev", Conflict: "merge"}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("unknown conflict mode: err = %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownEpoch is returned for a record wrapped under a REK epoch the
+// keyring does not hold: the epoch was dropped before every record had been
+// re-wrapped off it.
+var ErrUnknownEpoch = errors.New("store: record is wrapped under a REK epoch the keyring does not hold")
+
+// ErrBadKeyring rejects a keyring NewKeyring cannot use.
+var ErrBadKeyring = errors.New("store: invalid REK keyring")
+
+// Keyring holds the REKs a SealedStore opens records under, by epoch. New
+// writes seal under the current epoch; the others are held only so records
+// not yet re-wrapped stay readable while RunRewrap moves them. An epoch can be
+// dropped from the keyring once RewrapStatus reports none of its records
+// remain.
+//
+// Each epoch has its own ML-KEM-768 recipient, its decapsulation key sealed
+// under that epoch's REK (recipient.go), so a DEK re-wrapped onto a new epoch
+// is no longer reachable with the old REK.
+type Keyring struct {
+	current uint32
+	// reks are held by reference, not copied: the caller owns their
+	// lifetime, and Zero wipes them at shutdown.
+	reks map[uint32][]byte
+	// recipients are loaded by NewSealedStoreWithKeyring. An epoch with a
+	// REK but no recipient has only v1 records.
+	recipients map[uint32]*Recipient
+}
+
+// NewKeyring builds a keyring from reks, by epoch, sealing under current.
+// Epochs start at 1 (LegacyEpoch, the REK a store used before keyrings);
+// every REK is 32 bytes, and current must be among them.
+func NewKeyring(current uint32, reks map[uint32][]byte) (*Keyring, error) {
+	if _, ok := reks[current]; !ok {
+		return nil, fmt.Errorf("%w: no REK for the current epoch %d", ErrBadKeyring, current)
+	}
+	k := &Keyring{current: current, reks: make(map[uint32][]byte, len(reks)), recipients: make(map[uint32]*Recipient)}
+	for epoch, rek := range reks {
+		if epoch == 0 {
+			return nil, fmt.Errorf("%w: epochs start at 1", ErrBadKeyring)
+		}
+		if len(rek) != 32 {
+			return nil, ErrBadKey
+		}
+		k.reks[epoch] = rek
+	}
+	return k, nil
+}
+
+// Current is the epoch new writes seal under.
+func (k *Keyring) Current() uint32 { return k.current }
+
+// Epochs lists the epochs the keyring holds, oldest first.
+func (k *Keyring) Epochs() []uint32 {
+	out := make([]uint32, 0, len(k.reks))
+	for epoch := range k.reks {
+		out = append(out, epoch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Zero wipes every REK the keyring holds (best effort). Call it at shutdown.
+func (k *Keyring) Zero() {
+	if k == nil {
+		return
+	}
+	for _, rek := range k.reks {
+		clear(rek)
+	}
+}
+
+func (k *Keyring) rek(epoch uint32) ([]byte, error) {
+	rek, ok := k.reks[epoch]
+	if !ok {
+		return nil, fmt.Errorf("%w: epoch %d", ErrUnknownEpoch, epoch)
+	}
+	return rek, nil
+}
+
+func (k *Keyring) recipient(epoch uint32) (*Recipient, error) {
+	if _, err := k.rek(epoch); err != nil {
+		return nil, err
+	}
+	r := k.recipients[epoch]
+	if r == nil {
+		return nil, fmt.Errorf("%w: epoch %d", ErrNoRecipient, epoch)
+	}
+	return r, nil
+}
+
+// seal seals a value for (path, name, env) under the current epoch. The
+// record leaves with its DEK pending: a v4 wrap binds the version, which
+// putVersion has yet to give it (bindDEK).
+func (k *Keyring) seal(path, name, env string, value []byte) (*Secret, error) {
+	r, err := k.recipient(k.current)
+	if err != nil {
+		return nil, err
+	}
+	var dek []byte
+	rec, err := seal(path, name, env, value, func(d []byte) ([]byte, error) {
+		dek = append([]byte(nil), d...)
+		return nil, nil
+	})
+	if err != nil {
+		clear(dek)
+		return nil, err
+	}
+	rec.pending = &pendingWrap{r: r, dek: dek}
+	return rec, nil
+}
+
+// rebind gives rec, a copy of old about to be written as a new version, old's
+// DEK pending a v4 wrap under the current epoch: the copy's coordinate and
+// version are not the ones old's wrap is bound to.
+func (k *Keyring) rebind(old, rec *Secret) error {
+	if isLegacyUnsealed(old) || old.Scheme != ModeStandard {
+		return nil
+	}
+	r, err := k.recipient(k.current)
+	if err != nil {
+		return err
+	}
+	dek, err := k.unwrapDEK(old)
+	if err != nil {
+		return err
+	}
+	rec.WrappedDEK, rec.pending = nil, &pendingWrap{r: r, dek: dek}
+	return nil
+}
+
+// pendingWrap is the DEK of a record sealed but not yet written.
+type pendingWrap struct {
+	r   *Recipient
+	dek []byte
+}
+
+// bindDEK wraps a pending DEK as v4, bound to rec as it now stands, and
+// zeroes it. putVersion calls it once the record has its version; a record
+// with nothing pending is left as it is.
+func (rec *Secret) bindDEK() error {
+	p := rec.pending
+	if p == nil {
+		return nil
+	}
+	defer rec.dropDEK()
+	wrapped, err := p.r.wrap(wrapVersionBound, dekAAD(rec), p.dek)
+	if err != nil {
+		return err
+	}
+	rec.WrappedDEK = wrapped
+	return nil
+}
+
+// dropDEK zeroes a pending DEK that will not be bound: the write refused
+// the record before putVersion reached it.
+func (rec *Secret) dropDEK() {
+	if rec.pending != nil {
+		clear(rec.pending.dek)
+		rec.pending = nil
+	}
+}
+
+// open opens a record of any envelope version under the epoch it names.
+func (k *Keyring) open(secret *Secret) ([]byte, error) {
+	if secret == nil {
+		return nil, ErrBadEnvelope
+	}
+	dek, err := k.unwrapDEK(secret)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: unwrap dek: %w", err)
+	}
+	defer clear(dek)
+
+	aad := []byte(secret.Path + "/" + secret.Name + "/" + secret.Env)
+	pt, err := aeadOpen(dek, aad, secret.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: open plaintext: %w", err)
+	}
+	return pt, nil
+}
+
+// unwrapDEK recovers a record's DEK by its envelope version and epoch.
+func (k *Keyring) unwrapDEK(secret *Secret) ([]byte, error) {
+	epoch, err := wrapEpoch(secret)
+	if err != nil {
+		return nil, err
+	}
+	switch wrapVersion(secret) {
+	case wrapVersionMLKEM, wrapVersionEpoch:
+		r, err := k.recipient(epoch)
+		if err != nil {
+			return nil, err
+		}
+		return r.unwrap([]byte(secret.Name), secret.WrappedDEK)
+	case wrapVersionBound:
+		r, err := k.recipient(epoch)
+		if err != nil {
+			return nil, err
+		}
+		return r.unwrap(dekAAD(secret), secret.WrappedDEK)
+	}
+	rek, err := k.rek(epoch)
+	if err != nil {
+		return nil, err
+	}
+	return aeadOpen(rek, []byte(secret.Name), secret.WrappedDEK)
+}
+
+// stale reports whether rec is a sealed record whose DEK is not wrapped the
+// way the keyring writes today (v4 under the current epoch), and the epoch it
+// is wrapped under.
+func (k *Keyring) stale(rec *Secret) (uint32, bool, error) {
+	if isLegacyUnsealed(rec) || rec.Scheme != ModeStandard {
+		return 0, false, nil
+	}
+	epoch, err := wrapEpoch(rec)
+	if err != nil {
+		return 0, false, err
+	}
+	return epoch, wrapVersion(rec) != wrapVersionBound || epoch != k.current, nil
+}
+
+// rewrap moves rec's DEK to the current epoch in place, as v4 bound to rec's
+// coordinate and version; the payload ciphertext is untouched.
+func (k *Keyring) rewrap(rec *Secret) error {
+	dek, err := k.unwrapDEK(rec)
+	if err != nil {
+		return err
+	}
+	defer clear(dek)
+	r, err := k.recipient(k.current)
+	if err != nil {
+		return err
+	}
+	wrapped, err := r.wrap(wrapVersionBound, dekAAD(rec), dek)
+	if err != nil {
+		return err
+	}
+	rec.WrappedDEK = wrapped
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newREK(t *testing.T) []byte {
+	t.Helper()
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func keyringStore(t *testing.T, secrets *SecretStore, current uint32, reks map[uint32][]byte) *SealedStore {
+	t.Helper()
+	k, err := NewKeyring(current, reks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSealedStoreWithKeyring(secrets, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func recordEpoch(t *testing.T, s *SealedStore, path, name, env string) uint32 {
+	t.Helper()
+	rec, err := s.Secrets().Get(path, name, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch, err := wrapEpoch(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return epoch
+}
+
+func TestKeyringRotatesOnline(t *testing.T) {
+	secrets := findTestStore(t)
+	rek1, rek2 := newREK(t), newREK(t)
+	old := keyringStore(t, secrets, 1, map[uint32][]byte{1: rek1})
+	writeV1(t, old, "svc", "LEGACY", "prod", "v1 value")
+	putValue(t, old, "svc", "API_KEY", "prod", "epoch 1 value")
+
+	s := keyringStore(t, secrets, 2, map[uint32][]byte{1: rek1, 2: rek2})
+	putValue(t, s, "svc", "NEW", "prod", "epoch 2 value")
+	if e := recordEpoch(t, s, "svc", "NEW", "prod"); e != 2 {
+		t.Fatalf("new write sealed under epoch %d, want 2", e)
+	}
+	if v, err := s.Get("svc", "API_KEY", "prod"); err != nil || string(v) != "epoch 1 value" {
+		t.Fatalf("epoch 1 record through the keyring = %q, %v", v, err)
+	}
+	if _, err := keyringStore(t, secrets, 2, map[uint32][]byte{2: rek2}).Get("svc", "API_KEY", "prod"); !errors.Is(err, ErrUnknownEpoch) {
+		t.Fatalf("epoch 1 dropped too early: err = %v, want ErrUnknownEpoch", err)
+	}
+
+	// LEGACY and API_KEY, each latest + history.
+	n, err := s.Rewrap()
+	if err != nil || n != 4 {
+		t.Fatalf("Rewrap = %d, %v; want 4", n, err)
+	}
+	p := s.RewrapStatus()
+	if p.Running || p.Epoch != 2 || p.Rewrapped != 4 || len(p.Remaining) != 0 || p.FinishedAt == nil {
+		t.Fatalf("status = %+v", p)
+	}
+
+	dropped := keyringStore(t, secrets, 2, map[uint32][]byte{2: rek2})
+	for name, want := range map[string]string{"LEGACY": "v1 value", "API_KEY": "epoch 1 value", "NEW": "epoch 2 value"} {
+		if e := recordEpoch(t, dropped, "svc", name, "prod"); e != 2 {
+			t.Fatalf("%s under epoch %d after the re-wrap", name, e)
+		}
+		if v, err := dropped.Get("svc", name, "prod"); err != nil || string(v) != want {
+			t.Fatalf("%s without epoch 1 = %q, %v", name, v, err)
+		}
+	}
+	if v, _, err := dropped.GetVersion("svc", "API_KEY", "prod", 1); err != nil || string(v) != "epoch 1 value" {
+		t.Fatalf("history without epoch 1 = %q, %v", v, err)
+	}
+}
+
+func TestRunRewrapThrottlesAndReportsWhatItCannotMove(t *testing.T) {
+	secrets := findTestStore(t)
+	rek1, rek2, rek3 := newREK(t), newREK(t), newREK(t)
+	one := keyringStore(t, secrets, 1, map[uint32][]byte{1: rek1})
+	for i := 0; i < rewrapBatch; i++ {
+		putValue(t, one, "bulk", fmt.Sprintf("K%03d", i), "dev", "v")
+	}
+	two := keyringStore(t, secrets, 2, map[uint32][]byte{1: rek1, 2: rek2})
+	putValue(t, two, "svc", "TWO", "dev", "v")
+
+	// Epoch 3 holds epoch 2 but not epoch 1: the 2*rewrapBatch epoch-1
+	// records stay put, and are reported.
+	s := keyringStore(t, secrets, 3, map[uint32][]byte{2: rek2, 3: rek3})
+	var logs []string
+	s.RunRewrap(context.Background(), 1, func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) })
+	p := s.RewrapStatus()
+	if p.Rewrapped != 2 || p.Remaining[1] != 2*rewrapBatch || len(p.Remaining) != 1 || len(logs) != 2 {
+		t.Fatalf("status = %+v, logs = %q", p, logs)
+	}
+	if e := recordEpoch(t, s, "svc", "TWO", "dev"); e != 3 {
+		t.Fatalf("TWO under epoch %d, want 3", e)
+	}
+
+	all := keyringStore(t, secrets, 3, map[uint32][]byte{1: rek1, 2: rek2, 3: rek3})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := all.runRewrap(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled run: %v", err)
+	}
+	if p := all.RewrapStatus(); p.Rewrapped != rewrapBatch || p.Remaining[1] != rewrapBatch {
+		t.Fatalf("a cancelled run stops between batches: %+v", p)
+	}
+	if n, err := all.Rewrap(); err != nil || n != rewrapBatch || len(all.RewrapStatus().Remaining) != 0 {
+		t.Fatalf("resumed run = %d, %v", n, err)
+	}
+}
+
+func TestKeyringRejectsAWrongREK(t *testing.T) {
+	secrets := findTestStore(t)
+	rek1, rek2 := newREK(t), newREK(t)
+	s := keyringStore(t, secrets, 2, map[uint32][]byte{1: rek1, 2: rek2})
+	putValue(t, s, "svc", "K", "dev", "v")
+
+	k, _ := NewKeyring(2, map[uint32][]byte{1: rek1, 2: newREK(t)})
+	if _, err := NewSealedStoreWithKeyring(secrets, k); err == nil {
+		t.Fatal("a keyring with another REK for epoch 2 opened its recipient")
+	}
+	for _, reks := range []map[uint32][]byte{{1: rek1}, {0: rek1, 2: rek2}, {2: rek2[:16]}} {
+		if _, err := NewKeyring(2, reks); err == nil {
+			t.Errorf("NewKeyring(2, %d keys) accepted", len(reks))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// ErrLocked refuses a write, delete or metadata change of a locked secret. It
+// wraps ErrPreconditionFailed, so every transport answers it as a conflict.
+var ErrLocked = fmt.Errorf("%w: secret is locked (an admin must unlock it first)", ErrPreconditionFailed)
+
+// ErrNotLocked is returned by Unlock for a secret that carries no lock.
+var ErrNotLocked = errors.New("store: secret is not locked")
+
+// ErrSameApprover refuses the approval of a two-person unlock by the identity
+// that requested it.
+var ErrSameApprover = errors.New("store: a two-person unlock needs a second identity to approve it")
+
+// ErrInvalidLock refuses a lock the store could not keep: one on a secret
+// whose metadata carries an expiry, which would delete it behind the lock's
+// back.
+var ErrInvalidLock = errors.New("store: invalid lock")
+
+// UnlockApprovalWindow is how long the request half of a two-person unlock
+// waits for its approval. A later unlock after it lapses is a new request.
+const UnlockApprovalWindow = 24 * time.Hour
+
+// lockPrefix holds locks: kms/locks/{path}/{env}/{name}. Like metadata a lock
+// belongs to the coordinate, not a version; unlike metadata no ordinary write
+// can change it. A locked secret cannot be deleted, so its lock never outlives
+// it.
+var lockPrefix = []byte("kms/locks/")
+
+func lockKey(path, name, env string) []byte {
+	return []byte(fmt.Sprintf("%s%s/%s/%s", lockPrefix, normalizePath(path), env, name))
+}
+
+func getLock(txn *badger.Txn, path, name, env string) (*secret.Lock, error) {
+	item, err := txn.Get(lockKey(path, name, env))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l secret.Lock
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &l)
+	}); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func setLock(txn *badger.Txn, path, name, env string, l *secret.Lock) error {
+	raw, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return txn.Set(lockKey(path, name, env), raw)
+}
+
+// checkUnlocked is the lock check every write path makes inside its txn:
+// putVersion, tombstone and SetMeta refuse a locked coordinate, so no
+// transport and no batch operation can reach around it.
+func checkUnlocked(txn *badger.Txn, path, name, env string) error {
+	l, err := getLock(txn, path, name, env)
+	if err != nil {
+		return err
+	}
+	if l != nil {
+		return ErrLocked
+	}
+	return nil
+}
+
+// checkLockable refuses a lock on a coordinate whose metadata would expire it.
+func checkLockable(txn *badger.Txn, path, name, env string) error {
+	m, err := getMeta(txn, path, name, env)
+	if err != nil {
+		return err
+	}
+	if m != nil && m.ExpiresAt != nil {
+		return fmt.Errorf("%w: the secret has an expiry; clear expires_at before locking it", ErrInvalidLock)
+	}
+	return nil
+}
+
+// Lock locks the live secret at (path, name, env). A secret already locked is
+// ErrLocked: a second lock must not be able to swap a two-person lock for a
+// one-person one.
+func (s *SecretStore) Lock(path, name, env string, l secret.Lock) error {
+	l.UnlockRequestedBy, l.UnlockRequestedAt = "", nil
+	if l.LockedAt.IsZero() {
+		l.LockedAt = time.Now().UTC()
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := getRecord(txn, secretKey(path, name, env)); err != nil {
+			return err
+		}
+		if err := checkUnlocked(txn, path, name, env); err != nil {
+			return err
+		}
+		if err := checkLockable(txn, path, name, env); err != nil {
+			return err
+		}
+		return setLock(txn, path, name, env, &l)
+	})
+}
+
+// Locked returns the lock of (path, name, env); nil when there is none.
+func (s *SecretStore) Locked(path, name, env string) (*secret.Lock, error) {
+	var l *secret.Lock
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		l, err = getLock(txn, path, name, env)
+		return err
+	})
+	return l, err
+}
+
+// Unlock removes the lock of (path, name, env) on behalf of by, and returns
+// the lock that remains: nil once the secret is unlocked. A TwoPerson lock
+// takes two calls by different identities within UnlockApprovalWindow — the
+// first records the request and returns the lock with it, the second
+// approves and removes it; the requester approving is ErrSameApprover. The
+// caller audits each call; the store checks only identities, not roles.
+func (s *SecretStore) Unlock(path, name, env, by string, now time.Time) (*secret.Lock, error) {
+	var left *secret.Lock
+	err := s.db.Update(func(txn *badger.Txn) error {
+		l, err := getLock(txn, path, name, env)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return ErrNotLocked
+		}
+		if l.TwoPerson {
+			pending := l.UnlockRequestedAt != nil && now.Sub(*l.UnlockRequestedAt) < UnlockApprovalWindow
+			if !pending {
+				at := now.UTC()
+				l.UnlockRequestedBy, l.UnlockRequestedAt = by, &at
+				left = l
+				return setLock(txn, path, name, env, l)
+			}
+			if l.UnlockRequestedBy == by {
+				return ErrSameApprover
+			}
+		}
+		return txn.Delete(lockKey(path, name, env))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return left, nil
+}
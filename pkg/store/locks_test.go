@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+func TestLockRefusesEveryWrite(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "providers/lux", "deploy-mnemonic", "main", "v1")
+	putValue(t, s, "providers/lux", "deploy-mnemonic", "main", "v2")
+	putValue(t, s, "providers/lux", "deploy-mnemonic", "test", "t1")
+	if err := s.Secrets().Lock("providers/lux", "deploy-mnemonic", "main", secret.Lock{LockedBy: "iam:ops"}); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := map[string]error{}
+	_, refused["put"] = s.Put("providers/lux", "deploy-mnemonic", "main", []byte("v3"), PutOptions{})
+	refused["delete"] = s.Delete("providers/lux", "deploy-mnemonic", "main", DeleteOptions{})
+	refused["meta"] = s.SetMeta("providers/lux", "deploy-mnemonic", "main", &secret.Meta{Owner: "x"}, Precondition{})
+	_, refused["rollback"] = s.Rollback("providers/lux", "deploy-mnemonic", "main", 1, PutOptions{})
+	_, refused["import"] = s.Import(importEntries("deploy-mnemonic", "v3"), ImportOptions{Path: "providers/lux", Env: "main", Conflict: ConflictOverwrite})
+	_, refused["promote"] = s.Promote(PromoteOptions{Path: "providers/lux", From: "test", To: "main"})
+	refused["lock again"] = s.Secrets().Lock("providers/lux", "deploy-mnemonic", "main", secret.Lock{})
+	for op, err := range refused {
+		if !errors.Is(err, ErrLocked) || !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("%s of a locked secret: err = %v, want ErrLocked", op, err)
+		}
+	}
+	if v, _ := s.Get("providers/lux", "deploy-mnemonic", "main"); string(v) != "v2" {
+		t.Fatalf("locked value = %q", v)
+	}
+
+	if left, err := s.Secrets().Unlock("providers/lux", "deploy-mnemonic", "main", "iam:ops", time.Now()); err != nil || left != nil {
+		t.Fatalf("unlock: %+v, %v", left, err)
+	}
+	putValue(t, s, "providers/lux", "deploy-mnemonic", "main", "v3")
+	if _, err := s.Secrets().Unlock("providers/lux", "deploy-mnemonic", "main", "iam:ops", time.Now()); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("unlock of an unlocked secret: %v", err)
+	}
+}
+
+func TestWriteOnceCreate(t *testing.T) {
+	s := sealedTestStore(t)
+	lock := func() PutOptions { return PutOptions{Lock: &secret.Lock{LockedBy: "iam:ops", Reason: "genesis"}} }
+	if _, err := s.Put("chain", "genesis", "main", []byte("g"), lock()); err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.Secrets().Locked("chain", "genesis", "main")
+	if err != nil || l == nil || l.Reason != "genesis" || l.LockedAt.IsZero() {
+		t.Fatalf("lock = %+v, %v", l, err)
+	}
+	putValue(t, s, "chain", "other", "main", "o")
+	if _, err := s.Put("chain", "other", "main", []byte("o2"), lock()); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("write-once over an existing secret: %v", err)
+	}
+	if l, _ := s.Secrets().Locked("chain", "other", "main"); l != nil {
+		t.Fatal("a refused write-once left a lock")
+	}
+	expiring := lock()
+	at := time.Now().Add(time.Hour)
+	expiring.Meta = &secret.Meta{ExpiresAt: &at}
+	if _, err := s.Put("chain", "expiring", "main", []byte("e"), expiring); !errors.Is(err, ErrInvalidLock) {
+		t.Fatalf("write-once with an expiry: %v", err)
+	}
+	if _, err := s.Get("chain", "expiring", "main"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("a refused write-once was stored: %v", err)
+	}
+}
+
+func TestTwoPersonUnlock(t *testing.T) {
+	s := sealedTestStore(t)
+	secrets := s.Secrets()
+	putValue(t, s, "chain", "genesis", "main", "g")
+	if err := secrets.Lock("chain", "genesis", "main", secret.Lock{LockedBy: "iam:a", TwoPerson: true}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	left, err := secrets.Unlock("chain", "genesis", "main", "iam:a", now)
+	if err != nil || left == nil || left.UnlockRequestedBy != "iam:a" {
+		t.Fatalf("request: %+v, %v", left, err)
+	}
+	if _, err := secrets.Unlock("chain", "genesis", "main", "iam:a", now.Add(time.Minute)); !errors.Is(err, ErrSameApprover) {
+		t.Fatalf("self-approval: %v", err)
+	}
+	// A request that lapses is replaced by the next unlock, which must
+	// itself be approved.
+	later := now.Add(UnlockApprovalWindow + time.Minute)
+	if left, err := secrets.Unlock("chain", "genesis", "main", "iam:b", later); err != nil || left == nil || left.UnlockRequestedBy != "iam:b" {
+		t.Fatalf("request after the window: %+v, %v", left, err)
+	}
+	if _, err := s.Put("chain", "genesis", "main", []byte("x"), PutOptions{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("put while an unlock is pending: %v", err)
+	}
+	if left, err := secrets.Unlock("chain", "genesis", "main", "iam:a", later.Add(time.Minute)); err != nil || left != nil {
+		t.Fatalf("approval: %+v, %v", left, err)
+	}
+	putValue(t, s, "chain", "genesis", "main", "x")
+}
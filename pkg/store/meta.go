@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// ErrSecretExpired is returned by reads of a secret whose metadata expiry has
+// passed. It wraps ErrSecretNotFound, so every caller that maps not-found
+// keeps doing so; one that wants to say why checks for this first.
+var ErrSecretExpired = fmt.Errorf("%w: expired", ErrSecretNotFound)
+
+// ErrInvalidMeta rejects metadata outside the bounds below.
+var ErrInvalidMeta = errors.New("store: invalid metadata")
+
+// ExpiryDeleter is the DeletedBy the expiry sweeper records on the tombstones
+// it writes, so a listing of deleted secrets tells an expiry from a delete.
+const ExpiryDeleter = "kms:expiry"
+
+// Metadata bounds. Labels are for selecting, not for storing documents.
+const (
+	maxLabels         = 64
+	maxLabelKeyLen    = 63
+	maxLabelValueLen  = 256
+	maxDescriptionLen = 1024
+	maxOwnerLen       = 256
+)
+
+// metaPrefix holds metadata: kms/meta/{path}/{env}/{name}. It is keyed by
+// coordinate, beside the live record rather than inside it, so it outlives
+// any one version: a description edit writes no version, and a rollback
+// restores a value without restoring the expiry it had then. It survives a
+// delete (an undelete gets it back) and goes with the purge.
+var metaPrefix = []byte("kms/meta/")
+
+func metaKey(path, name, env string) []byte {
+	return []byte(fmt.Sprintf("kms/meta/%s/%s/%s", normalizePath(path), env, name))
+}
+
+// WriteOptions are the conditions and side data of one SecretStore write.
+type WriteOptions struct {
+	// If guards the write; see Precondition.
+	If Precondition
+	// Meta, when non-nil, replaces the coordinate's metadata in the same
+	// transaction. nil keeps what is there.
+	Meta *secret.Meta
+	// Lock, when non-nil, makes the write write-once: it must create the
+	// secret (If.Absent is implied) and locks it in the same transaction.
+	Lock *secret.Lock
+}
+
+// ValidateMeta checks m against the metadata bounds. A nil m is valid.
+func ValidateMeta(m *secret.Meta) error {
+	if m == nil {
+		return nil
+	}
+	if len(m.Labels) > maxLabels {
+		return fmt.Errorf("%w: at most %d labels", ErrInvalidMeta, maxLabels)
+	}
+	for k, v := range m.Labels {
+		if k == "" || len(k) > maxLabelKeyLen || !ValidCoord(k, "x") {
+			return fmt.Errorf("%w: label key %q must be 1-%d characters with no '/', whitespace padding or control characters", ErrInvalidMeta, k, maxLabelKeyLen)
+		}
+		if len(v) > maxLabelValueLen {
+			return fmt.Errorf("%w: label %q value longer than %d", ErrInvalidMeta, k, maxLabelValueLen)
+		}
+	}
+	if len(m.Description) > maxDescriptionLen {
+		return fmt.Errorf("%w: description longer than %d", ErrInvalidMeta, maxDescriptionLen)
+	}
+	if len(m.Owner) > maxOwnerLen {
+		return fmt.Errorf("%w: owner longer than %d", ErrInvalidMeta, maxOwnerLen)
+	}
+	return nil
+}
+
+// isEmptyMeta reports whether m carries nothing worth storing.
+func isEmptyMeta(m *secret.Meta) bool {
+	return m == nil || (len(m.Labels) == 0 && m.Description == "" && m.Owner == "" && m.ExpiresAt == nil)
+}
+
+// getMeta loads the metadata of a coordinate inside txn; nil when it has none.
+func getMeta(txn *badger.Txn, path, name, env string) (*secret.Meta, error) {
+	item, err := txn.Get(metaKey(path, name, env))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m secret.Meta
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &m)
+	}); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// setMeta stores m as the metadata of a coordinate inside txn. Empty metadata
+// removes the key rather than storing an empty object.
+func setMeta(txn *badger.Txn, path, name, env string, m *secret.Meta) error {
+	if isEmptyMeta(m) {
+		return txn.Delete(metaKey(path, name, env))
+	}
+	stored := *m
+	if stored.ExpiresAt != nil {
+		at := stored.ExpiresAt.UTC()
+		stored.ExpiresAt = &at
+	}
+	raw, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return txn.Set(metaKey(path, name, env), raw)
+}
+
+// expiredError is the read error for metadata that expired: ErrSecretExpired
+// with the time it happened.
+func expiredError(m *secret.Meta) error {
+	return fmt.Errorf("%w at %s", ErrSecretExpired, m.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+// Meta returns the metadata of a live secret; nil when it has none.
+func (s *SecretStore) Meta(path, name, env string) (*secret.Meta, error) {
+	var m *secret.Meta
+	err := s.db.View(func(txn *badger.Txn) error {
+		if _, err := getRecord(txn, secretKey(path, name, env)); err != nil {
+			return err
+		}
+		var err error
+		m, err = getMeta(txn, path, name, env)
+		return err
+	})
+	return m, err
+}
+
+// SetMeta replaces the metadata of a live secret without writing a new
+// version. A locked secret is ErrLocked. cond is checked against the live record, as for a write; an
+// expired secret can be given a new expiry here, which is how it is renewed.
+func (s *SecretStore) SetMeta(path, name, env string, m *secret.Meta, cond Precondition) error {
+	if err := ValidateMeta(m); err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		cur, err := getRecord(txn, secretKey(path, name, env))
+		if err != nil {
+			return err
+		}
+		if err := checkUnlocked(txn, path, name, env); err != nil {
+			return err
+		}
+		if err := cond.check(cur); err != nil {
+			return err
+		}
+		return setMeta(txn, path, name, env, m)
+	})
+}
+
+// ExpireDue moves every live secret whose expiry has passed to the deleted
+// set, recorded as deleted by ExpiryDeleter, and returns how many it moved.
+// Reads refuse an expired secret the moment it expires whether or not this
+// has run; the sweep is what takes it out of listings for good and starts its
+// retention clock. Each expiry is its own transaction that re-reads the
+// metadata, so a renewal racing the sweep wins.
+func (s *SecretStore) ExpireDue(now time.Time) (int, error) {
+	var due []secret.Ref
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = metaPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			path, env, name, ok := splitCoordKey(metaPrefix, string(item.KeyCopy(nil)))
+			if !ok {
+				continue
+			}
+			var m secret.Meta
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &m)
+			}); err != nil {
+				return fmt.Errorf("store: corrupt metadata key=%s: %w", item.Key(), err)
+			}
+			if m.Expired(now) {
+				due = append(due, secret.Ref{Path: path, Env: env, Name: name})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, ref := range due {
+		moved := false
+		err := s.update(func(txn *badger.Txn, feed *changeBatch) error {
+			m, err := getMeta(txn, ref.Path, ref.Name, ref.Env)
+			if err != nil || !m.Expired(now) {
+				return err // renewed since the scan
+			}
+			err = tombstone(txn, feed, ref.Path, ref.Name, ref.Env, ExpiryDeleter, Precondition{}, now)
+			if errors.Is(err, ErrSecretNotFound) {
+				return nil // already deleted
+			}
+			moved = err == nil
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+		if moved {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// RunExpirer calls ExpireDue every interval until ctx is done, reporting each
+// sweep that expired something, or failed, to logf.
+func (s *SecretStore) RunExpirer(ctx context.Context, interval time.Duration, logf func(format string, args ...any)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			n, err := s.ExpireDue(now)
+			if err != nil {
+				logf("kms: expiring secrets: %v (%d expired before the error)", err, n)
+			} else if n > 0 {
+				logf("kms: expired %d secret(s) past their expires_at; recoverable for %s", n, s.retention)
+			}
+		}
+	}
+}
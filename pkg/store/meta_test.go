@@ -0,0 +1,90 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// TestMetaListedFilteredAndUnversioned: metadata written with a value comes
+// back on its Ref, selects it by label, and can be changed without writing a
+// new version.
+func TestMetaListedFilteredAndUnversioned(t *testing.T) {
+	s := sealedTestStore(t)
+	meta := &secret.Meta{Labels: map[string]string{"team": "payments"}, Owner: "payments", Description: "Stripe key"}
+	if _, err := s.Put("svc", "STRIPE", "prod", []byte("sk"), PutOptions{Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put("svc", "OTHER", "prod", []byte("x"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, _, err := s.Find(secret.Query{Labels: map[string]string{"team": "payments"}})
+	if err != nil || len(refs) != 1 || refs[0].Name != "STRIPE" || refs[0].Meta == nil || refs[0].Meta.Owner != "payments" {
+		t.Fatalf("find by label = %+v, %v; want STRIPE with its meta", refs, err)
+	}
+	if refs, _, _ := s.Find(secret.Query{Labels: map[string]string{"team": "infra"}}); len(refs) != 0 {
+		t.Fatalf("find by other label = %+v, want none", refs)
+	}
+
+	// A value write without meta keeps it; a meta edit writes no version.
+	if _, err := s.Put("svc", "STRIPE", "prod", []byte("sk2"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMeta("svc", "STRIPE", "prod", &secret.Meta{Owner: "billing"}, Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Meta("svc", "STRIPE", "prod")
+	if err != nil || got == nil || got.Owner != "billing" || len(got.Labels) != 0 {
+		t.Fatalf("meta = %+v, %v; want owner billing and no labels", got, err)
+	}
+	if versions, _ := s.Versions("svc", "STRIPE", "prod"); len(versions) != 2 {
+		t.Fatalf("versions = %d, want 2 (meta edits are not versions)", len(versions))
+	}
+	if err := s.SetMeta("svc", "STRIPE", "prod", &secret.Meta{Labels: map[string]string{"a/b": "x"}}, Precondition{}); !errors.Is(err, ErrInvalidMeta) {
+		t.Fatalf("bad label key: err = %v, want ErrInvalidMeta", err)
+	}
+}
+
+// TestMetaExpiry: an expired secret reads as not-found with the reason,
+// drops out of listings, is moved to the deleted set by the sweep, and a new
+// value clears the stale expiry.
+func TestMetaExpiry(t *testing.T) {
+	s := sealedTestStore(t)
+	past := time.Now().Add(-time.Minute)
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("v1"), PutOptions{Meta: &secret.Meta{ExpiresAt: &past}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.Get("svc", "TOKEN", "prod")
+	if !errors.Is(err, ErrSecretExpired) || !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("read expired: err = %v, want ErrSecretExpired wrapping ErrSecretNotFound", err)
+	}
+	if refs, _, _ := s.Find(secret.Query{}); len(refs) != 0 {
+		t.Fatalf("find = %+v, want the expired secret hidden", refs)
+	}
+
+	n, err := s.Secrets().ExpireDue(time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("expire sweep = %d, %v; want 1", n, err)
+	}
+	deleted, _, _ := s.Secrets().Deleted(secret.Query{})
+	if len(deleted) != 1 || deleted[0].DeletedBy != ExpiryDeleter {
+		t.Fatalf("deleted = %+v, want one deleted by %s", deleted, ExpiryDeleter)
+	}
+	if _, err := s.Get("svc", "TOKEN", "prod"); !errors.Is(err, ErrSecretExpired) {
+		t.Fatalf("read after sweep: err = %v, want ErrSecretExpired", err)
+	}
+	if n, _ := s.Secrets().ExpireDue(time.Now()); n != 0 {
+		t.Fatalf("second sweep = %d, want 0", n)
+	}
+
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("v2"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := s.Get("svc", "TOKEN", "prod"); err != nil || string(pt) != "v2" {
+		t.Fatalf("after rewrite = %q, %v; want v2 (stale expiry cleared)", pt, err)
+	}
+}
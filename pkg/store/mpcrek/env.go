@@ -0,0 +1,130 @@
+package mpcrek
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The environment KeyringFromEnv reads. With EnvEndpoint set the keyring
+// comes from MPC; otherwise from the legacy env-var REK.
+const (
+	EnvEndpoint    = "MPC_REK_ENDPOINT"
+	EnvKeyID       = "MPC_REK_KEY_ID"           // default DefaultKeyID
+	EnvPreviousIDs = "MPC_REK_PREVIOUS_KEY_IDS" // CSV of older epochs' key IDs
+	EnvTimeout     = "MPC_REK_TIMEOUT"          // default DefaultTimeout
+
+	EnvMasterKey         = "KMS_MASTER_KEY_B64"      // legacy: the current REK, base64
+	EnvMasterKeyEpoch    = "KMS_REK_EPOCH"           // legacy: its epoch, default 1
+	EnvMasterKeyPrevious = "KMS_MASTER_KEY_PREVIOUS" // legacy: "epoch:base64[,epoch:base64...]"
+)
+
+// Defaults of EnvKeyID and EnvTimeout.
+const (
+	DefaultKeyID   = "kms/rek/v1"
+	DefaultTimeout = 10 * time.Second
+)
+
+// ErrNoREK is KeyringFromEnv finding no REK: neither EnvEndpoint nor a usable
+// EnvMasterKey is set.
+var ErrNoREK = errors.New("mpcrek: no REK")
+
+// KeyringFromEnv reads the REK keyring, as store.NewKeyring takes it, from
+// the process environment: from MPC (BootstrapKeyring) when EnvEndpoint is
+// set, else from EnvMasterKey and its previous epochs. nodeID is the ZAP
+// identity the MPC fetch is attributed to.
+//
+// With EnvEndpoint set, a failed fetch is an error, never a fall back to the
+// env-var REK (see Fail-closed in the package doc).
+func KeyringFromEnv(nodeID string) (map[uint32][]byte, uint32, error) {
+	if endpoint := os.Getenv(EnvEndpoint); endpoint != "" {
+		keyID := os.Getenv(EnvKeyID)
+		if keyID == "" {
+			keyID = DefaultKeyID
+		}
+		var previous []string
+		for _, id := range strings.Split(os.Getenv(EnvPreviousIDs), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				previous = append(previous, id)
+			}
+		}
+		timeout := DefaultTimeout
+		if v := os.Getenv(EnvTimeout); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s %q invalid: %v", EnvTimeout, v, err)
+			}
+			timeout = d
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		reks, current, err := BootstrapKeyring(ctx, Config{
+			Endpoint: endpoint,
+			KeyID:    keyID,
+			NodeID:   nodeID,
+			Timeout:  timeout,
+		}, previous)
+		if err != nil {
+			return nil, 0, fmt.Errorf("MPC REK bootstrap failed: %w", err)
+		}
+		return reks, current, nil
+	}
+
+	b64 := os.Getenv(EnvMasterKey)
+	if b64 == "" {
+		return nil, 0, fmt.Errorf("%w: set %s, or %s to 32 bytes base64", ErrNoREK, EnvEndpoint, EnvMasterKey)
+	}
+	mk, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(mk) != 32 {
+		return nil, 0, fmt.Errorf("%w: %s invalid (need 32 bytes base64)", ErrNoREK, EnvMasterKey)
+	}
+	current := uint64(1)
+	if v := os.Getenv(EnvMasterKeyEpoch); v != "" {
+		if current, err = strconv.ParseUint(v, 10, 32); err != nil || current == 0 {
+			return nil, 0, fmt.Errorf("%s %q is not a positive integer", EnvMasterKeyEpoch, v)
+		}
+	}
+	reks, err := ParsePrevious(os.Getenv(EnvMasterKeyPrevious))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s invalid: %v", EnvMasterKeyPrevious, err)
+	}
+	if _, dup := reks[uint32(current)]; dup {
+		return nil, 0, fmt.Errorf("%s names the current epoch %d", EnvMasterKeyPrevious, current)
+	}
+	reks[uint32(current)] = mk
+	return reks, uint32(current), nil
+}
+
+// ParsePrevious reads EnvMasterKeyPrevious: "epoch:base64[,epoch:base64...]".
+// An error never echoes a key.
+func ParsePrevious(v string) (map[uint32][]byte, error) {
+	reks := make(map[uint32][]byte)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		epochStr, b64, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("entry is not epoch:base64")
+		}
+		epoch, err := strconv.ParseUint(epochStr, 10, 32)
+		if err != nil || epoch == 0 {
+			return nil, fmt.Errorf("epoch %q is not a positive integer", epochStr)
+		}
+		if _, dup := reks[uint32(epoch)]; dup {
+			return nil, fmt.Errorf("epoch %d named twice", epoch)
+		}
+		rek, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(rek) != 32 {
+			return nil, fmt.Errorf("epoch %d: need 32 bytes base64", epoch)
+		}
+		reks[uint32(epoch)] = rek
+	}
+	return reks, nil
+}
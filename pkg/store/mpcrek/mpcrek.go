@@ -47,11 +47,12 @@
 // # Re-key (REK rotation)
 //
 // Out of band: an operator invokes the MPC cluster's reshare / new-key
-// ceremony to mint REK at epoch N+1. KMS replicas observe the new epoch
-// (via a watch on `kms/rek/epoch`) and run the migration: for every
-// secret in ZapDB, Open under epoch N, Seal under epoch N+1, Put. The
-// re-key tool is `cmd/rek-rotate` (future; this PR ships only the boot
-// fetch).
+// ceremony to mint REK at epoch N+1 ("kms/rek/v(N+1)"), then rolls KMS
+// with that as MPC_REK_KEY_ID and epoch N among MPC_REK_PREVIOUS_KEY_IDS.
+// BootstrapKeyring fetches both; the store (store.Keyring) seals new
+// writes under N+1, still opens records under N, and re-wraps their DEKs
+// onto N+1 in the background. Once the re-wrap reports nothing left under
+// N, the next roll drops it from MPC_REK_PREVIOUS_KEY_IDS.
 //
 // # Fail-closed
 //
@@ -68,6 +69,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -96,9 +98,10 @@ var (
 // restarting pod doesn't fail the boot probe.
 //
 // KeyID is the MPC-side identifier of the wrapped REK record. Convention:
-// "kms/rek/v1" for the current epoch. Rotation publishes "kms/rek/v2"
-// alongside v1; the operator rolls KMS pods with the new env after the
-// migration tool runs.
+// "kms/rek/v<N>" for epoch N (EpochOf). Rotation publishes "kms/rek/v2"
+// alongside v1; the operator rolls KMS pods holding both
+// (BootstrapKeyring) until the background re-wrap has moved every record
+// off v1.
 //
 // NodeID is the ZAP node identity used for this client. Default
 // "kms-rek-bootstrap"; production deployments should set it to the pod
@@ -204,6 +207,58 @@ func Bootstrap(ctx context.Context, cfg Config) ([]byte, error) {
 	return rek, nil
 }
 
+// EpochOf parses the REK epoch from an MPC key ID of the conventional form
+// "kms/rek/v<N>" (see Config.KeyID). Epochs start at 1.
+func EpochOf(keyID string) (uint32, error) {
+	i := strings.LastIndex(keyID, "/v")
+	if i < 0 {
+		return 0, fmt.Errorf("mpcrek: key ID %q does not end in /v<epoch>", keyID)
+	}
+	n, err := strconv.ParseUint(keyID[i+2:], 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("mpcrek: key ID %q does not end in /v<epoch>", keyID)
+	}
+	return uint32(n), nil
+}
+
+// BootstrapKeyring fetches the current REK, cfg.KeyID, and the REK of each
+// older epoch in previous, and returns them by epoch (EpochOf) with the
+// current epoch. It is Bootstrap once per key and fails as Bootstrap does,
+// on any of them: a keyring missing an epoch it was asked to hold would leave
+// that epoch's records unreadable. Keys already fetched are zeroed on
+// failure.
+func BootstrapKeyring(ctx context.Context, cfg Config, previous []string) (map[uint32][]byte, uint32, error) {
+	current, err := EpochOf(cfg.KeyID)
+	if err != nil {
+		return nil, 0, err
+	}
+	keyIDs := append([]string{cfg.KeyID}, previous...)
+	reks := make(map[uint32][]byte, len(keyIDs))
+	fail := func(err error) (map[uint32][]byte, uint32, error) {
+		for _, rek := range reks {
+			Zero(rek)
+		}
+		return nil, 0, err
+	}
+	for _, keyID := range keyIDs {
+		epoch, err := EpochOf(keyID)
+		if err != nil {
+			return fail(err)
+		}
+		if _, dup := reks[epoch]; dup {
+			return fail(fmt.Errorf("mpcrek: epoch %d named twice", epoch))
+		}
+		one := cfg
+		one.KeyID = keyID
+		rek, err := Bootstrap(ctx, one)
+		if err != nil {
+			return fail(err)
+		}
+		reks[epoch] = rek
+	}
+	return reks, current, nil
+}
+
 // Zero overwrites every byte of b with 0 and includes a runtime.KeepAlive
 // to discourage the compiler from eliding the writes. This is
 // best-effort: a sufficiently aggressive optimizer or a swap to disk
@@ -1,8 +1,11 @@
 package mpcrek
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -254,3 +257,76 @@ func (nilResultDecrypter) Decrypt(_ context.Context, _ string, _ []byte) (*mpc.D
 	return nil, nil
 }
 func (nilResultDecrypter) Close() {}
+
+// keyedDecrypter answers each key ID with its own REK.
+type keyedDecrypter map[string][]byte
+
+func (k keyedDecrypter) Decrypt(_ context.Context, keyID string, _ []byte) (*mpc.DecryptResult, error) {
+	rek, ok := k[keyID]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return &mpc.DecryptResult{Plaintext: append([]byte(nil), rek...)}, nil
+}
+
+func (keyedDecrypter) Close() {}
+
+func TestBootstrapKeyring_FetchesEveryEpoch(t *testing.T) {
+	v1, v2 := make([]byte, 32), make([]byte, 32)
+	v1[0], v2[0] = 1, 2
+	restore := withDialer(t, keyedDecrypter{"kms/rek/v1": v1, "kms/rek/v2": v2})
+	defer restore()
+
+	cfg := Config{Endpoint: "mpc-0:9999", KeyID: "kms/rek/v2"}
+	reks, current, err := BootstrapKeyring(context.Background(), cfg, []string{"kms/rek/v1"})
+	if err != nil || current != 2 || len(reks) != 2 || reks[1][0] != 1 || reks[2][0] != 2 {
+		t.Fatalf("BootstrapKeyring = %v, %d, %v", reks, current, err)
+	}
+	for _, previous := range [][]string{{"kms/rek/v3"}, {"kms/rek/v2"}, {"kms/rek/latest"}} {
+		if _, _, err := BootstrapKeyring(context.Background(), cfg, previous); err == nil {
+			t.Errorf("previous %q: want an error", previous)
+		}
+	}
+	if _, err := EpochOf("kms/rek/v0"); err == nil {
+		t.Error("EpochOf accepted epoch 0")
+	}
+}
+
+func TestParsePrevious(t *testing.T) {
+	k := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	reks, err := ParsePrevious(" 1:" + k + ", 2:" + k + " ")
+	if err != nil || len(reks) != 2 || len(reks[1]) != 32 || len(reks[2]) != 32 {
+		t.Fatalf("ParsePrevious = %v, %v", reks, err)
+	}
+	for _, bad := range []string{k, "0:" + k, "x:" + k, "1:short", "1:" + k + ",1:" + k} {
+		if _, err := ParsePrevious(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		} else if strings.Contains(err.Error(), k) {
+			t.Errorf("%q: the error echoes the key", bad)
+		}
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	k := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	t.Setenv(EnvEndpoint, "")
+	t.Setenv(EnvMasterKey, "")
+	if _, _, err := KeyringFromEnv("test"); !errors.Is(err, ErrNoREK) {
+		t.Fatalf("no REK set: %v", err)
+	}
+	t.Setenv(EnvMasterKey, "c2hvcnQ=")
+	if _, _, err := KeyringFromEnv("test"); !errors.Is(err, ErrNoREK) {
+		t.Fatalf("short master key: %v", err)
+	}
+	t.Setenv(EnvMasterKey, k)
+	t.Setenv(EnvMasterKeyEpoch, "3")
+	t.Setenv(EnvMasterKeyPrevious, "2:"+k)
+	reks, current, err := KeyringFromEnv("test")
+	if err != nil || current != 3 || len(reks) != 2 || len(reks[3]) != 32 || len(reks[2]) != 32 {
+		t.Fatalf("KeyringFromEnv = %v, %d, %v", reks, current, err)
+	}
+	t.Setenv(EnvMasterKeyPrevious, "3:"+k)
+	if _, _, err := KeyringFromEnv("test"); err == nil {
+		t.Fatal("a previous epoch equal to the current one was accepted")
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// MaxPageSize is the largest page FindPage returns, whatever Query.Limit
+// asks for. It is also the page size of a Query with no Limit.
+const MaxPageSize = maxFindRows
+
+// ErrInvalidCursor rejects a Query.Cursor this store did not issue.
+var ErrInvalidCursor = errors.New("store: invalid page cursor")
+
+// encodeCursor makes the opaque cursor that resumes a scan after ref. It
+// names the coordinate, not a position, so records written or deleted
+// between pages shift nothing: the next page starts at the first coordinate
+// ordered after it, whatever exists then.
+func encodeCursor(ref secret.Ref) string {
+	raw, _ := json.Marshal([3]string{ref.Path, ref.Env, ref.Name})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (secret.Ref, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return secret.Ref{}, ErrInvalidCursor
+	}
+	var t [3]string
+	if err := json.Unmarshal(raw, &t); err != nil || t[1] == "" || t[2] == "" {
+		return secret.Ref{}, ErrInvalidCursor
+	}
+	return secret.Ref{Path: t[0], Env: t[1], Name: t[2]}, nil
+}
+
+// refLess is the (path, env, name) order every enumeration answers in.
+func refLess(a, b secret.Ref) bool {
+	if a.Path != b.Path {
+		return a.Path < b.Path
+	}
+	if a.Env != b.Env {
+		return a.Env < b.Env
+	}
+	return a.Name < b.Name
+}
+
+// pageHeap is a max-heap on refLess: its root is the largest Ref kept so far,
+// the one a smaller candidate evicts.
+type pageHeap []secret.Ref
+
+func (h pageHeap) Len() int           { return len(h) }
+func (h pageHeap) Less(i, j int) bool { return refLess(h[j], h[i]) }
+func (h pageHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *pageHeap) Push(x any)        { *h = append(*h, x.(secret.Ref)) }
+func (h *pageHeap) Pop() any {
+	old := *h
+	ref := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ref
+}
+
+// FindPage is Find one page at a time: the first q.Limit (bounded by
+// MaxPageSize) matches ordered after q.Cursor, and the cursor of the page
+// after them — "" when this page is the last.
+//
+// The key order of the store is not the (path, env, name) order a listing
+// answers in — "a/b/prod/X" sorts before "a/prod/Y" — so a page cannot stop
+// at the Nth key it meets. It scans the subtree's keys (keys only, as Find
+// always has) and keeps the smallest page-size matches in a bounded heap, so
+// memory follows the page, not the store.
+func (s *SecretStore) FindPage(q secret.Query) (refs []secret.Ref, next string, err error) {
+	var after *secret.Ref
+	if q.Cursor != "" {
+		ref, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &ref
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	root := normalizePath(q.Path)
+	prefix := secretPrefix
+	if root != "" {
+		prefix = []byte(string(secretPrefix) + root + "/")
+	}
+	now := time.Now()
+	page := &pageHeap{}
+	more := false
+	err = s.db.View(func(txn *badger.Txn) error {
+		// matches applies the metadata filters, which need a point read, so
+		// only to a coordinate that would otherwise make the page.
+		matches := func(ref *secret.Ref) (bool, error) {
+			meta, err := getMeta(txn, ref.Path, ref.Name, ref.Env)
+			if err != nil {
+				return false, err
+			}
+			ref.Meta = meta
+			return !meta.Expired(now) && meta.HasLabels(q.Labels), nil
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false // keys only — a listing never touches a value
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			// KeyCopy: Item.Key() is only valid for the current step.
+			path, env, name, ok := splitSecretKey(string(it.Item().KeyCopy(nil)))
+			if !ok {
+				continue
+			}
+			if q.Env != "" && env != q.Env {
+				continue
+			}
+			if !underPath(root, path) {
+				continue
+			}
+			ref := secret.Ref{Path: path, Env: env, Name: name}
+			if after != nil && !refLess(*after, ref) {
+				continue
+			}
+			if page.Len() == limit && !refLess(ref, (*page)[0]) {
+				// Past the end of this page. One match out here is enough to
+				// know there is a next page.
+				if !more {
+					found, err := matches(&ref)
+					if err != nil {
+						return err
+					}
+					more = found
+				}
+				continue
+			}
+			ok, err := matches(&ref)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			heap.Push(page, ref)
+			if page.Len() > limit {
+				heap.Pop(page)
+				more = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	refs = append([]secret.Ref{}, (*page)...)
+	sort.Slice(refs, func(i, j int) bool { return refLess(refs[i], refs[j]) })
+	if more {
+		next = encodeCursor(refs[len(refs)-1])
+	}
+	return refs, next, nil
+}
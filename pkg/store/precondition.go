@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPreconditionFailed is returned when a write's Precondition does not hold
+// against the record it would replace. Nothing was written; the caller should
+// re-read and decide again.
+var ErrPreconditionFailed = errors.New("store: precondition failed")
+
+// Precondition makes a write or delete conditional on the live record it
+// replaces — optimistic concurrency for read-modify-write callers such as
+// rotation jobs. It is checked inside the same ZapDB transaction as the write,
+// so two writers that both read version 3 cannot both commit a version 4: the
+// second finds version 4 and fails.
+//
+// The zero Precondition always holds (last write wins, as before).
+type Precondition struct {
+	// Version, when > 0, requires the live record to be at exactly this
+	// version.
+	Version int
+	// Absent requires that no live record exists. A deleted (tombstoned)
+	// coordinate counts as absent.
+	Absent bool
+	// Present requires that a live record exists, at any version.
+	Present bool
+}
+
+// check evaluates p against cur, the live record (nil when there is none).
+func (p Precondition) check(cur *Secret) error {
+	switch {
+	case p.Absent && cur != nil:
+		return fmt.Errorf("%w: secret exists at version %d", ErrPreconditionFailed, liveVersion(cur))
+	case (p.Present || p.Version > 0) && cur == nil:
+		return fmt.Errorf("%w: secret does not exist", ErrPreconditionFailed)
+	case p.Version > 0 && liveVersion(cur) != p.Version:
+		return fmt.Errorf("%w: secret is at version %d, not %d", ErrPreconditionFailed, liveVersion(cur), p.Version)
+	}
+	return nil
+}
+
+// liveVersion is a record's version, reading a pre-versioning record as 1.
+func liveVersion(rec *Secret) int {
+	if rec.Version == 0 {
+		return 1
+	}
+	return rec.Version
+}
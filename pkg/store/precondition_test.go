@@ -0,0 +1,41 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPreconditionGuardsWritesAndDeletes: a stale version, a create-only over
+// a live record, and a delete at the wrong version all fail with
+// ErrPreconditionFailed and leave the record as it was.
+func TestPreconditionGuardsWritesAndDeletes(t *testing.T) {
+	s := sealedTestStore(t)
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("one"), PutOptions{If: Precondition{Absent: true}}); err != nil {
+		t.Fatalf("create-only on empty coordinate: %v", err)
+	}
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("dup"), PutOptions{If: Precondition{Absent: true}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("create-only over existing: err = %v, want ErrPreconditionFailed", err)
+	}
+	if v, err := s.Put("svc", "TOKEN", "prod", []byte("two"), PutOptions{If: Precondition{Version: 1}}); err != nil || v != 2 {
+		t.Fatalf("put at v1 = v%d, %v; want v2", v, err)
+	}
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("lost"), PutOptions{If: Precondition{Version: 1}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("stale put: err = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := s.Put("svc", "OTHER", "prod", []byte("x"), PutOptions{If: Precondition{Present: true}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("update-only on missing: err = %v, want ErrPreconditionFailed", err)
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{If: Precondition{Version: 1}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("stale delete: err = %v, want ErrPreconditionFailed", err)
+	}
+	if pt, version, err := s.GetVersion("svc", "TOKEN", "prod", 0); err != nil || string(pt) != "two" || version != 2 {
+		t.Fatalf("after failed preconditions = %q v%d, %v; want two v2", pt, version, err)
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{If: Precondition{Version: 2}}); err != nil {
+		t.Fatalf("delete at v2: %v", err)
+	}
+	// A deleted coordinate is absent: create-only may write it again.
+	if v, err := s.Put("svc", "TOKEN", "prod", []byte("three"), PutOptions{If: Precondition{Absent: true}}); err != nil || v != 3 {
+		t.Fatalf("create-only over tombstone = v%d, %v; want v3", v, err)
+	}
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// Promotion actions; see secret.Promotion.
+const (
+	PromoteCreate    = "create"
+	PromoteUpdate    = "update"
+	PromoteUnchanged = "unchanged"
+)
+
+// ErrPromoteSameEnv rejects a promote whose source and destination env are
+// the same: there is nothing to copy, and a caller that asked for it has the
+// envs wrong.
+var ErrPromoteSameEnv = errors.New("store: promote source and destination env are the same")
+
+// PromoteOptions selects what a promote copies and where.
+type PromoteOptions struct {
+	// Path is the subtree root whose secrets are promoted; "" is the store.
+	Path string
+	// From is the source env, To the destination env.
+	From, To string
+	// DryRun reports what the promote would do and writes nothing.
+	DryRun bool
+	// Writer is recorded on every version the promote writes.
+	Writer string
+}
+
+// Promote copies every live secret under opts.Path in env opts.From to the
+// same path and name in env opts.To, and reports what it did to each, in
+// (path, name) order. Each value is opened and sealed again under a fresh DEK
+// for its destination coordinate — a ciphertext is bound to the env it was
+// written in and cannot simply be moved. A threshold-reveal value is likewise
+// decrypted and encrypted again for its destination (see ThresholdReveal),
+// before the transaction below.
+//
+// The whole promote is one transaction: the destination env gets every
+// change or none, and no write to the source can land half-way through. A
+// destination that already holds the same value is left alone, so promoting
+// twice writes nothing the second time. Secrets only in the destination are
+// not touched. Metadata stays with its coordinate and is not copied; a value
+// is copied as stored, so a ${ref:...@env} in it still names that env.
+//
+// More than MaxBatch source secrets is ErrBatchTooLarge: narrow the path.
+func (s *SealedStore) Promote(opts PromoteOptions) ([]secret.Promotion, error) {
+	return s.PromoteContext(context.Background(), opts)
+}
+
+// PromoteContext is Promote on behalf of the request ctx. Its
+// threshold-reveal re-encrypts run on ctx before the transaction, which
+// refuses the promote with ErrThresholdSourceChanged if a source is no longer
+// the version that was encrypted again.
+func (s *SealedStore) PromoteContext(ctx context.Context, opts PromoteOptions) ([]secret.Promotion, error) {
+	if !ValidCoord(opts.From, "x") || !ValidCoord(opts.To, "x") {
+		return nil, ErrInvalidCoord
+	}
+	if opts.From == opts.To {
+		return nil, ErrPromoteSameEnv
+	}
+	var copies map[secret.Ref]*thresholdCopy
+	if !opts.DryRun {
+		var err error
+		if copies, err = s.resealForPromote(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+	var out []secret.Promotion
+	var written []*thresholdCopy
+	promote := func(txn *badger.Txn, feed *changeBatch) error {
+		refs, err := envRefs(txn, opts.Path, opts.From)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		out, written = make([]secret.Promotion, 0, len(refs)), nil
+		for _, ref := range refs {
+			p, ok, err := s.promoteOne(txn, feed, ref, opts, now, copies)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			out = append(out, p)
+			if c := copies[ref]; c != nil && !opts.DryRun && p.Action != PromoteUnchanged {
+				written = append(written, c)
+			}
+		}
+		return nil
+	}
+	var err error
+	if opts.DryRun {
+		err = s.secrets.db.View(func(txn *badger.Txn) error { return promote(txn, nil) })
+	} else {
+		err = s.secrets.update(promote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range written {
+		s.auditCopy(c, "promote", opts.Writer)
+	}
+	return out, nil
+}
+
+// resealForPromote encrypts again, for opts.To, every live threshold-reveal
+// source the promote would write, keyed by its source coordinate. A source
+// whose destination already holds an unexpired copy of it is left out: the
+// promote leaves that one alone.
+func (s *SealedStore) resealForPromote(ctx context.Context, opts PromoteOptions) (map[secret.Ref]*thresholdCopy, error) {
+	var refs []secret.Ref
+	var srcs []*Secret
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		all, err := envRefs(txn, opts.Path, opts.From)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, ref := range all {
+			src, err := readVersion(txn, ref.Path, ref.Name, opts.From, 0, now)
+			if errors.Is(err, ErrSecretNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if src.Scheme != ModeThresholdReveal {
+				continue
+			}
+			if dst, err := getRecord(txn, secretKey(ref.Path, ref.Name, opts.To)); err == nil {
+				same, _ := s.sameValue(src, nil, dst)
+				meta, err := getMeta(txn, ref.Path, ref.Name, opts.To)
+				if err != nil {
+					return err
+				}
+				if same && !meta.Expired(now) {
+					continue
+				}
+			}
+			refs, srcs = append(refs, ref), append(srcs, src)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	copies := make(map[secret.Ref]*thresholdCopy, len(refs))
+	for i, ref := range refs {
+		c, err := s.resealThreshold(ctx, srcs[i], ref.Path, ref.Name, opts.To)
+		if err != nil {
+			return nil, err
+		}
+		copies[ref] = c
+	}
+	return copies, nil
+}
+
+// promoteOne plans, and unless this is a dry run writes, the promote of one
+// source coordinate inside txn. ok is false for a source that has expired: it
+// is not live, so it is not promoted.
+//
+// A threshold-reveal source is not opened to plan the promote: it is
+// unchanged only against a destination holding a copy of the same put
+// (Origin). Writing it writes its copy in copies, made by resealForPromote
+// from this very version, or fails with ErrThresholdSourceChanged.
+func (s *SealedStore) promoteOne(txn *badger.Txn, feed *changeBatch, ref secret.Ref, opts PromoteOptions, now time.Time, copies map[secret.Ref]*thresholdCopy) (p secret.Promotion, ok bool, err error) {
+	src, err := readVersion(txn, ref.Path, ref.Name, opts.From, 0, now)
+	if errors.Is(err, ErrSecretNotFound) {
+		return p, false, nil
+	}
+	if err != nil {
+		return p, false, err
+	}
+	var value []byte
+	if src.Scheme != ModeThresholdReveal {
+		if value, err = s.openRecord(context.Background(), src); err != nil {
+			return p, false, err
+		}
+		defer clear(value)
+	}
+	p = secret.Promotion{Path: ref.Path, Name: ref.Name, Action: PromoteCreate, SourceVersion: recordVersion(src)}
+
+	dst, err := getRecord(txn, secretKey(ref.Path, ref.Name, opts.To))
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+	case err != nil:
+		return p, false, err
+	default:
+		p.Action, p.TargetVersion = PromoteUpdate, recordVersion(dst)
+		same, err := s.sameValue(src, value, dst)
+		if err != nil {
+			return p, false, err
+		}
+		meta, err := getMeta(txn, ref.Path, ref.Name, opts.To)
+		if err != nil {
+			return p, false, err
+		}
+		if same && !meta.Expired(now) {
+			p.Action = PromoteUnchanged
+		}
+	}
+	if opts.DryRun || p.Action == PromoteUnchanged {
+		return p, true, nil
+	}
+	var rec *Secret
+	if src.Scheme == ModeThresholdReveal {
+		c := copies[ref]
+		if c == nil || !c.from(src) {
+			return p, false, ErrThresholdSourceChanged
+		}
+		copied := *c.rec
+		copied.CreatedAt, copied.UpdatedAt = now.UTC(), now.UTC()
+		rec = &copied
+	} else if rec, err = s.sealRecord(ref.Path, ref.Name, opts.To, value); err != nil {
+		return p, false, err
+	}
+	defer rec.dropDEK()
+	rec.CreatedBy = opts.Writer
+	if err := putVersion(txn, feed, rec, Precondition{}); err != nil {
+		return p, false, err
+	}
+	p.Version = rec.Version
+	return p, true, nil
+}
+
+// sameValue reports whether dst holds the value of src (value, when src is
+// not threshold-reveal). A threshold-reveal record on either side is
+// compared by Origin, never revealed.
+func (s *SealedStore) sameValue(src *Secret, value []byte, dst *Secret) (bool, error) {
+	if src.Scheme == ModeThresholdReveal || dst.Scheme == ModeThresholdReveal {
+		return src.Scheme == dst.Scheme && src.Origin != "" && src.Origin == dst.Origin, nil
+	}
+	cur, err := s.openRecord(context.Background(), dst)
+	if err != nil {
+		return false, err
+	}
+	defer clear(cur)
+	return bytes.Equal(cur, value), nil
+}
+
+// sealRecord seals a value for (path, name, env) under the current REK
+// epoch. Its DEK is wrapped when putVersion writes it; a caller that may fail
+// before then drops it (dropDEK).
+func (s *SealedStore) sealRecord(path, name, env string, value []byte) (*Secret, error) {
+	return s.keys.seal(path, name, env, value)
+}
+
+// openRecord opens a stored record of any envelope version and epoch,
+// refusing one that was never sealed. A threshold-reveal record is opened by
+// a t-of-n decrypt instead of the REK, audited as read by ctx's principal.
+func (s *SealedStore) openRecord(ctx context.Context, rec *Secret) ([]byte, error) {
+	if isLegacyUnsealed(rec) {
+		return nil, ErrUnsealedRecord
+	}
+	if rec.Scheme == ModeThresholdReveal {
+		return s.openThreshold(ctx, rec)
+	}
+	return s.keys.open(rec)
+}
+
+// recordVersion is the version of a stored record; a pre-versioning record
+// is its own version 1.
+func recordVersion(rec *Secret) int {
+	if rec.Version == 0 {
+		return 1
+	}
+	return rec.Version
+}
+
+// envRefs lists, inside txn, every coordinate stored under root in env, in
+// (path, name) order, up to MaxBatch. The iterator is closed before it
+// returns, so the caller may write in the same txn.
+func envRefs(txn *badger.Txn, root, env string) ([]secret.Ref, error) {
+	root = normalizePath(root)
+	prefix := secretPrefix
+	if root != "" {
+		prefix = []byte(string(secretPrefix) + root + "/")
+	}
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var refs []secret.Ref
+	for it.Rewind(); it.Valid(); it.Next() {
+		path, e, name, ok := splitSecretKey(string(it.Item().KeyCopy(nil)))
+		if !ok || e != env || !underPath(root, path) {
+			continue
+		}
+		if len(refs) == MaxBatch {
+			return nil, ErrBatchTooLarge
+		}
+		refs = append(refs, secret.Ref{Path: path, Env: env, Name: name})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refLess(refs[i], refs[j]) })
+	return refs, nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+func actions(changes []secret.Promotion) map[string]string {
+	out := map[string]string{}
+	for _, c := range changes {
+		out[c.Path+"/"+c.Name] = c.Action
+	}
+	return out
+}
+
+func TestPromoteDryRunThenApply(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "svc", "A", "test", "a-test")
+	putValue(t, s, "svc", "B", "test", "b-test")
+	putValue(t, s, "svc/sub", "C", "test", "c-test")
+	putValue(t, s, "svc", "B", "main", "b-old")
+	putValue(t, s, "svc/sub", "C", "main", "c-test")
+	putValue(t, s, "svc", "ONLY_MAIN", "main", "keep")
+	putValue(t, s, "other", "A", "test", "not promoted")
+
+	want := map[string]string{"svc/A": PromoteCreate, "svc/B": PromoteUpdate, "svc/sub/C": PromoteUnchanged}
+	plan, err := s.Promote(PromoteOptions{Path: "svc", From: "test", To: "main", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(plan); len(got) != len(want) || got["svc/A"] != want["svc/A"] || got["svc/B"] != want["svc/B"] || got["svc/sub/C"] != want["svc/sub/C"] {
+		t.Fatalf("plan = %v, want %v", got, want)
+	}
+	if _, err := s.Get("svc", "A", "main"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("dry run wrote svc/A@main: err = %v", err)
+	}
+
+	done, err := s.Promote(PromoteOptions{Path: "svc", From: "test", To: "main", Writer: "iam:ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(done); got["svc/A"] != PromoteCreate || got["svc/B"] != PromoteUpdate {
+		t.Fatalf("applied = %v", got)
+	}
+	for _, c := range done {
+		if c.Path == "svc" && c.Name == "B" && (c.TargetVersion != 1 || c.Version != 2) {
+			t.Fatalf("svc/B versions = %+v, want 1 -> 2", c)
+		}
+	}
+	for name, value := range map[string]string{"A": "a-test", "B": "b-test", "ONLY_MAIN": "keep"} {
+		got, err := s.Get("svc", name, "main")
+		if err != nil || string(got) != value {
+			t.Fatalf("svc/%s@main = %q, %v; want %q", name, got, err, value)
+		}
+	}
+	// Sealed under the destination coordinate: the record carries main, and
+	// its history says who promoted it.
+	rec, err := s.Secrets().Get("svc", "A", "main")
+	if err != nil || rec.Env != "main" || rec.CreatedBy != "iam:ops" {
+		t.Fatalf("svc/A@main record = %+v, %v", rec, err)
+	}
+
+	again, err := s.Promote(PromoteOptions{Path: "svc", From: "test", To: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range again {
+		if c.Action != PromoteUnchanged || c.Version != 0 {
+			t.Fatalf("second promote changed %+v", c)
+		}
+	}
+}
+
+func TestPromoteRejectsBadEnvs(t *testing.T) {
+	s := sealedTestStore(t)
+	if _, err := s.Promote(PromoteOptions{From: "test", To: "test"}); !errors.Is(err, ErrPromoteSameEnv) {
+		t.Fatalf("same env: err = %v", err)
+	}
+	if _, err := s.Promote(PromoteOptions{From: "test", To: "a/b"}); !errors.Is(err, ErrInvalidCoord) {
+		t.Fatalf("bad env: err = %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+	badger "github.com/luxfi/zapdb"
+)
+
+// recipientKey returns the key of an epoch's ML-KEM-768 recipient: the public
+// key its DEKs are encapsulated to, and its decapsulation key sealed under
+// the epoch's REK. LegacyEpoch keeps kms/recipient/mlkem768, where the one
+// recipient lived before keyrings; epoch N is kms/recipient/mlkem768@N.
+// Neither is under kms/keys/, which Store loads as validator key sets.
+func recipientKey(epoch uint32) []byte {
+	if epoch == LegacyEpoch {
+		return []byte("kms/recipient/mlkem768")
+	}
+	return []byte(fmt.Sprintf("kms/recipient/mlkem768@%d", epoch))
+}
+
+// recipientRecord is the stored form of a recipient. SealedKey is an AES-GCM
+// envelope of the packed decapsulation key under the epoch's REK, AAD = its
+// recipientKey; the decapsulation key is never at rest in the clear.
+type recipientRecord struct {
+	Scheme    string    `json:"scheme"`
+	PublicKey []byte    `json:"public_key"`
+	SealedKey []byte    `json:"sealed_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// loadRecipients fills k with the recipient of each of its epochs,
+// unsealing each decapsulation key under that epoch's REK, and creates the
+// current epoch's on first use. An older epoch with no recipient has only v1
+// records and needs none. A recipient that does not open under its REK is an
+// error: the server was started with another REK for that epoch, and every
+// record wrapped to it would be unreadable.
+func (s *SecretStore) loadRecipients(k *Keyring) error {
+	for _, epoch := range k.Epochs() {
+		rek := k.reks[epoch]
+		rec, err := s.getRecipient(epoch)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			if epoch != k.current {
+				continue
+			}
+			rec, err = s.createRecipient(epoch, rek)
+		}
+		if err != nil {
+			return err
+		}
+		r, err := openRecipient(epoch, rek, rec)
+		if err != nil {
+			return fmt.Errorf("store: the ML-KEM recipient of REK epoch %d does not open under its REK: %w", epoch, err)
+		}
+		k.recipients[epoch] = r
+	}
+	return nil
+}
+
+func (s *SecretStore) getRecipient(epoch uint32) (*recipientRecord, error) {
+	var rec recipientRecord
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(recipientKey(epoch))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &rec)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// createRecipient generates and stores a recipient, unless another writer
+// stored one first; either way it returns the one stored.
+func (s *SecretStore) createRecipient(epoch uint32, rek []byte) (*recipientRecord, error) {
+	r, err := GenerateRecipient(epoch)
+	if err != nil {
+		return nil, err
+	}
+	packed := make([]byte, mlkem768.PrivateKeySize)
+	r.priv.Pack(packed)
+	defer clear(packed)
+	sealedKey, err := aeadSeal(rek, recipientKey(epoch), packed)
+	if err != nil {
+		return nil, err
+	}
+	rec := &recipientRecord{
+		Scheme:    mlkem768.Scheme().Name(),
+		PublicKey: make([]byte, mlkem768.PublicKeySize),
+		SealedKey: sealedKey,
+		CreatedAt: time.Now().UTC(),
+	}
+	r.pub.Pack(rec.PublicKey)
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(recipientKey(epoch)); err == nil {
+			return errRecipientExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return txn.Set(recipientKey(epoch), raw)
+	})
+	if errors.Is(err, errRecipientExists) || errors.Is(err, badger.ErrConflict) {
+		return s.getRecipient(epoch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+var errRecipientExists = errors.New("store: recipient exists")
+
+// openRecipient unseals epoch's rec under rek and checks that the
+// decapsulation key belongs to the stored public key.
+func openRecipient(epoch uint32, rek []byte, rec *recipientRecord) (*Recipient, error) {
+	if rec.Scheme != mlkem768.Scheme().Name() {
+		return nil, fmt.Errorf("unsupported scheme %q", rec.Scheme)
+	}
+	packed, err := aeadOpen(rek, recipientKey(epoch), rec.SealedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(packed)
+	var priv mlkem768.PrivateKey
+	if err := priv.Unpack(packed); err != nil {
+		return nil, err
+	}
+	var pub mlkem768.PublicKey
+	if err := pub.Unpack(rec.PublicKey); err != nil {
+		return nil, err
+	}
+	if !priv.Public().Equal(&pub) {
+		return nil, errors.New("decapsulation key does not match the public key")
+	}
+	return &Recipient{epoch: epoch, pub: &pub, priv: &priv}, nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// A value may refer to another secret with ${ref:path/name@env}. Reads expand
+// references server-side (SealedStore.Expand), so a database host kept once
+// can be part of many connection strings. "@env" may be omitted to mean the
+// referring secret's own env; a name with no "/" lives at the store root.
+// "$${ref:" is a literal "${ref:".
+const refOpen = "${ref:"
+
+// MaxRefDepth bounds how deep references may nest: a secret referring to one
+// that refers to another is depth 2.
+const MaxRefDepth = 8
+
+// maxRefsPerRead bounds how many references one read expands in total, so a
+// value cannot fan out into an amplification of reads.
+const maxRefsPerRead = 64
+
+// ErrRef is wrapped by every expansion error, each of which names the
+// reference it failed on. A caller maps ErrRefForbidden to a refusal and the
+// rest to a bad value.
+var ErrRef = errors.New("store: secret reference")
+
+var (
+	ErrRefSyntax     = fmt.Errorf("%w: malformed", ErrRef)
+	ErrRefCycle      = fmt.Errorf("%w: cycle", ErrRef)
+	ErrRefDepth      = fmt.Errorf("%w: nested deeper than %d", ErrRef, MaxRefDepth)
+	ErrRefTooMany    = fmt.Errorf("%w: more than %d in one read", ErrRef, maxRefsPerRead)
+	ErrRefForbidden  = fmt.Errorf("%w: not authorized", ErrRef)
+	ErrRefUnresolved = fmt.Errorf("%w: does not resolve", ErrRef)
+)
+
+// RefAuthorizer decides whether the reader may read ref. Expand asks it for
+// every reference before reading it, so a reference reaches only what the
+// caller could read directly. A non-nil error refuses.
+type RefAuthorizer func(ref secret.Ref) error
+
+// HasRefs reports whether value contains a reference to expand.
+func HasRefs(value []byte) bool {
+	return bytes.Contains(value, []byte(refOpen))
+}
+
+// Expand returns value, read at from, with every reference replaced by the
+// referenced secret's latest value, itself expanded. authorize is asked about
+// each reference before it is read. A value with no reference is returned as
+// is; otherwise the result is a new slice the caller must zero, and value is
+// left untouched.
+//
+// Any failure — a malformed reference, a cycle, nesting past MaxRefDepth, a
+// refused or missing reference — fails the whole read: a half-expanded
+// connection string is worse than none.
+func (s *SealedStore) Expand(from secret.Ref, value []byte, authorize RefAuthorizer) ([]byte, error) {
+	return s.ExpandContext(context.Background(), from, value, authorize)
+}
+
+// ExpandContext is Expand reading the references on behalf of the principal
+// on ctx (WithPrincipal).
+func (s *SealedStore) ExpandContext(ctx context.Context, from secret.Ref, value []byte, authorize RefAuthorizer) ([]byte, error) {
+	if !HasRefs(value) {
+		return value, nil
+	}
+	budget := maxRefsPerRead
+	return s.expand(ctx, from, value, []secret.Ref{from}, authorize, &budget)
+}
+
+func (s *SealedStore) expand(ctx context.Context, from secret.Ref, value []byte, chain []secret.Ref, authorize RefAuthorizer, budget *int) ([]byte, error) {
+	var out bytes.Buffer
+	rest := value
+	for {
+		i := bytes.Index(rest, []byte(refOpen))
+		if i < 0 {
+			out.Write(rest)
+			return out.Bytes(), nil
+		}
+		if i > 0 && rest[i-1] == '$' {
+			// "$${ref:" — the escape. Emit one "$" and the literal opener.
+			out.Write(rest[:i-1])
+			out.WriteString(refOpen)
+			rest = rest[i+len(refOpen):]
+			continue
+		}
+		out.Write(rest[:i])
+		end := bytes.IndexByte(rest[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated %q", ErrRefSyntax, truncateRef(rest[i:]))
+		}
+		ref, err := parseRef(string(rest[i+len(refOpen):i+end]), from.Env)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[i+end+1:]
+
+		for _, seen := range chain {
+			if seen.Path == ref.Path && seen.Env == ref.Env && seen.Name == ref.Name {
+				return nil, fmt.Errorf("%w: %s", ErrRefCycle, refChain(append(chain, ref)))
+			}
+		}
+		if len(chain) > MaxRefDepth {
+			return nil, fmt.Errorf("%w: %s", ErrRefDepth, refChain(append(chain, ref)))
+		}
+		if *budget--; *budget < 0 {
+			return nil, ErrRefTooMany
+		}
+		if authorize != nil {
+			if err := authorize(ref); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrRefForbidden, refString(ref), err)
+			}
+		}
+		v, _, err := s.GetVersionContext(ctx, ref.Path, ref.Name, ref.Env, 0)
+		if errors.Is(err, ErrSecretNotFound) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrRefUnresolved, refString(ref), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// expand always builds a new slice, so v and expanded are both ours.
+		expanded, err := s.expand(ctx, ref, v, append(chain[:len(chain):len(chain)], ref), authorize, budget)
+		if err != nil {
+			clear(v)
+			return nil, err
+		}
+		out.Write(expanded)
+		clear(expanded)
+		clear(v)
+	}
+}
+
+// parseRef reads "path/name@env" (or "name@env", or either without "@env",
+// which takes defaultEnv).
+func parseRef(body, defaultEnv string) (secret.Ref, error) {
+	target, env := body, defaultEnv
+	if at := strings.LastIndex(body, "@"); at >= 0 {
+		target, env = body[:at], body[at+1:]
+	}
+	ref := secret.Ref{Env: env, Name: target}
+	if slash := strings.LastIndex(target, "/"); slash >= 0 {
+		ref.Path, ref.Name = normalizePath(target[:slash]), target[slash+1:]
+	}
+	if !ValidCoord(ref.Env, ref.Name) {
+		return secret.Ref{}, fmt.Errorf("%w: ${ref:%s}", ErrRefSyntax, body)
+	}
+	return ref, nil
+}
+
+func refString(ref secret.Ref) string {
+	if ref.Path == "" {
+		return ref.Name + "@" + ref.Env
+	}
+	return ref.Path + "/" + ref.Name + "@" + ref.Env
+}
+
+func refChain(chain []secret.Ref) string {
+	parts := make([]string, len(chain))
+	for i, ref := range chain {
+		parts[i] = refString(ref)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// truncateRef keeps an error message about a malformed reference short.
+func truncateRef(b []byte) string {
+	if len(b) > 40 {
+		return string(b[:40]) + "..."
+	}
+	return string(b)
+}
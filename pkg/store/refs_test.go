@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+func putValue(t *testing.T, s *SealedStore, path, name, env, value string) {
+	t.Helper()
+	if _, err := s.Put(path, name, env, []byte(value), PutOptions{}); err != nil {
+		t.Fatalf("put %s/%s@%s: %v", path, name, env, err)
+	}
+}
+
+func expandAt(s *SealedStore, path, name, env string, authorize RefAuthorizer) (string, error) {
+	v, err := s.Get(path, name, env)
+	if err != nil {
+		return "", err
+	}
+	out, err := s.Expand(secret.Ref{Path: path, Env: env, Name: name}, v, authorize)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func TestExpandResolvesReferences(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "db", "host", "prod", "db.internal")
+	putValue(t, s, "db", "user", "prod", "app")
+	putValue(t, s, "", "port", "shared", "5432")
+	putValue(t, s, "app", "dsn", "prod", "postgres://${ref:db/user}@${ref:db/host@prod}:${ref:port@shared}/app")
+	putValue(t, s, "app", "doc", "prod", "write $${ref:db/host} to refer")
+	putValue(t, s, "app", "plain", "prod", "no references here")
+
+	for name, want := range map[string]string{
+		"dsn":   "postgres://app@db.internal:5432/app",
+		"doc":   "write ${ref:db/host} to refer",
+		"plain": "no references here",
+	} {
+		got, err := expandAt(s, "app", name, "prod", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExpandNestedReferences(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "a", "leaf", "dev", "value")
+	putValue(t, s, "a", "mid", "dev", "[${ref:a/leaf}]")
+	putValue(t, s, "a", "top", "dev", "<${ref:a/mid}>")
+	got, err := expandAt(s, "a", "top", "dev", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "<[value]>" {
+		t.Fatalf("top = %q", got)
+	}
+}
+
+func TestExpandRejectsCycleAndDepth(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "c", "a", "dev", "${ref:c/b}")
+	putValue(t, s, "c", "b", "dev", "${ref:c/a}")
+	putValue(t, s, "c", "self", "dev", "x${ref:c/self}")
+	for _, name := range []string{"a", "self"} {
+		if _, err := expandAt(s, "c", name, "dev", nil); !errors.Is(err, ErrRefCycle) {
+			t.Fatalf("%s: err = %v, want ErrRefCycle", name, err)
+		}
+	}
+
+	// A chain one longer than MaxRefDepth: d0 -> d1 -> ... -> d(N+1).
+	for i := 0; i <= MaxRefDepth; i++ {
+		putValue(t, s, "d", fmt.Sprintf("d%d", i), "dev", fmt.Sprintf("${ref:d/d%d}", i+1))
+	}
+	putValue(t, s, "d", fmt.Sprintf("d%d", MaxRefDepth+1), "dev", "end")
+	if _, err := expandAt(s, "d", "d0", "dev", nil); !errors.Is(err, ErrRefDepth) {
+		t.Fatalf("deep chain: err = %v, want ErrRefDepth", err)
+	}
+	if got, err := expandAt(s, "d", "d1", "dev", nil); err != nil || got != "end" {
+		t.Fatalf("chain of MaxRefDepth: %q, %v", got, err)
+	}
+}
+
+func TestExpandFailsClosed(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "x", "secret", "prod", "s3cr3t")
+	putValue(t, s, "y", "ref", "prod", "${ref:x/secret}")
+	putValue(t, s, "y", "missing", "prod", "${ref:x/nope}")
+	putValue(t, s, "y", "bad", "prod", "${ref:x/}")
+	putValue(t, s, "y", "open", "prod", "${ref:x/secret")
+
+	denyX := func(ref secret.Ref) error {
+		if ref.Path == "x" {
+			return errors.New("path x not granted")
+		}
+		return nil
+	}
+	if _, err := expandAt(s, "y", "ref", "prod", denyX); !errors.Is(err, ErrRefForbidden) {
+		t.Fatalf("denied reference: err = %v, want ErrRefForbidden", err)
+	}
+	if _, err := expandAt(s, "y", "missing", "prod", nil); !errors.Is(err, ErrRefUnresolved) {
+		t.Fatalf("missing reference: err = %v, want ErrRefUnresolved", err)
+	}
+	for _, name := range []string{"bad", "open"} {
+		if _, err := expandAt(s, "y", name, "prod", nil); !errors.Is(err, ErrRefSyntax) {
+			t.Fatalf("%s: err = %v, want ErrRefSyntax", name, err)
+		}
+	}
+}
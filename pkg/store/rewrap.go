@@ -0,0 +1,311 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// rewrapBatch is how many records a re-wrap run moves per scan, so a run over
+// a large store never holds more than this many records in memory, and a
+// throttled run pauses between batches of this size.
+const rewrapBatch = 256
+
+// ErrRewrapRunning refuses a re-wrap run while another is in progress.
+var ErrRewrapRunning = errors.New("store: a re-wrap run is already in progress")
+
+// RewrapProgress reports a re-wrap run.
+type RewrapProgress struct {
+	// Epoch is the REK epoch records are being moved to.
+	Epoch   uint32 `json:"epoch"`
+	Running bool   `json:"running"`
+	// Rewrapped counts the records this run has moved so far.
+	Rewrapped int `json:"rewrapped"`
+	// Remaining counts, per epoch, the records still wrapped under it (or,
+	// for the current epoch, in an older envelope). It is counted when the
+	// run starts, kept as the run moves records, and recounted when it
+	// ends. An epoch other than the current one can be dropped from the
+	// keyring once it is absent here after a finished run.
+	Remaining  map[uint32]int `json:"remaining"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// rewrapPrefixes hold every sealed record: the latest records, their version
+// history, tombstones (whose values are tombstoneRecords), transit keys,
+// tokenization keys and outstanding BYOK import keys.
+var rewrapPrefixes = [][]byte{secretPrefix, versionPrefix, deletedPrefix, transitPrefix, tokenizePrefix, byokPrefix}
+
+// Rewrap moves every record not wrapped the way the store writes today — a v1,
+// v2 or v3 envelope, or a v4 one under an older REK epoch — to a v4 envelope
+// under the current epoch: its DEK is unwrapped and encapsulated to the
+// current epoch's ML-KEM recipient, bound to the record's coordinate and
+// version. The payload ciphertext, the version and
+// every other field are left as they were, so no value changes and the change
+// feed sees nothing. It returns the number of records it moved.
+//
+// Records under an epoch the keyring does not hold are left where they are,
+// and stay in RewrapStatus's Remaining. Rewrap is idempotent and safe beside
+// live writes: each record is replaced in its own transaction only if its
+// stored bytes are unchanged since the scan.
+func (s *SealedStore) Rewrap() (int, error) {
+	return s.runRewrap(context.Background(), 0)
+}
+
+// RunRewrap is Rewrap as a background job: it pauses between batches of
+// rewrapBatch records so a large store is re-wrapped without starving live
+// traffic, and reports to logf when it starts and ends. Progress is readable
+// at any time from RewrapStatus. It returns when the run ends or ctx is done.
+func (s *SealedStore) RunRewrap(ctx context.Context, pause time.Duration, logf func(format string, args ...any)) {
+	remaining, err := s.secrets.staleRecords(s.keys)
+	if err != nil {
+		logf("kms: re-wrap: counting records: %v", err)
+		return
+	}
+	if len(remaining) == 0 {
+		return
+	}
+	logf("kms: re-wrap: moving %d record(s) to REK epoch %d: %v", total(remaining), s.keys.current, remaining)
+	n, err := s.runRewrap(ctx, pause)
+	p := s.RewrapStatus()
+	switch {
+	case err != nil:
+		logf("kms: re-wrap: stopped after %d record(s): %v", n, err)
+	case len(p.Remaining) > 0:
+		logf("kms: re-wrap: moved %d record(s); %v remain under REK epochs this keyring does not hold", n, p.Remaining)
+	default:
+		logf("kms: re-wrap: moved %d record(s); every record is under REK epoch %d", n, p.Epoch)
+	}
+}
+
+// RewrapStatus returns the progress of the latest re-wrap run.
+func (s *SealedStore) RewrapStatus() RewrapProgress {
+	s.rewrapMu.Lock()
+	defer s.rewrapMu.Unlock()
+	p := s.rewrap
+	p.Remaining = make(map[uint32]int, len(s.rewrap.Remaining))
+	for epoch, n := range s.rewrap.Remaining {
+		p.Remaining[epoch] = n
+	}
+	return p
+}
+
+// runRewrap is one re-wrap run, pausing between batches.
+func (s *SealedStore) runRewrap(ctx context.Context, pause time.Duration) (int, error) {
+	s.rewrapMu.Lock()
+	if s.rewrap.Running {
+		s.rewrapMu.Unlock()
+		return 0, ErrRewrapRunning
+	}
+	s.rewrap = RewrapProgress{Epoch: s.keys.current, Running: true, StartedAt: time.Now().UTC()}
+	s.rewrapMu.Unlock()
+
+	err := s.rewrapAll(ctx, pause)
+	remaining, cerr := s.secrets.staleRecords(s.keys)
+	if err == nil {
+		err = cerr
+	}
+
+	s.rewrapMu.Lock()
+	defer s.rewrapMu.Unlock()
+	now := time.Now().UTC()
+	s.rewrap.Running, s.rewrap.FinishedAt = false, &now
+	if cerr == nil {
+		s.rewrap.Remaining = remaining
+	}
+	if err != nil {
+		s.rewrap.Error = err.Error()
+	}
+	return s.rewrap.Rewrapped, err
+}
+
+func (s *SealedStore) rewrapAll(ctx context.Context, pause time.Duration) error {
+	remaining, err := s.secrets.staleRecords(s.keys)
+	if err != nil {
+		return err
+	}
+	s.rewrapMu.Lock()
+	s.rewrap.Remaining = remaining
+	s.rewrapMu.Unlock()
+
+	for _, prefix := range rewrapPrefixes {
+		tomb := bytes.Equal(prefix, deletedPrefix)
+		seek := prefix
+		for seek != nil {
+			var err error
+			if seek, err = s.rewrapBatch(prefix, seek, tomb); err != nil {
+				return err
+			}
+			if seek == nil || pause <= 0 {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+	return nil
+}
+
+// rewrapBatch moves up to rewrapBatch stale records under prefix, starting
+// at seek, and returns the key to resume from; nil once prefix is done.
+func (s *SealedStore) rewrapBatch(prefix, seek []byte, tomb bool) ([]byte, error) {
+	type found struct {
+		key, raw, out []byte
+		epoch         uint32
+	}
+	var batch []found
+	var next []byte
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(seek); it.Valid(); it.Next() {
+			item := it.Item()
+			if len(batch) == rewrapBatch {
+				next = item.KeyCopy(nil)
+				return nil
+			}
+			raw, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			out, epoch, err := s.rewrapRaw(raw, tomb)
+			if err != nil {
+				return err
+			}
+			if out != nil {
+				batch = append(batch, found{key: item.KeyCopy(nil), raw: raw, out: out, epoch: epoch})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range batch {
+		wrote, err := s.secrets.replaceIfUnchanged(f.key, f.raw, f.out)
+		if err != nil {
+			return nil, err
+		}
+		// A record rewritten since the scan was rewritten by a live write,
+		// under the current epoch: it is no longer remaining either way.
+		s.rewrapMu.Lock()
+		if wrote {
+			s.rewrap.Rewrapped++
+		}
+		if s.rewrap.Remaining[f.epoch]--; s.rewrap.Remaining[f.epoch] <= 0 {
+			delete(s.rewrap.Remaining, f.epoch)
+		}
+		s.rewrapMu.Unlock()
+	}
+	return next, nil
+}
+
+// rewrapRaw returns the stored bytes raw with the record's DEK moved to the
+// current epoch, and the epoch it moved from; nil when the record needs no
+// move, or is under an epoch the keyring does not hold.
+func (s *SealedStore) rewrapRaw(raw []byte, tomb bool) ([]byte, uint32, error) {
+	var t tombstoneRecord
+	rec, target := &t.Record, any(&t.Record)
+	if tomb {
+		target = &t
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return nil, 0, err
+	}
+	epoch, stale, err := s.keys.stale(rec)
+	if err != nil || !stale {
+		return nil, 0, err
+	}
+	if _, held := s.keys.reks[epoch]; !held {
+		return nil, 0, nil
+	}
+	if err := s.keys.rewrap(rec); err != nil {
+		return nil, 0, err
+	}
+	out, err := json.Marshal(target)
+	return out, epoch, err
+}
+
+// staleRecords counts, per epoch, the records k would re-wrap.
+func (s *SecretStore) staleRecords(k *Keyring) (map[uint32]int, error) {
+	counts := make(map[uint32]int)
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, prefix := range rewrapPrefixes {
+			tomb := bytes.Equal(prefix, deletedPrefix)
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				var t tombstoneRecord
+				rec, target := &t.Record, any(&t.Record)
+				if tomb {
+					target = &t
+				}
+				if err := it.Item().Value(func(val []byte) error {
+					return json.Unmarshal(val, target)
+				}); err != nil {
+					it.Close()
+					return err
+				}
+				epoch, stale, err := k.stale(rec)
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if stale {
+					counts[epoch]++
+				}
+			}
+			it.Close()
+		}
+		return nil
+	})
+	return counts, err
+}
+
+func total(counts map[uint32]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// replaceIfUnchanged sets key to out only if it still holds old, and reports
+// whether it did. A record deleted or rewritten since it was read is left to
+// the write that changed it.
+func (s *SecretStore) replaceIfUnchanged(key, old, out []byte) (bool, error) {
+	wrote := false
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cur, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(cur, old) {
+			return nil
+		}
+		wrote = true
+		return txn.Set(key, out)
+	})
+	return wrote, err
+}
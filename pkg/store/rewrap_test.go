@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+)
+
+// writeV1 stores value at (path, name, env) in the v1 envelope, as the store
+// wrote it before v2.
+func writeV1(t *testing.T, s *SealedStore, path, name, env, value string) {
+	t.Helper()
+	sec, err := Seal(s.keys.reks[LegacyEpoch], path, name, env, []byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Secrets().Write(sec, WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewrapMovesV1RecordsToMLKEM(t *testing.T) {
+	s := sealedTestStore(t)
+	writeV1(t, s, "svc", "API_KEY", "prod", "one")
+	writeV1(t, s, "svc", "API_KEY", "prod", "two")
+	writeV1(t, s, "svc", "GONE", "prod", "deleted")
+	if err := s.Delete("svc", "GONE", "prod", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	putValue(t, s, "svc", "NEW", "prod", "already v4")
+
+	before, _ := s.Secrets().Get("svc", "API_KEY", "prod")
+	// Latest + two history entries of API_KEY, GONE's history entry and its
+	// tombstone; NEW is already v4.
+	n, err := s.Rewrap()
+	if err != nil || n != 5 {
+		t.Fatalf("Rewrap = %d, %v; want 5", n, err)
+	}
+	after, _ := s.Secrets().Get("svc", "API_KEY", "prod")
+	if after.WrappedDEK[0] != wrapVersionBound || !bytes.Equal(after.Ciphertext, before.Ciphertext) || after.Version != before.Version {
+		t.Fatal("Rewrap changed more than the DEK wrap")
+	}
+	for version, want := range map[int]string{1: "one", 2: "two"} {
+		rec, err := s.Secrets().GetVersion("svc", "API_KEY", "prod", version)
+		if err != nil || rec.WrappedDEK[0] != wrapVersionBound {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if v, _, err := s.GetVersion("svc", "API_KEY", "prod", version); err != nil || string(v) != want {
+			t.Fatalf("version %d = %q, %v", version, v, err)
+		}
+	}
+	if _, err := s.Secrets().Undelete("svc", "GONE", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get("svc", "GONE", "prod"); err != nil || string(v) != "deleted" {
+		t.Fatalf("undeleted = %q, %v", v, err)
+	}
+	if n, err := s.Rewrap(); err != nil || n != 0 {
+		t.Fatalf("second Rewrap = %d, %v; want 0", n, err)
+	}
+}
+
+func TestRecipientIsSealedUnderTheREK(t *testing.T) {
+	s := sealedTestStore(t)
+	putValue(t, s, "svc", "K", "dev", "v")
+
+	again, err := NewSealedStore(s.Secrets(), s.keys.reks[LegacyEpoch])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := again.Get("svc", "K", "dev"); err != nil || string(v) != "v" {
+		t.Fatalf("a second sealed store over the same records = %q, %v", v, err)
+	}
+	stored, err := s.Secrets().getRecipient(LegacyEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := make([]byte, mlkem768.PrivateKeySize)
+	s.keys.recipients[LegacyEpoch].priv.Pack(packed)
+	if bytes.Contains(stored.SealedKey, packed[:64]) {
+		t.Fatal("the decapsulation key is stored in the clear")
+	}
+
+	other := make([]byte, 32)
+	rand.Read(other)
+	if _, err := NewSealedStore(s.Secrets(), other); err == nil {
+		t.Fatal("a sealed store opened the recipient under another REK")
+	}
+	if _, err := NewSealedStore(s.Secrets(), other); errors.Is(err, ErrBadKey) {
+		t.Fatal("wrong REK reported as a bad key size")
+	}
+}
+
+func TestRewrapBindsV3RecordsToTheirCoordinate(t *testing.T) {
+	s := sealedTestStore(t)
+	for _, value := range []string{"one", "two"} {
+		sec, err := SealFor(s.keys.recipients[LegacyEpoch], "svc", "API_KEY", "prod", []byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Secrets().Write(sec, WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := s.Rewrap(); err != nil || n != 3 {
+		t.Fatalf("Rewrap = %d, %v; want 3 (latest and two history entries)", n, err)
+	}
+	for version, want := range map[int]string{1: "one", 2: "two"} {
+		rec, err := s.Secrets().GetVersion("svc", "API_KEY", "prod", version)
+		if err != nil || rec.WrappedDEK[0] != wrapVersionBound {
+			t.Fatalf("version %d not moved to v4: %v", version, err)
+		}
+		if v, _, err := s.GetVersion("svc", "API_KEY", "prod", version); err != nil || string(v) != want {
+			t.Fatalf("version %d = %q, %v", version, v, err)
+		}
+	}
+}
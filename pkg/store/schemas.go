@@ -0,0 +1,154 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/schema"
+)
+
+// ErrSchemaNotFound is returned for a path that has no schema of its own.
+var ErrSchemaNotFound = errors.New("store: no schema at this path")
+
+// schemaPrefix holds value schemas: kms/schemas/{path}, the root's at
+// kms/schemas/ itself. A schema belongs to a path, not to an env or a
+// secret: it says what every secret under that path must look like, in every
+// env, so a value promoted from test to main met the same rules when it was
+// written. Rollback and Promote re-use values the store already holds and are
+// not checked again; a schema governs what callers write, from when it is set.
+var schemaPrefix = []byte("kms/schemas/")
+
+func schemaKey(path string) []byte {
+	return []byte(string(schemaPrefix) + normalizePath(path))
+}
+
+// SetSchema replaces the schema of path. It applies to writes from now on;
+// values already stored are not re-checked.
+func (s *SecretStore) SetSchema(path string, sc *schema.Schema) error {
+	if sc == nil {
+		return schema.ErrInvalidSchema
+	}
+	if err := sc.Check(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(schemaKey(path), raw)
+	})
+}
+
+// Schema returns the schema set at path itself — not those of its ancestors,
+// which apply as well (see Schemas).
+func (s *SecretStore) Schema(path string) (*schema.Schema, error) {
+	var sc *schema.Schema
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		sc, err = getSchema(txn, normalizePath(path))
+		if err == nil && sc == nil {
+			err = ErrSchemaNotFound
+		}
+		return err
+	})
+	return sc, err
+}
+
+// DeleteSchema removes the schema of path.
+func (s *SecretStore) DeleteSchema(path string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(schemaKey(path)); err == badger.ErrKeyNotFound {
+			return ErrSchemaNotFound
+		} else if err != nil {
+			return err
+		}
+		return txn.Delete(schemaKey(path))
+	})
+}
+
+// PathSchema is a schema and the path it is set at.
+type PathSchema struct {
+	Path   string         `json:"path"`
+	Schema *schema.Schema `json:"schema"`
+}
+
+// Schemas returns every schema that applies to a secret at path: the root's,
+// then each ancestor's, then path's own, skipping those not set.
+func (s *SecretStore) Schemas(path string) ([]PathSchema, error) {
+	var out []PathSchema
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		out, err = schemasFor(txn, path)
+		return err
+	})
+	return out, err
+}
+
+func schemasFor(txn *badger.Txn, path string) ([]PathSchema, error) {
+	p := normalizePath(path)
+	paths := []string{""}
+	for i, c := range p {
+		if c == '/' {
+			paths = append(paths, p[:i])
+		}
+	}
+	if p != "" {
+		paths = append(paths, p)
+	}
+	var out []PathSchema
+	for _, at := range paths {
+		sc, err := getSchema(txn, at)
+		if err != nil {
+			return nil, err
+		}
+		if sc != nil {
+			out = append(out, PathSchema{Path: at, Schema: sc})
+		}
+	}
+	return out, nil
+}
+
+func getSchema(txn *badger.Txn, path string) (*schema.Schema, error) {
+	item, err := txn.Get(schemaKey(path))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sc schema.Schema
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &sc)
+	}); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// validateValue checks the value of the secret name against every schema in
+// schemas and returns the first *schema.RuleError, its Path set to the path
+// of the schema the rule belongs to ("/" for the root's).
+func validateValue(schemas []PathSchema, name string, value []byte) error {
+	for _, ps := range schemas {
+		if err := ps.Schema.Validate(name, value); err != nil {
+			var re *schema.RuleError
+			if errors.As(err, &re) {
+				re.Path = "/" + ps.Path
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkValue is validateValue against the schemas that apply at path.
+func (s *SecretStore) checkValue(path, name string, value []byte) error {
+	schemas, err := s.Schemas(path)
+	if err != nil {
+		return err
+	}
+	return validateValue(schemas, name, value)
+}
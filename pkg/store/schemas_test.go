@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/schema"
+)
+
+func mustSchema(t *testing.T, doc string) *schema.Schema {
+	t.Helper()
+	sc, err := schema.Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func TestSchemasApplyFromEveryAncestor(t *testing.T) {
+	s := sealedTestStore(t)
+	secrets := s.Secrets()
+	if err := secrets.SetSchema("", mustSchema(t, `{"rules":[{"id":"cap","type":"length","max_length":32}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.SetSchema("/svc/", mustSchema(t, `{"rules":[{"id":"endpoint","name":"*_URL","type":"url"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	putValue(t, s, "svc/api", "DB_URL", "dev", "postgres://db/app")
+	putValue(t, s, "other", "DB_URL", "dev", "not checked here")
+
+	_, err := s.Put("svc/api", "DB_URL", "dev", []byte("db:5432"), PutOptions{})
+	var re *schema.RuleError
+	if !errors.As(err, &re) || re.Rule != `"endpoint"` || re.Path != "/svc" {
+		t.Fatalf("url rule: %v", err)
+	}
+	_, err = s.Put("other", "TOKEN", "dev", make([]byte, 33), PutOptions{})
+	if !errors.As(err, &re) || re.Rule != `"cap"` || re.Path != "/" {
+		t.Fatalf("root rule: %v", err)
+	}
+	if v, _ := s.Versions("svc/api", "DB_URL", "dev"); len(v) != 1 {
+		t.Fatalf("a refused write stored a version: %+v", v)
+	}
+
+	if _, err := s.Import(importEntries("A_URL", "https://ok.example", "B_URL", "bad"), ImportOptions{Path: "svc", Env: "dev"}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("import: %v", err)
+	}
+	if v, _ := s.Versions("svc", "A_URL", "dev"); len(v) != 0 {
+		t.Fatal("a refused import wrote its good entries")
+	}
+
+	applies, err := secrets.Schemas("svc/api")
+	if err != nil || len(applies) != 2 || applies[0].Path != "" || applies[1].Path != "svc" {
+		t.Fatalf("Schemas = %+v, %v", applies, err)
+	}
+	if err := secrets.DeleteSchema("svc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.DeleteSchema("svc"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("second delete: %v", err)
+	}
+	putValue(t, s, "svc/api", "DB_URL", "dev", "db:5432")
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/generate"
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// ErrUnsealedRecord is returned when a read finds a record that was stored
+// without a WrappedDEK — the raw value the HTTP surface used to write before it
+// shared this sealing path. Such a record is not readable until
+// SealLegacy has re-sealed it; it is never handed back as if its bytes were the
+// value.
+var ErrUnsealedRecord = errors.New("store: record is not sealed under the REK (run SealLegacy)")
+
+// SealedStore is the ONE value path into and out of a SecretStore. Every
+// transport that reads or writes a secret value — the HTTP /v1/kms/secrets*
+// surface, OpSecretPut / OpSecretGet on the ZAP wire and /v1/sdk — goes through
+// it, so a record written on one is always the record the other reads.
+//
+// Before it existed the two transports disagreed about what a record holds: the
+// HTTP put stored the request value straight into Ciphertext with no
+// WrappedDEK, the ZAP get then failed to Open it, and an HTTP get of a
+// ZAP-written record returned sealed bytes as if they were the value. Seal and
+// Open live in one place now; neither transport touches Ciphertext.
+type SealedStore struct {
+	secrets *SecretStore
+	// keys are the REKs by epoch, with the ML-KEM-768 recipient of each:
+	// writes seal to the current epoch's, reads open under whichever epoch a
+	// record names.
+	keys *Keyring
+	// threshold opens and seals ModeThresholdReveal records; nil refuses
+	// them (ErrThresholdUnavailable). See SetThresholdReveal.
+	threshold *ThresholdReveal
+
+	// rewrap is the state of the latest re-wrap run; see RewrapStatus.
+	rewrapMu sync.Mutex
+	rewrap   RewrapProgress
+}
+
+// NewSealedStore binds a SecretStore to the REK that seals its values, as a
+// keyring of that one key at LegacyEpoch. The master key is held by
+// reference, not copied: the caller owns its lifetime and zeroes it at
+// shutdown (see mpcrek.Zero).
+func NewSealedStore(secrets *SecretStore, masterKey []byte) (*SealedStore, error) {
+	if len(masterKey) != 32 {
+		return nil, ErrBadKey
+	}
+	k, err := NewKeyring(LegacyEpoch, map[uint32][]byte{LegacyEpoch: masterKey})
+	if err != nil {
+		return nil, err
+	}
+	return NewSealedStoreWithKeyring(secrets, k)
+}
+
+// NewSealedStoreWithKeyring binds a SecretStore to a keyring of REKs by
+// epoch.
+//
+// It loads the ML-KEM recipient of each epoch, creating the current epoch's
+// on first use. A recipient sealed under a different REK than the keyring
+// holds for its epoch is an error, not a fresh start.
+func NewSealedStoreWithKeyring(secrets *SecretStore, k *Keyring) (*SealedStore, error) {
+	if secrets == nil {
+		return nil, errors.New("store: sealed store requires a secret store")
+	}
+	if k == nil {
+		return nil, ErrBadKeyring
+	}
+	if err := secrets.loadRecipients(k); err != nil {
+		return nil, err
+	}
+	return &SealedStore{secrets: secrets, keys: k}, nil
+}
+
+// Keyring returns the REK keyring the store seals under.
+func (s *SealedStore) Keyring() *Keyring { return s.keys }
+
+// Secrets returns the underlying record store, for the coordinate-only
+// operations (Find, Deleted, Undelete, Purge) that never touch a value.
+func (s *SealedStore) Secrets() *SecretStore { return s.secrets }
+
+// PutOptions carries what a write records besides its value.
+type PutOptions struct {
+	// Writer identifies the caller that wrote this version ("iam:org/user",
+	// "zap:<identity>"); it is reported by Versions and never interpreted.
+	Writer string
+	// If guards the write; see Precondition.
+	If Precondition
+	// Meta, when non-nil, replaces the secret's metadata with this write.
+	Meta *secret.Meta
+	// Lock, when non-nil, creates the secret locked; see WriteOptions.Lock.
+	Lock *secret.Lock
+	// Mode is how the value is stored: ModeStandard (sealed under the REK)
+	// or ModeThresholdReveal (TFHE under the threshold key; see
+	// ThresholdReveal). "" keeps the mode of the latest version, and is
+	// ModeStandard for a new secret.
+	Mode string
+}
+
+// Put seals value under a fresh DEK and stores it at (path, name, env) as that
+// coordinate's next version, which it returns. The value must pass every
+// schema that applies at path (SecretStore.Schemas); one that fails is
+// refused with a *schema.RuleError naming the rule.
+func (s *SealedStore) Put(path, name, env string, value []byte, opts PutOptions) (int, error) {
+	return s.PutContext(context.Background(), path, name, env, value, opts)
+}
+
+// PutContext is Put for a write on behalf of the request ctx: a
+// threshold-reveal encrypt stops when it is cancelled.
+func (s *SealedStore) PutContext(ctx context.Context, path, name, env string, value []byte, opts PutOptions) (int, error) {
+	if !ValidCoord(env, name) {
+		return 0, ErrInvalidCoord
+	}
+	if err := s.secrets.checkValue(path, name, value); err != nil {
+		return 0, err
+	}
+	mode, err := s.writeMode(path, name, env, opts.Mode)
+	if err != nil {
+		return 0, err
+	}
+	var sec *Secret
+	if mode == ModeThresholdReveal {
+		sec, err = s.sealThreshold(ctx, path, name, env, value)
+	} else {
+		sec, err = s.sealRecord(path, name, env, value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer sec.dropDEK()
+	sec.CreatedBy = opts.Writer
+	if err := s.secrets.Write(sec, WriteOptions{If: opts.If, Meta: opts.Meta, Lock: opts.Lock}); err != nil {
+		return 0, err
+	}
+	return sec.Version, nil
+}
+
+// Generate makes a value by policy inside the KMS (pkg/generate) and puts it
+// at (path, name, env) exactly as Put would, so no caller ever handles it on
+// the way in. It returns the version written and what was generated; the
+// caller zeroes gen.Secret and decides whether to reveal it.
+func (s *SealedStore) Generate(path, name, env string, p generate.Policy, opts PutOptions) (int, *generate.Value, error) {
+	return s.GenerateContext(context.Background(), path, name, env, p, opts)
+}
+
+// GenerateContext is Generate for a write on behalf of the request ctx; see
+// PutContext.
+func (s *SealedStore) GenerateContext(ctx context.Context, path, name, env string, p generate.Policy, opts PutOptions) (int, *generate.Value, error) {
+	gen, err := generate.Generate(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	version, err := s.PutContext(ctx, path, name, env, gen.Secret, opts)
+	if err != nil {
+		clear(gen.Secret)
+		return 0, nil, err
+	}
+	return version, gen, nil
+}
+
+// Get reads and opens the latest value at (path, name, env). The caller must
+// zero the returned slice after use.
+func (s *SealedStore) Get(path, name, env string) ([]byte, error) {
+	value, _, err := s.GetVersion(path, name, env, 0)
+	return value, err
+}
+
+// GetVersion reads and opens one version of (path, name, env) — 0 is the
+// latest — and reports which version it opened. The caller must zero the
+// returned slice after use.
+func (s *SealedStore) GetVersion(path, name, env string, version int) ([]byte, int, error) {
+	return s.GetVersionContext(context.Background(), path, name, env, version)
+}
+
+// GetVersionContext is GetVersion for a read on behalf of the principal on
+// ctx (WithPrincipal), whom a threshold reveal audits.
+func (s *SealedStore) GetVersionContext(ctx context.Context, path, name, env string, version int) ([]byte, int, error) {
+	sec, err := s.secrets.GetVersion(path, name, env, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := s.openRecord(ctx, sec)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, sec.Version, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context that names who a read is for — the writer
+// identity the transport authenticated — so the audit line of a threshold
+// reveal it runs says who asked.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// principalFrom returns the principal WithPrincipal put on ctx, or "".
+func principalFrom(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// Versions lists the versions of (path, name, env); see SecretStore.Versions.
+func (s *SealedStore) Versions(path, name, env string) ([]secret.Version, error) {
+	return s.secrets.Versions(path, name, env)
+}
+
+// Rollback makes version the latest value of (path, name, env) by writing it
+// as a new version authored by opts.Writer, which it returns. A
+// threshold-reveal version is decrypted and encrypted again, audited, rather
+// than copied.
+func (s *SealedStore) Rollback(path, name, env string, version int, opts PutOptions) (int, error) {
+	return s.RollbackContext(context.Background(), path, name, env, version, opts)
+}
+
+// RollbackContext is Rollback on behalf of the request ctx. A
+// threshold-reveal version is encrypted again on ctx before the write
+// transaction, which then refuses it with ErrThresholdSourceChanged if the
+// version is no longer the one that was read.
+func (s *SealedStore) RollbackContext(ctx context.Context, path, name, env string, version int, opts PutOptions) (int, error) {
+	var copied *thresholdCopy
+	var src *Secret
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		var err error
+		src, err = getVersion(txn, path, name, env, version)
+		return err
+	})
+	if version > 0 && err == nil && src.Scheme == ModeThresholdReveal {
+		if copied, err = s.resealThreshold(ctx, src, src.Path, src.Name, src.Env); err != nil {
+			return 0, err
+		}
+	}
+	rebind := func(old, rec *Secret) error {
+		if old.Scheme != ModeThresholdReveal {
+			return s.keys.rebind(old, rec)
+		}
+		if copied == nil || !copied.from(old) {
+			return ErrThresholdSourceChanged
+		}
+		rec.Ciphertext, rec.KeyHandle = copied.rec.Ciphertext, copied.rec.KeyHandle
+		return nil
+	}
+	rec, err := s.secrets.rollback(path, name, env, version, opts.Writer, opts.If, rebind)
+	if err != nil {
+		return 0, err
+	}
+	if copied != nil {
+		s.auditCopy(copied, "rollback", opts.Writer)
+	}
+	return rec.Version, nil
+}
+
+// Meta returns the metadata of (path, name, env); see SecretStore.Meta.
+func (s *SealedStore) Meta(path, name, env string) (*secret.Meta, error) {
+	return s.secrets.Meta(path, name, env)
+}
+
+// SetMeta replaces the metadata of (path, name, env); see SecretStore.SetMeta.
+func (s *SealedStore) SetMeta(path, name, env string, m *secret.Meta, cond Precondition) error {
+	return s.secrets.SetMeta(path, name, env, m, cond)
+}
+
+// Delete tombstones the record at (path, name, env); see SecretStore.Delete.
+func (s *SealedStore) Delete(path, name, env string, opts DeleteOptions) error {
+	return s.secrets.Delete(path, name, env, opts)
+}
+
+// Find enumerates coordinates; see SecretStore.Find.
+func (s *SealedStore) Find(q secret.Query) ([]secret.Ref, bool, error) {
+	return s.secrets.Find(q)
+}
+
+// FindPage enumerates one page of coordinates; see SecretStore.FindPage.
+func (s *SealedStore) FindPage(q secret.Query) ([]secret.Ref, string, error) {
+	return s.secrets.FindPage(q)
+}
+
+// isLegacyUnsealed reports whether rec is a pre-SealedStore HTTP write: a
+// standard-mode record with no wrapped DEK, whose Ciphertext is the raw value.
+func isLegacyUnsealed(rec *Secret) bool {
+	return len(rec.WrappedDEK) == 0 && (rec.Scheme == "" || rec.Scheme == ModeStandard)
+}
+
+// SealLegacy finds every record the HTTP surface stored unsealed and re-seals it
+// in place under the REK, so a value written over HTTP before the transports
+// shared one path reads back over ZAP — and the other way round. It returns the
+// number of records it re-sealed.
+//
+// It is idempotent: a sealed record is never touched, so running it at every
+// boot costs one keys-and-values scan and converges after the first. Each
+// record is rewritten in its own transaction that re-checks the stored bytes,
+// so a concurrent Put of the same coordinate is never overwritten with a stale
+// value.
+func (s *SealedStore) SealLegacy() (int, error) {
+	type legacy struct {
+		key []byte
+		raw []byte
+		rec Secret
+	}
+	var found []legacy
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = secretPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			raw, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			var rec Secret
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return fmt.Errorf("store: corrupt secret record key=%s: %w", item.Key(), err)
+			}
+			if isLegacyUnsealed(&rec) {
+				found = append(found, legacy{key: item.KeyCopy(nil), raw: raw, rec: rec})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sealed := 0
+	for _, l := range found {
+		pt := l.rec.Ciphertext
+		rec, err := s.sealRecord(l.rec.Path, l.rec.Name, l.rec.Env, pt)
+		clear(pt)
+		if err != nil {
+			return sealed, err
+		}
+		rec.KeyHandle, rec.PolicyID, rec.Version = l.rec.KeyHandle, l.rec.PolicyID, l.rec.Version
+		if !l.rec.CreatedAt.IsZero() {
+			rec.CreatedAt = l.rec.CreatedAt
+		}
+		if err := rec.bindDEK(); err != nil {
+			return sealed, err
+		}
+		out, err := json.Marshal(rec)
+		if err != nil {
+			return sealed, err
+		}
+		wrote, err := s.secrets.replaceIfUnchanged(l.key, l.raw, out)
+		if err != nil {
+			return sealed, err
+		}
+		if wrote {
+			sealed++
+		}
+	}
+	return sealed, nil
+}
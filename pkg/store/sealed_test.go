@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func sealedTestStore(t *testing.T) *SealedStore {
+	t.Helper()
+	mk := make([]byte, 32)
+	if _, err := rand.Read(mk); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSealedStore(findTestStore(t), mk)
+	if err != nil {
+		t.Fatalf("sealed store: %v", err)
+	}
+	return s
+}
+
+// TestSealedStoreWritesWhatOpenReads pins the contract both transports rely on:
+// a value put through the sealed path is a real envelope (WrappedDEK present,
+// Ciphertext not the value), and the raw record opens under the store keyring — the
+// exact read the ZAP get performed on HTTP-written records and failed.
+func TestSealedStoreWritesWhatOpenReads(t *testing.T) {
+	s := sealedTestStore(t)
+	value := []byte("postgres://db.internal/app")
+	if _, err := s.Put("svc", "DATABASE_URL", "prod", value, PutOptions{}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	rec, err := s.Secrets().Get("svc", "DATABASE_URL", "prod")
+	if err != nil {
+		t.Fatalf("raw get: %v", err)
+	}
+	if len(rec.WrappedDEK) == 0 {
+		t.Fatal("record stored without a WrappedDEK")
+	}
+	if bytes.Contains(rec.Ciphertext, value) {
+		t.Fatal("record Ciphertext carries the plaintext value")
+	}
+	if rec.WrappedDEK[0] != wrapVersionBound {
+		t.Fatalf("record written in envelope v%d, want v4", rec.WrappedDEK[0])
+	}
+	pt, err := s.keys.open(rec)
+	if err != nil {
+		t.Fatalf("open raw record: %v", err)
+	}
+	if !bytes.Equal(pt, value) {
+		t.Fatalf("open = %q, want %q", pt, value)
+	}
+
+	got, err := s.Get("svc", "DATABASE_URL", "prod")
+	if err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("sealed get = %q, %v; want %q", got, err, value)
+	}
+	if _, err := s.Get("svc", "DATABASE_URL", "staging"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("other env: err = %v, want ErrSecretNotFound", err)
+	}
+	if _, err := s.Put("svc", "a/b", "prod", value, PutOptions{}); !errors.Is(err, ErrInvalidCoord) {
+		t.Fatalf("ambiguous name: err = %v, want ErrInvalidCoord", err)
+	}
+}
+
+// TestSealLegacyReSealsInPlace covers the migration: a raw value the HTTP
+// surface stored before it sealed is refused on read (never handed back as if
+// its bytes were the value), re-sealed by SealLegacy, and then readable — while
+// already-sealed records are left byte-identical and a second run is a no-op.
+func TestSealLegacyReSealsInPlace(t *testing.T) {
+	s := sealedTestStore(t)
+	if err := s.Secrets().Put(&Secret{Path: "svc", Env: "prod", Name: "LEGACY", Ciphertext: []byte("raw-http-value")}); err != nil {
+		t.Fatalf("seed legacy: %v", err)
+	}
+	if _, err := s.Put("svc", "SEALED", "prod", []byte("zap-value"), PutOptions{}); err != nil {
+		t.Fatalf("seed sealed: %v", err)
+	}
+	before, _ := s.Secrets().Get("svc", "SEALED", "prod")
+
+	if _, err := s.Get("svc", "LEGACY", "prod"); !errors.Is(err, ErrUnsealedRecord) {
+		t.Fatalf("legacy read before migration: err = %v, want ErrUnsealedRecord", err)
+	}
+
+	n, err := s.SealLegacy()
+	if err != nil {
+		t.Fatalf("seal legacy: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("re-sealed %d records, want 1", n)
+	}
+	got, err := s.Get("svc", "LEGACY", "prod")
+	if err != nil || string(got) != "raw-http-value" {
+		t.Fatalf("legacy read after migration = %q, %v", got, err)
+	}
+	after, _ := s.Secrets().Get("svc", "SEALED", "prod")
+	if !bytes.Equal(before.Ciphertext, after.Ciphertext) || !bytes.Equal(before.WrappedDEK, after.WrappedDEK) {
+		t.Fatal("migration rewrote an already-sealed record")
+	}
+
+	if n, err := s.SealLegacy(); err != nil || n != 0 {
+		t.Fatalf("second run = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestNewSealedStoreRejectsBadKey(t *testing.T) {
+	if _, err := NewSealedStore(findTestStore(t), make([]byte, 16)); err != ErrBadKey {
+		t.Fatalf("16-byte key: err = %v, want ErrBadKey", err)
+	}
+}
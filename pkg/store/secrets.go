@@ -1,10 +1,8 @@
 package store
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"sort"
 	"strings"
 	"time"
 
@@ -58,16 +56,28 @@ type Secret struct {
 	PolicyID   string    `json:"policy_id"`   // access policy (who can decrypt)
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+	Version    int       `json:"version,omitempty"`    // 1-based; every Put is a new version
+	CreatedBy  string    `json:"created_by,omitempty"` // writer identity of this version
+	Origin     string    `json:"origin,omitempty"`     // tfhe only: ID of the put whose value this holds
+
+	// pending is the DEK of a record a SealedStore sealed but has not yet
+	// written; putVersion wraps it (bindDEK). Never stored.
+	pending *pendingWrap
 }
 
 // SecretStore manages encrypted secrets in ZapDB.
 type SecretStore struct {
 	db *badger.DB
+	// retention is how long a deleted secret stays recoverable before
+	// PurgeExpired removes it for good.
+	retention time.Duration
+	// changes is the feed of every write; see ChangeLog.
+	changes *ChangeLog
 }
 
 // NewSecretStore creates a secret store backed by ZapDB.
 func NewSecretStore(db *badger.DB) *SecretStore {
-	return &SecretStore{db: db}
+	return &SecretStore{db: db, retention: DefaultRetention, changes: newChangeLog(ChangeLogSize)}
 }
 
 // secretKey returns the ZapDB key for a secret: kms/secrets/{path}/{env}/{name}
@@ -97,7 +107,13 @@ func secretKey(path, name, env string) []byte {
 // rejoins to the identical key, so whatever a listing reports can always be
 // fetched and deleted verbatim.
 func splitSecretKey(key string) (path, env, name string, ok bool) {
-	rel, found := strings.CutPrefix(key, string(secretPrefix))
+	return splitCoordKey(secretPrefix, key)
+}
+
+// splitCoordKey is splitSecretKey for any keyspace laid out as
+// {prefix}{path}/{env}/{name} — the live records and their tombstones alike.
+func splitCoordKey(prefix []byte, key string) (path, env, name string, ok bool) {
+	rel, found := strings.CutPrefix(key, string(prefix))
 	if !found {
 		return "", "", "", false
 	}
@@ -151,42 +167,56 @@ func ValidCoord(env, name string) bool {
 	return true
 }
 
-// Put stores an encrypted secret (upsert).
+// Put stores an encrypted secret as the next version of its coordinate. The
+// previous versions stay readable through GetVersion; rec.Version is set to
+// the number this write was given.
 func (s *SecretStore) Put(rec *Secret) error {
+	return s.Write(rec, WriteOptions{})
+}
+
+// Write is Put with options: a precondition checked in the write's own
+// transaction (a failed one is ErrPreconditionFailed and writes nothing),
+// metadata stored alongside the new version, and a lock for a write-once
+// create.
+func (s *SecretStore) Write(rec *Secret, opts WriteOptions) error {
 	if !ValidCoord(rec.Env, rec.Name) {
 		return ErrInvalidCoord
 	}
+	if err := ValidateMeta(opts.Meta); err != nil {
+		return err
+	}
 	if rec.Scheme == "" {
 		rec.Scheme = ModeStandard
 	}
-	raw, err := json.Marshal(rec)
-	if err != nil {
-		return err
+	if opts.Lock != nil {
+		opts.If.Absent = true
+		if opts.Lock.LockedAt.IsZero() {
+			opts.Lock.LockedAt = time.Now().UTC()
+		}
 	}
-	return s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(secretKey(rec.Path, rec.Name, rec.Env), raw)
-	})
-}
-
-// Get retrieves an encrypted secret. Caller must decrypt via appropriate path.
-func (s *SecretStore) Get(path, name, env string) (*Secret, error) {
-	var rec Secret
-	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(secretKey(path, name, env))
-		if err == badger.ErrKeyNotFound {
-			return ErrSecretNotFound
+	return s.update(func(txn *badger.Txn, feed *changeBatch) error {
+		if err := putVersion(txn, feed, rec, opts.If); err != nil {
+			return err
 		}
-		if err != nil {
+		if opts.Meta != nil {
+			if err := setMeta(txn, rec.Path, rec.Name, rec.Env, opts.Meta); err != nil {
+				return err
+			}
+		}
+		if opts.Lock == nil {
+			return nil
+		}
+		if err := checkLockable(txn, rec.Path, rec.Name, rec.Env); err != nil {
 			return err
 		}
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &rec)
-		})
+		return setLock(txn, rec.Path, rec.Name, rec.Env, opts.Lock)
 	})
-	if err != nil {
-		return nil, err
-	}
-	return &rec, nil
+}
+
+// Get retrieves the latest version of an encrypted secret. Caller must decrypt
+// via appropriate path. An expired secret is ErrSecretExpired.
+func (s *SecretStore) Get(path, name, env string) (*Secret, error) {
+	return s.GetVersion(path, name, env, 0)
 }
 
 // maxFindRows bounds a single enumeration. The scan is keys-only and cheap per
@@ -194,66 +224,32 @@ func (s *SecretStore) Get(path, name, env string) (*Secret, error) {
 // lever: one request forces the whole keyspace into memory and onto the wire.
 // 10000 is far above any real deployment (prod holds hundreds) yet caps the
 // blast radius; a caller that hits it is TOLD (truncated=true) to narrow with
-// path/env rather than being handed a silently-partial answer — a short list
-// that claims to be the whole store is the failure this file exists to prevent.
+// path/env, or to follow the page cursor, rather than being handed a
+// silently-partial answer — a short list that claims to be the whole store is
+// the failure this file exists to prevent.
 const maxFindRows = 10000
 
 // Find returns the coordinates of every secret matching q, ordered by
 // (path, env, name) so two runs over the same data are byte-identical and
-// diffable. truncated is true when the match set exceeded maxFindRows and the
-// returned slice is a bounded prefix of the full answer.
+// diffable. truncated is true when the match set did not fit one page and the
+// returned slice is a bounded prefix of the full answer; FindPage returns the
+// cursor that continues it.
 //
 // It scans KEYS ONLY (PrefetchValues=false): a value blob is never loaded, so
-// no code path leads from an enumeration to a secret. Filtering happens on the
-// decoded coordinate rather than on a single opaque byte prefix, which is what
-// lets one query span sub-paths and environments — the key layout braids path
-// and env into one string (kms/secrets/{path}/{env}/{name}), so a lone prefix
-// scan can only ever answer for one exact (path, env) pair.
+// no code path leads from an enumeration to a secret. Each match's metadata is
+// read by exact key and returned on its Ref; it is what q.Labels filters on.
+// An expired secret is left out, as a read of it would answer not-found.
+// Filtering happens on the decoded coordinate rather than on a single opaque
+// byte prefix, which is what lets one query span sub-paths and environments —
+// the key layout braids path and env into one string
+// (kms/secrets/{path}/{env}/{name}), so a lone prefix scan can only ever
+// answer for one exact (path, env) pair.
 func (s *SecretStore) Find(q secret.Query) (refs []secret.Ref, truncated bool, err error) {
-	root := normalizePath(q.Path)
-	refs = []secret.Ref{}
-	err = s.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = false // keys only — a listing never touches a value
-		opts.Prefix = secretPrefix
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			// KeyCopy: Item.Key() is only valid for the current step.
-			path, env, name, ok := splitSecretKey(string(it.Item().KeyCopy(nil)))
-			if !ok {
-				continue
-			}
-			if q.Env != "" && env != q.Env {
-				continue
-			}
-			if !underPath(root, path) {
-				continue
-			}
-			if len(refs) >= maxFindRows {
-				// Stop scanning: the answer is capped and the caller is told so.
-				truncated = true
-				return nil
-			}
-			refs = append(refs, secret.Ref{Path: path, Env: env, Name: name})
-		}
-		return nil
-	})
+	refs, next, err := s.FindPage(q)
 	if err != nil {
 		return nil, false, err
 	}
-	sort.Slice(refs, func(i, j int) bool {
-		a, b := refs[i], refs[j]
-		if a.Path != b.Path {
-			return a.Path < b.Path
-		}
-		if a.Env != b.Env {
-			return a.Env < b.Env
-		}
-		return a.Name < b.Name
-	})
-	return refs, truncated, nil
+	return refs, next != "", nil
 }
 
 // normalizePath reduces the spellings of one subtree — "deploy", "/deploy",
@@ -261,6 +257,10 @@ func (s *SecretStore) Find(q secret.Query) (refs []secret.Ref, truncated bool, e
 // leading slash a caller happened to type.
 func normalizePath(p string) string { return strings.Trim(p, "/") }
 
+// UnderPath reports whether stored lies in the subtree rooted at root, by the
+// same rule Find applies to Query.Path.
+func UnderPath(root, stored string) bool { return underPath(normalizePath(root), stored) }
+
 // underPath reports whether stored lies in the subtree rooted at root. Both
 // sides are normalized, and the comparison is on the segment boundary so
 // "deploy" reaches "deploy/ci" but never "deployfoo". An empty root is the
@@ -273,17 +273,12 @@ func underPath(root, stored string) bool {
 	return s == root || strings.HasPrefix(s, root+"/")
 }
 
-// Delete removes a secret.
-func (s *SecretStore) Delete(path, name, env string) error {
-	key := secretKey(path, name, env)
-	return s.db.Update(func(txn *badger.Txn) error {
-		_, err := txn.Get(key)
-		if err == badger.ErrKeyNotFound {
-			return ErrSecretNotFound
-		}
-		if err != nil {
-			return err
-		}
-		return txn.Delete(key)
+// Delete tombstones a secret: the record moves out of the live keyspace, so
+// Find no longer lists it and Get answers ErrSecretNotFound, but it and its
+// version history are kept until the retention period runs out (see
+// Undelete, Purge, PurgeExpired).
+func (s *SecretStore) Delete(path, name, env string, opts DeleteOptions) error {
+	return s.update(func(txn *badger.Txn, feed *changeBatch) error {
+		return tombstone(txn, feed, path, name, env, opts.Deleter, opts.If, time.Now().UTC())
 	})
 }
@@ -164,3 +164,56 @@ func TestFindCapsTheAnswerAndSaysSo(t *testing.T) {
 		t.Fatalf("narrowed find: truncated=%v err=%v; want false, nil", tr, err)
 	}
 }
+
+// TestFindPageFollowsCursor: pages of a caller-chosen size, concatenated by
+// following the cursor, are exactly the one-shot answer in the same order —
+// across the path/env boundary where key order and listing order disagree —
+// and the last page has no cursor.
+func TestFindPageFollowsCursor(t *testing.T) {
+	s := findTestStore(t)
+	for _, c := range [][3]string{
+		{"a", "prod", "Y"}, {"a/b", "prod", "X"}, {"a", "dev", "Z"},
+		{"b", "prod", "A"}, {"", "prod", "ROOT"}, {"a/b/c", "prod", "W"}, {"a", "prod", "B"},
+	} {
+		mustPut(t, s, c[0], c[1], c[2])
+	}
+	all, truncated, err := s.Find(secret.Query{})
+	if err != nil || truncated || len(all) != 7 {
+		t.Fatalf("find all = %d truncated=%v, %v", len(all), truncated, err)
+	}
+
+	var paged []secret.Ref
+	q := secret.Query{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor did not terminate")
+		}
+		refs, next, err := s.FindPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refs) > 3 {
+			t.Fatalf("page of %d, want at most 3", len(refs))
+		}
+		paged = append(paged, refs...)
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("paged %d refs, want %d", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i] != all[i] {
+			t.Fatalf("paged[%d] = %+v, want %+v", i, paged[i], all[i])
+		}
+	}
+
+	if refs, next, err := s.FindPage(secret.Query{Path: "a", Limit: 10}); err != nil || next != "" || len(refs) != 5 {
+		t.Fatalf("subtree page = %d refs next=%q, %v; want 5 and no cursor", len(refs), next, err)
+	}
+	if _, _, err := s.FindPage(secret.Query{Cursor: "not-a-cursor"}); err != ErrInvalidCursor {
+		t.Fatalf("bad cursor: err = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -61,7 +61,7 @@ func TestPutThenGetAcrossPathSpellings(t *testing.T) {
 	if _, err := s.Get(refs[0].Path, refs[0].Name, refs[0].Env); err != nil {
 		t.Fatalf("listed coordinate %+v is not fetchable: %v", refs[0], err)
 	}
-	if err := s.Delete(refs[0].Path, refs[0].Name, refs[0].Env); err != nil {
+	if err := s.Delete(refs[0].Path, refs[0].Name, refs[0].Env, DeleteOptions{}); err != nil {
 		t.Fatalf("listed coordinate %+v is not deletable: %v", refs[0], err)
 	}
 }
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/keys"
+	"github.com/luxfi/kms/pkg/mpc"
+)
+
+// ErrThresholdUnavailable refuses a threshold-reveal write or read on a
+// store with no threshold encryptor (SetThresholdReveal): such a value can
+// be neither made nor opened here, and is never stored any other way.
+var ErrThresholdUnavailable = errors.New("store: threshold reveal is not configured")
+
+// ErrThresholdBinding refuses a threshold-reveal record whose plaintext
+// names another coordinate: its ciphertext was moved, not written, there.
+var ErrThresholdBinding = errors.New("store: threshold ciphertext is bound to another coordinate")
+
+// ErrThresholdSourceChanged refuses a rollback or promote whose
+// threshold-reveal source changed while it was being encrypted again, before
+// the write: the copy is of a value no longer there. Retry it.
+var ErrThresholdSourceChanged = fmt.Errorf("%w: threshold-reveal source changed during its re-encrypt", ErrPreconditionFailed)
+
+// ErrUnsupportedMode rejects a write mode the store does not write.
+var ErrUnsupportedMode = fmt.Errorf("store: mode must be %q or %q", ModeStandard, ModeThresholdReveal)
+
+// DefaultThresholdTimeout bounds one threshold encrypt or decrypt when
+// ThresholdReveal.Timeout is zero. A t-of-n decrypt is a network round
+// across the cluster; a stalled one must not hold a request forever.
+const DefaultThresholdTimeout = 30 * time.Second
+
+// ThresholdReveal is the T-Chain key that ModeThresholdReveal secrets are
+// encrypted under. Such a record has no DEK and no REK wrap: its Ciphertext
+// is the TFHE ciphertext the Encryptor returned, and only a t-of-n decrypt
+// opens it, so the REK alone — or a copy of ZapDB with it — reveals nothing.
+//
+// The plaintext is prefixed with the record's coordinate before it is
+// encrypted (thresholdHeader), and a reveal checks it, so a ciphertext moved
+// to another coordinate in ZapDB is refused rather than revealed there.
+// Rollback and promote therefore do not copy it: they decrypt and encrypt it
+// again for the coordinate they write, before their write transaction, and
+// audit the step once it has committed.
+type ThresholdReveal struct {
+	// Encryptor does the threshold encrypt and decrypt (the MPC backend);
+	// it is asked for mpc.SchemeTFHE on the context (mpc.WithScheme).
+	Encryptor keys.Encryptor
+	// KeyID is the threshold key new values are encrypted under. A record
+	// keeps the key it was written under in KeyHandle.
+	KeyID string
+	// Timeout bounds each call; zero is DefaultThresholdTimeout.
+	Timeout time.Duration
+	// Logf receives the audit line of every reveal and re-encrypt, with who
+	// asked (WithPrincipal) and the number of shares the decrypt used. nil
+	// discards it.
+	Logf func(format string, args ...any)
+}
+
+// SetThresholdReveal lets the store write and read ModeThresholdReveal
+// secrets. Call it at boot, before serving; nil turns the mode off.
+func (s *SealedStore) SetThresholdReveal(t *ThresholdReveal) {
+	s.threshold = t
+}
+
+// writeMode resolves a write's mode. An explicit one is used as given; ""
+// keeps the mode of the latest stored version, so a threshold-reveal secret
+// is not turned into a standard one by a writer that did not ask.
+func (s *SealedStore) writeMode(path, name, env, mode string) (string, error) {
+	switch mode {
+	case ModeStandard, ModeThresholdReveal:
+		return mode, nil
+	case "":
+	default:
+		return "", ErrUnsupportedMode
+	}
+	mode = ModeStandard
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		rec, err := getRecord(txn, secretKey(path, name, env))
+		if errors.Is(err, ErrSecretNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Scheme == ModeThresholdReveal {
+			mode = ModeThresholdReveal
+		}
+		return nil
+	})
+	return mode, err
+}
+
+// thresholdHeader is what a threshold-reveal plaintext is prefixed with: the
+// record's normalized path, env and name, each length-prefixed as in dekAAD.
+// The version is left out, so a new version of the same coordinate (a put,
+// a rollback) is bound alike.
+func thresholdHeader(path, name, env string) []byte {
+	h := []byte("kms/tfhe/v1")
+	for _, f := range []string{normalizePath(path), env, name} {
+		h = binary.BigEndian.AppendUint32(h, uint32(len(f)))
+		h = append(h, f...)
+	}
+	return h
+}
+
+// sealThreshold encrypts value for (path, name, env) under the threshold
+// key, behind that coordinate's header. The backend must answer with a TFHE
+// ciphertext: one it made under any other scheme could be opened without the
+// quorum, so it is refused. The record gets a fresh Origin.
+func (s *SealedStore) sealThreshold(ctx context.Context, path, name, env string, value []byte) (*Secret, error) {
+	t := s.threshold
+	if t == nil || t.Encryptor == nil {
+		return nil, ErrThresholdUnavailable
+	}
+	origin := make([]byte, 16)
+	if _, err := rand.Read(origin); err != nil {
+		return nil, err
+	}
+	pt := append(thresholdHeader(path, name, env), value...)
+	defer clear(pt)
+	ctx, cancel := t.context(ctx)
+	defer cancel()
+	res, err := t.Encryptor.Encrypt(ctx, t.KeyID, pt)
+	if err != nil {
+		return nil, fmt.Errorf("store: threshold encrypt: %w", err)
+	}
+	if res.Scheme != mpc.SchemeTFHE {
+		return nil, fmt.Errorf("store: threshold encrypt answered scheme %q, want %q", res.Scheme, mpc.SchemeTFHE)
+	}
+	keyID := res.KeyID
+	if keyID == "" {
+		keyID = t.KeyID
+	}
+	now := time.Now().UTC()
+	return &Secret{
+		Name:       name,
+		Path:       path,
+		Env:        env,
+		Ciphertext: res.Ciphertext,
+		Scheme:     ModeThresholdReveal,
+		KeyHandle:  keyID,
+		Origin:     hex.EncodeToString(origin),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// openThreshold reveals a ModeThresholdReveal record by a t-of-n decrypt
+// and audits it with who asked (WithPrincipal) and the shares used.
+func (s *SealedStore) openThreshold(ctx context.Context, rec *Secret) ([]byte, error) {
+	value, shares, err := s.decryptThreshold(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	s.threshold.logf("kms: audit: threshold reveal path=%s name=%s env=%s version=%d key=%s by=%q shares=%d",
+		rec.Path, rec.Name, rec.Env, recordVersion(rec), rec.KeyHandle, principalFrom(ctx), shares)
+	return value, nil
+}
+
+// thresholdCopy is a threshold-reveal record encrypted again for the
+// coordinate a rollback or promote writes it at. The decrypt and encrypt are
+// network rounds across the cluster, so they run before the write
+// transaction; inside it, from checks the source is still the record that was
+// read, and the audit line is written once the transaction has committed.
+type thresholdCopy struct {
+	src    *Secret
+	rec    *Secret
+	shares int
+}
+
+// resealThreshold decrypts src and encrypts its value again for (path, name,
+// env). The copy keeps src's Origin: it holds the same value.
+func (s *SealedStore) resealThreshold(ctx context.Context, src *Secret, path, name, env string) (*thresholdCopy, error) {
+	value, shares, err := s.decryptThreshold(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(value)
+	rec, err := s.sealThreshold(ctx, path, name, env, value)
+	if err != nil {
+		return nil, err
+	}
+	rec.Origin = src.Origin
+	return &thresholdCopy{src: src, rec: rec, shares: shares}, nil
+}
+
+// from reports whether cur, read inside the write transaction, is the record
+// c was made from.
+func (c *thresholdCopy) from(cur *Secret) bool {
+	return cur.Scheme == ModeThresholdReveal && recordVersion(cur) == recordVersion(c.src) &&
+		cur.KeyHandle == c.src.KeyHandle && bytes.Equal(cur.Ciphertext, c.src.Ciphertext)
+}
+
+// auditCopy writes the audit line of a committed copy; action and by name
+// the step and who took it.
+func (s *SealedStore) auditCopy(c *thresholdCopy, action, by string) {
+	s.threshold.logf("kms: audit: threshold re-encrypt action=%s path=%s name=%s env=%s version=%d to env=%s key=%s by=%q shares=%d",
+		action, c.src.Path, c.src.Name, c.src.Env, recordVersion(c.src), c.rec.Env, c.rec.KeyHandle, by, c.shares)
+}
+
+// decryptThreshold runs the t-of-n decrypt of rec and checks its header
+// names rec's coordinate; it returns the value behind the header and the
+// shares used. A decrypt that reports no shares did not run the threshold
+// protocol and is refused.
+func (s *SealedStore) decryptThreshold(ctx context.Context, rec *Secret) ([]byte, int, error) {
+	t := s.threshold
+	if t == nil || t.Encryptor == nil {
+		return nil, 0, ErrThresholdUnavailable
+	}
+	ctx, cancel := t.context(ctx)
+	defer cancel()
+	res, err := t.Encryptor.Decrypt(ctx, rec.KeyHandle, rec.Ciphertext)
+	if err != nil {
+		return nil, 0, fmt.Errorf("store: threshold decrypt: %w", err)
+	}
+	defer clear(res.Plaintext)
+	if res.Shares < 1 {
+		return nil, 0, errors.New("store: threshold decrypt reported no shares")
+	}
+	header := thresholdHeader(rec.Path, rec.Name, rec.Env)
+	if !bytes.HasPrefix(res.Plaintext, header) {
+		return nil, 0, fmt.Errorf("%w: %s/%s@%s", ErrThresholdBinding, rec.Path, rec.Name, rec.Env)
+	}
+	return bytes.Clone(res.Plaintext[len(header):]), res.Shares, nil
+}
+
+func (t *ThresholdReveal) logf(format string, args ...any) {
+	if t.Logf != nil {
+		t.Logf(format, args...)
+	}
+}
+
+func (t *ThresholdReveal) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultThresholdTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return mpc.WithScheme(ctx, mpc.SchemeTFHE), cancel
+}
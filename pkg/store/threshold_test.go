@@ -0,0 +1,201 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/luxfi/kms/pkg/mpc"
+)
+
+// fakeThreshold is an in-process keys.Encryptor standing in for the T-Chain:
+// it encrypts under a key the store never sees, answers the scheme it was
+// asked for, and reports the shares a decrypt used.
+type fakeThreshold struct {
+	key      byte
+	schemes  []string
+	decrypts int
+	shares   int
+	during   func() // runs inside the next Encrypt
+}
+
+func (f *fakeThreshold) Encrypt(ctx context.Context, keyID string, plaintext []byte) (*mpc.EncryptResult, error) {
+	if during := f.during; during != nil {
+		f.during = nil
+		during()
+	}
+	scheme := mpc.SchemeFrom(ctx, mpc.SchemeAESGCM)
+	f.schemes = append(f.schemes, scheme)
+	ct := append([]byte("tfhe:"), plaintext...)
+	for i := 5; i < len(ct); i++ {
+		ct[i] ^= f.key
+	}
+	return &mpc.EncryptResult{Ciphertext: ct, KeyID: keyID, Scheme: scheme}, nil
+}
+
+func (f *fakeThreshold) Decrypt(ctx context.Context, keyID string, ciphertext []byte) (*mpc.DecryptResult, error) {
+	f.decrypts++
+	if !bytes.HasPrefix(ciphertext, []byte("tfhe:")) || mpc.SchemeFrom(ctx, "") != mpc.SchemeTFHE {
+		return nil, errors.New("not a tfhe decrypt")
+	}
+	pt := bytes.Clone(ciphertext[5:])
+	for i := range pt {
+		pt[i] ^= f.key
+	}
+	return &mpc.DecryptResult{Plaintext: pt, Shares: f.shares}, nil
+}
+
+func TestThresholdRevealSecrets(t *testing.T) {
+	s := sealedTestStore(t)
+	if _, err := s.Put("vault", "ROOT", "main", []byte("v1"), PutOptions{Mode: ModeThresholdReveal}); !errors.Is(err, ErrThresholdUnavailable) {
+		t.Fatalf("threshold put with no encryptor: %v", err)
+	}
+
+	fake := &fakeThreshold{key: 0x5a, shares: 3}
+	var audit []string
+	s.SetThresholdReveal(&ThresholdReveal{Encryptor: fake, KeyID: "t-key", Logf: func(format string, args ...any) {
+		audit = append(audit, fmt.Sprintf(format, args...))
+	}})
+	if _, err := s.Put("vault", "ROOT", "main", []byte("v1"), PutOptions{Mode: ModeThresholdReveal}); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := s.secrets.Get("vault", "ROOT", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Scheme != ModeThresholdReveal || len(rec.WrappedDEK) != 0 || rec.KeyHandle != "t-key" || bytes.Contains(rec.Ciphertext, []byte("v1")) {
+		t.Fatalf("stored record = %+v", rec)
+	}
+	if fake.schemes[0] != mpc.SchemeTFHE {
+		t.Fatalf("encrypted with scheme %q", fake.schemes[0])
+	}
+	ctx := WithPrincipal(context.Background(), "iam:acme/alice")
+	if got, _, err := s.GetVersionContext(ctx, "vault", "ROOT", "main", 0); err != nil || string(got) != "v1" {
+		t.Fatalf("reveal = %q, %v", got, err)
+	}
+	if len(audit) != 1 || !strings.Contains(audit[0], "shares=3") || !strings.Contains(audit[0], "name=ROOT") || !strings.Contains(audit[0], `by="iam:acme/alice"`) {
+		t.Fatalf("audit = %q", audit)
+	}
+
+	// The plaintext names its coordinate: the ciphertext copied to another
+	// one is refused there, not revealed.
+	splice := *rec
+	splice.Path, splice.Version = "elsewhere", 0
+	if err := s.secrets.Write(&splice, WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("elsewhere", "ROOT", "main"); !errors.Is(err, ErrThresholdBinding) {
+		t.Fatalf("spliced ciphertext: %v", err)
+	}
+
+	// The mode sticks: a put that does not name one keeps it.
+	if v, err := s.Put("vault", "ROOT", "main", []byte("v2"), PutOptions{}); err != nil || v != 2 {
+		t.Fatalf("second put = %d, %v", v, err)
+	}
+	if rec, _ := s.secrets.Get("vault", "ROOT", "main"); rec.Scheme != ModeThresholdReveal {
+		t.Fatalf("a put without a mode wrote %q", rec.Scheme)
+	}
+	if _, err := s.Put("vault", "ROOT", "main", []byte("v"), PutOptions{Mode: ModeConfidentialCompute}); !errors.Is(err, ErrUnsupportedMode) {
+		t.Fatalf("ckks put: %v", err)
+	}
+
+	// Rollback encrypts the old value again, audited as the writer's;
+	// re-wrap and legacy sealing leave it be.
+	audit = nil
+	if v, err := s.Rollback("vault", "ROOT", "main", 1, PutOptions{Writer: "iam:acme/bob"}); err != nil || v != 3 {
+		t.Fatalf("rollback = %d, %v", v, err)
+	}
+	if len(audit) != 1 || !strings.Contains(audit[0], "re-encrypt action=rollback") || !strings.Contains(audit[0], `by="iam:acme/bob"`) {
+		t.Fatalf("rollback audit = %q", audit)
+	}
+	if v3, _ := s.secrets.Get("vault", "ROOT", "main"); v3.Origin == "" || v3.Origin != rec.Origin {
+		t.Fatalf("rollback lost the origin of version 1: %+v", v3)
+	}
+	if got, err := s.Get("vault", "ROOT", "main"); err != nil || string(got) != "v1" {
+		t.Fatalf("rolled back = %q, %v", got, err)
+	}
+	if n, err := s.Rewrap(); err != nil || n != 0 {
+		t.Fatalf("Rewrap = %d, %v", n, err)
+	}
+	if n, err := s.SealLegacy(); err != nil || n != 0 {
+		t.Fatalf("SealLegacy = %d, %v", n, err)
+	}
+
+	// Promote encrypts it again for the destination, audited; diff and a
+	// promote with nothing to write never reveal it.
+	audit = nil
+	if _, err := s.Promote(PromoteOptions{Path: "vault", From: "main", To: "dr", Writer: "iam:acme/bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != 1 || !strings.Contains(audit[0], "re-encrypt action=promote") || !strings.Contains(audit[0], "to env=dr") {
+		t.Fatalf("promote audit = %q", audit)
+	}
+	before := fake.decrypts
+	d, err := s.Diff("vault", "main", "dr")
+	if err != nil || d.Same != 1 || len(d.Differ) != 0 {
+		t.Fatalf("diff after promote = %+v, %v", d, err)
+	}
+	ps, err := s.Promote(PromoteOptions{Path: "vault", From: "main", To: "dr"})
+	if err != nil || len(ps) != 1 || ps[0].Action != PromoteUnchanged {
+		t.Fatalf("second promote = %+v, %v", ps, err)
+	}
+	if fake.decrypts != before {
+		t.Fatalf("diff and an unchanged promote ran %d threshold decrypts", fake.decrypts-before)
+	}
+	if got, err := s.Get("vault", "ROOT", "dr"); err != nil || string(got) != "v1" {
+		t.Fatalf("promoted = %q, %v", got, err)
+	}
+
+	// The re-encrypt runs before the write transaction, which refuses a
+	// source that changed meanwhile; nothing is written or audited.
+	if _, err := s.Put("vault", "ROOT", "main", []byte("v4"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	audit = nil
+	fake.during = func() {
+		if _, err := s.Put("vault", "ROOT", "main", []byte("v5"), PutOptions{}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := s.PromoteContext(ctx, PromoteOptions{Path: "vault", From: "main", To: "dr"}); !errors.Is(err, ErrThresholdSourceChanged) {
+		t.Fatalf("promote of a source changed mid-way: %v", err)
+	}
+	if len(audit) != 0 {
+		t.Fatalf("a promote that wrote nothing audited %q", audit)
+	}
+	if got, err := s.Get("vault", "ROOT", "dr"); err != nil || string(got) != "v1" {
+		t.Fatalf("refused promote left %q, %v", got, err)
+	}
+	if _, err := s.PromoteContext(ctx, PromoteOptions{Path: "vault", From: "main", To: "dr"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("vault", "ROOT", "dr"); err != nil || string(got) != "v5" {
+		t.Fatalf("retried promote = %q, %v", got, err)
+	}
+
+	// A decrypt that used no shares, or an encrypt in another scheme, did
+	// not run the threshold protocol.
+	fake.shares = 0
+	if _, err := s.Get("vault", "ROOT", "main"); err == nil {
+		t.Fatal("a decrypt with no shares revealed the value")
+	}
+	s.SetThresholdReveal(&ThresholdReveal{Encryptor: schemeIgnoring{fake}, KeyID: "t-key"})
+	if _, err := s.Put("vault", "OTHER", "main", []byte("x"), PutOptions{Mode: ModeThresholdReveal}); err == nil {
+		t.Fatal("an aes-gcm ciphertext was stored as threshold-reveal")
+	}
+	s.SetThresholdReveal(nil)
+	if _, err := s.Get("vault", "ROOT", "main"); !errors.Is(err, ErrThresholdUnavailable) {
+		t.Fatalf("read with no encryptor: %v", err)
+	}
+}
+
+// schemeIgnoring is a backend that encrypts under its default scheme
+// whatever it is asked for.
+type schemeIgnoring struct{ *fakeThreshold }
+
+func (f schemeIgnoring) Encrypt(ctx context.Context, keyID string, plaintext []byte) (*mpc.EncryptResult, error) {
+	return f.fakeThreshold.Encrypt(context.Background(), keyID, plaintext)
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/tokenize"
+)
+
+// ErrTokenizeKeyNotFound is returned for a tokenization key name the store
+// does not hold.
+var ErrTokenizeKeyNotFound = errors.New("store: tokenization key not found")
+
+// ErrTokenizeKeyExists refuses to create a tokenization key under a name
+// already taken: every token made under the first would stop detokenizing.
+var ErrTokenizeKeyExists = errors.New("store: tokenization key already exists")
+
+// tokenizePrefix holds tokenization keys: kms/tokenize/{name}. Each is sealed
+// as a transit key is, at the coordinate (tokenizePath, name, "") and version
+// 1 — a tokenization key has one version — and re-wrapped with the rest
+// (rewrapPrefixes).
+var tokenizePrefix = []byte("kms/tokenize/")
+
+const tokenizePath = "tokenize"
+
+func tokenizeKey(name string) []byte {
+	return []byte(string(tokenizePrefix) + name)
+}
+
+// CreateTokenizeKey makes a tokenization key as opts says, and returns what
+// may be said about it.
+func (s *SealedStore) CreateTokenizeKey(name string, opts tokenize.KeyOptions) (*tokenize.Info, error) {
+	k, err := tokenize.NewKey(name, opts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer k.Zero()
+	err = s.secrets.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(tokenizeKey(name)); err == nil {
+			return ErrTokenizeKeyExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return s.putSealedJSON(txn, tokenizeKey(name), tokenizePath, name, 1, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.Info(), nil
+}
+
+// TokenizeKeyInfo describes the named key, without its material.
+func (s *SealedStore) TokenizeKeyInfo(name string) (*tokenize.Info, error) {
+	var info *tokenize.Info
+	err := s.UseTokenizeKey(name, func(k *tokenize.Key) error {
+		info = k.Info()
+		return nil
+	})
+	return info, err
+}
+
+// TokenizeKeys lists the names of every tokenization key, in order.
+func (s *SealedStore) TokenizeKeys() ([]string, error) {
+	var names []string
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = tokenizePrefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			names = append(names, strings.TrimPrefix(string(it.Item().Key()), string(tokenizePrefix)))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// UseTokenizeKey opens the named key and hands it to fn, zeroing its
+// material when fn returns. fn must not keep the key.
+func (s *SealedStore) UseTokenizeKey(name string, fn func(*tokenize.Key) error) error {
+	if !tokenize.ValidName(name) {
+		return ErrTokenizeKeyNotFound
+	}
+	var k tokenize.Key
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		return s.getSealedJSON(txn, tokenizeKey(name), &k)
+	})
+	if errors.Is(err, ErrSecretNotFound) {
+		return ErrTokenizeKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer k.Zero()
+	return fn(&k)
+}
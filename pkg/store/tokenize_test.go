@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/tokenize"
+)
+
+func TestTokenizeKeysAreSealed(t *testing.T) {
+	secrets := findTestStore(t)
+	rek1, rek2 := newREK(t), newREK(t)
+	s := keyringStore(t, secrets, 1, map[uint32][]byte{1: rek1})
+
+	info, err := s.CreateTokenizeKey("pan", tokenize.KeyOptions{Alphabet: "numeric"})
+	if err != nil || info.Mode != tokenize.ModeFF1 || info.Alphabet != "0123456789" {
+		t.Fatalf("create = %+v, %v", info, err)
+	}
+	if _, err := s.CreateTokenizeKey("pan", tokenize.KeyOptions{}); !errors.Is(err, ErrTokenizeKeyExists) {
+		t.Fatalf("second create: %v", err)
+	}
+	var tok string
+	if err := s.UseTokenizeKey("pan", func(k *tokenize.Key) error {
+		tok, err = k.Tokenize("4111111111111111", nil)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec *Secret
+	if err := s.secrets.db.View(func(txn *badger.Txn) error {
+		rec, err = getRecord(txn, tokenizeKey("pan"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.WrappedDEK[0] != wrapVersionBound || rec.Version != 1 {
+		t.Fatalf("tokenization key stored as envelope 0x%02x version %d", rec.WrappedDEK[0], rec.Version)
+	}
+
+	// A REK rotation re-wraps tokenization keys with the secrets.
+	s2 := keyringStore(t, secrets, 2, map[uint32][]byte{1: rek1, 2: rek2})
+	if n, err := s2.Rewrap(); err != nil || n != 1 {
+		t.Fatalf("Rewrap = %d, %v; want the one tokenization key", n, err)
+	}
+	if err := s2.UseTokenizeKey("pan", func(k *tokenize.Key) error {
+		v, err := k.Detokenize(tok, nil)
+		if err == nil && v != "4111111111111111" {
+			err = errors.New("wrong value")
+		}
+		return err
+	}); err != nil {
+		t.Fatalf("detokenize after REK rotation: %v", err)
+	}
+	if names, err := s2.TokenizeKeys(); err != nil || len(names) != 1 || names[0] != "pan" {
+		t.Fatalf("TokenizeKeys = %v, %v", names, err)
+	}
+	if _, err := s2.TokenizeKeyInfo("missing"); !errors.Is(err, ErrTokenizeKeyNotFound) {
+		t.Fatalf("missing key: %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// DefaultRetention is how long a deleted secret stays recoverable when the
+// operator has not configured one (KMS_DELETE_RETENTION).
+const DefaultRetention = 30 * 24 * time.Hour
+
+// ErrNotDeleted is returned by Undelete and Purge when the coordinate has no
+// tombstone: it was never deleted, was already purged, or has been written
+// again since.
+var ErrNotDeleted = errors.New("store: secret is not deleted")
+
+// deletedPrefix holds tombstones: kms/deleted/{path}/{env}/{name}, the same
+// layout as the live keyspace so one decoder serves both. Find scans only
+// kms/secrets/, which is what hides a deleted record from every listing.
+var deletedPrefix = []byte("kms/deleted/")
+
+func deletedKey(path, name, env string) []byte {
+	return []byte(fmt.Sprintf("kms/deleted/%s/%s/%s", normalizePath(path), env, name))
+}
+
+// DeleteOptions carries what a delete records besides the coordinate.
+type DeleteOptions struct {
+	// Deleter identifies the caller, reported by Deleted.
+	Deleter string
+	// If guards the delete; see Precondition.
+	If Precondition
+}
+
+// tombstoneRecord is the stored value of a tombstone: the latest record as it
+// was when deleted, plus who deleted it and when. The version history stays
+// where it was, under kms/versions/.
+type tombstoneRecord struct {
+	Record    Secret    `json:"record"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by,omitempty"`
+}
+
+// SetRetention changes how long a deleted secret stays recoverable. It takes
+// effect at the next purge, for tombstones already written too: the purge
+// deadline is computed from the deletion time, not stored with it. Call it at
+// boot, before the purger starts.
+func (s *SecretStore) SetRetention(d time.Duration) {
+	if d > 0 {
+		s.retention = d
+	}
+}
+
+// Retention reports how long a deleted secret stays recoverable.
+func (s *SecretStore) Retention() time.Duration { return s.retention }
+
+// tombstone moves the latest record of a coordinate to kms/deleted/ inside
+// txn. A second delete of an already-deleted coordinate is ErrSecretNotFound,
+// exactly as before deletes were soft. A locked coordinate is ErrLocked; cond
+// is checked against the live record after that.
+func tombstone(txn *badger.Txn, feed *changeBatch, path, name, env, by string, cond Precondition, now time.Time) error {
+	if err := checkUnlocked(txn, path, name, env); err != nil {
+		return err
+	}
+	key := secretKey(path, name, env)
+	cur, err := getRecord(txn, key)
+	if err != nil {
+		return err
+	}
+	if err := cond.check(cur); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(tombstoneRecord{Record: *cur, DeletedAt: now, DeletedBy: by})
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(deletedKey(path, name, env), raw); err != nil {
+		return err
+	}
+	feed.add(ChangeDelete, path, name, env, liveVersion(cur))
+	return txn.Delete(key)
+}
+
+// getTombstone loads the tombstone of a coordinate inside txn.
+func getTombstone(txn *badger.Txn, path, name, env string) (*tombstoneRecord, error) {
+	item, err := txn.Get(deletedKey(path, name, env))
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotDeleted
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tomb tombstoneRecord
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &tomb)
+	}); err != nil {
+		return nil, err
+	}
+	return &tomb, nil
+}
+
+// Undelete restores a tombstoned secret as it was deleted — same value, same
+// version — and returns that version. Its history was never moved, so pinned
+// reads of older versions work again too.
+func (s *SecretStore) Undelete(path, name, env string) (int, error) {
+	var version int
+	err := s.update(func(txn *badger.Txn, feed *changeBatch) error {
+		tomb, err := getTombstone(txn, path, name, env)
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(tomb.Record)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(secretKey(path, name, env), raw); err != nil {
+			return err
+		}
+		version = liveVersion(&tomb.Record)
+		feed.add(ChangePut, path, name, env, version)
+		return txn.Delete(deletedKey(path, name, env))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Purge removes a deleted secret for good: its tombstone and every version in
+// its history. Only a deleted coordinate can be purged — a live secret must be
+// deleted first, so no single call destroys a value nobody meant to delete.
+func (s *SecretStore) Purge(path, name, env string) error {
+	return s.update(func(txn *badger.Txn, feed *changeBatch) error {
+		tomb, err := getTombstone(txn, path, name, env)
+		if err != nil {
+			return err
+		}
+		return purge(txn, feed, path, name, env, tomb)
+	})
+}
+
+// purge deletes a tombstone and the history and metadata it owns inside txn.
+func purge(txn *badger.Txn, feed *changeBatch, path, name, env string, tomb *tombstoneRecord) error {
+	for v := 1; v <= tomb.Record.Version; v++ {
+		if err := txn.Delete(versionKey(path, name, env, v)); err != nil {
+			return err
+		}
+	}
+	if err := txn.Delete(metaKey(path, name, env)); err != nil {
+		return err
+	}
+	feed.add(ChangePurge, path, name, env, liveVersion(&tomb.Record))
+	return txn.Delete(deletedKey(path, name, env))
+}
+
+// Deleted lists the tombstoned secrets matching q, ordered like Find, with
+// the time each becomes unrecoverable. Like Find it never returns a value, and
+// it is bounded by the same row cap (truncated reports a capped answer).
+func (s *SecretStore) Deleted(q secret.Query) (out []secret.Deleted, truncated bool, err error) {
+	root := normalizePath(q.Path)
+	out = []secret.Deleted{}
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = deletedPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			path, env, name, ok := splitCoordKey(deletedPrefix, string(item.KeyCopy(nil)))
+			if !ok || (q.Env != "" && env != q.Env) || !underPath(root, path) {
+				continue
+			}
+			if len(out) >= maxFindRows {
+				truncated = true
+				return nil
+			}
+			var tomb tombstoneRecord
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &tomb)
+			}); err != nil {
+				return fmt.Errorf("store: corrupt tombstone key=%s: %w", item.Key(), err)
+			}
+			version := tomb.Record.Version
+			if version == 0 {
+				version = 1
+			}
+			out = append(out, secret.Deleted{
+				Ref:       secret.Ref{Path: path, Env: env, Name: name},
+				Version:   version,
+				DeletedAt: tomb.DeletedAt,
+				DeletedBy: tomb.DeletedBy,
+				PurgeAt:   tomb.DeletedAt.Add(s.retention),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Ref, out[j].Ref
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Env != b.Env {
+			return a.Env < b.Env
+		}
+		return a.Name < b.Name
+	})
+	return out, truncated, nil
+}
+
+// PurgeExpired purges every tombstone older than the retention period and
+// returns how many it removed. Each purge is its own transaction that re-reads
+// the tombstone, so an Undelete or a fresh write racing the sweep wins.
+func (s *SecretStore) PurgeExpired(now time.Time) (int, error) {
+	cutoff := now.Add(-s.retention)
+	var expired []secret.Ref
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = deletedPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			path, env, name, ok := splitCoordKey(deletedPrefix, string(item.KeyCopy(nil)))
+			if !ok {
+				continue
+			}
+			var tomb tombstoneRecord
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &tomb)
+			}); err != nil {
+				return fmt.Errorf("store: corrupt tombstone key=%s: %w", item.Key(), err)
+			}
+			if !tomb.DeletedAt.After(cutoff) {
+				expired = append(expired, secret.Ref{Path: path, Env: env, Name: name})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, ref := range expired {
+		removed := false
+		err := s.update(func(txn *badger.Txn, feed *changeBatch) error {
+			tomb, err := getTombstone(txn, ref.Path, ref.Name, ref.Env)
+			if errors.Is(err, ErrNotDeleted) {
+				return nil // undeleted or re-written since the scan
+			}
+			if err != nil {
+				return err
+			}
+			if tomb.DeletedAt.After(cutoff) {
+				return nil // deleted again since the scan; a fresh window
+			}
+			removed = true
+			return purge(txn, feed, ref.Path, ref.Name, ref.Env, tomb)
+		})
+		if err != nil {
+			return purged, err
+		}
+		if removed {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// RunPurger calls PurgeExpired every interval until ctx is done, reporting
+// each sweep that removed something, or failed, to logf.
+func (s *SecretStore) RunPurger(ctx context.Context, interval time.Duration, logf func(format string, args ...any)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			n, err := s.PurgeExpired(now)
+			if err != nil {
+				logf("kms: purging deleted secrets: %v (%d purged before the error)", err, n)
+			} else if n > 0 {
+				logf("kms: purged %d deleted secret(s) past the %s retention window", n, s.retention)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// TestDeleteIsRecoverable: a delete hides the record from Find and Get, lists
+// it as deleted with who did it, and Undelete puts back the same value and
+// version with its history intact.
+func TestDeleteIsRecoverable(t *testing.T) {
+	s := sealedTestStore(t)
+	for _, v := range []string{"a", "b"} {
+		if _, err := s.Put("svc", "TOKEN", "prod", []byte(v), PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{Deleter: "iam:org/alice"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := s.Get("svc", "TOKEN", "prod"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("get after delete: err = %v, want ErrSecretNotFound", err)
+	}
+	if refs, _, _ := s.Find(secret.Query{}); len(refs) != 0 {
+		t.Fatalf("find after delete = %v, want nothing", refs)
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{}); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("second delete: err = %v, want ErrSecretNotFound", err)
+	}
+
+	deleted, _, err := s.Secrets().Deleted(secret.Query{Env: "prod"})
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("deleted = %v, %v; want one", deleted, err)
+	}
+	d := deleted[0]
+	if d.Ref != (secret.Ref{Path: "svc", Env: "prod", Name: "TOKEN"}) || d.Version != 2 || d.DeletedBy != "iam:org/alice" {
+		t.Fatalf("deleted[0] = %+v", d)
+	}
+	if got := d.PurgeAt.Sub(d.DeletedAt); got != DefaultRetention {
+		t.Fatalf("purge window = %s, want %s", got, DefaultRetention)
+	}
+
+	version, err := s.Secrets().Undelete("svc", "TOKEN", "prod")
+	if err != nil || version != 2 {
+		t.Fatalf("undelete = v%d, %v; want v2", version, err)
+	}
+	if pt, err := s.Get("svc", "TOKEN", "prod"); err != nil || string(pt) != "b" {
+		t.Fatalf("after undelete = %q, %v; want b", pt, err)
+	}
+	if pt, _, err := s.GetVersion("svc", "TOKEN", "prod", 1); err != nil || string(pt) != "a" {
+		t.Fatalf("after undelete v1 = %q, %v; want a", pt, err)
+	}
+	if _, err := s.Secrets().Undelete("svc", "TOKEN", "prod"); !errors.Is(err, ErrNotDeleted) {
+		t.Fatalf("undelete of live secret: err = %v, want ErrNotDeleted", err)
+	}
+}
+
+// TestWriteAfterDeleteContinuesHistory: re-writing a deleted coordinate
+// consumes the tombstone and numbers on from the deleted version.
+func TestWriteAfterDeleteContinuesHistory(t *testing.T) {
+	s := sealedTestStore(t)
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("old"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := s.Put("svc", "TOKEN", "prod", []byte("new"), PutOptions{}); err != nil || version != 2 {
+		t.Fatalf("re-write = v%d, %v; want v2", version, err)
+	}
+	if deleted, _, _ := s.Secrets().Deleted(secret.Query{}); len(deleted) != 0 {
+		t.Fatalf("tombstone survived the re-write: %v", deleted)
+	}
+	if pt, _, err := s.GetVersion("svc", "TOKEN", "prod", 1); err != nil || string(pt) != "old" {
+		t.Fatalf("v1 after re-write = %q, %v; want old", pt, err)
+	}
+}
+
+// TestPurgeRemovesHistory: only a deleted secret can be purged, and a purged
+// coordinate starts its history over.
+func TestPurgeRemovesHistory(t *testing.T) {
+	s := sealedTestStore(t)
+	for _, v := range []string{"a", "b"} {
+		if _, err := s.Put("svc", "GONE", "prod", []byte(v), PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Secrets().Purge("svc", "GONE", "prod"); !errors.Is(err, ErrNotDeleted) {
+		t.Fatalf("purge of live secret: err = %v, want ErrNotDeleted", err)
+	}
+	if err := s.Delete("svc", "GONE", "prod", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Secrets().Purge("svc", "GONE", "prod"); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := s.Secrets().Undelete("svc", "GONE", "prod"); !errors.Is(err, ErrNotDeleted) {
+		t.Fatalf("undelete after purge: err = %v, want ErrNotDeleted", err)
+	}
+	if version, err := s.Put("svc", "GONE", "prod", []byte("c"), PutOptions{}); err != nil || version != 1 {
+		t.Fatalf("re-create = v%d, %v; want v1", version, err)
+	}
+	if _, _, err := s.GetVersion("svc", "GONE", "prod", 2); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("purged v2: err = %v, want ErrVersionNotFound", err)
+	}
+}
+
+// TestPurgeExpiredHonoursRetention: the sweep leaves a tombstone inside its
+// window alone and removes it once the window has passed.
+func TestPurgeExpiredHonoursRetention(t *testing.T) {
+	s := sealedTestStore(t)
+	s.Secrets().SetRetention(time.Hour)
+	if _, err := s.Put("svc", "TOKEN", "prod", []byte("v"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("svc", "TOKEN", "prod", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.Secrets().PurgeExpired(time.Now().Add(30 * time.Minute)); err != nil || n != 0 {
+		t.Fatalf("sweep inside window purged %d, %v; want 0", n, err)
+	}
+	if n, err := s.Secrets().PurgeExpired(time.Now().Add(2 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("sweep past window purged %d, %v; want 1", n, err)
+	}
+	if deleted, _, _ := s.Secrets().Deleted(secret.Query{}); len(deleted) != 0 {
+		t.Fatalf("tombstone survived the sweep: %v", deleted)
+	}
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+// ErrTransitKeyNotFound is returned for a transit key name the store does not
+// hold.
+var ErrTransitKeyNotFound = errors.New("store: transit key not found")
+
+// ErrTransitKeyExists refuses to create a transit key under a name already
+// taken: a second create must not replace the material of the first and
+// strand every ciphertext made under it.
+var ErrTransitKeyExists = errors.New("store: transit key already exists")
+
+// transitPrefix holds transit keys: kms/transit/{name}. Each is a record
+// sealed exactly as a secret is, its value the JSON of the transit.Key with
+// every version's material, so a REK rotation re-wraps it with the rest
+// (rewrapPrefixes). It is sealed at the coordinate (transitPath, name, "") —
+// an empty env no secret can have — at the key's latest version.
+var transitPrefix = []byte("kms/transit/")
+
+const transitPath = "transit"
+
+func transitKey(name string) []byte {
+	return []byte(string(transitPrefix) + name)
+}
+
+// CreateTransitKey makes a transit key as opts says at version 1, and
+// returns what may be said about it.
+func (s *SealedStore) CreateTransitKey(name string, opts transit.KeyOptions) (*transit.Info, error) {
+	k, err := transit.NewKey(name, opts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer k.Zero()
+	err = s.secrets.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(transitKey(name)); err == nil {
+			return ErrTransitKeyExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return s.putTransitKey(txn, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.Info(), nil
+}
+
+// RotateTransitKey adds a version to the named key; new encryptions use it,
+// and every older version still decrypts.
+func (s *SealedStore) RotateTransitKey(name string) (*transit.Info, error) {
+	var info *transit.Info
+	err := s.secrets.db.Update(func(txn *badger.Txn) error {
+		k, err := s.getTransitKey(txn, name)
+		if err != nil {
+			return err
+		}
+		defer k.Zero()
+		if err := k.Rotate(time.Now()); err != nil {
+			return err
+		}
+		info = k.Info()
+		return s.putTransitKey(txn, k)
+	})
+	return info, err
+}
+
+// TransitKeyInfo describes the named key, without its material.
+func (s *SealedStore) TransitKeyInfo(name string) (*transit.Info, error) {
+	var info *transit.Info
+	err := s.UseTransitKey(name, func(k *transit.Key) error {
+		info = k.Info()
+		return nil
+	})
+	return info, err
+}
+
+// TransitKeys lists the names of every transit key, in order.
+func (s *SealedStore) TransitKeys() ([]string, error) {
+	var names []string
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = transitPrefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			names = append(names, strings.TrimPrefix(string(it.Item().Key()), string(transitPrefix)))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// UseTransitKey opens the named key and hands it to fn, zeroing its material
+// when fn returns. fn must not keep the key.
+func (s *SealedStore) UseTransitKey(name string, fn func(*transit.Key) error) error {
+	var k *transit.Key
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		var err error
+		k, err = s.getTransitKey(txn, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer k.Zero()
+	return fn(k)
+}
+
+func (s *SealedStore) getTransitKey(txn *badger.Txn, name string) (*transit.Key, error) {
+	if !transit.ValidName(name) {
+		return nil, ErrTransitKeyNotFound
+	}
+	var k transit.Key
+	err := s.getSealedJSON(txn, transitKey(name), &k)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil, ErrTransitKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// putTransitKey seals k and writes it in txn.
+func (s *SealedStore) putTransitKey(txn *badger.Txn, k *transit.Key) error {
+	return s.putSealedJSON(txn, transitKey(k.Name), transitPath, k.Name, k.Latest(), k)
+}
+
+// getSealedJSON opens the sealed record at key and decodes its value, the
+// JSON of a KMS-held key, into v. ErrSecretNotFound if there is none.
+func (s *SealedStore) getSealedJSON(txn *badger.Txn, key []byte, v any) error {
+	rec, err := getRecord(txn, key)
+	if err != nil {
+		return err
+	}
+	raw, err := s.openRecord(context.Background(), rec)
+	if err != nil {
+		return err
+	}
+	defer clear(raw)
+	return json.Unmarshal(raw, v)
+}
+
+// putSealedJSON seals the JSON of v at the coordinate (path, name, "") and
+// version, and writes it at key in txn.
+func (s *SealedStore) putSealedJSON(txn *badger.Txn, key []byte, path, name string, version int, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	defer clear(raw)
+	rec, err := s.sealRecord(path, name, "", raw)
+	if err != nil {
+		return err
+	}
+	rec.Version = version
+	if err := rec.bindDEK(); err != nil {
+		return err
+	}
+	out, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return txn.Set(key, out)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+func TestTransitKeysAreSealedAndRotate(t *testing.T) {
+	secrets := findTestStore(t)
+	rek1, rek2 := newREK(t), newREK(t)
+	s := keyringStore(t, secrets, 1, map[uint32][]byte{1: rek1})
+
+	info, err := s.CreateTransitKey("orders", transit.KeyOptions{})
+	if err != nil || info.Type != transit.TypeAES256GCM || info.LatestVersion != 1 {
+		t.Fatalf("create = %+v, %v", info, err)
+	}
+	if _, err := s.CreateTransitKey("orders", transit.KeyOptions{}); !errors.Is(err, ErrTransitKeyExists) {
+		t.Fatalf("second create: %v", err)
+	}
+	var ct string
+	if err := s.UseTransitKey("orders", func(k *transit.Key) error {
+		ct, err = k.Encrypt([]byte("pan"), nil, nil)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := s.RotateTransitKey("orders"); err != nil || info.LatestVersion != 2 {
+		t.Fatalf("rotate = %+v, %v", info, err)
+	}
+
+	rec, err := getTransitRecord(s, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.WrappedDEK[0] != wrapVersionBound || rec.Version != 2 {
+		t.Fatalf("transit key stored as envelope 0x%02x version %d", rec.WrappedDEK[0], rec.Version)
+	}
+
+	// A REK rotation re-wraps transit keys with the secrets.
+	s2 := keyringStore(t, secrets, 2, map[uint32][]byte{1: rek1, 2: rek2})
+	if n, err := s2.Rewrap(); err != nil || n != 1 {
+		t.Fatalf("Rewrap = %d, %v; want the one transit key", n, err)
+	}
+	if err := s2.UseTransitKey("orders", func(k *transit.Key) error {
+		pt, err := k.Decrypt(ct, nil, nil)
+		if err == nil && string(pt) != "pan" {
+			err = errors.New("wrong plaintext")
+		}
+		return err
+	}); err != nil {
+		t.Fatalf("decrypt after REK rotation: %v", err)
+	}
+	if names, err := s2.TransitKeys(); err != nil || len(names) != 1 || names[0] != "orders" {
+		t.Fatalf("TransitKeys = %v, %v", names, err)
+	}
+	if _, err := s2.TransitKeyInfo("missing"); !errors.Is(err, ErrTransitKeyNotFound) {
+		t.Fatalf("missing key: %v", err)
+	}
+}
+
+func getTransitRecord(s *SealedStore, name string) (*Secret, error) {
+	var rec *Secret
+	err := s.secrets.db.View(func(txn *badger.Txn) error {
+		var err error
+		rec, err = getRecord(txn, transitKey(name))
+		return err
+	})
+	return rec, err
+}
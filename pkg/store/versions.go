@@ -0,0 +1,267 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+
+	"github.com/luxfi/kms/pkg/secret"
+)
+
+// ErrVersionNotFound is returned when a pinned read or a rollback names a
+// version the coordinate never had. The coordinate itself exists — a missing
+// coordinate is still ErrSecretNotFound.
+var ErrVersionNotFound = errors.New("store: secret version not found")
+
+// versionKey returns the ZapDB key of one historical version:
+// kms/versions/{path}/{env}/{name}@{version}.
+//
+// History lives under its own prefix, not beside the latest record, so Find —
+// which scans kms/secrets/ and decodes every key it meets as a coordinate —
+// never mistakes a version for a secret. Versions are only ever read by exact
+// key (they are contiguous from 1 to the latest), never by a prefix scan that
+// decodes the key (Rewrap scans values only), so the '@' needs no escaping:
+// the suffix after the LAST '@' is always the number.
+func versionKey(path, name, env string, version int) []byte {
+	return []byte(fmt.Sprintf("%s%s/%s/%s@%d", versionPrefix, normalizePath(path), env, name, version))
+}
+
+var versionPrefix = []byte("kms/versions/")
+
+// getRecord loads and decodes the record at key inside txn.
+func getRecord(txn *badger.Txn, key []byte) (*Secret, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec Secret
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &rec)
+	}); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// putVersion writes rec as the next version of its coordinate: the latest
+// record at kms/secrets/... and the same bytes into the history. Numbering is
+// read and advanced inside txn, so two concurrent writers cannot both claim the
+// same version — the loser's commit conflicts.
+//
+// A record written before versioning existed carries Version 0. It is archived
+// as version 1 on its first overwrite, so the value it held stays reachable by
+// a pinned read and a rollback.
+//
+// Writing a deleted coordinate brings it back: the tombstone is consumed and
+// numbering continues from the deleted version, so the history the tombstone
+// was guarding is kept rather than overwritten by a fresh version 1.
+//
+// A locked coordinate is ErrLocked, whoever writes. cond is checked against
+// the live record before anything is written. An expiry in the coordinate's
+// metadata that has already passed is cleared: a new value is not born
+// expired.
+func putVersion(txn *badger.Txn, feed *changeBatch, rec *Secret, cond Precondition) error {
+	if err := checkUnlocked(txn, rec.Path, rec.Name, rec.Env); err != nil {
+		return err
+	}
+	key := secretKey(rec.Path, rec.Name, rec.Env)
+	next := 1
+	cur, err := getRecord(txn, key)
+	var live *Secret
+	if err == nil {
+		live = cur
+	}
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	if err := cond.check(live); err != nil {
+		return err
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		tomb, terr := getTombstone(txn, rec.Path, rec.Name, rec.Env)
+		switch {
+		case errors.Is(terr, ErrNotDeleted):
+		case terr != nil:
+			return terr
+		default:
+			if err := txn.Delete(deletedKey(rec.Path, rec.Name, rec.Env)); err != nil {
+				return err
+			}
+			cur, err = &tomb.Record, nil
+		}
+	}
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+	case err != nil:
+		return err
+	default:
+		if cur.Version == 0 {
+			cur.Version = 1
+			raw, err := json.Marshal(cur)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(versionKey(rec.Path, rec.Name, rec.Env, 1), raw); err != nil {
+				return err
+			}
+		}
+		next = cur.Version + 1
+	}
+	meta, err := getMeta(txn, rec.Path, rec.Name, rec.Env)
+	if err != nil {
+		return err
+	}
+	if meta.Expired(time.Now()) {
+		meta.ExpiresAt = nil
+		if err := setMeta(txn, rec.Path, rec.Name, rec.Env, meta); err != nil {
+			return err
+		}
+	}
+	rec.Version = next
+	if err := rec.bindDEK(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(key, raw); err != nil {
+		return err
+	}
+	feed.add(ChangePut, rec.Path, rec.Name, rec.Env, next)
+	return txn.Set(versionKey(rec.Path, rec.Name, rec.Env, next), raw)
+}
+
+// getVersion resolves version (0 = latest) of a coordinate inside txn.
+func getVersion(txn *badger.Txn, path, name, env string, version int) (*Secret, error) {
+	cur, err := getRecord(txn, secretKey(path, name, env))
+	if err != nil {
+		return nil, err
+	}
+	if cur.Version == 0 {
+		cur.Version = 1 // pre-versioning record: its one version
+	}
+	if version == 0 || version == cur.Version {
+		return cur, nil
+	}
+	if version < 0 || version > cur.Version {
+		return nil, ErrVersionNotFound
+	}
+	rec, err := getRecord(txn, versionKey(path, name, env, version))
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil, ErrVersionNotFound
+	}
+	return rec, err
+}
+
+// GetVersion retrieves one version of a secret; version 0 is the latest.
+// Caller must decrypt via appropriate path. Once a secret's metadata expiry
+// has passed every version of it is ErrSecretExpired — live or, after the
+// expiry sweeper moved it, deleted — so a reader learns why it is gone.
+func (s *SecretStore) GetVersion(path, name, env string, version int) (*Secret, error) {
+	var rec *Secret
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		rec, err = readVersion(txn, path, name, env, version, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// readVersion is GetVersion inside txn: the expiry check, then the version.
+func readVersion(txn *badger.Txn, path, name, env string, version int, now time.Time) (*Secret, error) {
+	meta, err := getMeta(txn, path, name, env)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Expired(now) {
+		return nil, expiredError(meta)
+	}
+	return getVersion(txn, path, name, env, version)
+}
+
+// Versions lists every version of a secret, oldest first. It reports who
+// wrote each version and when; it never opens one.
+func (s *SecretStore) Versions(path, name, env string) ([]secret.Version, error) {
+	var out []secret.Version
+	err := s.db.View(func(txn *badger.Txn) error {
+		cur, err := getRecord(txn, secretKey(path, name, env))
+		if err != nil {
+			return err
+		}
+		if cur.Version == 0 {
+			out = []secret.Version{{Version: 1, CreatedAt: cur.CreatedAt, CreatedBy: cur.CreatedBy}}
+			return nil
+		}
+		out = make([]secret.Version, 0, cur.Version)
+		for v := 1; v <= cur.Version; v++ {
+			rec, err := getRecord(txn, versionKey(path, name, env, v))
+			if errors.Is(err, ErrSecretNotFound) {
+				continue // archived before its first overwrite; nothing to report
+			}
+			if err != nil {
+				return err
+			}
+			out = append(out, secret.Version{Version: rec.Version, CreatedAt: rec.CreatedAt, CreatedBy: rec.CreatedBy})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Rollback promotes an old version to latest by writing its sealed bytes as a
+// NEW version. History is append-only: nothing between the old version and
+// the current one is discarded, so a rollback can itself be rolled back. The
+// new version records writer as its author and is subject to cond. It returns
+// the new record.
+//
+// A v4 record's DEK wrap is bound to its version, so its bytes cannot be
+// copied as a new one without the keyring: SecretStore.Rollback refuses it
+// with ErrNoRecipient, and SealedStore.Rollback re-wraps it.
+func (s *SecretStore) Rollback(path, name, env string, version int, writer string, cond Precondition) (*Secret, error) {
+	return s.rollback(path, name, env, version, writer, cond, nil)
+}
+
+// rollback is Rollback; rebind, when set, re-wraps the old version's DEK for
+// the copy.
+func (s *SecretStore) rollback(path, name, env string, version int, writer string, cond Precondition, rebind func(old, rec *Secret) error) (*Secret, error) {
+	if version <= 0 {
+		return nil, ErrVersionNotFound
+	}
+	var rec Secret
+	err := s.update(func(txn *badger.Txn, feed *changeBatch) error {
+		old, err := getVersion(txn, path, name, env, version)
+		if err != nil {
+			return err
+		}
+		rec = *old
+		now := time.Now().UTC()
+		rec.CreatedAt, rec.UpdatedAt, rec.CreatedBy = now, now, writer
+		switch {
+		case rebind != nil:
+			if err := rebind(old, &rec); err != nil {
+				return err
+			}
+			defer rec.dropDEK()
+		case wrapVersion(old) == wrapVersionBound:
+			return ErrNoRecipient
+		}
+		return putVersion(txn, feed, &rec, cond)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// TestVersionsPinnedReadAndRollback walks one coordinate through three writes
+// and a rollback: every version stays readable by number, the latest is what
+// an unpinned read returns, and a rollback appends rather than rewinds.
+func TestVersionsPinnedReadAndRollback(t *testing.T) {
+	s := sealedTestStore(t)
+	for i, v := range []string{"one", "two", "three"} {
+		got, err := s.Put("svc", "TOKEN", "prod", []byte(v), PutOptions{Writer: "iam:org/alice"})
+		if err != nil {
+			t.Fatalf("put %s: %v", v, err)
+		}
+		if got != i+1 {
+			t.Fatalf("put %s: version = %d, want %d", v, got, i+1)
+		}
+	}
+
+	if pt, version, err := s.GetVersion("svc", "TOKEN", "prod", 0); err != nil || string(pt) != "three" || version != 3 {
+		t.Fatalf("latest = %q v%d, %v; want three v3", pt, version, err)
+	}
+	if pt, _, err := s.GetVersion("svc", "TOKEN", "prod", 1); err != nil || string(pt) != "one" {
+		t.Fatalf("pinned v1 = %q, %v; want one", pt, err)
+	}
+	if _, _, err := s.GetVersion("svc", "TOKEN", "prod", 4); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("v4: err = %v, want ErrVersionNotFound", err)
+	}
+
+	version, err := s.Rollback("svc", "TOKEN", "prod", 1, PutOptions{Writer: "iam:org/bob"})
+	if err != nil || version != 4 {
+		t.Fatalf("rollback = v%d, %v; want v4", version, err)
+	}
+	if pt, err := s.Get("svc", "TOKEN", "prod"); err != nil || string(pt) != "one" {
+		t.Fatalf("after rollback latest = %q, %v; want one", pt, err)
+	}
+	if pt, _, err := s.GetVersion("svc", "TOKEN", "prod", 3); err != nil || string(pt) != "three" {
+		t.Fatalf("after rollback v3 = %q, %v; want three (history is append-only)", pt, err)
+	}
+
+	versions, err := s.Versions("svc", "TOKEN", "prod")
+	if err != nil {
+		t.Fatalf("versions: %v", err)
+	}
+	if len(versions) != 4 {
+		t.Fatalf("versions = %d entries, want 4", len(versions))
+	}
+	if versions[0].CreatedBy != "iam:org/alice" || versions[3].CreatedBy != "iam:org/bob" {
+		t.Fatalf("writers = %q, %q; want alice then bob", versions[0].CreatedBy, versions[3].CreatedBy)
+	}
+	for i, v := range versions {
+		if v.Version != i+1 || v.CreatedAt.IsZero() {
+			t.Fatalf("versions[%d] = %+v", i, v)
+		}
+	}
+}
+
+// TestVersionsArchivePreVersioningRecord: a record written before versioning
+// (Version 0) reads as version 1 and is kept as version 1 when overwritten.
+func TestVersionsArchivePreVersioningRecord(t *testing.T) {
+	s := sealedTestStore(t)
+	if _, err := s.Put("svc", "OLD", "prod", []byte("before"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Strip the history and the number, as a pre-versioning store held it.
+	rec, err := s.Secrets().Get("svc", "OLD", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Version = 0
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.secrets.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(versionKey("svc", "OLD", "prod", 1)); err != nil {
+			return err
+		}
+		return txn.Set(secretKey("svc", "OLD", "prod"), raw)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, version, err := s.GetVersion("svc", "OLD", "prod", 0); err != nil || version != 1 {
+		t.Fatalf("legacy read = v%d, %v; want v1", version, err)
+	}
+	if version, err := s.Put("svc", "OLD", "prod", []byte("after"), PutOptions{}); err != nil || version != 2 {
+		t.Fatalf("overwrite = v%d, %v; want v2", version, err)
+	}
+	if pt, _, err := s.GetVersion("svc", "OLD", "prod", 1); err != nil || string(pt) != "before" {
+		t.Fatalf("archived v1 = %q, %v; want before", pt, err)
+	}
+}
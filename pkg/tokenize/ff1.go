@@ -0,0 +1,116 @@
+package tokenize
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"math/big"
+)
+
+// ff1 is FF1 of NIST SP 800-38G: a ten-round Feistel network whose round
+// function is AES-CBC-MAC over the tweak, the round number and one half of
+// the numeral string. Numerals are most significant first.
+func ff1(block cipher.Block, radix int, x []int, tweak []byte, encrypt bool) []int {
+	n := len(x)
+	u, v := n/2, n-n/2
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	r := big.NewInt(int64(radix))
+	modU := new(big.Int).Exp(r, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(r, big.NewInt(int64(v)), nil)
+	// b bytes hold NUM(B): ⌈⌈v·log2(radix)⌉/8⌉, which is the byte length of
+	// radix^v − 1. d bytes of PRF output feed each round.
+	numLen := (new(big.Int).Sub(modV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((numLen+3)/4) + 4
+
+	t := len(tweak)
+	p := make([]byte, 16)
+	p[0], p[1], p[2] = 1, 2, 1
+	p[3], p[4], p[5] = byte(radix>>16), byte(radix>>8), byte(radix)
+	p[6], p[7] = 10, byte(u)
+	binary.BigEndian.PutUint32(p[8:], uint32(n))
+	binary.BigEndian.PutUint32(p[12:], uint32(t))
+
+	pad := ((-t-numLen-1)%16 + 16) % 16
+	q := make([]byte, t+pad+1+numLen)
+	copy(q, tweak)
+
+	for j := 0; j < 10; j++ {
+		i := j
+		in := b
+		if !encrypt {
+			i, in = 9-j, a
+		}
+		q[t+pad] = byte(i)
+		num(in, radix).FillBytes(q[t+pad+1:])
+		y := new(big.Int).SetBytes(ff1Expand(block, ff1PRF(block, p, q), d))
+
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+		c := new(big.Int)
+		if encrypt {
+			c.Add(num(a, radix), y).Mod(c, mod)
+			a, b = b, str(c, radix, m)
+		} else {
+			c.Sub(num(b, radix), y).Mod(c, mod)
+			a, b = str(c, radix, m), a
+		}
+	}
+	return append(a, b...)
+}
+
+// ff1PRF is AES-CBC-MAC with a zero IV over p || q (both whole blocks).
+func ff1PRF(block cipher.Block, p, q []byte) []byte {
+	y := make([]byte, 16)
+	for _, in := range [][]byte{p, q} {
+		for off := 0; off < len(in); off += 16 {
+			for k := range y {
+				y[k] ^= in[off+k]
+			}
+			block.Encrypt(y, y)
+		}
+	}
+	return y
+}
+
+// ff1Expand stretches the PRF output R to d bytes: R || CIPH(R ⊕ [1]) ||
+// CIPH(R ⊕ [2]) || ..., truncated.
+func ff1Expand(block cipher.Block, r []byte, d int) []byte {
+	s := append([]byte(nil), r...)
+	for j := 1; len(s) < d; j++ {
+		x := make([]byte, 16)
+		binary.BigEndian.PutUint64(x[8:], uint64(j))
+		for k := range x {
+			x[k] ^= r[k]
+		}
+		block.Encrypt(x, x)
+		s = append(s, x...)
+	}
+	return s[:d]
+}
+
+// num is NUM_radix(x): the numeral string as a number, most significant
+// numeral first.
+func num(x []int, radix int) *big.Int {
+	r := big.NewInt(int64(radix))
+	out := new(big.Int)
+	for _, d := range x {
+		out.Mul(out, r).Add(out, big.NewInt(int64(d)))
+	}
+	return out
+}
+
+// str is STR^m_radix(c): c as m numerals, most significant first.
+func str(c *big.Int, radix, m int) []int {
+	out := make([]int, m)
+	r := big.NewInt(int64(radix))
+	c = new(big.Int).Set(c)
+	d := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		c.DivMod(c, r, d)
+		out[i] = int(d.Int64())
+	}
+	return out
+}
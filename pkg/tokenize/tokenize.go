@@ -0,0 +1,285 @@
+// Package tokenize is the KMS's tokenization engine: format-preserving
+// encryption (NIST SP 800-38G) under named keys that never leave the KMS. A
+// card number tokenizes to another string of digits of the same length, a
+// phone number keeps its punctuation, so a token fits the column and the
+// validation of the value it replaces.
+//
+// A key has a mode and an alphabet. The mode is FF1 (the default) or FF3-1,
+// each over AES-256; FF3-1 is for interoperating with a system that
+// already holds FF3-1 tokens. The alphabet is the set of characters that
+// are encrypted: every character of a value in it is one numeral, and every
+// character not in it (a dash, a space, a '+') stays where it is.
+//
+// A token does not name a key version: there is no room for one in a
+// format-preserving string. A key is therefore never rotated — a new key is
+// created and the column re-tokenized. An optional tweak (a row ID, a
+// tenant) makes one value tokenize differently in different places; it must
+// be given again to detokenize.
+//
+// It only does the cryptography. Storing a key, sealed under the REK, is the
+// store's business (store.SealedStore.CreateTokenizeKey); a Key in memory
+// holds its material in the clear and is zeroed after use.
+package tokenize
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Modes.
+const (
+	// ModeFF1: FF1 over AES-256; any tweak up to MaxTweak bytes.
+	ModeFF1 = "ff1"
+	// ModeFF31: FF3-1 over AES-256; the tweak is 7 bytes, or none (zeros).
+	ModeFF31 = "ff3-1"
+)
+
+// DefaultMode is the mode of a key created without one.
+const DefaultMode = ModeFF1
+
+// Alphabets names the common alphabets; KeyOptions.Alphabet takes one of
+// these names or the characters themselves.
+var Alphabets = map[string]string{
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+	"alpha-lower":  "abcdefghijklmnopqrstuvwxyz",
+	"alpha-upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alpha":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"alphanumeric": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// DefaultAlphabet is the alphabet of a key created without one.
+const DefaultAlphabet = "numeric"
+
+// Bounds on what a key and a call take.
+const (
+	// MaxAlphabet bounds an alphabet, which is the radix: FF1 and FF3-1
+	// both stop at 2¹⁶.
+	MaxAlphabet = 1 << 16
+	// MaxValue bounds a value or token in bytes, MaxNumerals the characters
+	// of it that are encrypted. Tokens are for fields; FF3-1 stops sooner
+	// (2·⌊log_radix(2⁹⁶)⌋).
+	MaxValue    = 4 << 10
+	MaxNumerals = 256
+	// MaxTweak bounds an FF1 tweak.
+	MaxTweak = 256
+	// minDomain is the fewest values a string of a value's numerals may
+	// take: SP 800-38G requires radix^n ≥ 10⁶, so a four-digit PIN does
+	// not tokenize.
+	minDomain = 1_000_000
+)
+
+var (
+	// ErrInvalidKey rejects a key name, mode or alphabet this package
+	// cannot use.
+	ErrInvalidKey = errors.New("tokenize: invalid key")
+	// ErrInvalidValue rejects a value (or token) the key cannot tokenize:
+	// not UTF-8, too few or too many characters of its alphabet.
+	ErrInvalidValue = errors.New("tokenize: invalid value")
+	// ErrInvalidTweak rejects a tweak the key's mode cannot take.
+	ErrInvalidTweak = errors.New("tokenize: invalid tweak")
+)
+
+// validName is a key name: it is a URL path segment and a log field, so no
+// slashes, spaces or control characters.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidName reports whether name can name a tokenization key.
+func ValidName(name string) bool { return validName.MatchString(name) }
+
+// Key is a tokenization key and its material.
+type Key struct {
+	Name      string    `json:"name"`
+	Mode      string    `json:"mode"`
+	Alphabet  string    `json:"alphabet"`
+	CreatedAt time.Time `json:"created_at"`
+	Material  []byte    `json:"material"`
+}
+
+// KeyOptions is how a key is created.
+type KeyOptions struct {
+	// Mode is ModeFF1 or ModeFF31; "" is DefaultMode.
+	Mode string
+	// Alphabet is a name in Alphabets or the characters themselves, each
+	// once; "" is DefaultAlphabet.
+	Alphabet string
+}
+
+// Info is what may be said about a key outside the KMS: everything but its
+// material.
+type Info struct {
+	Name      string    `json:"name"`
+	Mode      string    `json:"mode"`
+	Alphabet  string    `json:"alphabet"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewKey makes a key as opts says, with fresh AES-256 material.
+func NewKey(name string, opts KeyOptions, now time.Time) (*Key, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("%w: name %q (letters, digits, '_', '.', '-'; at most 128)", ErrInvalidKey, name)
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = DefaultMode
+	}
+	if mode != ModeFF1 && mode != ModeFF31 {
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidKey, mode)
+	}
+	alphabet := opts.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if named, ok := Alphabets[alphabet]; ok {
+		alphabet = named
+	}
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	material := make([]byte, 32)
+	if _, err := rand.Read(material); err != nil {
+		return nil, fmt.Errorf("tokenize: rand: %w", err)
+	}
+	return &Key{Name: name, Mode: mode, Alphabet: alphabet, CreatedAt: now.UTC(), Material: material}, nil
+}
+
+func checkAlphabet(alphabet string) error {
+	if !utf8.ValidString(alphabet) {
+		return fmt.Errorf("%w: alphabet is not UTF-8", ErrInvalidKey)
+	}
+	runes := []rune(alphabet)
+	if len(runes) < 2 || len(runes) > MaxAlphabet {
+		return fmt.Errorf("%w: an alphabet has 2 to %d characters", ErrInvalidKey, MaxAlphabet)
+	}
+	seen := make(map[rune]bool, len(runes))
+	for _, r := range runes {
+		if seen[r] {
+			return fmt.Errorf("%w: alphabet repeats %q", ErrInvalidKey, r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// Info describes k without its material.
+func (k *Key) Info() *Info {
+	return &Info{Name: k.Name, Mode: k.Mode, Alphabet: k.Alphabet, CreatedAt: k.CreatedAt}
+}
+
+// Zero wipes the key's material (best effort).
+func (k *Key) Zero() {
+	if k == nil {
+		return
+	}
+	clear(k.Material)
+}
+
+// Tokenize returns the token for value: the same length, the characters
+// outside the alphabet where they were, the rest encrypted. Equal values
+// under one key and tweak give equal tokens.
+func (k *Key) Tokenize(value string, tweak []byte) (string, error) {
+	return k.crypt(value, tweak, true)
+}
+
+// Detokenize returns the value a token was made from, under the tweak it
+// was made with. A token of the right shape always detokenizes to some
+// value: format-preserving encryption has no room for an integrity tag.
+func (k *Key) Detokenize(token string, tweak []byte) (string, error) {
+	return k.crypt(token, tweak, false)
+}
+
+func (k *Key) crypt(value string, tweak []byte, encrypt bool) (string, error) {
+	if len(value) > MaxValue {
+		return "", fmt.Errorf("%w: over %d bytes", ErrInvalidValue, MaxValue)
+	}
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("%w: not UTF-8", ErrInvalidValue)
+	}
+	alphabet := []rune(k.Alphabet)
+	radix := len(alphabet)
+	index := make(map[rune]int, radix)
+	for i, r := range alphabet {
+		index[r] = i
+	}
+	runes := []rune(value)
+	var at []int // positions of the value's numerals
+	var x []int
+	for i, r := range runes {
+		if d, ok := index[r]; ok {
+			at = append(at, i)
+			x = append(x, d)
+		}
+	}
+	if err := k.checkLength(radix, len(x)); err != nil {
+		return "", err
+	}
+
+	block, err := k.block()
+	if err != nil {
+		return "", err
+	}
+	var y []int
+	switch k.Mode {
+	case ModeFF1:
+		if len(tweak) > MaxTweak {
+			return "", fmt.Errorf("%w: over %d bytes", ErrInvalidTweak, MaxTweak)
+		}
+		y = ff1(block, radix, x, tweak, encrypt)
+	case ModeFF31:
+		switch len(tweak) {
+		case 0:
+			tweak = make([]byte, ff3TweakSize)
+		case ff3TweakSize:
+		default:
+			return "", fmt.Errorf("%w: an FF3-1 tweak is %d bytes", ErrInvalidTweak, ff3TweakSize)
+		}
+		y = ff3(block, radix, x, ff3Tweak(tweak), encrypt)
+	default:
+		return "", fmt.Errorf("%w: unknown mode %q", ErrInvalidKey, k.Mode)
+	}
+	for i, pos := range at {
+		runes[pos] = alphabet[y[i]]
+	}
+	return string(runes), nil
+}
+
+// checkLength holds a value to n numerals the mode can take: enough for a
+// domain of at least minDomain values, and at most MaxNumerals (and, for
+// FF3-1, its own bound).
+func (k *Key) checkLength(radix, n int) error {
+	domain := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(n)), nil)
+	if n < 2 || domain.Cmp(big.NewInt(minDomain)) < 0 {
+		return fmt.Errorf("%w: too few characters of the key's alphabet to tokenize (%d)", ErrInvalidValue, n)
+	}
+	limit := MaxNumerals
+	if k.Mode == ModeFF31 {
+		limit = min(limit, ff3MaxLen(radix))
+	}
+	if n > limit {
+		return fmt.Errorf("%w: over %d characters of the key's alphabet", ErrInvalidValue, limit)
+	}
+	return nil
+}
+
+// block is AES-256 under the key's material: as given for FF1, byte-reversed
+// for FF3-1 (REVB(K)).
+func (k *Key) block() (cipher.Block, error) {
+	if len(k.Material) != 32 {
+		return nil, fmt.Errorf("%w: material is %d bytes", ErrInvalidKey, len(k.Material))
+	}
+	if k.Mode != ModeFF31 {
+		return aes.NewCipher(k.Material)
+	}
+	rev := slices.Clone(k.Material)
+	slices.Reverse(rev)
+	defer clear(rev)
+	return aes.NewCipher(rev)
+}
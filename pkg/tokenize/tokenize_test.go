@@ -0,0 +1,172 @@
+package tokenize
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleDigits are the numerals of the NIST samples, 0-9 then a-z.
+const sampleDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func numerals(s string) []int {
+	var out []int
+	for _, r := range s {
+		out = append(out, strings.IndexRune(sampleDigits, r))
+	}
+	return out
+}
+
+func numeralString(x []int) string {
+	var b strings.Builder
+	for _, d := range x {
+		b.WriteByte(sampleDigits[d])
+	}
+	return b.String()
+}
+
+// TestFF1Vectors runs the NIST SP 800-38G FF1 samples (AES-128 and AES-256).
+func TestFF1Vectors(t *testing.T) {
+	const k128 = "2B7E151628AED2A6ABF7158809CF4F3C"
+	const k256 = k128 + "EF4359D8D580AA4F7F036D6F04FC6A94"
+	for i, c := range []struct {
+		key, tweak string
+		radix      int
+		pt, ct     string
+	}{
+		{k128, "", 10, "0123456789", "2433477484"},
+		{k128, "39383736353433323130", 10, "0123456789", "6124200773"},
+		{k128, "3737373770717273373737", 36, "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+		{k256, "", 10, "0123456789", "6657667009"},
+		{k256, "39383736353433323130", 10, "0123456789", "1001623463"},
+		{k256, "3737373770717273373737", 36, "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+	} {
+		key, _ := hex.DecodeString(c.key)
+		tweak, _ := hex.DecodeString(c.tweak)
+		block, _ := aes.NewCipher(key)
+		if got := numeralString(ff1(block, c.radix, numerals(c.pt), tweak, true)); got != c.ct {
+			t.Errorf("sample %d: encrypt = %s, want %s", i, got, c.ct)
+		}
+		if got := numeralString(ff1(block, c.radix, numerals(c.ct), tweak, false)); got != c.pt {
+			t.Errorf("sample %d: decrypt = %s, want %s", i, got, c.pt)
+		}
+	}
+}
+
+// TestFF3Vectors runs the NIST FF3 samples through the rounds FF3-1 shares,
+// under their 64-bit tweaks, then checks the FF3-1 tweak expansion.
+func TestFF3Vectors(t *testing.T) {
+	const key = "EF4359D8D580AA4F7F036D6F04FC6A94"
+	for i, c := range []struct {
+		tweak  string
+		radix  int
+		pt, ct string
+	}{
+		{"D8E7920AFA330A73", 10, "890121234567890000", "750918814058654607"},
+		{"9A768A92F60E12D8", 10, "890121234567890000", "018989839189395384"},
+		{"D8E7920AFA330A73", 10, "89012123456789000000789000000", "48598367162252569629397416226"},
+		{"0000000000000000", 10, "89012123456789000000789000000", "34695224821734535122613701434"},
+		{"9A768A92F60E12D8", 26, "0123456789abcdefghi", "g2pk40i992fn20cjakb"},
+	} {
+		k, _ := hex.DecodeString(key)
+		slices.Reverse(k)
+		tweak, _ := hex.DecodeString(c.tweak)
+		block, _ := aes.NewCipher(k)
+		if got := numeralString(ff3(block, c.radix, numerals(c.pt), tweak, true)); got != c.ct {
+			t.Errorf("sample %d: encrypt = %s, want %s", i, got, c.ct)
+		}
+		if got := numeralString(ff3(block, c.radix, numerals(c.ct), tweak, false)); got != c.pt {
+			t.Errorf("sample %d: decrypt = %s, want %s", i, got, c.pt)
+		}
+	}
+	if got := hex.EncodeToString(ff3Tweak([]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde})); got != "123456709abcde80" {
+		t.Fatalf("ff3Tweak = %s", got)
+	}
+	if ff3MaxLen(10) != 56 {
+		t.Fatalf("ff3MaxLen(10) = %d, want 56", ff3MaxLen(10))
+	}
+}
+
+func TestTokenizeKeepsFormat(t *testing.T) {
+	for _, mode := range []string{ModeFF1, ModeFF31} {
+		k, err := NewKey("pan", KeyOptions{Mode: mode}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		const card = "4111-1111-1111-1111"
+		tok, err := k.Tokenize(card, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if len(tok) != len(card) || tok == card || strings.Count(tok, "-") != 3 || tok[4] != '-' {
+			t.Fatalf("%s: token %q does not keep the format of %q", mode, tok, card)
+		}
+		if again, _ := k.Tokenize(card, nil); again != tok {
+			t.Fatalf("%s: one value tokenized %q then %q", mode, tok, again)
+		}
+		if back, err := k.Detokenize(tok, nil); err != nil || back != card {
+			t.Fatalf("%s: detokenize = %q, %v", mode, back, err)
+		}
+		tweak := []byte("row-007")
+		if tweaked, _ := k.Tokenize(card, tweak); tweaked == tok {
+			t.Fatalf("%s: the tweak does not change the token", mode)
+		} else if back, _ := k.Detokenize(tweaked, tweak); back != card {
+			t.Fatalf("%s: detokenize under the tweak = %q", mode, back)
+		}
+	}
+
+	k, _ := NewKey("phone", KeyOptions{Alphabet: "0123456789"}, time.Now())
+	tok, err := k.Tokenize("+1 (555) 010-1234", nil)
+	if err != nil || !strings.HasPrefix(tok, "+") || tok[2] != ' ' || tok[3] != '(' {
+		t.Fatalf("phone token %q, %v", tok, err)
+	}
+	if _, err := k.Tokenize("1234", nil); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("a four-digit value: %v", err)
+	}
+	if _, err := k.Tokenize(strings.Repeat("1", MaxNumerals+1), nil); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("an over-long value: %v", err)
+	}
+	ff31, _ := NewKey("f", KeyOptions{Mode: ModeFF31}, time.Now())
+	if _, err := ff31.Tokenize("4111111111111111", []byte("eight by")); !errors.Is(err, ErrInvalidTweak) {
+		t.Fatalf("an 8-byte FF3-1 tweak: %v", err)
+	}
+
+	// A custom alphabet, and a name that resolves to its characters.
+	greek, err := NewKey("greek", KeyOptions{Alphabet: "αβγδεζηθικ"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := greek.Tokenize("αβγδεζηθ", nil); err != nil || len([]rune(tok)) != 8 || strings.Trim(tok, "αβγδεζηθικ") != "" {
+		t.Fatalf("greek token %q, %v", tok, err)
+	}
+	if hexKey, _ := NewKey("h", KeyOptions{Alphabet: "hex"}, time.Now()); hexKey.Alphabet != "0123456789abcdef" {
+		t.Fatalf("hex alphabet = %q", hexKey.Alphabet)
+	}
+}
+
+func TestNewKeyRejects(t *testing.T) {
+	for _, o := range []struct {
+		name string
+		opts KeyOptions
+	}{
+		{"a/b", KeyOptions{}},
+		{"x", KeyOptions{Mode: "ff3"}},
+		{"x", KeyOptions{Alphabet: "a"}},
+		{"x", KeyOptions{Alphabet: "abca"}},
+	} {
+		if _, err := NewKey(o.name, o.opts, time.Now()); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q %+v: err = %v", o.name, o.opts, err)
+		}
+	}
+	k, _ := NewKey("z", KeyOptions{}, time.Now())
+	k.Zero()
+	for _, b := range k.Material {
+		if b != 0 {
+			t.Fatal("Zero left material")
+		}
+	}
+}
@@ -0,0 +1,521 @@
+// Package transit is the KMS's encryption-as-a-service engine: named,
+// versioned keys that encrypt and decrypt a caller's data without the key
+// ever leaving the KMS. A service keeps the ciphertext in its own database and
+// holds nothing it could leak.
+//
+// A ciphertext names the key version that made it:
+//
+//	kms:v<N>:<base64(nonce(12) || AES-256-GCM ciphertext || tag)>
+//
+// so rotating a key never strands a ciphertext: every version decrypts, the
+// latest encrypts, and Rewrap moves a ciphertext to the latest without the
+// caller seeing its plaintext.
+//
+// An HMAC key (hmac-sha256, hmac-sha3-256) does not encrypt: it MACs a
+// caller's message (kms:v<N>:<base64(mac)>), verifies a MAC, and derives
+// subkeys by HKDF for a caller's context, so a service that signs requests
+// or keys tenants never holds the root key. It rotates as any key does.
+//
+// A key created Deterministic makes equal ciphertexts of equal plaintexts, so
+// a service can look a row up by an encrypted email or tax ID. Its nonce is
+// synthetic — an HMAC of the associated data and plaintext (HMAC-SIV) — and
+// its keys are derived per caller context, so the same value in two tables,
+// encrypted under two contexts, does not match. It is never the default: it
+// reveals which values are equal, and nothing else.
+//
+// It only does the cryptography. Storing a key, sealed under the REK, is the
+// store's business (store.SealedStore.CreateTransitKey); a Key in memory holds
+// its material in the clear and is zeroed after use.
+package transit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key types.
+const (
+	// TypeAES256GCM: 256-bit AES-GCM with a random 96-bit nonce.
+	TypeAES256GCM = "aes256-gcm96"
+	// TypeHMACSHA256 and TypeHMACSHA3256: a 256-bit key for HMAC and HKDF
+	// over SHA-256 or SHA3-256. Neither encrypts.
+	TypeHMACSHA256  = "hmac-sha256"
+	TypeHMACSHA3256 = "hmac-sha3-256"
+)
+
+// DefaultType is the type of a key created without one.
+const DefaultType = TypeAES256GCM
+
+// ciphertextPrefix starts every transit ciphertext.
+const ciphertextPrefix = "kms:v"
+
+var (
+	// ErrInvalidKey rejects a key name or type this package cannot use.
+	ErrInvalidKey = errors.New("transit: invalid key")
+	// ErrInvalidCiphertext rejects a ciphertext that is not kms:v<N>:...,
+	// or names a version the key does not have.
+	ErrInvalidCiphertext = errors.New("transit: invalid ciphertext")
+	// ErrDecrypt is a ciphertext that does not open under its key version
+	// and associated data: tampered, truncated, or another key's.
+	ErrDecrypt = errors.New("transit: ciphertext does not decrypt under this key")
+	// ErrInvalidContext is a context where the key takes none, or none
+	// where it needs one: a deterministic encryption and a derive need a
+	// context, a randomized encryption takes none.
+	ErrInvalidContext = errors.New("transit: context missing, or given where the key takes none")
+	// ErrTooLarge refuses a plaintext over MaxPlaintext.
+	ErrTooLarge = fmt.Errorf("transit: plaintext over %d bytes", MaxPlaintext)
+)
+
+// MaxPlaintext bounds what one call encrypts. Transit is for fields, tokens
+// and data keys; a file is encrypted locally under a data key.
+const MaxPlaintext = 1 << 20
+
+// validName is a key name: it is a URL path segment and a log field, so no
+// slashes, spaces or control characters.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidName reports whether name can name a transit key.
+func ValidName(name string) bool { return validName.MatchString(name) }
+
+// Key is a transit key and every version of its material. Versions[i] is
+// version i+1; the last is the one Encrypt uses.
+type Key struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Deterministic keys encrypt with a synthetic nonce under per-context
+	// keys: see the package doc. Set at creation, never changed.
+	Deterministic bool      `json:"deterministic,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Versions      []Version `json:"versions"`
+}
+
+// KeyOptions is how a key is created.
+type KeyOptions struct {
+	// Type is the key type; "" is DefaultType.
+	Type string
+	// Deterministic makes equal plaintexts under one context encrypt
+	// equal. Off unless asked for.
+	Deterministic bool
+}
+
+// Version is one version of a key's material.
+type Version struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Imported material was made outside the KMS and brought in by
+	// ImportKey; the KMS made all other material.
+	Imported bool   `json:"imported,omitempty"`
+	Material []byte `json:"material"`
+}
+
+// Info is what may be said about a key outside the KMS: everything but its
+// material.
+type Info struct {
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Deterministic bool          `json:"deterministic,omitempty"`
+	LatestVersion int           `json:"latest_version"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Versions      []VersionInfo `json:"versions"`
+}
+
+// VersionInfo is one version of a key, without its material.
+type VersionInfo struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Imported  bool      `json:"imported,omitempty"`
+}
+
+// NewKey makes a key as opts says at version 1.
+func NewKey(name string, opts KeyOptions, now time.Time) (*Key, error) {
+	k, err := newKey(name, opts, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.Rotate(now); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// ImportKey makes a key as opts says whose version 1 is material made
+// outside the KMS: 32 bytes for an AES key, 32 to 64 for an HMAC key. It
+// copies material; the caller zeroes its own. A rotation adds material the
+// KMS makes.
+func ImportKey(name string, opts KeyOptions, material []byte, now time.Time) (*Key, error) {
+	k, err := newKey(name, opts, now)
+	if err != nil {
+		return nil, err
+	}
+	switch n := len(material); {
+	case k.Type == TypeAES256GCM && n != 32:
+		return nil, fmt.Errorf("%w: %s material is 32 bytes, not %d", ErrInvalidKey, k.Type, n)
+	case k.Type != TypeAES256GCM && (n < 32 || n > 64):
+		return nil, fmt.Errorf("%w: %s material is 32 to 64 bytes, not %d", ErrInvalidKey, k.Type, n)
+	}
+	k.Versions = []Version{{Version: 1, CreatedAt: now.UTC(), Imported: true, Material: bytes.Clone(material)}}
+	return k, nil
+}
+
+func newKey(name string, opts KeyOptions, now time.Time) (*Key, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("%w: name %q (letters, digits, '_', '.', '-'; at most 128)", ErrInvalidKey, name)
+	}
+	typ := opts.Type
+	if typ == "" {
+		typ = DefaultType
+	}
+	switch typ {
+	case TypeAES256GCM:
+	case TypeHMACSHA256, TypeHMACSHA3256:
+		if opts.Deterministic {
+			return nil, fmt.Errorf("%w: a %s key does not encrypt, deterministically or not", ErrInvalidKey, typ)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidKey, typ)
+	}
+	return &Key{Name: name, Type: typ, Deterministic: opts.Deterministic, CreatedAt: now.UTC()}, nil
+}
+
+// Rotate adds a version of fresh material; it is the one Encrypt uses from
+// now on.
+func (k *Key) Rotate(now time.Time) error {
+	material := make([]byte, 32)
+	if _, err := rand.Read(material); err != nil {
+		return fmt.Errorf("transit: rand: %w", err)
+	}
+	k.Versions = append(k.Versions, Version{Version: len(k.Versions) + 1, CreatedAt: now.UTC(), Material: material})
+	return nil
+}
+
+// Latest is the version Encrypt uses.
+func (k *Key) Latest() int { return len(k.Versions) }
+
+// Info describes k without its material.
+func (k *Key) Info() *Info {
+	info := &Info{Name: k.Name, Type: k.Type, Deterministic: k.Deterministic, LatestVersion: k.Latest(), CreatedAt: k.CreatedAt}
+	for _, v := range k.Versions {
+		info.Versions = append(info.Versions, VersionInfo{Version: v.Version, CreatedAt: v.CreatedAt, Imported: v.Imported})
+	}
+	return info
+}
+
+// Zero wipes every version's material (best effort).
+func (k *Key) Zero() {
+	if k == nil {
+		return
+	}
+	for _, v := range k.Versions {
+		clear(v.Material)
+	}
+}
+
+// Encrypt seals plaintext under the latest version. aad, when set, must be
+// given again to decrypt: it binds the ciphertext to a row, a tenant, a
+// column — whatever the caller says it belongs to. context is what a
+// deterministic key derives its keys from, typically the table and column
+// (required); a randomized key takes none.
+//
+// A deterministic ciphertext is equal for equal (plaintext, aad, context)
+// at one key version: after a rotation the column is rewrapped before
+// lookups by new ciphertexts find old rows.
+func (k *Key) Encrypt(plaintext, aad, context []byte) (string, error) {
+	return k.encrypt(k.Latest(), plaintext, aad, context)
+}
+
+// Decrypt opens a ciphertext made under any version of k, with the aad and
+// context it was made with. The caller zeroes the plaintext after use.
+func (k *Key) Decrypt(ciphertext string, aad, context []byte) ([]byte, error) {
+	if err := k.canEncrypt(); err != nil {
+		return nil, err
+	}
+	if err := k.checkContext(context); err != nil {
+		return nil, err
+	}
+	version, body, err := k.parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	gcm, macKey, err := k.cipher(version, context)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(macKey)
+	if len(body) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidCiphertext)
+	}
+	nonce := body[:gcm.NonceSize()]
+	pt, err := gcm.Open(nil, nonce, body[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	// A deterministic nonce is checked too: one not derived from this
+	// plaintext was not made by this key, whatever the tag says.
+	if macKey != nil && !hmac.Equal(nonce, syntheticNonce(macKey, aad, pt, len(nonce))) {
+		clear(pt)
+		return nil, ErrDecrypt
+	}
+	return pt, nil
+}
+
+// Rewrap decrypts a ciphertext and encrypts it again under the latest
+// version, with the same aad and context; the plaintext never leaves this
+// call. A ciphertext already at the latest version is re-encrypted all the
+// same.
+func (k *Key) Rewrap(ciphertext string, aad, context []byte) (string, error) {
+	pt, err := k.Decrypt(ciphertext, aad, context)
+	if err != nil {
+		return "", err
+	}
+	defer clear(pt)
+	return k.Encrypt(pt, aad, context)
+}
+
+// DefaultDataKeyBits is the size of a data key asked for without one.
+const DefaultDataKeyBits = 256
+
+// DataKey makes a fresh random key of bits (128, 256 or 512) for the caller to
+// encrypt with locally, and returns it with its ciphertext under k. The caller
+// stores the ciphertext beside its data, discards the plaintext, and asks the
+// KMS to decrypt the ciphertext when it needs the key again. A data key is
+// never looked up by its ciphertext, so a deterministic key makes none.
+func (k *Key) DataKey(bits int) (plaintext []byte, ciphertext string, err error) {
+	if k.Deterministic {
+		return nil, "", fmt.Errorf("%w: a deterministic key makes no data keys", ErrInvalidKey)
+	}
+	if bits == 0 {
+		bits = DefaultDataKeyBits
+	}
+	if bits != 128 && bits != 256 && bits != 512 {
+		return nil, "", fmt.Errorf("%w: data key bits must be 128, 256 or 512", ErrInvalidKey)
+	}
+	plaintext = make([]byte, bits/8)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, "", fmt.Errorf("transit: rand: %w", err)
+	}
+	ciphertext, err = k.Encrypt(plaintext, nil, nil)
+	if err != nil {
+		clear(plaintext)
+		return nil, "", err
+	}
+	return plaintext, ciphertext, nil
+}
+
+// HMAC MACs message under the latest version: kms:v<N>:<base64(mac)>.
+func (k *Key) HMAC(message []byte) (string, error) {
+	h, err := k.hash()
+	if err != nil {
+		return "", err
+	}
+	if len(message) > MaxPlaintext {
+		return "", ErrTooLarge
+	}
+	return format(k.Latest(), k.mac(h, k.Latest(), message)), nil
+}
+
+// VerifyHMAC reports whether mac is message's MAC under the version it
+// names. A MAC that does not match is false, not an error; one that is not
+// kms:v<N>:... or names a version k does not have is ErrInvalidCiphertext.
+func (k *Key) VerifyHMAC(message []byte, mac string) (bool, error) {
+	h, err := k.hash()
+	if err != nil {
+		return false, err
+	}
+	version, body, err := k.parse(mac)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(body, k.mac(h, version, message)), nil
+}
+
+// deriveLabel separates derived subkeys from any other use of the material.
+const deriveLabel = "kms/transit/derive/v1"
+
+// Derive makes the subkey of bits (128, 256 or 512; 0 is 256) for context —
+// a tenant, a purpose — under version (0 is the latest), by HKDF over the
+// key's hash. The same key, version and context always give the same
+// subkey, so a caller derives it again rather than storing it; it keeps the
+// version returned to do so after a rotation. The caller zeroes it.
+func (k *Key) Derive(context []byte, version, bits int) ([]byte, int, error) {
+	h, err := k.hash()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(context) == 0 {
+		return nil, 0, ErrInvalidContext
+	}
+	if version == 0 {
+		version = k.Latest()
+	}
+	if version < 1 || version > k.Latest() {
+		return nil, 0, fmt.Errorf("%w: key %q has no version %d", ErrInvalidKey, k.Name, version)
+	}
+	if bits == 0 {
+		bits = DefaultDataKeyBits
+	}
+	if bits != 128 && bits != 256 && bits != 512 {
+		return nil, 0, fmt.Errorf("%w: derived key bits must be 128, 256 or 512", ErrInvalidKey)
+	}
+	out, err := hkdf.Key(h, k.Versions[version-1].Material, nil, deriveLabel+"\x00"+string(context), bits/8)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, version, nil
+}
+
+// hash is an HMAC key's hash; any other key neither MACs nor derives.
+func (k *Key) hash() (func() hash.Hash, error) {
+	switch k.Type {
+	case TypeHMACSHA256:
+		return sha256.New, nil
+	case TypeHMACSHA3256:
+		return func() hash.Hash { return sha3.New256() }, nil
+	}
+	return nil, fmt.Errorf("%w: a %s key does not MAC or derive", ErrInvalidKey, k.Type)
+}
+
+func (k *Key) mac(h func() hash.Hash, version int, message []byte) []byte {
+	m := hmac.New(h, k.Versions[version-1].Material)
+	m.Write(message)
+	return m.Sum(nil)
+}
+
+// CiphertextVersion reports the key version a ciphertext names.
+func CiphertextVersion(ciphertext string) (int, error) {
+	rest, ok := strings.CutPrefix(ciphertext, ciphertextPrefix)
+	if !ok {
+		return 0, fmt.Errorf("%w: not a kms:v<N>: ciphertext", ErrInvalidCiphertext)
+	}
+	v, _, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, fmt.Errorf("%w: not a kms:v<N>: ciphertext", ErrInvalidCiphertext)
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 || strconv.Itoa(version) != v {
+		return 0, fmt.Errorf("%w: bad version %q", ErrInvalidCiphertext, v)
+	}
+	return version, nil
+}
+
+func (k *Key) encrypt(version int, plaintext, aad, context []byte) (string, error) {
+	if len(plaintext) > MaxPlaintext {
+		return "", ErrTooLarge
+	}
+	if err := k.canEncrypt(); err != nil {
+		return "", err
+	}
+	if err := k.checkContext(context); err != nil {
+		return "", err
+	}
+	gcm, macKey, err := k.cipher(version, context)
+	if err != nil {
+		return "", err
+	}
+	defer clear(macKey)
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if macKey != nil {
+		copy(nonce, syntheticNonce(macKey, aad, plaintext, len(nonce)))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("transit: rand: %w", err)
+	}
+	return format(version, gcm.Seal(nonce, nonce, plaintext, aad)), nil
+}
+
+func (k *Key) canEncrypt() error {
+	if k.Type != TypeAES256GCM {
+		return fmt.Errorf("%w: a %s key does not encrypt", ErrInvalidKey, k.Type)
+	}
+	return nil
+}
+
+func (k *Key) checkContext(context []byte) error {
+	if k.Deterministic != (len(context) > 0) {
+		return ErrInvalidContext
+	}
+	return nil
+}
+
+// sivLabel separates a deterministic key's derivations from any other use
+// of its material.
+const sivLabel = "kms/transit/siv/v1"
+
+// cipher is the AEAD a version encrypts with, and for a deterministic key the
+// key its synthetic nonces are made with. A deterministic version's material
+// is never used directly: HKDF-SHA256 of it, with the context in the info,
+// gives an AES key and an HMAC key for that context alone.
+func (k *Key) cipher(version int, context []byte) (cipher.AEAD, []byte, error) {
+	material := k.Versions[version-1].Material
+	if !k.Deterministic {
+		gcm, err := newGCM(material)
+		return gcm, nil, err
+	}
+	derived, err := hkdf.Key(sha256.New, material, nil, sivLabel+"\x00"+string(context), 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer clear(derived[:32])
+	gcm, err := newGCM(derived[:32])
+	if err != nil {
+		clear(derived)
+		return nil, nil, err
+	}
+	return gcm, derived[32:], nil
+}
+
+// syntheticNonce is the nonce of a deterministic encryption: HMAC-SHA256 of
+// the associated data (length-prefixed) and the plaintext, truncated. Equal
+// inputs give equal nonces, and so equal ciphertexts; unequal ones collide
+// with the probability of a random nonce.
+func syntheticNonce(macKey, aad, plaintext []byte, size int) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(aad)))
+	mac.Write(n[:])
+	mac.Write(aad)
+	mac.Write(plaintext)
+	return mac.Sum(nil)[:size]
+}
+
+// parse splits a ciphertext into the version it names, which k must have,
+// and its body.
+func (k *Key) parse(ciphertext string) (int, []byte, error) {
+	version, err := CiphertextVersion(ciphertext)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version > k.Latest() {
+		return 0, nil, fmt.Errorf("%w: key %q has no version %d", ErrInvalidCiphertext, k.Name, version)
+	}
+	body, err := base64.StdEncoding.DecodeString(ciphertext[len(ciphertextPrefix)+len(strconv.Itoa(version))+1:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: body is not base64", ErrInvalidCiphertext)
+	}
+	return version, body, nil
+}
+
+func format(version int, body []byte) string {
+	return ciphertextPrefix + strconv.Itoa(version) + ":" + base64.StdEncoding.EncodeToString(body)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
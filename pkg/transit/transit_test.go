@@ -0,0 +1,230 @@
+package transit
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptDecryptAcrossRotation(t *testing.T) {
+	now := time.Now()
+	k, err := NewKey("orders", KeyOptions{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct1, err := k.Encrypt([]byte("4111 1111 1111 1111"), []byte("row-7"), nil)
+	if err != nil || !strings.HasPrefix(ct1, "kms:v1:") {
+		t.Fatalf("v1 ciphertext %q, %v", ct1, err)
+	}
+	if again, _ := k.Encrypt([]byte("4111 1111 1111 1111"), []byte("row-7"), nil); again == ct1 {
+		t.Fatal("two encryptions of one plaintext are equal")
+	}
+	if err := k.Rotate(now); err != nil {
+		t.Fatal(err)
+	}
+	ct2, _ := k.Encrypt([]byte("new"), nil, nil)
+	if v, err := CiphertextVersion(ct2); err != nil || v != 2 {
+		t.Fatalf("latest version %d, %v", v, err)
+	}
+	if pt, err := k.Decrypt(ct1, []byte("row-7"), nil); err != nil || string(pt) != "4111 1111 1111 1111" {
+		t.Fatalf("v1 after rotation = %q, %v", pt, err)
+	}
+	if _, err := k.Decrypt(ct1, []byte("row-8"), nil); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong associated data: %v", err)
+	}
+
+	moved, err := k.Rewrap(ct1, []byte("row-7"), nil)
+	if err != nil || !strings.HasPrefix(moved, "kms:v2:") {
+		t.Fatalf("rewrap = %q, %v", moved, err)
+	}
+	if pt, err := k.Decrypt(moved, []byte("row-7"), nil); err != nil || string(pt) != "4111 1111 1111 1111" {
+		t.Fatalf("rewrapped = %q, %v", pt, err)
+	}
+
+	other, _ := NewKey("other", KeyOptions{}, now)
+	if _, err := other.Decrypt(ct1, []byte("row-7"), nil); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("another key's ciphertext: %v", err)
+	}
+	for _, bad := range []string{"", "kms:v3:AAAA", "kms:v0:AAAA", "kms:v01:AAAA", "vault:v1:AAAA", "kms:v1:!!", "kms:v1:AAAA"} {
+		if _, err := k.Decrypt(bad, nil, nil); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%q: err = %v, want ErrInvalidCiphertext", bad, err)
+		}
+	}
+}
+
+func TestDataKey(t *testing.T) {
+	k, _ := NewKey("dek", KeyOptions{Type: TypeAES256GCM}, time.Now())
+	pt, ct, err := k.DataKey(0)
+	if err != nil || len(pt) != 32 {
+		t.Fatalf("data key %d bytes, %v", len(pt), err)
+	}
+	got, err := k.Decrypt(ct, nil, nil)
+	if err != nil || string(got) != string(pt) {
+		t.Fatalf("data key does not decrypt to itself: %v", err)
+	}
+	if _, _, err := k.DataKey(192); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("192 bits: %v", err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	now := time.Now()
+	k, err := NewKey("emails", KeyOptions{Deterministic: true}, now)
+	if err != nil || !k.Info().Deterministic {
+		t.Fatalf("NewKey = %+v, %v", k, err)
+	}
+	users, leads := []byte("users.email"), []byte("leads.email")
+	ct, err := k.Encrypt([]byte("a@lux.network"), nil, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := k.Encrypt([]byte("a@lux.network"), nil, users); again != ct {
+		t.Fatal("equal plaintexts under one context encrypt unequal")
+	}
+	if other, _ := k.Encrypt([]byte("b@lux.network"), nil, users); other == ct {
+		t.Fatal("unequal plaintexts encrypt equal")
+	}
+	if elsewhere, _ := k.Encrypt([]byte("a@lux.network"), nil, leads); elsewhere == ct {
+		t.Fatal("one plaintext under two contexts encrypts equal")
+	}
+	if bound, _ := k.Encrypt([]byte("a@lux.network"), []byte("tenant-1"), users); bound == ct {
+		t.Fatal("associated data does not change the ciphertext")
+	}
+	if pt, err := k.Decrypt(ct, nil, users); err != nil || string(pt) != "a@lux.network" {
+		t.Fatalf("decrypt = %q, %v", pt, err)
+	}
+	if _, err := k.Decrypt(ct, nil, leads); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("decrypt under another context: %v", err)
+	}
+	if _, err := k.Encrypt([]byte("a@lux.network"), nil, nil); !errors.Is(err, ErrInvalidContext) {
+		t.Fatalf("no context: %v", err)
+	}
+	if _, _, err := k.DataKey(0); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("deterministic data key: %v", err)
+	}
+
+	// A rotation changes the ciphertext; rewrap brings old ones along.
+	if err := k.Rotate(now); err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := k.Encrypt([]byte("a@lux.network"), nil, users)
+	if moved, err := k.Rewrap(ct, nil, users); err != nil || moved != fresh || moved == ct {
+		t.Fatalf("rewrap = %q, %v; fresh %q", moved, err, fresh)
+	}
+
+	random, _ := NewKey("r", KeyOptions{}, now)
+	if _, err := random.Encrypt([]byte("x"), nil, users); !errors.Is(err, ErrInvalidContext) {
+		t.Fatalf("context on a randomized key: %v", err)
+	}
+}
+
+func TestHMACAndDerive(t *testing.T) {
+	now := time.Now()
+	k, err := NewKey("webhooks", KeyOptions{Type: TypeHMACSHA256}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("POST /v1/orders\n{}")
+	mac, err := k.HMAC(msg)
+	if err != nil || !strings.HasPrefix(mac, "kms:v1:") {
+		t.Fatalf("HMAC = %q, %v", mac, err)
+	}
+	want := hmac.New(sha256.New, k.Versions[0].Material)
+	want.Write(msg)
+	if mac != "kms:v1:"+base64.StdEncoding.EncodeToString(want.Sum(nil)) {
+		t.Fatal("HMAC is not HMAC-SHA256 under the version's material")
+	}
+	if ok, err := k.VerifyHMAC(msg, mac); err != nil || !ok {
+		t.Fatalf("verify = %v, %v", ok, err)
+	}
+	if ok, _ := k.VerifyHMAC([]byte("POST /v1/refunds\n{}"), mac); ok {
+		t.Fatal("a MAC verifies another message")
+	}
+	if _, err := k.VerifyHMAC(msg, "kms:v9:AAAA"); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("unknown version: %v", err)
+	}
+
+	// A subkey is HKDF over the material, stable per context and version.
+	sub, version, err := k.Derive([]byte("tenant-1"), 0, 0)
+	if err != nil || version != 1 || len(sub) != 32 {
+		t.Fatalf("Derive = %d bytes v%d, %v", len(sub), version, err)
+	}
+	expect, _ := hkdf.Key(sha256.New, k.Versions[0].Material, nil, "kms/transit/derive/v1\x00tenant-1", 32)
+	if string(sub) != string(expect) {
+		t.Fatal("Derive is not HKDF-SHA256 under the version's material")
+	}
+	if other, _, _ := k.Derive([]byte("tenant-2"), 0, 0); string(other) == string(sub) {
+		t.Fatal("two contexts derive one key")
+	}
+	if _, _, err := k.Derive(nil, 0, 0); !errors.Is(err, ErrInvalidContext) {
+		t.Fatalf("no context: %v", err)
+	}
+	if short, _, _ := k.Derive([]byte("tenant-1"), 0, 128); len(short) != 16 {
+		t.Fatalf("128 bits = %d bytes", len(short))
+	}
+	if _, _, err := k.Derive([]byte("tenant-1"), 0, 64); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("64 bits: %v", err)
+	}
+
+	// After a rotation old MACs verify and old subkeys derive again by version.
+	if err := k.Rotate(now); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := k.VerifyHMAC(msg, mac); !ok {
+		t.Fatal("a v1 MAC no longer verifies")
+	}
+	if again, _, _ := k.Derive([]byte("tenant-1"), 1, 0); string(again) != string(sub) {
+		t.Fatal("v1 subkey does not derive again")
+	}
+	if fresh, version, _ := k.Derive([]byte("tenant-1"), 0, 0); version != 2 || string(fresh) == string(sub) {
+		t.Fatal("latest subkey is not v2's")
+	}
+	if _, _, err := k.Derive([]byte("tenant-1"), 3, 0); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("missing version: %v", err)
+	}
+
+	// An HMAC key does not encrypt; an encryption key does not MAC.
+	if _, err := k.Encrypt([]byte("x"), nil, nil); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("encrypt under an hmac key: %v", err)
+	}
+	if _, _, err := k.DataKey(0); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("data key under an hmac key: %v", err)
+	}
+	aes, _ := NewKey("orders", KeyOptions{}, now)
+	if _, err := aes.HMAC(msg); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("HMAC under an aes key: %v", err)
+	}
+	if _, err := NewKey("d", KeyOptions{Type: TypeHMACSHA256, Deterministic: true}, now); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("deterministic hmac key: %v", err)
+	}
+
+	k3, _ := NewKey("sha3", KeyOptions{Type: TypeHMACSHA3256}, now)
+	mac3, _ := k3.HMAC(msg)
+	want3 := hmac.New(func() hash.Hash { return sha3.New256() }, k3.Versions[0].Material)
+	want3.Write(msg)
+	if mac3 != "kms:v1:"+base64.StdEncoding.EncodeToString(want3.Sum(nil)) {
+		t.Fatal("HMAC is not HMAC-SHA3-256 under an hmac-sha3-256 key")
+	}
+}
+
+func TestNewKeyRejects(t *testing.T) {
+	for _, c := range []struct{ name, typ string }{{"", ""}, {"a/b", ""}, {"-x", ""}, {"ok", "rsa-4096"}} {
+		if _, err := NewKey(c.name, KeyOptions{Type: c.typ}, time.Now()); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q %q: err = %v", c.name, c.typ, err)
+		}
+	}
+	k, _ := NewKey("z", KeyOptions{}, time.Now())
+	k.Zero()
+	for _, b := range k.Versions[0].Material {
+		if b != 0 {
+			t.Fatal("Zero left material")
+		}
+	}
+}
@@ -2,12 +2,28 @@
 //
 // Services wanting to fetch secrets from KMS without a REST round-trip
 // spin up a short-lived ZAP Node (mDNS-discovered or direct-addressed) and
-// call the four opcodes defined in zapserver:
+// call the secret opcodes defined in zapserver:
 //
-//	0x0040  OpSecretGet    { path, name, env }            → { value }
-//	0x0041  OpSecretPut    { path, name, env, value }     → { ok:true }   (admin)
-//	0x0042  OpSecretList   { path, env }                  → { secrets }
-//	0x0043  OpSecretDelete { path, name, env }            → { ok:true }   (admin)
+//	0x0040  OpSecretGet      { path, name, env, version?, raw? }  → { value, version }
+//	0x0041  OpSecretPut      { path, name, env, value,
+//	                           expect_version?, expect_absent?, lock?,
+//	                           generate?, reveal? } → { ok:true, version, public_key?, value? } (admin)
+//	0x0042  OpSecretList     { path, env, labels?, cursor?, limit? } → { secrets, next_cursor? }
+//	0x0043  OpSecretDelete   { path, name, env, expect_version? } → { ok:true }      (admin)
+//	0x0044  OpSecretVersions { path, name, env }            → { versions }
+//	0x0045  OpSecretRollback { path, name, env, version }   → { ok:true, version }   (admin)
+//	0x0046  OpSecretUndelete { path, name, env }            → { ok:true, version }   (admin)
+//	0x0047  OpSecretPurge    { path, name, env }            → { ok:true }            (admin)
+//	0x0048  OpSecretDeleted  { path, env }                  → { deleted }
+//	0x0049  OpSecretSetMeta  { path, name, env, meta }      → { ok:true }            (admin)
+//	0x004A  OpSecretBatchGet { path, refs? | env?, labels? } → { items, truncated }
+//	0x004B  OpSecretPromote  { path, from, to, dry_run? }   → { changes, dry_run }  (admin)
+//	0x004C  OpSecretDiff     { path, a, b }                 → { only_in_a, only_in_b, differ, same }
+//	0x004D  OpSecretImport   { path, env, format, document, conflict? } → { imported }  (admin)
+//	0x004E  OpSecretWatch    { path, env?, labels?, cursor?, limit?, wait_ms? } → { changes, cursor, lost? }
+//
+// A write whose expect_* precondition does not hold answers status 0x04 and
+// surfaces as ErrConflict.
 //
 // Example:
 //
@@ -28,10 +44,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"time"
 
 	"github.com/luxfi/kms/pkg/envelope"
+	"github.com/luxfi/kms/pkg/generate"
 	"github.com/luxfi/kms/pkg/secret"
 	kmszap "github.com/luxfi/kms/pkg/zap"
 	"github.com/luxfi/zap"
@@ -43,6 +61,20 @@ const (
 	OpSecretPut    uint16 = 0x0041
 	OpSecretList   uint16 = 0x0042
 	OpSecretDelete uint16 = 0x0043
+
+	OpSecretVersions uint16 = 0x0044
+	OpSecretRollback uint16 = 0x0045
+
+	OpSecretUndelete uint16 = 0x0046
+	OpSecretPurge    uint16 = 0x0047
+	OpSecretDeleted  uint16 = 0x0048
+
+	OpSecretSetMeta  uint16 = 0x0049
+	OpSecretBatchGet uint16 = 0x004A
+	OpSecretPromote  uint16 = 0x004B
+	OpSecretDiff     uint16 = 0x004C
+	OpSecretImport   uint16 = 0x004D
+	OpSecretWatch    uint16 = 0x004E
 )
 
 const (
@@ -50,14 +82,25 @@ const (
 	statusNotFound byte = 0x01
 	statusError    byte = 0x02
 	statusForbid   byte = 0x03
+	statusConflict byte = 0x04
 )
 
 // ErrNotFound is returned when a secret path/name does not exist.
 var ErrNotFound = errors.New("zapclient: secret not found")
 
+// ErrConflict is returned when a conditional write's expect_version or
+// expect_absent did not hold. Nothing was written; re-read and retry.
+var ErrConflict = errors.New("zapclient: precondition failed (secret changed since it was read)")
+
 // ErrForbidden is returned when the caller lacks role=admin for Put/Delete.
 var ErrForbidden = errors.New("zapclient: forbidden (admin role required)")
 
+// ErrChangesLost is returned by WatchAt, and yielded by Watch, when the
+// server no longer holds the changes since the cursor — it restarted, or the
+// watcher fell behind. Re-read what you watch; the feed carries on from the
+// cursor returned with it.
+var ErrChangesLost = errors.New("zapclient: changes were missed; re-read and keep watching")
+
 // Client is a thin wrapper over a zap.Node plus a resolved KMS peer ID.
 type Client struct {
 	node        *zap.Node
@@ -338,22 +381,48 @@ func (c *Client) Get(ctx context.Context, name, env string) (string, error) {
 	return c.GetAt(ctx, c.defaultPath, name, env)
 }
 
-// GetAt reads a secret at an explicit path.
+// GetAt reads the latest version of a secret at an explicit path.
 func (c *Client) GetAt(ctx context.Context, path, name, env string) (string, error) {
-	body, _ := json.Marshal(map[string]string{"path": path, "name": name, "env": env})
+	return c.GetVersionAt(ctx, path, name, env, 0)
+}
+
+// GetVersionAt reads one pinned version of a secret; version 0 is the latest.
+func (c *Client) GetVersionAt(ctx context.Context, path, name, env string, version int) (string, error) {
+	value, _, err := c.getVersion(ctx, path, name, env, version, false)
+	return value, err
+}
+
+// GetWithVersionAt reads the latest value of a secret together with its
+// version — the read half of a read-modify-write with PutIfAt.
+func (c *Client) GetWithVersionAt(ctx context.Context, path, name, env string) (string, int, error) {
+	return c.getVersion(ctx, path, name, env, 0, false)
+}
+
+// GetRawAt reads the latest value of a secret as stored, its ${ref:...}
+// references unexpanded, together with its version. Every other read expands
+// them; this is the one to edit a value through.
+func (c *Client) GetRawAt(ctx context.Context, path, name, env string) (string, int, error) {
+	return c.getVersion(ctx, path, name, env, 0, true)
+}
+
+func (c *Client) getVersion(ctx context.Context, path, name, env string, version int, raw bool) (string, int, error) {
+	body, _ := json.Marshal(map[string]any{"path": path, "name": name, "env": env, "version": version, "raw": raw})
 	resp, err := c.call(ctx, OpSecretGet, body)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	var out struct {
+		Value   string `json:"value"`
+		Version int    `json:"version"`
 	}
-	var out struct{ Value string }
 	if err := json.Unmarshal(resp, &out); err != nil {
-		return "", fmt.Errorf("zapclient: decode Get: %w", err)
+		return "", 0, fmt.Errorf("zapclient: decode Get: %w", err)
 	}
 	b, err := base64.StdEncoding.DecodeString(out.Value)
 	if err != nil {
-		return "", fmt.Errorf("zapclient: decode value: %w", err)
+		return "", 0, fmt.Errorf("zapclient: decode value: %w", err)
 	}
-	return string(b), nil
+	return string(b), out.Version, nil
 }
 
 // Put writes a secret. Requires admin role on the caller principal.
@@ -373,6 +442,102 @@ func (c *Client) PutAt(ctx context.Context, path, name, env, value string) error
 	return err
 }
 
+// PutLockedAt creates a secret locked (write-once): it fails with
+// ErrConflict if the secret exists, and from then on every put and delete of
+// it is ErrConflict until an admin unlocks it. twoPerson makes the unlock
+// need two admins. It returns the version written. Admin-only.
+func (c *Client) PutLockedAt(ctx context.Context, path, name, env, value, reason string, twoPerson bool) (int, error) {
+	body, _ := json.Marshal(map[string]any{
+		"path":  path,
+		"name":  name,
+		"env":   env,
+		"value": base64.StdEncoding.EncodeToString([]byte(value)),
+		"lock":  map[string]any{"reason": reason, "two_person": twoPerson},
+	})
+	resp, err := c.call(ctx, OpSecretPut, body)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return 0, fmt.Errorf("zapclient: decode Put: %w", err)
+	}
+	return out.Version, nil
+}
+
+// Generated is what GenerateAt wrote: the version, a keypair's public key,
+// and the value itself only when it was asked to reveal it.
+type Generated struct {
+	Version   int
+	PublicKey string
+	Value     string
+}
+
+// GenerateAt has the server make a value by policy and store it at
+// (path, name, env), so the value never exists on this side unless reveal
+// asks for it, once. Admin-only.
+func (c *Client) GenerateAt(ctx context.Context, path, name, env string, policy generate.Policy, reveal bool) (Generated, error) {
+	body, _ := json.Marshal(map[string]any{
+		"path":     path,
+		"name":     name,
+		"env":      env,
+		"generate": policy,
+		"reveal":   reveal,
+	})
+	resp, err := c.call(ctx, OpSecretPut, body)
+	if err != nil {
+		return Generated{}, err
+	}
+	var out struct {
+		Version   int    `json:"version"`
+		PublicKey string `json:"public_key"`
+		Value     string `json:"value"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return Generated{}, fmt.Errorf("zapclient: decode Put: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(out.Value)
+	if err != nil {
+		return Generated{}, fmt.Errorf("zapclient: decode value: %w", err)
+	}
+	return Generated{Version: out.Version, PublicKey: out.PublicKey, Value: string(value)}, nil
+}
+
+// WriteCondition makes PutIfAt conditional on the record it replaces. The
+// zero value always holds.
+type WriteCondition struct {
+	// ExpectVersion, when > 0, requires the current version to be exactly it.
+	ExpectVersion int
+	// ExpectAbsent requires that the secret does not exist yet.
+	ExpectAbsent bool
+}
+
+// PutIfAt writes a secret only if cond holds against the current record, and
+// returns the version it wrote. A failed condition is ErrConflict. Admin-only.
+func (c *Client) PutIfAt(ctx context.Context, path, name, env, value string, cond WriteCondition) (int, error) {
+	body, _ := json.Marshal(map[string]any{
+		"path":           path,
+		"name":           name,
+		"env":            env,
+		"value":          base64.StdEncoding.EncodeToString([]byte(value)),
+		"expect_version": cond.ExpectVersion,
+		"expect_absent":  cond.ExpectAbsent,
+	})
+	resp, err := c.call(ctx, OpSecretPut, body)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return 0, fmt.Errorf("zapclient: decode Put: %w", err)
+	}
+	return out.Version, nil
+}
+
 // List enumerates the secrets under the client's default path.
 func (c *Client) List(ctx context.Context, env string) ([]secret.Ref, error) {
 	return c.ListAt(ctx, c.defaultPath, env)
@@ -385,19 +550,66 @@ func (c *Client) List(ctx context.Context, env string) ([]secret.Ref, error) {
 // environments — and a bare name would then be unaddressable: re-joining it at
 // the queried root names a record that is not there. Each returned Ref feeds
 // straight into GetAt/DeleteAt, which is what makes list-then-get total.
+//
+// It returns the first page, the largest the server allows; FindAll follows
+// the cursor through a store larger than that.
 func (c *Client) ListAt(ctx context.Context, path, env string) ([]secret.Ref, error) {
-	body, _ := json.Marshal(map[string]string{"path": path, "env": env})
+	return c.FindAt(ctx, secret.Query{Path: path, Env: env})
+}
+
+// FindAt is ListAt for a full secret.Query, including its label filter.
+// Each returned Ref carries the secret's metadata, if it has any.
+func (c *Client) FindAt(ctx context.Context, q secret.Query) ([]secret.Ref, error) {
+	refs, _, err := c.FindPageAt(ctx, q)
+	return refs, err
+}
+
+// FindPageAt returns one page of q — q.Limit coordinates (bounded by the
+// server) after q.Cursor — and the cursor of the next page, "" after the last.
+func (c *Client) FindPageAt(ctx context.Context, q secret.Query) ([]secret.Ref, string, error) {
+	body, _ := json.Marshal(map[string]any{
+		"path": q.Path, "env": q.Env, "labels": q.Labels, "cursor": q.Cursor, "limit": q.Limit,
+	})
 	resp, err := c.call(ctx, OpSecretList, body)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	var out struct {
-		Secrets []secret.Ref `json:"secrets"`
+		Secrets    []secret.Ref `json:"secrets"`
+		NextCursor string       `json:"next_cursor"`
 	}
 	if err := json.Unmarshal(resp, &out); err != nil {
-		return nil, fmt.Errorf("zapclient: decode List: %w", err)
+		return nil, "", fmt.Errorf("zapclient: decode List: %w", err)
+	}
+	return out.Secrets, out.NextCursor, nil
+}
+
+// FindAll iterates every coordinate q selects, in listing order, fetching a
+// page of q.Limit at a time and following the cursor until the last. An
+// error ends the iteration after being yielded once.
+//
+//	for ref, err := range c.FindAll(ctx, secret.Query{Path: "deploy", Limit: 500}) {
+//		if err != nil { ... }
+//	}
+func (c *Client) FindAll(ctx context.Context, q secret.Query) iter.Seq2[secret.Ref, error] {
+	return func(yield func(secret.Ref, error) bool) {
+		for {
+			refs, next, err := c.FindPageAt(ctx, q)
+			if err != nil {
+				yield(secret.Ref{}, err)
+				return
+			}
+			for _, ref := range refs {
+				if !yield(ref, nil) {
+					return
+				}
+			}
+			if next == "" {
+				return
+			}
+			q.Cursor = next
+		}
 	}
-	return out.Secrets, nil
 }
 
 // Delete removes a secret. Admin-only.
@@ -405,13 +617,289 @@ func (c *Client) Delete(ctx context.Context, name, env string) error {
 	return c.DeleteAt(ctx, c.defaultPath, name, env)
 }
 
-// DeleteAt removes a secret at an explicit path. Admin-only.
+// DeleteAt deletes a secret at an explicit path. Admin-only. The delete is
+// recoverable with UndeleteAt until the server's retention window closes.
 func (c *Client) DeleteAt(ctx context.Context, path, name, env string) error {
 	body, _ := json.Marshal(map[string]string{"path": path, "name": name, "env": env})
 	_, err := c.call(ctx, OpSecretDelete, body)
 	return err
 }
 
+// VersionsAt lists every version of a secret, oldest first — who wrote each
+// and when, never a value.
+func (c *Client) VersionsAt(ctx context.Context, path, name, env string) ([]secret.Version, error) {
+	body, _ := json.Marshal(map[string]string{"path": path, "name": name, "env": env})
+	resp, err := c.call(ctx, OpSecretVersions, body)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Versions []secret.Version `json:"versions"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("zapclient: decode Versions: %w", err)
+	}
+	return out.Versions, nil
+}
+
+// RollbackAt makes an old version the latest by re-writing it as a new
+// version, which it returns. Admin-only.
+func (c *Client) RollbackAt(ctx context.Context, path, name, env string, version int) (int, error) {
+	body, _ := json.Marshal(map[string]any{"path": path, "name": name, "env": env, "version": version})
+	resp, err := c.call(ctx, OpSecretRollback, body)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return 0, fmt.Errorf("zapclient: decode Rollback: %w", err)
+	}
+	return out.Version, nil
+}
+
+// DeleteIfAt deletes a secret only if it is still at expectVersion. A failed
+// condition is ErrConflict. Admin-only.
+func (c *Client) DeleteIfAt(ctx context.Context, path, name, env string, expectVersion int) error {
+	body, _ := json.Marshal(map[string]any{"path": path, "name": name, "env": env, "expect_version": expectVersion})
+	_, err := c.call(ctx, OpSecretDelete, body)
+	return err
+}
+
+// UndeleteAt restores a deleted secret and returns the version it restored.
+// Admin-only.
+func (c *Client) UndeleteAt(ctx context.Context, path, name, env string) (int, error) {
+	body, _ := json.Marshal(map[string]string{"path": path, "name": name, "env": env})
+	resp, err := c.call(ctx, OpSecretUndelete, body)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return 0, fmt.Errorf("zapclient: decode Undelete: %w", err)
+	}
+	return out.Version, nil
+}
+
+// PurgeAt removes a deleted secret and its history for good. Admin-only.
+func (c *Client) PurgeAt(ctx context.Context, path, name, env string) error {
+	body, _ := json.Marshal(map[string]string{"path": path, "name": name, "env": env})
+	_, err := c.call(ctx, OpSecretPurge, body)
+	return err
+}
+
+// DeletedAt lists the deleted, still recoverable secrets under a path.
+func (c *Client) DeletedAt(ctx context.Context, path, env string) ([]secret.Deleted, error) {
+	body, _ := json.Marshal(map[string]string{"path": path, "env": env})
+	resp, err := c.call(ctx, OpSecretDeleted, body)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Deleted []secret.Deleted `json:"deleted"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("zapclient: decode Deleted: %w", err)
+	}
+	return out.Deleted, nil
+}
+
+// SetMetaAt replaces a secret's labels, description, owner and expiry without
+// writing a new version; nil clears them. Admin-only.
+func (c *Client) SetMetaAt(ctx context.Context, path, name, env string, meta *secret.Meta) error {
+	body, _ := json.Marshal(map[string]any{"path": path, "name": name, "env": env, "meta": meta})
+	_, err := c.call(ctx, OpSecretSetMeta, body)
+	return err
+}
+
+// Item is one answer of a batch read. Status is "ok" (Value and Version are
+// set), "not_found", "expired", "forbidden" (the value holds a reference the
+// caller may not read) or "error"; a missing item does not fail the batch.
+type Item struct {
+	secret.Ref
+	Status  string
+	Value   string
+	Version int
+	// Error explains an "expired", "forbidden" or "error" status.
+	Error string
+}
+
+// Found reports whether the item carries a value.
+func (it Item) Found() bool { return it.Status == "ok" }
+
+// GetManyAt reads every ref in one signed request and one response, in the
+// order given. Each ref must lie under path, the root the request is
+// authorized for.
+func (c *Client) GetManyAt(ctx context.Context, path string, refs []secret.Ref) ([]Item, error) {
+	items, _, err := c.batchGet(ctx, map[string]any{"path": path, "refs": refs})
+	return items, err
+}
+
+// GetMatching reads every secret q selects in one signed request and one
+// response, in listing order. truncated reports that more matched than one
+// batch carries; narrow q rather than trusting a partial answer.
+func (c *Client) GetMatching(ctx context.Context, q secret.Query) (items []Item, truncated bool, err error) {
+	return c.batchGet(ctx, map[string]any{"path": q.Path, "env": q.Env, "labels": q.Labels})
+}
+
+func (c *Client) batchGet(ctx context.Context, req map[string]any) ([]Item, bool, error) {
+	body, _ := json.Marshal(req)
+	resp, err := c.call(ctx, OpSecretBatchGet, body)
+	if err != nil {
+		return nil, false, err
+	}
+	var out struct {
+		Items []struct {
+			secret.Ref
+			Status  string `json:"status"`
+			Value   string `json:"value"`
+			Version int    `json:"version"`
+			Error   string `json:"error"`
+		} `json:"items"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, false, fmt.Errorf("zapclient: decode BatchGet: %w", err)
+	}
+	items := make([]Item, len(out.Items))
+	for i, it := range out.Items {
+		items[i] = Item{Ref: it.Ref, Status: it.Status, Version: it.Version, Error: it.Error}
+		if it.Status != "ok" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(it.Value)
+		if err != nil {
+			return nil, false, fmt.Errorf("zapclient: decode value of %s/%s@%s: %w", it.Path, it.Name, it.Env, err)
+		}
+		items[i].Value = string(b)
+	}
+	return items, out.Truncated, nil
+}
+
+// PromoteAt copies every secret under path in env from to env to, in one
+// server-side transaction, and returns what it did to each. With dryRun it
+// writes nothing and returns what it would do. Requires admin.
+func (c *Client) PromoteAt(ctx context.Context, path, from, to string, dryRun bool) ([]secret.Promotion, error) {
+	body, _ := json.Marshal(map[string]any{"path": path, "from": from, "to": to, "dry_run": dryRun})
+	resp, err := c.call(ctx, OpSecretPromote, body)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Changes []secret.Promotion `json:"changes"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("zapclient: decode Promote: %w", err)
+	}
+	return out.Changes, nil
+}
+
+// DiffAt reports which secrets under path exist only in env a, only in env
+// b, or in both with different values. Values are compared on the server;
+// the answer carries names only.
+func (c *Client) DiffAt(ctx context.Context, path, a, b string) (*secret.EnvDiff, error) {
+	body, _ := json.Marshal(map[string]any{"path": path, "a": a, "b": b})
+	resp, err := c.call(ctx, OpSecretDiff, body)
+	if err != nil {
+		return nil, err
+	}
+	var out secret.EnvDiff
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("zapclient: decode Diff: %w", err)
+	}
+	return &out, nil
+}
+
+// ImportAt writes every secret of a dotenv, JSON or YAML document to path and
+// env in one server-side transaction. conflict is "fail" (or ""), "skip" or
+// "overwrite"; under "fail" an existing name surfaces as ErrConflict and
+// nothing is written. Requires admin.
+func (c *Client) ImportAt(ctx context.Context, path, env, format, document, conflict string) ([]secret.Imported, error) {
+	body, _ := json.Marshal(map[string]any{"path": path, "env": env, "format": format, "document": document, "conflict": conflict})
+	resp, err := c.call(ctx, OpSecretImport, body)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Imported []secret.Imported `json:"imported"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("zapclient: decode Import: %w", err)
+	}
+	return out.Imported, nil
+}
+
+// WatchAt asks for the changes q selects written after q.Cursor ("" is
+// now), waiting up to wait (the server caps it) for one if there are none
+// yet. It returns the changes — coordinates and versions, never values — and
+// the cursor to pass next; with ErrChangesLost, the cursor to carry on from.
+//
+// The request holds the connection while it waits, and a ZAP connection
+// serves one request at a time: watch from a Client of its own.
+func (c *Client) WatchAt(ctx context.Context, q secret.Query, wait time.Duration) ([]secret.Change, string, error) {
+	body, _ := json.Marshal(map[string]any{
+		"path": q.Path, "env": q.Env, "labels": q.Labels, "cursor": q.Cursor, "limit": q.Limit,
+		"wait_ms": wait.Milliseconds(),
+	})
+	resp, err := c.call(ctx, OpSecretWatch, body)
+	if err != nil {
+		return nil, "", err
+	}
+	var out struct {
+		Changes []secret.Change `json:"changes"`
+		Cursor  string          `json:"cursor"`
+		Lost    bool            `json:"lost"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, "", fmt.Errorf("zapclient: decode Watch: %w", err)
+	}
+	if out.Lost {
+		return nil, out.Cursor, ErrChangesLost
+	}
+	return out.Changes, out.Cursor, nil
+}
+
+// watchWait is how long each request of Watch waits for a change.
+const watchWait = 25 * time.Second
+
+// Watch iterates the changes q selects from q.Cursor on ("" is now), asking
+// again whenever a wait ends quiet, until ctx is done or the loop breaks.
+// ErrChangesLost is yielded and the watch goes on from where the server
+// says; any other error ends the iteration after being yielded once.
+//
+//	for ch, err := range c.Watch(ctx, secret.Query{Path: "svc", Env: "main"}) {
+//		if errors.Is(err, zapclient.ErrChangesLost) { reload(); continue }
+//		if err != nil { ... }
+//		reloadOne(ch.Path, ch.Name, ch.Env)
+//	}
+func (c *Client) Watch(ctx context.Context, q secret.Query) iter.Seq2[secret.Change, error] {
+	return func(yield func(secret.Change, error) bool) {
+		for ctx.Err() == nil {
+			changes, next, err := c.WatchAt(ctx, q, watchWait)
+			switch {
+			case errors.Is(err, ErrChangesLost):
+				if !yield(secret.Change{}, err) {
+					return
+				}
+			case err != nil:
+				if ctx.Err() == nil {
+					yield(secret.Change{}, err)
+				}
+				return
+			}
+			for _, ch := range changes {
+				if !yield(ch, nil) {
+					return
+				}
+			}
+			q.Cursor = next
+		}
+	}
+}
+
 // call is the shared request/response wrapper around zap.Node.Call.
 //
 // Wire format on both directions: opcode(2 LE) || envelope-json for
@@ -501,6 +989,8 @@ func (c *Client) call(ctx context.Context, op uint16, body []byte) ([]byte, erro
 		return nil, ErrNotFound
 	case statusForbid:
 		return nil, ErrForbidden
+	case statusConflict:
+		return nil, fmt.Errorf("%w: %s", ErrConflict, string(payload))
 	default:
 		return nil, fmt.Errorf("zapclient: server error: %s", string(payload))
 	}
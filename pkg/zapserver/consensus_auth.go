@@ -53,6 +53,25 @@ const (
 	OpAuthPut    Op = Op(OpSecretPut)
 	OpAuthList   Op = Op(OpSecretList)
 	OpAuthDelete Op = Op(OpSecretDelete)
+	// Version history: listing versions is a read, rollback is a write.
+	OpAuthVersions Op = Op(OpSecretVersions)
+	OpAuthRollback Op = Op(OpSecretRollback)
+	// Soft delete: undelete and purge are writes, listing tombstones a read.
+	OpAuthUndelete Op = Op(OpSecretUndelete)
+	OpAuthPurge    Op = Op(OpSecretPurge)
+	OpAuthDeleted  Op = Op(OpSecretDeleted)
+	// Metadata edits are writes.
+	OpAuthSetMeta Op = Op(OpSecretSetMeta)
+	// A batch get is a read, authorized once for the whole batch.
+	OpAuthBatchGet Op = Op(OpSecretBatchGet)
+	// A promote writes a whole env subtree; a write, even as a dry run.
+	OpAuthPromote Op = Op(OpSecretPromote)
+	// An env diff is a read; each env is also authorized as a get.
+	OpAuthDiff Op = Op(OpSecretDiff)
+	// A bulk import writes many secrets.
+	OpAuthImport Op = Op(OpSecretImport)
+	// Watching the change feed is a read of the path.
+	OpAuthWatch Op = Op(OpSecretWatch)
 	// Threshold key ops. Deliberate, documented widening of the
 	// authorizer contract (not a silent one): OpSign is a privileged
 	// key operation gated behind the operator (write) authority;
@@ -60,6 +79,26 @@ const (
 	// authority.
 	OpAuthSign   Op = Op(OpSign)
 	OpAuthVerify Op = Op(OpVerify)
+	// Transit: using a key — to encrypt, MAC or derive — is a read of
+	// "transit/<key>"; creating, rotating or importing one is a write.
+	OpAuthTransitEncrypt     Op = Op(OpTransitEncrypt)
+	OpAuthTransitDecrypt     Op = Op(OpTransitDecrypt)
+	OpAuthTransitRewrap      Op = Op(OpTransitRewrap)
+	OpAuthTransitDataKey     Op = Op(OpTransitDataKey)
+	OpAuthTransitCreate      Op = Op(OpTransitCreate)
+	OpAuthTransitRotate      Op = Op(OpTransitRotate)
+	OpAuthTransitImportToken Op = Op(OpTransitImportToken)
+	OpAuthTransitImport      Op = Op(OpTransitImport)
+	OpAuthTransitHMAC        Op = Op(OpTransitHMAC)
+	OpAuthTransitVerify      Op = Op(OpTransitVerify)
+	OpAuthTransitDerive      Op = Op(OpTransitDerive)
+	// Tokenization: tokenizing is a read of "tokenize/<key>" and creating
+	// a key a write. Detokenizing is neither: it needs the detokenizer
+	// authority (IsDetokenize), so a service that may make tokens cannot
+	// by that alone turn them back into card numbers.
+	OpAuthTokenize       Op = Op(OpTokenize)
+	OpAuthDetokenize     Op = Op(OpDetokenize)
+	OpAuthTokenizeCreate Op = Op(OpTokenizeCreate)
 )
 
 // IsWrite reports whether the opcode is a mutation (or, for OpSign, a
@@ -67,13 +106,19 @@ const (
 // these behind the operator authority.
 func (o Op) IsWrite() bool {
 	switch o {
-	case OpAuthPut, OpAuthDelete, OpAuthSign:
+	case OpAuthPut, OpAuthDelete, OpAuthRollback, OpAuthUndelete, OpAuthPurge, OpAuthSetMeta, OpAuthPromote, OpAuthImport, OpAuthSign,
+		OpAuthTransitCreate, OpAuthTransitRotate, OpAuthTransitImportToken, OpAuthTransitImport, OpAuthTokenizeCreate:
 		return true
 	default:
 		return false
 	}
 }
 
+// IsDetokenize reports whether the opcode turns a token back into its
+// value, which the in-process authorizer gates behind the detokenizer
+// authority.
+func (o Op) IsDetokenize() bool { return o == OpAuthDetokenize }
+
 // String returns "OpSecretGet" / "OpSecretPut" / etc. so audit logs
 // stay readable without leaking opcode bytes.
 func (o Op) String() string {
@@ -86,10 +131,60 @@ func (o Op) String() string {
 		return "OpSecretList"
 	case OpAuthDelete:
 		return "OpSecretDelete"
+	case OpAuthVersions:
+		return "OpSecretVersions"
+	case OpAuthRollback:
+		return "OpSecretRollback"
+	case OpAuthUndelete:
+		return "OpSecretUndelete"
+	case OpAuthPurge:
+		return "OpSecretPurge"
+	case OpAuthDeleted:
+		return "OpSecretDeleted"
+	case OpAuthSetMeta:
+		return "OpSecretSetMeta"
+	case OpAuthBatchGet:
+		return "OpSecretBatchGet"
+	case OpAuthPromote:
+		return "OpSecretPromote"
+	case OpAuthDiff:
+		return "OpSecretDiff"
+	case OpAuthImport:
+		return "OpSecretImport"
+	case OpAuthWatch:
+		return "OpSecretWatch"
 	case OpAuthSign:
 		return "OpSign"
 	case OpAuthVerify:
 		return "OpVerify"
+	case OpAuthTransitEncrypt:
+		return "OpTransitEncrypt"
+	case OpAuthTransitDecrypt:
+		return "OpTransitDecrypt"
+	case OpAuthTransitRewrap:
+		return "OpTransitRewrap"
+	case OpAuthTransitDataKey:
+		return "OpTransitDataKey"
+	case OpAuthTransitCreate:
+		return "OpTransitCreate"
+	case OpAuthTransitRotate:
+		return "OpTransitRotate"
+	case OpAuthTransitImportToken:
+		return "OpTransitImportToken"
+	case OpAuthTransitImport:
+		return "OpTransitImport"
+	case OpAuthTransitHMAC:
+		return "OpTransitHMAC"
+	case OpAuthTransitVerify:
+		return "OpTransitVerify"
+	case OpAuthTransitDerive:
+		return "OpTransitDerive"
+	case OpAuthTokenize:
+		return "OpTokenize"
+	case OpAuthDetokenize:
+		return "OpDetokenize"
+	case OpAuthTokenizeCreate:
+		return "OpTokenizeCreate"
 	}
 	return fmt.Sprintf("Op_0x%04X", uint16(o))
 }
@@ -193,6 +288,11 @@ type InProcessAuthorizerConfig struct {
 	// Operator is the write authority. Required.
 	Operator AuthorityProvider
 
+	// Detokenizers is the detokenize authority: only its members, who
+	// must also be validators, may turn a token back into its value.
+	// Optional; nil means no identity may detokenize.
+	Detokenizers AuthorityProvider
+
 	// CacheTTL is the per-authority result TTL. 0 disables caching
 	// (every request dials both providers). 30s is the production
 	// default — the kmsd reconfigures the cache via the operator's
@@ -210,9 +310,10 @@ func NewInProcessAuthorizer(cfg InProcessAuthorizerConfig) (*InProcessAuthorizer
 		return nil, errors.New("zapserver: operator authority provider is required")
 	}
 	return &InProcessAuthorizer{
-		validators: cfg.Validators,
-		operator:   cfg.Operator,
-		cacheTTL:   cfg.CacheTTL,
+		validators:   cfg.Validators,
+		operator:     cfg.Operator,
+		detokenizers: cfg.Detokenizers,
+		cacheTTL:     cfg.CacheTTL,
 	}, nil
 }
 
@@ -220,15 +321,18 @@ func NewInProcessAuthorizer(cfg InProcessAuthorizerConfig) (*InProcessAuthorizer
 // process" name means the policy composition runs in the kmsd process;
 // the AUTHORITY data still comes from consensus (via the providers).
 type InProcessAuthorizer struct {
-	validators AuthorityProvider
-	operator   AuthorityProvider
-	cacheTTL   time.Duration
-
-	mu             sync.RWMutex
-	validatorsSet  map[ids.NodeID]struct{}
-	validatorsRead time.Time
-	operatorSet    map[ids.NodeID]struct{}
-	operatorRead   time.Time
+	validators   AuthorityProvider
+	operator     AuthorityProvider
+	detokenizers AuthorityProvider
+	cacheTTL     time.Duration
+
+	mu               sync.RWMutex
+	validatorsSet    map[ids.NodeID]struct{}
+	validatorsRead   time.Time
+	operatorSet      map[ids.NodeID]struct{}
+	operatorRead     time.Time
+	detokenizersSet  map[ids.NodeID]struct{}
+	detokenizersRead time.Time
 }
 
 // Authorize is the entry point. Decision order:
@@ -238,13 +342,20 @@ type InProcessAuthorizer struct {
 //     → Deny("not-a-validator").
 //  3. For writes: additionally look up the NodeID in the operator
 //     authority. Miss → Deny("not-an-operator").
-//  4. Allow.
+//  4. For a detokenize: additionally look up the NodeID in the
+//     detokenizer authority. None configured, or a miss →
+//     Deny("not-a-detokenizer").
+//  5. Allow.
 //
 // On provider error: Deny + error so the caller can log the transient
 // failure while the wire still sees a clean forbid.
 func (a *InProcessAuthorizer) Authorize(ctx context.Context, ident Identity, path string, op Op) (Decision, error) {
 	switch op {
-	case OpAuthGet, OpAuthPut, OpAuthList, OpAuthDelete, OpAuthSign, OpAuthVerify:
+	case OpAuthGet, OpAuthPut, OpAuthList, OpAuthDelete, OpAuthVersions, OpAuthRollback,
+		OpAuthUndelete, OpAuthPurge, OpAuthDeleted, OpAuthSetMeta, OpAuthBatchGet, OpAuthPromote, OpAuthDiff, OpAuthImport, OpAuthWatch, OpAuthSign, OpAuthVerify,
+		OpAuthTransitEncrypt, OpAuthTransitDecrypt, OpAuthTransitRewrap, OpAuthTransitDataKey, OpAuthTransitCreate, OpAuthTransitRotate,
+		OpAuthTransitImportToken, OpAuthTransitImport, OpAuthTransitHMAC, OpAuthTransitVerify, OpAuthTransitDerive,
+		OpAuthTokenize, OpAuthDetokenize, OpAuthTokenizeCreate:
 	default:
 		return Deny(fmt.Sprintf("unknown-opcode-%s", op.String())), nil
 	}
@@ -261,6 +372,20 @@ func (a *InProcessAuthorizer) Authorize(ctx context.Context, ident Identity, pat
 		return Deny("not-a-validator"), nil
 	}
 
+	if op.IsDetokenize() {
+		if a.detokenizers == nil {
+			return Deny("not-a-detokenizer"), nil
+		}
+		detokenizers, err := a.snapshotDetokenizers(ctx)
+		if err != nil {
+			return Deny("detokenizer-authority-unreachable"), err
+		}
+		if _, ok := detokenizers[ident.NodeID]; !ok {
+			return Deny("not-a-detokenizer"), nil
+		}
+		return Allow("detokenizer"), nil
+	}
+
 	if !op.IsWrite() {
 		return Allow("validator-read"), nil
 	}
@@ -322,6 +447,29 @@ func (a *InProcessAuthorizer) snapshotOperator(ctx context.Context) (map[ids.Nod
 	return set, nil
 }
 
+// snapshotDetokenizers returns the current detokenizer authority. Cached
+// up to a.cacheTTL.
+func (a *InProcessAuthorizer) snapshotDetokenizers(ctx context.Context) (map[ids.NodeID]struct{}, error) {
+	a.mu.RLock()
+	if a.cacheTTL > 0 && a.detokenizersSet != nil && time.Since(a.detokenizersRead) < a.cacheTTL {
+		set := a.detokenizersSet
+		a.mu.RUnlock()
+		return set, nil
+	}
+	a.mu.RUnlock()
+
+	members, err := a.detokenizers.Members(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detokenizers: %w", err)
+	}
+	set := toNodeIDSet(members)
+	a.mu.Lock()
+	a.detokenizersSet = set
+	a.detokenizersRead = time.Now()
+	a.mu.Unlock()
+	return set, nil
+}
+
 // toNodeIDSet builds a constant-time-lookup set from a slice. The
 // returned map is internal; callers receive a read-only view via
 // snapshot*.
@@ -20,12 +20,37 @@
 //
 // Op → verb map (env.Op):
 //
-//	OpSecretGet    0x0040  read   (validator authority)  { path, name, env }
-//	OpSecretPut    0x0041  write  (operator authority)   { path, name, env, value }  (also the rotate op — upsert)
-//	OpSecretList   0x0042  read   (validator authority)  { path, env }
-//	OpSecretDelete 0x0043  write  (operator authority)   { path, name, env }
-//	OpSign         0x0050  write  (operator authority)   { validator_id, key_type, message }
-//	OpVerify       0x0051  read   (validator authority)  { validator_id, key_type, message, signature }
+//	OpSecretGet      0x0040  read   (validator authority)  { path, name, env, version?, raw? }
+//	OpSecretPut      0x0041  write  (operator authority)   { path, name, env, value, expect_version?, expect_absent?, meta?, lock?, generate?, reveal?, mode? }  (also the rotate op — upsert)
+//	OpSecretList     0x0042  read   (validator authority)  { path, env, labels?, cursor?, limit? }
+//	OpSecretDelete   0x0043  write  (operator authority)   { path, name, env, expect_version? }
+//	OpSecretVersions 0x0044  read   (validator authority)  { path, name, env }
+//	OpSecretRollback 0x0045  write  (operator authority)   { path, name, env, version, expect_version? }
+//	OpSecretUndelete 0x0046  write  (operator authority)   { path, name, env }
+//	OpSecretPurge    0x0047  write  (operator authority)   { path, name, env }
+//	OpSecretDeleted  0x0048  read   (validator authority)  { path, env }
+//	OpSecretSetMeta  0x0049  write  (operator authority)   { path, name, env, meta, expect_version? }
+//	OpSecretBatchGet 0x004A  read   (validator authority)  { path, refs? | env?, labels? }
+//	OpSecretPromote  0x004B  write  (operator authority)   { path, from, to, dry_run? }
+//	OpSecretDiff     0x004C  read   (validator authority)  { path, a, b }
+//	OpSecretImport   0x004D  write  (operator authority)   { path, env, format, document, conflict? }
+//	OpSecretWatch    0x004E  read   (validator authority)  { path, env?, labels?, cursor?, limit?, wait_ms? }
+//	OpSign           0x0050  write  (operator authority)   { validator_id, key_type, message }
+//	OpVerify         0x0051  read   (validator authority)  { validator_id, key_type, message, signature }
+//	OpTransitEncrypt 0x0060  read   (validator authority)  { key, plaintext, associated_data?, context? }
+//	OpTransitDecrypt 0x0061  read   (validator authority)  { key, ciphertext, associated_data?, context? }
+//	OpTransitRewrap  0x0062  read   (validator authority)  { key, ciphertext, associated_data?, context? }
+//	OpTransitDataKey 0x0063  read   (validator authority)  { key, bits?, wrapped? }
+//	OpTransitCreate  0x0064  write  (operator authority)   { key, type?, deterministic? }
+//	OpTransitRotate  0x0065  write  (operator authority)   { key }
+//	OpTransitImportToken 0x0066  write  (operator authority)  { key, ttl_seconds? }
+//	OpTransitImport  0x0067  write  (operator authority)   { key, token, algorithm?, wrapped_key, type?, deterministic? }
+//	OpTokenize       0x0068  read   (validator authority)  { key, value, tweak? }
+//	OpDetokenize     0x0069  detokenize (detokenizer authority)  { key, token, tweak? }
+//	OpTokenizeCreate 0x006A  write  (operator authority)   { key, mode?, alphabet? }
+//	OpTransitHMAC    0x0070  read   (validator authority)  { key, input }
+//	OpTransitVerify  0x0071  read   (validator authority)  { key, input, mac }
+//	OpTransitDerive  0x0072  read   (validator authority)  { key, context, version?, bits? }  (refused here: no session to seal to)
 
 package zapserver
 
@@ -111,6 +136,8 @@ func httpStatusFor(status byte) int {
 		return http.StatusNotFound
 	case statusForbid:
 		return http.StatusForbidden
+	case statusConflict:
+		return http.StatusConflict
 	default: // statusError
 		return http.StatusBadRequest
 	}
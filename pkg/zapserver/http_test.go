@@ -16,6 +16,8 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -25,6 +27,10 @@ import (
 
 	"github.com/luxfi/ids"
 	"github.com/luxfi/keys"
+	"github.com/luxfi/kms/pkg/byok"
+	"github.com/luxfi/kms/pkg/generate"
+	"github.com/luxfi/kms/pkg/schema"
+	"github.com/luxfi/kms/pkg/secret"
 	"github.com/luxfi/kms/pkg/store"
 	"github.com/luxfi/log"
 	badger "github.com/luxfi/zapdb"
@@ -468,3 +474,698 @@ func TestHTTP_Verify_NonValidator_403(t *testing.T) {
 		t.Fatalf("backend verify reached on forbidden request")
 	}
 }
+
+// TestHTTP_SealedStoreIsSharedWithHTTPSurface proves the two secret transports
+// read each other's records. The HTTP /v1/kms/secrets surface writes through
+// store.SealedStore; a record written that way must answer OpSecretGet, and a
+// record written by OpSecretPut must read back through the same SealedStore.
+func TestHTTP_SealedStoreIsSharedWithHTTPSurface(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	sealed, err := store.NewSealedStore(srv.store, srv.masterKey)
+	if err != nil {
+		t.Fatalf("sealed store: %v", err)
+	}
+
+	// HTTP-style write → ZAP-op read.
+	if _, err := sealed.Put("hanzo/svc", "FROM_HTTP", "prod", []byte("http-value"), store.PutOptions{}); err != nil {
+		t.Fatalf("sealed put: %v", err)
+	}
+	rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "FROM_HTTP", Env: "prod"}, "n1", httpTestClock)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get of HTTP-written record code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var out getResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if pt, _ := base64.StdEncoding.DecodeString(out.Value); string(pt) != "http-value" {
+		t.Fatalf("get of HTTP-written record = %q, want http-value", pt)
+	}
+
+	// ZAP-op write → HTTP-style read.
+	put := putReq{Path: "hanzo/svc", Name: "FROM_ZAP", Env: "prod", Value: base64.StdEncoding.EncodeToString([]byte("zap-value"))}
+	if rec := do(t, h, op, OpSecretPut, put, "n2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("put code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	got, err := sealed.Get("hanzo/svc", "FROM_ZAP", "prod")
+	if err != nil || string(got) != "zap-value" {
+		t.Fatalf("sealed read of ZAP-written record = %q, %v; want zap-value", got, err)
+	}
+}
+
+// TestHTTP_VersionsPinnedGetAndRollback drives the version ops through the
+// shared dispatch: two puts make two versions, OpSecretGet pins either,
+// OpSecretVersions names the writer, and OpSecretRollback re-writes v1 as v3.
+func TestHTTP_VersionsPinnedGetAndRollback(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	_, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+
+	for i, v := range []string{"v1-value", "v2-value"} {
+		put := putReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Value: base64.StdEncoding.EncodeToString([]byte(v))}
+		if rec := do(t, h, op, OpSecretPut, put, fmt.Sprintf("p%d", i), httpTestClock); rec.Code != http.StatusOK {
+			t.Fatalf("put %d code=%d body=%s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	get := func(version int, nonce string) getResp {
+		t.Helper()
+		rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Version: version}, nonce, httpTestClock)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get v%d code=%d body=%s", version, rec.Code, rec.Body.String())
+		}
+		var out getResp
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return out
+	}
+	if out := get(0, "g0"); out.Version != 2 {
+		t.Fatalf("latest version = %d, want 2", out.Version)
+	}
+	if out := get(1, "g1"); out.Value != base64.StdEncoding.EncodeToString([]byte("v1-value")) {
+		t.Fatalf("pinned v1 = %q", out.Value)
+	}
+	if rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Version: 9}, "g9", httpTestClock); rec.Code != http.StatusNotFound {
+		t.Fatalf("get v9 code=%d, want 404", rec.Code)
+	}
+
+	rec := do(t, h, op, OpSecretVersions, versionsReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod"}, "l1", httpTestClock)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("versions code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var vs versionsResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &vs)
+	if len(vs.Versions) != 2 || !strings.HasPrefix(vs.Versions[1].CreatedBy, "zap:") {
+		t.Fatalf("versions = %+v", vs.Versions)
+	}
+
+	rec = do(t, h, op, OpSecretRollback, rollbackReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Version: 1}, "r1", httpTestClock)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rollback code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if out := get(0, "g2"); out.Version != 3 || out.Value != base64.StdEncoding.EncodeToString([]byte("v1-value")) {
+		t.Fatalf("after rollback latest = %+v, want v1-value at v3", out)
+	}
+}
+
+// TestHTTP_DeleteIsRecoverable: OpSecretDelete tombstones, OpSecretDeleted
+// lists the tombstone, OpSecretUndelete restores it and OpSecretPurge, once
+// it is deleted again, removes it for good.
+func TestHTTP_DeleteIsRecoverable(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	seed(t, srv, "hanzo/svc", "TOKEN", "prod", "value")
+	coord := delReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod"}
+
+	if rec := do(t, h, op, OpSecretDelete, coord, "d1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("delete code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod"}, "g1", httpTestClock); rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete code=%d, want 404", rec.Code)
+	}
+	rec := do(t, h, op, OpSecretDeleted, listReq{Path: "hanzo"}, "l1", httpTestClock)
+	var out deletedResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if rec.Code != http.StatusOK || len(out.Deleted) != 1 || out.Deleted[0].Name != "TOKEN" {
+		t.Fatalf("deleted code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, op, OpSecretUndelete, coord, "u1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("undelete code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod"}, "g2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("get after undelete code=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(t, h, op, OpSecretPurge, coord, "p1", httpTestClock); rec.Code != http.StatusNotFound {
+		t.Fatalf("purge of live secret code=%d, want 404", rec.Code)
+	}
+	do(t, h, op, OpSecretDelete, coord, "d2", httpTestClock)
+	if rec := do(t, h, op, OpSecretPurge, coord, "p2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("purge code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, op, OpSecretUndelete, coord, "u2", httpTestClock); rec.Code != http.StatusNotFound {
+		t.Fatalf("undelete after purge code=%d, want 404", rec.Code)
+	}
+}
+
+// TestHTTP_ConditionalWriteConflict: expect_version and expect_absent are
+// checked against the stored record, and a stale one answers 409 (status byte
+// 0x04) without writing.
+func TestHTTP_ConditionalWriteConflict(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	seed(t, srv, "hanzo/svc", "TOKEN", "prod", "value")
+	put := func(value string) putReq {
+		return putReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Value: base64.StdEncoding.EncodeToString([]byte(value))}
+	}
+
+	create := put("dup")
+	create.ExpectAbsent = true
+	if rec := do(t, h, op, OpSecretPut, create, "c1", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("create-only over existing code=%d, want 409", rec.Code)
+	}
+	stale := put("stale")
+	stale.ExpectVersion = 2
+	if rec := do(t, h, op, OpSecretPut, stale, "p1", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("stale put code=%d, want 409", rec.Code)
+	}
+	fresh := put("fresh")
+	fresh.ExpectVersion = 1
+	if rec := do(t, h, op, OpSecretPut, fresh, "p2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("current put code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	del := delReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", ExpectVersion: 1}
+	if rec := do(t, h, op, OpSecretDelete, del, "d1", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("stale delete code=%d, want 409", rec.Code)
+	}
+	rec := do(t, h, op, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod"}, "g1", httpTestClock)
+	var got getResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if v, _ := base64.StdEncoding.DecodeString(got.Value); string(v) != "fresh" || got.Version != 2 {
+		t.Fatalf("after conflicts = %q v%d, want fresh v2", v, got.Version)
+	}
+}
+
+// TestHTTP_MetaSetAndLabelList: OpSecretSetMeta attaches labels without a new
+// version, and OpSecretList filters on them and returns the meta.
+func TestHTTP_MetaSetAndLabelList(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	seed(t, srv, "hanzo/svc", "TOKEN", "prod", "value")
+	seed(t, srv, "hanzo/svc", "OTHER", "prod", "value")
+
+	set := setMetaReq{Path: "hanzo/svc", Name: "TOKEN", Env: "prod", Meta: &secret.Meta{Labels: map[string]string{"tier": "gold"}}}
+	if rec := do(t, h, op, OpSecretSetMeta, set, "m1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("set meta code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	rec := do(t, h, op, OpSecretList, listReq{Path: "hanzo", Labels: map[string]string{"tier": "gold"}}, "l1", httpTestClock)
+	var out listResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if rec.Code != http.StatusOK || len(out.Secrets) != 1 || out.Secrets[0].Name != "TOKEN" || out.Secrets[0].Meta.Labels["tier"] != "gold" {
+		t.Fatalf("list by label code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// denyPathAuthorizer refuses every op on one path and defers the rest — the
+// shape a path-scoped grant takes.
+type denyPathAuthorizer struct {
+	inner ConsensusAuthorizer
+	path  string
+}
+
+func (d denyPathAuthorizer) Authorize(ctx context.Context, ident Identity, path string, op Op) (Decision, error) {
+	if path == d.path {
+		return Deny("path not granted"), nil
+	}
+	return d.inner.Authorize(ctx, ident, path, op)
+}
+
+// TestHTTP_GetExpandsReferencesPerCallerAuthority: a reference expands only
+// into what the caller could get directly. The same value that reads through
+// a granted path is refused, naming the reference, when its target is not.
+func TestHTTP_GetExpandsReferencesPerCallerAuthority(t *testing.T) {
+	ident := newIdentity(t, "hanzo/auto")
+	defer ident.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{ident.NodeID}, nil, nil)
+	srv.authz = denyPathAuthorizer{inner: srv.authz, path: "hanzo/vault"}
+	seed(t, srv, "hanzo/db", "host", "prod", "db.internal")
+	seed(t, srv, "hanzo/vault", "root", "prod", "do-not-leak")
+	seed(t, srv, "hanzo/auto", "dsn", "prod", "pg://${ref:hanzo/db/host}")
+	seed(t, srv, "hanzo/auto", "steal", "prod", "${ref:hanzo/vault/root}")
+
+	rec := do(t, h, ident, OpSecretGet, getReq{Path: "hanzo/auto", Name: "dsn", Env: "prod"}, "g1", httpTestClock)
+	var out getResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if pt, _ := base64.StdEncoding.DecodeString(out.Value); rec.Code != http.StatusOK || string(pt) != "pg://db.internal" {
+		t.Fatalf("dsn code=%d value=%q body=%s", rec.Code, pt, rec.Body.String())
+	}
+
+	rec = do(t, h, ident, OpSecretGet, getReq{Path: "hanzo/auto", Name: "steal", Env: "prod"}, "g2", httpTestClock)
+	if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "do-not-leak") || !strings.Contains(rec.Body.String(), "hanzo/vault/root@prod") {
+		t.Fatalf("steal code=%d body=%s, want 403 naming the reference", rec.Code, rec.Body.String())
+	}
+
+	rec = do(t, h, ident, OpSecretGet, getReq{Path: "hanzo/auto", Name: "steal", Env: "prod", Raw: true}, "g3", httpTestClock)
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if pt, _ := base64.StdEncoding.DecodeString(out.Value); rec.Code != http.StatusOK || string(pt) != "${ref:hanzo/vault/root}" {
+		t.Fatalf("raw code=%d value=%q", rec.Code, pt)
+	}
+
+	rec = do(t, h, ident, OpSecretBatchGet, batchGetReq{Path: "hanzo/auto", Env: "prod"}, "b1", httpTestClock)
+	var batch batchGetResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &batch)
+	statuses := map[string]string{}
+	for _, it := range batch.Items {
+		statuses[it.Name] = it.Status
+	}
+	if rec.Code != http.StatusOK || statuses["dsn"] != batchOK || statuses["steal"] != batchForbidden {
+		t.Fatalf("batch code=%d statuses=%v body=%s", rec.Code, statuses, rec.Body.String())
+	}
+}
+
+// TestHTTP_PromoteIsAnOperatorWrite: a validator that may read cannot
+// promote; an operator can, and the destination env reads back.
+func TestHTTP_PromoteIsAnOperatorWrite(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/auto")
+	defer reader.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID, reader.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	seed(t, srv, "hanzo/svc", "TOKEN", "test", "tested")
+
+	req := promoteReq{Path: "hanzo/svc", From: "test", To: "main"}
+	if rec := do(t, h, reader, OpSecretPromote, req, "p1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator promote code=%d want 403", rec.Code)
+	}
+	rec := do(t, h, op, OpSecretPromote, req, "p2", httpTestClock)
+	var out promoteResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if rec.Code != http.StatusOK || len(out.Changes) != 1 || out.Changes[0].Action != store.PromoteCreate {
+		t.Fatalf("promote code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	rec = do(t, h, reader, OpSecretGet, getReq{Path: "hanzo/svc", Name: "TOKEN", Env: "main"}, "g1", httpTestClock)
+	var got getResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if pt, _ := base64.StdEncoding.DecodeString(got.Value); rec.Code != http.StatusOK || string(pt) != "tested" {
+		t.Fatalf("promoted get code=%d value=%q", rec.Code, pt)
+	}
+}
+
+// TestHTTP_DiffNeedsReadOnThePath: a diff is a read of the path; a caller
+// refused it gets nothing, not even names.
+func TestHTTP_DiffNeedsReadOnThePath(t *testing.T) {
+	ident := newIdentity(t, "hanzo/auto")
+	defer ident.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{ident.NodeID}, nil, nil)
+	seed(t, srv, "hanzo/svc", "TOKEN", "test", "a")
+	seed(t, srv, "hanzo/svc", "TOKEN", "main", "b")
+	seed(t, srv, "hanzo/svc", "NEW", "test", "c")
+
+	rec := do(t, h, ident, OpSecretDiff, diffReq{Path: "hanzo/svc", A: "test", B: "main"}, "d1", httpTestClock)
+	var d secret.EnvDiff
+	_ = json.Unmarshal(rec.Body.Bytes(), &d)
+	if rec.Code != http.StatusOK || len(d.OnlyInA) != 1 || d.OnlyInA[0].Name != "NEW" || len(d.Differ) != 1 || d.Differ[0].Name != "TOKEN" {
+		t.Fatalf("diff code=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	srv.authz = denyPathAuthorizer{inner: srv.authz, path: "hanzo/svc"}
+	if rec := do(t, h, ident, OpSecretDiff, diffReq{Path: "hanzo/svc", A: "test", B: "main"}, "d2", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("refused diff code=%d want 403 body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_ImportIsAnOperatorWrite: an import is refused to a validator, and
+// for an operator a conflicting name answers 409 with nothing written.
+func TestHTTP_ImportIsAnOperatorWrite(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/auto")
+	defer reader.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID, reader.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	seed(t, srv, "hanzo/svc", "EXISTING", "dev", "old")
+
+	req := importReq{Path: "hanzo/svc", Env: "dev", Format: "yaml", Document: "NEW: n\nEXISTING: e\n"}
+	if rec := do(t, h, reader, OpSecretImport, req, "i1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator import code=%d want 403", rec.Code)
+	}
+	if rec := do(t, h, op, OpSecretImport, req, "i2", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("conflicting import code=%d want 409 body=%s", rec.Code, rec.Body.String())
+	}
+	req.Conflict = store.ConflictSkip
+	rec := do(t, h, op, OpSecretImport, req, "i3", httpTestClock)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"skipped"`) {
+		t.Fatalf("skip import code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_WatchIsAReadOfThePath: a watch answers the changes since its
+// cursor as coordinates and versions, waits for one when there is none, and
+// is refused to an identity that may not read the path.
+func TestHTTP_WatchIsAReadOfThePath(t *testing.T) {
+	ident := newIdentity(t, "hanzo/auto")
+	defer ident.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{ident.NodeID}, nil, nil)
+	start := srv.store.Changes().Head()
+	seed(t, srv, "hanzo/svc", "TOKEN", "main", "watched-value")
+	seed(t, srv, "hanzo/other", "TOKEN", "main", "x")
+
+	rec := do(t, h, ident, OpSecretWatch, watchReq{Path: "hanzo/svc", Cursor: start}, "w1", httpTestClock)
+	var resp watchResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Changes) != 1 || resp.Changes[0].Name != "TOKEN" || resp.Changes[0].Op != store.ChangePut || resp.Cursor != srv.store.Changes().Head() {
+		t.Fatalf("watch code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "watched-value") || strings.Contains(rec.Body.String(), base64.StdEncoding.EncodeToString([]byte("watched-value"))) {
+		t.Fatalf("watch carries the value: %s", rec.Body.String())
+	}
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- do(t, h, ident, OpSecretWatch, watchReq{Path: "hanzo/svc", Cursor: resp.Cursor, WaitMS: 10000}, "w2", httpTestClock)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	seed(t, srv, "hanzo/svc", "NEXT", "main", "y")
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"NEXT"`) {
+			t.Fatalf("waiting watch code=%d body=%s", rec.Code, rec.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a waiting watch did not answer the write")
+	}
+
+	rec = do(t, h, ident, OpSecretWatch, watchReq{Path: "hanzo/svc", Cursor: "0000000000000000.3"}, "w3", httpTestClock)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"lost":true`) {
+		t.Fatalf("foreign cursor code=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	srv.authz = denyPathAuthorizer{inner: srv.authz, path: "hanzo/svc"}
+	if rec := do(t, h, ident, OpSecretWatch, watchReq{Path: "hanzo/svc"}, "w4", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("refused watch code=%d want 403 body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_PutRefusedBySchemaNamesTheRule: a value the path's schema refuses
+// is the caller's error (400), the answer names the rule, and nothing is
+// written.
+func TestHTTP_PutRefusedBySchemaNamesTheRule(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	sc, err := schema.Parse([]byte(`{"rules":[{"id":"rpc-endpoint","name":"*_URL","type":"url"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.store.SetSchema("hanzo", sc); err != nil {
+		t.Fatal(err)
+	}
+	put := putReq{Path: "hanzo/svc", Name: "RPC_URL", Env: "prod", Value: base64.StdEncoding.EncodeToString([]byte("localhost:9650"))}
+	rec := do(t, h, op, OpSecretPut, put, "s1", httpTestClock)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "rpc-endpoint") || strings.Contains(rec.Body.String(), "localhost:9650") {
+		t.Fatalf("refused put code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if _, err := srv.store.Get("hanzo/svc", "RPC_URL", "prod"); !errors.Is(err, store.ErrSecretNotFound) {
+		t.Fatalf("refused put was stored: %v", err)
+	}
+	put.Value = base64.StdEncoding.EncodeToString([]byte("http://localhost:9650/ext/bc/C/rpc"))
+	if rec := do(t, h, op, OpSecretPut, put, "s2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("valid put code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_LockedSecretRefusesOperatorWrites: a put carrying a lock creates
+// the secret write-once; from then on the operator's own puts and deletes
+// answer 409 — the store refuses them, not the transport.
+func TestHTTP_LockedSecretRefusesOperatorWrites(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	put := putReq{Path: "providers/hanzo", Name: "deploy-mnemonic", Env: "main", Value: base64.StdEncoding.EncodeToString([]byte("seed")),
+		Lock: &secret.Lock{Reason: "root deploy key", LockedBy: "forged"}}
+	if rec := do(t, h, op, OpSecretPut, put, "l1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("locked create code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if l, err := srv.store.Locked("providers/hanzo", "deploy-mnemonic", "main"); err != nil || l == nil || l.LockedBy == "forged" || !strings.HasPrefix(l.LockedBy, "zap:") {
+		t.Fatalf("lock = %+v, %v", l, err)
+	}
+	put.Lock = nil
+	if rec := do(t, h, op, OpSecretPut, put, "l2", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("overwrite code=%d, want 409", rec.Code)
+	}
+	del := delReq{Path: "providers/hanzo", Name: "deploy-mnemonic", Env: "main"}
+	if rec := do(t, h, op, OpSecretDelete, del, "l3", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("delete code=%d, want 409", rec.Code)
+	}
+}
+
+func TestHTTP_PutGeneratesTheValue(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	_, h := newHTTPServer(t, []ids.NodeID{op.NodeID}, []ids.NodeID{op.NodeID}, nil)
+	put := putReq{Path: "providers/hanzo", Name: "signer", Env: "main", Generate: &generate.Policy{Type: generate.TypeEd25519}, Reveal: true}
+	rec := do(t, h, op, OpSecretPut, put, "g1", httpTestClock)
+	var out struct {
+		Version   int    `json:"version"`
+		PublicKey string `json:"public_key"`
+		Value     string `json:"value"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); rec.Code != http.StatusOK || err != nil || out.Version != 1 || len(out.PublicKey) != 64 {
+		t.Fatalf("generate code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	rec = do(t, h, op, OpSecretGet, getReq{Path: "providers/hanzo", Name: "signer", Env: "main"}, "g2", httpTestClock)
+	var got getResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Value != out.Value {
+		t.Fatalf("stored value differs from the revealed one: %v", err)
+	}
+
+	put = putReq{Path: "providers/hanzo", Name: "token", Env: "main", Generate: &generate.Policy{Type: generate.TypeHex}}
+	rec = do(t, h, op, OpSecretPut, put, "g3", httpTestClock)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"value"`) {
+		t.Fatalf("unrevealed generate code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	put.Value = base64.StdEncoding.EncodeToString([]byte("v"))
+	if rec := do(t, h, op, OpSecretPut, put, "g4", httpTestClock); rec.Code != http.StatusBadRequest {
+		t.Fatalf("value with generate code=%d, want 400", rec.Code)
+	}
+}
+
+func TestHTTP_KeyringServesEveryEpochItHolds(t *testing.T) {
+	ident := newIdentity(t, "hanzo/auto")
+	defer ident.Wipe()
+	srv, _ := newHTTPServer(t, []ids.NodeID{ident.NodeID}, nil, nil)
+	seedHTTP(t, srv, "hanzo/auto", "api-key", "prod", "epoch 1 value")
+
+	rek2 := make([]byte, 32)
+	rek2[0] = 2
+	k, err := store.NewKeyring(2, map[uint32][]byte{1: srv.masterKey, 2: rek2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := New(Config{Store: srv.store, Keyring: k, Authorizer: srv.authz, Logger: log.NewNoOpLogger(), Now: func() time.Time { return httpTestClock }})
+	rec := do(t, rotated.HTTPHandler(), ident, OpSecretGet, getReq{Path: "hanzo/auto", Name: "api-key", Env: "prod"}, "k1", httpTestClock)
+	var out getResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); rec.Code != http.StatusOK || err != nil || out.Value != base64.StdEncoding.EncodeToString([]byte("epoch 1 value")) {
+		t.Fatalf("epoch 1 record on a rotated server: code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_TransitKeysAreOperatorWritesAndValidatorReads: a validator can use
+// a transit key and never create or rotate one, and each op is authorized on
+// transit/<key> so a grant that leaves the key out refuses it.
+func TestHTTP_TransitKeysAreOperatorWritesAndValidatorReads(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/auto")
+	defer reader.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID, reader.NodeID}, []ids.NodeID{op.NodeID}, nil)
+
+	if rec := do(t, h, reader, OpTransitCreate, transitReq{Key: "orders"}, "c1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator create code=%d want 403", rec.Code)
+	}
+	if rec := do(t, h, op, OpTransitCreate, transitReq{Key: "orders"}, "c2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("operator create code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, op, OpTransitCreate, transitReq{Key: "orders"}, "c3", httpTestClock); rec.Code != http.StatusConflict {
+		t.Fatalf("second create code=%d want 409", rec.Code)
+	}
+
+	aad := base64.StdEncoding.EncodeToString([]byte("row-7"))
+	enc := transitReq{Key: "orders", Plaintext: base64.StdEncoding.EncodeToString([]byte("pan")), AssociatedData: aad}
+	rec := do(t, h, reader, OpTransitEncrypt, enc, "e1", httpTestClock)
+	var ct transitResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &ct)
+	if rec.Code != http.StatusOK || ct.KeyVersion != 1 || !strings.HasPrefix(ct.Ciphertext, "kms:v1:") {
+		t.Fatalf("encrypt code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, reader, OpTransitRotate, transitReq{Key: "orders"}, "r1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator rotate code=%d want 403", rec.Code)
+	}
+	if rec := do(t, h, op, OpTransitRotate, transitReq{Key: "orders"}, "r2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("operator rotate code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	rec = do(t, h, reader, OpTransitRewrap, transitReq{Key: "orders", Ciphertext: ct.Ciphertext, AssociatedData: aad}, "w1", httpTestClock)
+	var moved transitResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &moved)
+	if rec.Code != http.StatusOK || moved.KeyVersion != 2 || !strings.HasPrefix(moved.Ciphertext, "kms:v2:") {
+		t.Fatalf("rewrap code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	for i, c := range []string{ct.Ciphertext, moved.Ciphertext} {
+		rec = do(t, h, reader, OpTransitDecrypt, transitReq{Key: "orders", Ciphertext: c, AssociatedData: aad}, fmt.Sprintf("d%d", i), httpTestClock)
+		var pt transitResp
+		_ = json.Unmarshal(rec.Body.Bytes(), &pt)
+		if got, _ := base64.StdEncoding.DecodeString(pt.Plaintext); rec.Code != http.StatusOK || string(got) != "pan" {
+			t.Fatalf("decrypt %d code=%d body=%s", i, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(t, h, reader, OpTransitDecrypt, transitReq{Key: "orders", Ciphertext: ct.Ciphertext}, "d9", httpTestClock); rec.Code != http.StatusBadRequest {
+		t.Fatalf("decrypt without associated data code=%d want 400", rec.Code)
+	}
+
+	rec = do(t, h, reader, OpTransitDataKey, transitReq{Key: "orders", Wrapped: true}, "k1", httpTestClock)
+	var dk transitResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &dk)
+	if rec.Code != http.StatusOK || dk.Plaintext != "" || dk.Ciphertext == "" {
+		t.Fatalf("wrapped datakey code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, reader, OpTransitEncrypt, transitReq{Key: "missing"}, "m1", httpTestClock); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown key code=%d want 404", rec.Code)
+	}
+
+	scoped := New(Config{Store: srv.store, MasterKey: srv.masterKey, Authorizer: denyPathAuthorizer{inner: srv.authz, path: "transit/orders"},
+		Logger: log.NewNoOpLogger(), Now: func() time.Time { return httpTestClock }})
+	if rec := do(t, scoped.HTTPHandler(), reader, OpTransitEncrypt, enc, "s1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("ungranted key code=%d want 403", rec.Code)
+	}
+}
+
+// TestHTTP_TransitHMACAndDerive: a validator MACs and verifies under an
+// HMAC key; a derived key is refused on this session-less transport and
+// answered only when the response is sealed to the caller's session.
+func TestHTTP_TransitHMACAndDerive(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/webhooks")
+	defer reader.Wipe()
+	srv, h := newHTTPServer(t, []ids.NodeID{op.NodeID, reader.NodeID}, []ids.NodeID{op.NodeID}, nil)
+
+	if rec := do(t, h, op, OpTransitCreate, transitReq{Key: "hooks", Type: "hmac-sha256"}, "c1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("operator create code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	input := base64.StdEncoding.EncodeToString([]byte("POST /v1/orders"))
+	rec := do(t, h, reader, OpTransitHMAC, transitReq{Key: "hooks", Input: input}, "h1", httpTestClock)
+	var mac struct {
+		MAC        string `json:"mac"`
+		KeyVersion int    `json:"key_version"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &mac)
+	if rec.Code != http.StatusOK || mac.KeyVersion != 1 || !strings.HasPrefix(mac.MAC, "kms:v1:") {
+		t.Fatalf("hmac code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	for i, c := range []struct {
+		input string
+		valid bool
+	}{{input, true}, {base64.StdEncoding.EncodeToString([]byte("POST /v1/refunds")), false}} {
+		rec = do(t, h, reader, OpTransitVerify, transitReq{Key: "hooks", Input: c.input, MAC: mac.MAC}, fmt.Sprintf("v%d", i), httpTestClock)
+		var got struct{ Valid bool }
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		if rec.Code != http.StatusOK || got.Valid != c.valid {
+			t.Fatalf("verify %d code=%d body=%s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	derive := transitReq{Key: "hooks", Context: base64.StdEncoding.EncodeToString([]byte("tenant-1"))}
+	if rec := do(t, h, reader, OpTransitDerive, derive, "d1", httpTestClock); rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), `"key":`) {
+		t.Fatalf("derive without a session code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	inner, _ := json.Marshal(derive)
+	status, body, err := srv.dispatch(withSealedSession(context.Background()), Identity{ServicePath: "hanzo/webhooks"}, OpTransitDerive, inner)
+	var sub struct {
+		Key        string `json:"key"`
+		KeyVersion int    `json:"key_version"`
+	}
+	_ = json.Unmarshal(body, &sub)
+	if raw, _ := base64.StdEncoding.DecodeString(sub.Key); err != nil || status != statusOK || sub.KeyVersion != 1 || len(raw) != 32 {
+		t.Fatalf("sealed derive status=%d body=%s err=%v", status, body, err)
+	}
+
+	// An encryption key neither MACs nor derives.
+	do(t, h, op, OpTransitCreate, transitReq{Key: "orders"}, "c2", httpTestClock)
+	if rec := do(t, h, reader, OpTransitHMAC, transitReq{Key: "orders", Input: input}, "h2", httpTestClock); rec.Code != http.StatusBadRequest {
+		t.Fatalf("hmac under an aes key code=%d want 400", rec.Code)
+	}
+}
+
+// TestHTTP_TransitImportIsAnOperatorWrite: only an operator makes an import
+// token or spends one; the imported key then serves validators like any.
+func TestHTTP_TransitImportIsAnOperatorWrite(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/settlement")
+	defer reader.Wipe()
+	_, h := newHTTPServer(t, []ids.NodeID{op.NodeID, reader.NodeID}, []ids.NodeID{op.NodeID}, nil)
+
+	if rec := do(t, h, reader, OpTransitImportToken, transitReq{Key: "partner"}, "t1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator import-token code=%d want 403", rec.Code)
+	}
+	rec := do(t, h, op, OpTransitImportToken, transitReq{Key: "partner", TTLSeconds: 600}, "t2", httpTestClock)
+	var pub byok.PublicKeys
+	if err := json.Unmarshal(rec.Body.Bytes(), &pub); err != nil || rec.Code != http.StatusOK || pub.Name != "partner" {
+		t.Fatalf("operator import-token code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	kemPub, _ := base64.StdEncoding.DecodeString(pub.MLKEM768)
+	wrapped, err := byok.WrapMLKEM(kemPub, pub.Token, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := transitReq{Key: "partner", Token: pub.Token, WrappedKey: base64.StdEncoding.EncodeToString(wrapped)}
+	if rec := do(t, h, reader, OpTransitImport, imp, "i1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator import code=%d want 403", rec.Code)
+	}
+	if rec := do(t, h, op, OpTransitImport, imp, "i2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("operator import code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	enc := transitReq{Key: "partner", Plaintext: base64.StdEncoding.EncodeToString([]byte("x"))}
+	if rec := do(t, h, reader, OpTransitEncrypt, enc, "e1", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("encrypt under the imported key code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTP_DetokenizeNeedsItsOwnAuthority: a validator tokenizes, but only a
+// member of the detokenizer authority detokenizes — an operator does not,
+// and with no detokenizer authority configured nobody does.
+func TestHTTP_DetokenizeNeedsItsOwnAuthority(t *testing.T) {
+	op := newIdentity(t, "hanzo/kms-operator")
+	defer op.Wipe()
+	reader := newIdentity(t, "hanzo/checkout")
+	defer reader.Wipe()
+	detok := newIdentity(t, "hanzo/payouts")
+	defer detok.Wipe()
+	validators := []ids.NodeID{op.NodeID, reader.NodeID, detok.NodeID}
+	srv, h := newHTTPServer(t, validators, []ids.NodeID{op.NodeID}, nil)
+
+	if rec := do(t, h, reader, OpTokenizeCreate, tokenizeReq{Key: "pan"}, "c1", httpTestClock); rec.Code != http.StatusForbidden {
+		t.Fatalf("validator create code=%d want 403", rec.Code)
+	}
+	if rec := do(t, h, op, OpTokenizeCreate, tokenizeReq{Key: "pan", Alphabet: "numeric"}, "c2", httpTestClock); rec.Code != http.StatusOK {
+		t.Fatalf("operator create code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	const card = "4111-1111-1111-1111"
+	rec := do(t, h, reader, OpTokenize, tokenizeReq{Key: "pan", Value: card}, "t1", httpTestClock)
+	var tok tokenizeResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &tok)
+	if rec.Code != http.StatusOK || len(tok.Token) != len(card) || tok.Token == card {
+		t.Fatalf("tokenize code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	for i, id := range []*keys.ServiceIdentity{reader, op, detok} {
+		if rec := do(t, h, id, OpDetokenize, tokenizeReq{Key: "pan", Token: tok.Token}, fmt.Sprintf("n%d", i), httpTestClock); rec.Code != http.StatusForbidden {
+			t.Fatalf("identity %d detokenized with no detokenizer authority: code=%d", i, rec.Code)
+		}
+	}
+
+	authz, err := NewInProcessAuthorizer(InProcessAuthorizerConfig{
+		Validators:   NewStaticAuthorityProvider(validators),
+		Operator:     NewStaticAuthorityProvider([]ids.NodeID{op.NodeID}),
+		Detokenizers: NewStaticAuthorityProvider([]ids.NodeID{detok.NodeID}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = New(Config{Store: srv.store, MasterKey: srv.masterKey, Authorizer: authz,
+		Logger: log.NewNoOpLogger(), Now: func() time.Time { return httpTestClock }}).HTTPHandler()
+	for i, id := range []*keys.ServiceIdentity{reader, op} {
+		if rec := do(t, h, id, OpDetokenize, tokenizeReq{Key: "pan", Token: tok.Token}, fmt.Sprintf("x%d", i), httpTestClock); rec.Code != http.StatusForbidden {
+			t.Fatalf("identity %d detokenize code=%d want 403", i, rec.Code)
+		}
+	}
+	rec = do(t, h, detok, OpDetokenize, tokenizeReq{Key: "pan", Token: tok.Token}, "d1", httpTestClock)
+	var val tokenizeResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &val)
+	if rec.Code != http.StatusOK || val.Value != card {
+		t.Fatalf("detokenize code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, reader, OpTokenize, tokenizeReq{Key: "pan", Value: "1234"}, "t2", httpTestClock); rec.Code != http.StatusBadRequest {
+		t.Fatalf("four-digit value code=%d want 400", rec.Code)
+	}
+}
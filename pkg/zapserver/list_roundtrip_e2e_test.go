@@ -15,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/luxfi/kms/pkg/secret"
 	"github.com/luxfi/kms/pkg/store"
 	"github.com/luxfi/kms/pkg/zapclient"
 	"github.com/luxfi/log"
@@ -138,3 +139,144 @@ func TestListE2E_EveryListedCoordinateIsFetchable(t *testing.T) {
 		t.Fatal("deploy/RUNNER_TOKEN@prod resolved; the sub-path record must not be addressable from the root")
 	}
 }
+
+// TestBatchGetE2E: one OpSecretBatchGet answers what a list plus a get per
+// secret used to — by query and by refs — with a per-item status for a ref
+// that is not there, and refuses a ref outside the path it is authorized for.
+func TestBatchGetE2E(t *testing.T) {
+	addr := bootListServer(t, [][4]string{
+		{"deploy", "prod", "PIN_TOKEN", "v-pin"},
+		{"deploy/ci", "prod", "RUNNER_TOKEN", "v-runner"},
+		{"deploy", "staging", "PIN_TOKEN", "v-pin-staging"},
+		{"other", "prod", "ELSEWHERE", "v-else"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	ident, hdr := newE2EIdentity(t, "ats/batch-service")
+	defer ident.Wipe()
+	c, err := zapclient.DialWithConfig(ctx, zapclient.Config{
+		NodeID:         "batch-client",
+		PeerAddr:       addr,
+		DefaultPath:    "deploy",
+		IdentityHeader: hdr,
+		Signer:         ident,
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	items, truncated, err := c.GetMatching(ctx, secret.Query{Path: "deploy", Env: "prod"})
+	if err != nil || truncated || len(items) != 2 {
+		t.Fatalf("GetMatching = %+v truncated=%v, %v; want 2 items", items, truncated, err)
+	}
+	if items[0].Name != "PIN_TOKEN" || items[0].Value != "v-pin" || items[1].Value != "v-runner" || !items[1].Found() {
+		t.Fatalf("GetMatching items = %+v", items)
+	}
+
+	items, err = c.GetManyAt(ctx, "deploy", []secret.Ref{
+		{Path: "deploy", Env: "staging", Name: "PIN_TOKEN"},
+		{Path: "deploy", Env: "prod", Name: "MISSING"},
+	})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("GetManyAt = %+v, %v", items, err)
+	}
+	if items[0].Value != "v-pin-staging" || items[1].Status != "not_found" {
+		t.Fatalf("GetManyAt items = %+v, want staging value then not_found", items)
+	}
+
+	if _, err := c.GetManyAt(ctx, "deploy", []secret.Ref{{Path: "other", Env: "prod", Name: "ELSEWHERE"}}); err == nil {
+		t.Fatal("a ref outside the request path was answered")
+	}
+}
+
+// TestListE2E_FindAllFollowsCursor: the client iterator walks a listing one
+// small page at a time and yields every coordinate exactly once, in order.
+func TestListE2E_FindAllFollowsCursor(t *testing.T) {
+	var seed [][4]string
+	for i := 0; i < 7; i++ {
+		seed = append(seed, [4]string{"deploy", "prod", "K" + strconv.Itoa(i), "v"})
+	}
+	addr := bootListServer(t, seed)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	ident, hdr := newE2EIdentity(t, "ats/page-service")
+	defer ident.Wipe()
+	c, err := zapclient.DialWithConfig(ctx, zapclient.Config{
+		NodeID:         "page-client",
+		PeerAddr:       addr,
+		DefaultPath:    "deploy",
+		IdentityHeader: hdr,
+		Signer:         ident,
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	first, next, err := c.FindPageAt(ctx, secret.Query{Path: "deploy", Limit: 3})
+	if err != nil || len(first) != 3 || next == "" {
+		t.Fatalf("first page = %d refs next=%q, %v; want 3 and a cursor", len(first), next, err)
+	}
+	var names []string
+	for ref, err := range c.FindAll(ctx, secret.Query{Path: "deploy", Limit: 3}) {
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		names = append(names, ref.Name)
+	}
+	if len(names) != 7 || names[0] != "K0" || names[6] != "K6" {
+		t.Fatalf("FindAll = %v, want K0..K6", names)
+	}
+}
+
+// TestWatchE2E_ClientSeesAPutFromAnotherClient: a watcher on its own
+// connection is told about a rotation another client writes — coordinate and
+// version, then reads the value itself.
+func TestWatchE2E_ClientSeesAPutFromAnotherClient(t *testing.T) {
+	addr := bootListServer(t, [][4]string{{"deploy", "prod", "API_KEY", "v1"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	dial := func(nodeID, name string) *zapclient.Client {
+		ident, hdr := newE2EIdentity(t, name)
+		t.Cleanup(ident.Wipe)
+		c, err := zapclient.DialWithConfig(ctx, zapclient.Config{
+			NodeID: nodeID, PeerAddr: addr, DefaultPath: "deploy", IdentityHeader: hdr, Signer: ident,
+		})
+		if err != nil {
+			t.Fatalf("Dial %s: %v", nodeID, err)
+		}
+		t.Cleanup(c.Close)
+		return c
+	}
+	watcher := dial("watch-client", "ats/watch-service")
+	writer := dial("rotate-client", "ats/rotator")
+
+	changes, head, err := watcher.WatchAt(ctx, secret.Query{Path: "deploy"}, 0)
+	if err != nil || len(changes) != 0 || head == "" {
+		t.Fatalf("WatchAt now = %+v %q, %v", changes, head, err)
+	}
+	got := make(chan secret.Change, 1)
+	go func() {
+		for ch, err := range watcher.Watch(ctx, secret.Query{Path: "deploy", Env: "prod", Cursor: head}) {
+			if err == nil {
+				got <- ch
+			}
+			return
+		}
+	}()
+	if err := writer.PutAt(ctx, "deploy", "API_KEY", "prod", "v2"); err != nil {
+		t.Fatalf("PutAt: %v", err)
+	}
+	select {
+	case ch := <-got:
+		if ch.Name != "API_KEY" || ch.Op != "put" || ch.Version != 2 {
+			t.Fatalf("change = %+v", ch)
+		}
+		if v, err := watcher.GetAt(ctx, ch.Path, ch.Name, ch.Env); err != nil || v != "v2" {
+			t.Fatalf("re-read = %q, %v", v, err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the watcher never saw the put")
+	}
+}
@@ -2,14 +2,97 @@
 //
 // Wire format per request: opcode(2 LE) || envelope JSON.
 // Response: 1-byte status (0x00 ok, 0x01 not found, 0x02 error,
-// 0x03 forbid) || payload.
+// 0x03 forbid, 0x04 conflict) || payload.
 //
 // Opcodes:
 //
-//	0x0040  OpSecretGet   { path, name, env }          → { value: base64 } or not-found
-//	0x0041  OpSecretPut   { path, name, env, value }   → { ok: true }           (admin only)
-//	0x0042  OpSecretList  { path, env }                → { secrets: [{path,env,name}] }
-//	0x0043  OpSecretDelete{ path, name, env }          → { ok: true }           (admin only)
+//	0x0040  OpSecretGet      { path, name, env, version?, raw? } → { value: base64, version } or not-found
+//	0x0041  OpSecretPut      { path, name, env, value, expect_version?, expect_absent?, meta?, lock?, generate?, reveal?, mode? }
+//	                                                       → { ok: true, version, public_key?, value? }   (admin only)
+//	0x0042  OpSecretList     { path, env, labels?, cursor?, limit? }
+//	                                                       → { secrets: [{path,env,name,meta?}], next_cursor? }
+//	0x0043  OpSecretDelete   { path, name, env, expect_version? }
+//	                                                       → { ok: true }            (admin only; recoverable)
+//	0x0044  OpSecretVersions { path, name, env }           → { versions: [{version,created_at,created_by}] }
+//	0x0045  OpSecretRollback { path, name, env, version, expect_version? }
+//	                                                       → { ok: true, version }   (admin only)
+//	0x0046  OpSecretUndelete { path, name, env }           → { ok: true, version }   (admin only)
+//	0x0047  OpSecretPurge    { path, name, env }           → { ok: true }            (admin only)
+//	0x0048  OpSecretDeleted  { path, env }                 → { deleted: [{path,env,name,version,deleted_at,purge_at}] }
+//	0x0049  OpSecretSetMeta  { path, name, env, meta, expect_version? }
+//	                                                       → { ok: true }            (admin only)
+//	0x004A  OpSecretBatchGet { path, refs? | env?, labels? } → { items: [{path,env,name,status,value?,version?}], truncated }
+//	0x004B  OpSecretPromote  { path, from, to, dry_run? }  → { changes: [{path,name,action,…}], dry_run }
+//	                                                       (admin only)
+//	0x004C  OpSecretDiff     { path, a, b }                → { path, a, b, only_in_a, only_in_b, differ, same }
+//	0x004D  OpSecretImport   { path, env, format, document, conflict? }
+//	                                                       → { imported: [{name,action,…}] } (admin only)
+//	0x004E  OpSecretWatch    { path, env?, labels?, cursor?, limit?, wait_ms? }
+//	                                                       → { changes: [{path,env,name,op,version,at,cursor}], cursor, lost? }
+//	0x0060  OpTransitEncrypt { key, plaintext, associated_data?, context? }  → { ciphertext, key_version }
+//	0x0061  OpTransitDecrypt { key, ciphertext, associated_data?, context? } → { plaintext }
+//	0x0062  OpTransitRewrap  { key, ciphertext, associated_data?, context? } → { ciphertext, key_version }
+//	0x0063  OpTransitDataKey { key, bits?, wrapped? }      → { ciphertext, key_version, plaintext? }
+//	0x0064  OpTransitCreate  { key, type?, deterministic? } → { name, type, deterministic?, latest_version, versions }  (admin only)
+//	0x0065  OpTransitRotate  { key }                       → { name, type, latest_version, versions }  (admin only)
+//	0x0066  OpTransitImportToken { key, ttl_seconds? }     → { token, name, expires_at, mlkem768_public_key, rsa_oaep_3072_public_key }  (admin only)
+//	0x0067  OpTransitImport  { key, token, algorithm?, wrapped_key, type?, deterministic? }
+//	                                                       → { name, type, latest_version, versions }  (admin only)
+//
+// A transit ciphertext is kms:v<N>:..., naming the key version that made
+// it; plaintext, associated_data and context are base64. A deterministic key
+// encrypts equal plaintexts equal under one context, which every call on it
+// must name; a randomized key takes none. Transit ops are authorized
+// on the path "transit/<key>".
+//
+// Import brings in a key made outside the KMS (BYOK, pkg/byok): an import
+// token is a one-time ML-KEM-768 and RSA-3072 keypair for one key name,
+// expiring after ttl_seconds (default an hour); the partner wraps its
+// material to one of them (algorithm mlkem768 or rsa-oaep-3072) and the
+// import unwraps it in the server. A token is spent by its first import,
+// whether the wrap opens or not.
+//
+//	0x0068  OpTokenize       { key, value, tweak? }        → { token }
+//	0x0069  OpDetokenize     { key, token, tweak? }        → { value }  (detokenizer authority)
+//	0x006A  OpTokenizeCreate { key, mode?, alphabet? }     → { name, mode, alphabet }  (admin only)
+//
+// A token keeps the value's length and every character outside the key's
+// alphabet; tweak is base64. Tokenization ops are authorized on the path
+// "tokenize/<key>"; a detokenize needs the detokenizer authority, which
+// neither the validator nor the operator authority implies.
+//
+//	0x0070  OpTransitHMAC    { key, input }                → { mac, key_version }
+//	0x0071  OpTransitVerify  { key, input, mac }           → { valid }
+//	0x0072  OpTransitDerive  { key, context, version?, bits? } → { key, key_version }  (sealed session only)
+//
+// HMAC, verify and derive take an hmac-sha256 or hmac-sha3-256 key; input
+// and context are base64, a mac is kms:v<N>:.... A derived key is answered
+// only inside a hybrid session (OpClientHello), so it travels sealed to the
+// caller; on a transport without one derive fails.
+//
+// A put with mode "tfhe" stores the value under the T-Chain threshold key
+// (Config.ThresholdReveal): every later read of it is a t-of-n decrypt,
+// audited with the shares used. A put without mode keeps the secret's mode.
+//
+// Writes take optimistic-concurrency preconditions (expect_version,
+// expect_absent), checked in the write's own transaction; a failed one
+// answers 0x04 conflict and writes nothing.
+//
+// meta is {labels, description, owner, expires_at}. A secret past its
+// expires_at answers not-found with the error "…: expired at <time>".
+//
+// Watch is a long poll on the change feed (store.ChangeLog): it answers the
+// changes after cursor that the query selects — coordinates and versions,
+// never values — holding the request up to wait_ms (at most maxWatchWait)
+// until there is one. A ZAP connection serves one request at a time, so a
+// watcher holds its connection while it waits and should have one of its
+// own. lost means changes were missed: re-read, then watch on from cursor.
+//
+// Get and batch-get expand ${ref:path/name@env} references in a value (see
+// store.SealedStore.Expand); raw on a get skips it. Each reference is
+// authorized as a get of its own path by the caller, so a refused one
+// answers 0x03 forbid (a batch item "forbidden"); a cycle, a missing target
+// or too deep a chain is 0x02 error.
 //
 // Auth: every secret-opcode payload is wrapped in a signed Envelope
 // (see auth.go). The envelope carries the caller's mnemonic-derived
@@ -37,7 +120,10 @@ import (
 	"time"
 
 	"github.com/luxfi/keys"
+	"github.com/luxfi/kms/pkg/bundle"
 	"github.com/luxfi/kms/pkg/envelope"
+	"github.com/luxfi/kms/pkg/generate"
+	"github.com/luxfi/kms/pkg/schema"
 	"github.com/luxfi/kms/pkg/secret"
 	"github.com/luxfi/kms/pkg/store"
 	kmszap "github.com/luxfi/kms/pkg/zap"
@@ -51,11 +137,71 @@ const (
 	OpSecretList   uint16 = 0x0042
 	OpSecretDelete uint16 = 0x0043
 
+	// Version history. Every put is a new version; versions lists them
+	// and rollback re-writes an old one as the latest.
+	OpSecretVersions uint16 = 0x0044
+	OpSecretRollback uint16 = 0x0045
+
+	// Soft delete. OpSecretDelete tombstones; a tombstone can be undeleted
+	// until the retention window closes, purged early, or listed.
+	OpSecretUndelete uint16 = 0x0046
+	OpSecretPurge    uint16 = 0x0047
+	OpSecretDeleted  uint16 = 0x0048
+
+	// Metadata. A put may carry meta too; this op changes it without
+	// writing a new version.
+	OpSecretSetMeta uint16 = 0x0049
+
+	// Batch read: every value a service boots with in one signed request
+	// and one response, instead of a list plus one get per secret.
+	OpSecretBatchGet uint16 = 0x004A
+
+	// Promote: copy an env's subtree to another env in one transaction,
+	// or report what that would do.
+	OpSecretPromote uint16 = 0x004B
+
+	// Diff: which secrets under a path exist in only one of two envs, and
+	// which differ in value. Names only; values are compared server-side.
+	OpSecretDiff uint16 = 0x004C
+
+	// Import: a dotenv, JSON or YAML bundle written to one path and env
+	// in one transaction.
+	OpSecretImport uint16 = 0x004D
+
+	// Watch: the changes written under a path since a cursor, as
+	// coordinates and versions, waiting for one if there are none yet.
+	OpSecretWatch uint16 = 0x004E
+
 	// Threshold key ops. Dispatched to the SignBackend (luxfi/mpc
 	// t-of-n cluster). Exposed on the HTTP /v1/sdk surface; the KMS
 	// process never holds full key material.
 	OpSign   uint16 = 0x0050
 	OpVerify uint16 = 0x0051
+
+	// Transit engine (pkg/transit): encryption under named, versioned
+	// keys that never leave the KMS. Using a key is a read; creating or
+	// rotating one is a write. See transit.go.
+	OpTransitEncrypt uint16 = 0x0060
+	OpTransitDecrypt uint16 = 0x0061
+	OpTransitRewrap  uint16 = 0x0062
+	OpTransitDataKey uint16 = 0x0063
+	OpTransitCreate  uint16 = 0x0064
+	OpTransitRotate  uint16 = 0x0065
+	// BYOK: an import token, then the import that spends it; both writes.
+	OpTransitImportToken uint16 = 0x0066
+	OpTransitImport      uint16 = 0x0067
+	// MAC and key derivation under a transit HMAC key; all reads. Derive
+	// answers only a caller with a sealed session.
+	OpTransitHMAC   uint16 = 0x0070
+	OpTransitVerify uint16 = 0x0071
+	OpTransitDerive uint16 = 0x0072
+
+	// Tokenization (pkg/tokenize): format-preserving tokens under named
+	// keys. Tokenizing is a read; detokenizing needs the detokenizer
+	// authority as well; creating a key is a write. See tokenize.go.
+	OpTokenize       uint16 = 0x0068
+	OpDetokenize     uint16 = 0x0069
+	OpTokenizeCreate uint16 = 0x006A
 )
 
 // status byte values in the response.
@@ -64,6 +210,9 @@ const (
 	statusNotFound byte = 0x01
 	statusError    byte = 0x02
 	statusForbid   byte = 0x03
+	// statusConflict: a write's expect_version / expect_absent precondition
+	// did not hold. Nothing was written; re-read and retry.
+	statusConflict byte = 0x04
 )
 
 // Server wires a SecretStore onto a ZAP Node. It does not own the node's
@@ -71,16 +220,20 @@ const (
 type Server struct {
 	store     *store.SecretStore
 	masterKey []byte
-	authz     ConsensusAuthorizer
-	verifier  *envelope.VerifierWithLedger
+	// sealed is the one value path shared with the HTTP secret surface:
+	// every get/put seals and opens through it, so a record written on
+	// either transport reads back on the other.
+	sealed   *store.SealedStore
+	authz    ConsensusAuthorizer
+	verifier *envelope.VerifierWithLedger
 	// signer is the optional threshold-signing backend for OpSign /
 	// OpVerify. nil ⇒ the sign/verify ops return a clear "signing not
 	// configured" (mirrors the fail-open MPC posture of the key
 	// routes). The KMS never holds full key material — the backend
 	// delegates to the luxfi/mpc t-of-n cluster.
-	signer    SignBackend
-	log       log.Logger
-	now       func() time.Time
+	signer SignBackend
+	log    log.Logger
+	now    func() time.Time
 
 	// Per-peer hybrid handshake sessions. Keyed by ZAP NodeID. A peer
 	// with no entry has not run the application-layer hybrid handshake
@@ -98,6 +251,11 @@ type Server struct {
 type Config struct {
 	Store     *store.SecretStore
 	MasterKey []byte
+	// Keyring, when set, is the REK keyring the server seals under, shared
+	// with the HTTP surface, and MasterKey is not needed: new writes seal
+	// under its current epoch and records under any epoch it holds read
+	// back. nil ⇒ MasterKey alone, as store.LegacyEpoch.
+	Keyring *store.Keyring
 	// Authorizer is the consensus-native authorization predicate. The
 	// kmsd asks this every request: "is the verified envelope identity
 	// authorized for op on path?". Required; nil refuses to boot.
@@ -109,6 +267,10 @@ type Config struct {
 	// Pass an explicit NonceLedger to share state across replicas (e.g.
 	// a disk-backed impl for HA kmsd) or to tune TTL / GC cadence.
 	NonceLedger NonceLedger
+	// ThresholdReveal, when set, lets puts with mode "tfhe" store a value
+	// under the T-Chain threshold key, and opens such records by a t-of-n
+	// decrypt. nil refuses them. See store.ThresholdReveal.
+	ThresholdReveal *store.ThresholdReveal
 	// Signer is the optional threshold-signing backend for the OpSign /
 	// OpVerify ops on the /v1/sdk surface. nil ⇒ sign/verify return
 	// statusError("signing not configured"). Never holds full key
@@ -123,11 +285,11 @@ type Config struct {
 }
 
 // New returns a Server ready to attach to a ZAP node via Register.
-// Panics if masterKey is not 32 bytes (caller must unseal first) or if
-// the authorizer is nil (the server is fail-closed by construction —
-// there is no open mode).
+// Panics if neither a keyring nor a 32-byte masterKey is given (caller
+// must unseal first) or if the authorizer is nil (the server is
+// fail-closed by construction — there is no open mode).
 func New(cfg Config) *Server {
-	if len(cfg.MasterKey) != 32 {
+	if cfg.Keyring == nil && len(cfg.MasterKey) != 32 {
 		panic("zapserver: master key must be 32 bytes")
 	}
 	if cfg.Authorizer == nil {
@@ -156,9 +318,20 @@ func New(cfg Config) *Server {
 		// file, not a user-config issue.
 		panic("zapserver: verifier-with-ledger construction failed: " + err.Error())
 	}
+	var sealed *store.SealedStore
+	if cfg.Keyring != nil {
+		sealed, err = store.NewSealedStoreWithKeyring(cfg.Store, cfg.Keyring)
+	} else {
+		sealed, err = store.NewSealedStore(cfg.Store, cfg.MasterKey)
+	}
+	if err != nil {
+		panic("zapserver: " + err.Error())
+	}
+	sealed.SetThresholdReveal(cfg.ThresholdReveal)
 	s := &Server{
 		store:     cfg.Store,
 		masterKey: cfg.MasterKey,
+		sealed:    sealed,
 		authz:     cfg.Authorizer,
 		verifier:  verifier,
 		signer:    cfg.Signer,
@@ -186,6 +359,31 @@ func (s *Server) Register(n *zap.Node) {
 	n.Handle(OpSecretPut, s.wrap(OpSecretPut, s.handlePut))
 	n.Handle(OpSecretList, s.wrap(OpSecretList, s.handleList))
 	n.Handle(OpSecretDelete, s.wrap(OpSecretDelete, s.handleDelete))
+	n.Handle(OpSecretVersions, s.wrap(OpSecretVersions, s.handleVersions))
+	n.Handle(OpSecretRollback, s.wrap(OpSecretRollback, s.handleRollback))
+	n.Handle(OpSecretUndelete, s.wrap(OpSecretUndelete, s.handleUndelete))
+	n.Handle(OpSecretPurge, s.wrap(OpSecretPurge, s.handlePurge))
+	n.Handle(OpSecretDeleted, s.wrap(OpSecretDeleted, s.handleDeleted))
+	n.Handle(OpSecretSetMeta, s.wrap(OpSecretSetMeta, s.handleSetMeta))
+	n.Handle(OpSecretBatchGet, s.wrap(OpSecretBatchGet, s.handleBatchGet))
+	n.Handle(OpSecretPromote, s.wrap(OpSecretPromote, s.handlePromote))
+	n.Handle(OpSecretDiff, s.wrap(OpSecretDiff, s.handleDiff))
+	n.Handle(OpSecretImport, s.wrap(OpSecretImport, s.handleImport))
+	n.Handle(OpSecretWatch, s.wrap(OpSecretWatch, s.handleWatch))
+	n.Handle(OpTransitEncrypt, s.wrap(OpTransitEncrypt, s.handleTransitEncrypt))
+	n.Handle(OpTransitDecrypt, s.wrap(OpTransitDecrypt, s.handleTransitDecrypt))
+	n.Handle(OpTransitRewrap, s.wrap(OpTransitRewrap, s.handleTransitRewrap))
+	n.Handle(OpTransitDataKey, s.wrap(OpTransitDataKey, s.handleTransitDataKey))
+	n.Handle(OpTransitCreate, s.wrap(OpTransitCreate, s.handleTransitCreate))
+	n.Handle(OpTransitRotate, s.wrap(OpTransitRotate, s.handleTransitRotate))
+	n.Handle(OpTransitImportToken, s.wrap(OpTransitImportToken, s.handleTransitImportToken))
+	n.Handle(OpTransitImport, s.wrap(OpTransitImport, s.handleTransitImport))
+	n.Handle(OpTransitHMAC, s.wrap(OpTransitHMAC, s.handleTransitHMAC))
+	n.Handle(OpTransitVerify, s.wrap(OpTransitVerify, s.handleTransitVerify))
+	n.Handle(OpTransitDerive, s.wrap(OpTransitDerive, s.handleTransitDerive))
+	n.Handle(OpTokenize, s.wrap(OpTokenize, s.handleTokenize))
+	n.Handle(OpDetokenize, s.wrap(OpDetokenize, s.handleDetokenize))
+	n.Handle(OpTokenizeCreate, s.wrap(OpTokenizeCreate, s.handleTokenizeCreate))
 	// Application-layer hybrid handshake. Distinct from the secret
 	// opcodes so a session is established before any get/put runs.
 	n.Handle(kmszap.OpClientHello, s.handleHandshake)
@@ -225,6 +423,7 @@ func (s *Server) Register(n *zap.Node) {
 				return respond(statusError, errJSON("session decrypt failed")), nil
 			}
 			payload = pt
+			ctx = withSealedSession(ctx)
 		}
 		ident, innerReq, decisionErr := s.verifyAndAuthorize(ctx, payload, op)
 		if decisionErr != nil {
@@ -261,10 +460,60 @@ func (s *Server) dispatch(ctx context.Context, ident Identity, op uint16, inner
 		return s.handleList(ctx, ident, inner)
 	case OpSecretDelete:
 		return s.handleDelete(ctx, ident, inner)
+	case OpSecretVersions:
+		return s.handleVersions(ctx, ident, inner)
+	case OpSecretRollback:
+		return s.handleRollback(ctx, ident, inner)
+	case OpSecretUndelete:
+		return s.handleUndelete(ctx, ident, inner)
+	case OpSecretPurge:
+		return s.handlePurge(ctx, ident, inner)
+	case OpSecretDeleted:
+		return s.handleDeleted(ctx, ident, inner)
+	case OpSecretSetMeta:
+		return s.handleSetMeta(ctx, ident, inner)
+	case OpSecretBatchGet:
+		return s.handleBatchGet(ctx, ident, inner)
+	case OpSecretPromote:
+		return s.handlePromote(ctx, ident, inner)
+	case OpSecretDiff:
+		return s.handleDiff(ctx, ident, inner)
+	case OpSecretImport:
+		return s.handleImport(ctx, ident, inner)
+	case OpSecretWatch:
+		return s.handleWatch(ctx, ident, inner)
 	case OpSign:
 		return s.handleSign(ctx, ident, inner)
 	case OpVerify:
 		return s.handleVerify(ctx, ident, inner)
+	case OpTransitEncrypt:
+		return s.handleTransitEncrypt(ctx, ident, inner)
+	case OpTransitDecrypt:
+		return s.handleTransitDecrypt(ctx, ident, inner)
+	case OpTransitRewrap:
+		return s.handleTransitRewrap(ctx, ident, inner)
+	case OpTransitDataKey:
+		return s.handleTransitDataKey(ctx, ident, inner)
+	case OpTransitCreate:
+		return s.handleTransitCreate(ctx, ident, inner)
+	case OpTransitRotate:
+		return s.handleTransitRotate(ctx, ident, inner)
+	case OpTransitImportToken:
+		return s.handleTransitImportToken(ctx, ident, inner)
+	case OpTransitImport:
+		return s.handleTransitImport(ctx, ident, inner)
+	case OpTransitHMAC:
+		return s.handleTransitHMAC(ctx, ident, inner)
+	case OpTransitVerify:
+		return s.handleTransitVerify(ctx, ident, inner)
+	case OpTransitDerive:
+		return s.handleTransitDerive(ctx, ident, inner)
+	case OpTokenize:
+		return s.handleTokenize(ctx, ident, inner)
+	case OpDetokenize:
+		return s.handleDetokenize(ctx, ident, inner)
+	case OpTokenizeCreate:
+		return s.handleTokenizeCreate(ctx, ident, inner)
 	default:
 		return statusError, errJSON("unknown opcode"), nil
 	}
@@ -278,6 +527,22 @@ func (s *Server) session(peerID string) *kmszap.Session {
 	return s.sessions[peerID]
 }
 
+// sealedSessionKey marks a request whose response is sealed to the
+// caller's hybrid session.
+type sealedSessionKey struct{}
+
+func withSealedSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sealedSessionKey{}, true)
+}
+
+// hasSealedSession reports whether ctx's response is sealed to the
+// caller's session: only then may a handler answer key material that
+// exists nowhere else (a derived key).
+func hasSealedSession(ctx context.Context) bool {
+	sealed, _ := ctx.Value(sealedSessionKey{}).(bool)
+	return sealed
+}
+
 // setSession stores a freshly negotiated session, replacing any prior
 // entry for the same peer. Replacing is the sane behaviour: a new
 // ClientHello means the client wants to rotate.
@@ -384,6 +649,7 @@ func (s *Server) wrap(op uint16, h handlerFn) zap.Handler {
 				return respond(statusError, errJSON("session decrypt failed")), nil
 			}
 			payload = pt
+			ctx = withSealedSession(ctx)
 		}
 		ident, innerReq, decisionErr := s.verifyAndAuthorize(ctx, payload, op)
 		if decisionErr != nil {
@@ -445,18 +711,27 @@ func (s *Server) verifyAndAuthorize(ctx context.Context, raw []byte, op uint16)
 }
 
 // pathFromInnerRequest extracts the canonical "path" from the opcode's
-// inner JSON request shape. Each opcode has a single `path` field;
-// missing → "" which the authorizer treats as the root prefix.
+// inner JSON request shape. Each secret opcode has a single `path` field;
+// missing → "" which the authorizer treats as the root prefix. A transit
+// opcode names a `key` instead and is authorized on "transit/<key>"; a
+// tokenization opcode on "tokenize/<key>".
 func pathFromInnerRequest(op uint16, req json.RawMessage) (string, error) {
 	if len(req) == 0 {
 		return "", errors.New("envelope: empty inner request")
 	}
 	var anyReq struct {
 		Path string `json:"path"`
+		Key  string `json:"key"`
 	}
 	if err := json.Unmarshal(req, &anyReq); err != nil {
 		return "", fmt.Errorf("envelope: inner: %w", err)
 	}
+	if isTransitOp(op) {
+		return transitAuthPath(anyReq.Key), nil
+	}
+	if isTokenizeOp(op) {
+		return tokenizeAuthPath(anyReq.Key), nil
+	}
 	return anyReq.Path, nil
 }
 
@@ -489,31 +764,57 @@ type getReq struct {
 	Path string `json:"path"`
 	Name string `json:"name"`
 	Env  string `json:"env"`
+	// Version pins the read to one version; omitted (0) reads the latest.
+	Version int `json:"version,omitempty"`
+	// Raw returns the value as stored, with its ${ref:...} references
+	// unexpanded — what an editor needs to write it back.
+	Raw bool `json:"raw,omitempty"`
 }
 
 type getResp struct {
-	Value string `json:"value"` // base64 plaintext
+	Value   string `json:"value"`   // base64 plaintext
+	Version int    `json:"version"` // the version that was read
 }
 
-func (s *Server) handleGet(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+func (s *Server) handleGet(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
 	var req getReq
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return statusError, errJSON(err.Error()), nil
 	}
-	sec, err := s.store.Get(req.Path, req.Name, req.Env)
+	if req.Version < 0 {
+		return statusError, errJSON("version must be positive"), nil
+	}
+	ctx = store.WithPrincipal(ctx, writerOf(ident))
+	pt, version, err := s.sealed.GetVersionContext(ctx, req.Path, req.Name, req.Env, req.Version)
+	if errors.Is(err, store.ErrSecretExpired) {
+		return statusNotFound, errJSON(err.Error()), nil
+	}
 	if errors.Is(err, store.ErrSecretNotFound) {
 		return statusNotFound, errJSON("not found"), nil
 	}
-	if err != nil {
-		return statusError, nil, err
+	if errors.Is(err, store.ErrVersionNotFound) {
+		return statusNotFound, errJSON("version not found"), nil
+	}
+	if errors.Is(err, store.ErrThresholdUnavailable) {
+		return statusError, errJSON(err.Error()), nil
 	}
-	pt, err := store.Open(s.masterKey, sec)
 	if err != nil {
 		return statusError, nil, err
 	}
 	defer zero(pt)
-	b, _ := json.Marshal(getResp{Value: base64.StdEncoding.EncodeToString(pt)})
-	s.log.Debug("kms.zap get", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
+	if !req.Raw {
+		expanded, err := s.sealed.ExpandContext(ctx, secret.Ref{Path: req.Path, Env: req.Env, Name: req.Name}, pt, s.refAuthorizer(ctx, ident))
+		if errors.Is(err, store.ErrRef) {
+			return refStatus(err), errJSON(err.Error()), nil
+		}
+		if err != nil {
+			return statusError, nil, err
+		}
+		defer zero(expanded)
+		pt = expanded
+	}
+	b, _ := json.Marshal(getResp{Value: base64.StdEncoding.EncodeToString(pt), Version: version})
+	s.log.Debug("kms.zap get", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env, "version", version)
 	return statusOK, b, nil
 }
 
@@ -522,33 +823,101 @@ type putReq struct {
 	Name  string `json:"name"`
 	Env   string `json:"env"`
 	Value string `json:"value"` // base64 plaintext
+	// ExpectVersion, when > 0, makes the write conditional on the current
+	// version; ExpectAbsent on there being no current record.
+	ExpectVersion int  `json:"expect_version,omitempty"`
+	ExpectAbsent  bool `json:"expect_absent,omitempty"`
+	// Meta, when present, replaces the secret's metadata with this write;
+	// omitted keeps what is there.
+	Meta *secret.Meta `json:"meta,omitempty"`
+	// Lock, when present, creates the secret locked (write-once): the put
+	// fails if the secret exists. Only reason and two_person are read; the
+	// server records who locked it and when.
+	Lock *secret.Lock `json:"lock,omitempty"`
+	// Generate, in place of value, has the server make the value by this
+	// policy. The answer carries it (base64) only when Reveal is set.
+	Generate *generate.Policy `json:"generate,omitempty"`
+	Reveal   bool             `json:"reveal,omitempty"`
+	// Mode is "aead+mlkem" or "tfhe" (threshold reveal: every read is a
+	// t-of-n decrypt); omitted keeps the secret's current mode.
+	Mode string `json:"mode,omitempty"`
 }
 
-func (s *Server) handlePut(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+func (s *Server) handlePut(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
 	var req putReq
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return statusError, errJSON(err.Error()), nil
 	}
+	if req.Generate != nil && req.Value != "" {
+		return statusError, errJSON("value and generate are exclusive: send one"), nil
+	}
 	pt, err := base64.StdEncoding.DecodeString(req.Value)
 	if err != nil {
 		return statusError, errJSON("bad base64"), nil
 	}
 	defer zero(pt)
-	sec, err := store.Seal(s.masterKey, req.Path, req.Name, req.Env, pt)
+	var lock *secret.Lock
+	if req.Lock != nil {
+		lock = &secret.Lock{LockedBy: writerOf(ident), Reason: req.Lock.Reason, TwoPerson: req.Lock.TwoPerson}
+	}
+	opts := store.PutOptions{
+		Writer: writerOf(ident),
+		If:     store.Precondition{Version: req.ExpectVersion, Absent: req.ExpectAbsent},
+		Meta:   req.Meta,
+		Lock:   lock,
+		Mode:   req.Mode,
+	}
+	var (
+		version int
+		gen     *generate.Value
+	)
+	ctx = store.WithPrincipal(ctx, writerOf(ident))
+	if req.Generate != nil {
+		version, gen, err = s.sealed.GenerateContext(ctx, req.Path, req.Name, req.Env, *req.Generate, opts)
+	} else {
+		version, err = s.sealed.PutContext(ctx, req.Path, req.Name, req.Env, pt, opts)
+	}
 	if err != nil {
+		// A value a path schema refuses is the caller's to fix; the message
+		// names the rule (schema.RuleError).
+		if errors.Is(err, store.ErrInvalidCoord) || errors.Is(err, store.ErrInvalidMeta) || errors.Is(err, store.ErrInvalidLock) ||
+			errors.Is(err, schema.ErrInvalidValue) || errors.Is(err, generate.ErrInvalidPolicy) ||
+			errors.Is(err, store.ErrUnsupportedMode) || errors.Is(err, store.ErrThresholdUnavailable) {
+			return statusError, errJSON(err.Error()), nil
+		}
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			return statusConflict, errJSON(err.Error()), nil
+		}
 		return statusError, nil, err
 	}
-	if err := s.store.Put(sec); err != nil {
-		return statusError, nil, err
+	s.log.Info("kms.zap put", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env, "version", version)
+	if lock != nil {
+		s.log.Info("kms.zap audit lock", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env, "two_person", lock.TwoPerson)
 	}
-	s.log.Info("kms.zap put", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
-	b, _ := json.Marshal(map[string]bool{"ok": true})
+	resp := map[string]any{"ok": true, "version": version}
+	if gen != nil {
+		defer zero(gen.Secret)
+		s.log.Info("kms.zap generate", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env, "type", req.Generate.Type, "reveal", req.Reveal)
+		if gen.PublicKey != "" {
+			resp["public_key"] = gen.PublicKey
+		}
+		if req.Reveal {
+			resp["value"] = base64.StdEncoding.EncodeToString(gen.Secret)
+		}
+	}
+	b, _ := json.Marshal(resp)
 	return statusOK, b, nil
 }
 
 type listReq struct {
 	Path string `json:"path"`
 	Env  string `json:"env"`
+	// Labels narrows the list to secrets carrying every one of these
+	// labels (OpSecretList only).
+	Labels map[string]string `json:"labels,omitempty"`
+	// Cursor and Limit page the list (OpSecretList only); see secret.Query.
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
 }
 
 type listResp struct {
@@ -559,9 +928,11 @@ type listResp struct {
 	// would name a secret the matching get could not fetch. The wire carries
 	// exactly what a get needs, so list-then-get closes by construction.
 	Secrets []secret.Ref `json:"secrets"`
-	// Truncated is true when the match set exceeded the store's row cap and the
-	// answer is a bounded prefix — the caller should narrow with path/env.
+	// Truncated is true when the match set did not fit this page and the
+	// answer is a bounded prefix — follow NextCursor, or narrow with path/env.
 	Truncated bool `json:"truncated,omitempty"`
+	// NextCursor, when set, is the cursor of the next page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // handleList answers OpSecretList from the same store.Find the HTTP face uses,
@@ -573,12 +944,17 @@ func (s *Server) handleList(_ context.Context, ident Identity, payload []byte) (
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return statusError, errJSON(err.Error()), nil
 	}
-	refs, truncated, err := s.store.Find(secret.Query{Path: req.Path, Env: req.Env})
+	refs, next, err := s.store.FindPage(secret.Query{
+		Path: req.Path, Env: req.Env, Labels: req.Labels, Cursor: req.Cursor, Limit: req.Limit,
+	})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		return statusError, errJSON(err.Error()), nil
+	}
 	if err != nil {
 		return statusError, nil, err
 	}
 	s.log.Debug("kms.zap list", "ident", ident.String(), "path", req.Path, "env", req.Env)
-	b, _ := json.Marshal(listResp{Secrets: refs, Truncated: truncated})
+	b, _ := json.Marshal(listResp{Secrets: refs, Truncated: next != "", NextCursor: next})
 	return statusOK, b, nil
 }
 
@@ -586,6 +962,9 @@ type delReq struct {
 	Path string `json:"path"`
 	Name string `json:"name"`
 	Env  string `json:"env"`
+	// ExpectVersion, when > 0, makes the delete conditional on the current
+	// version (OpSecretDelete only).
+	ExpectVersion int `json:"expect_version,omitempty"`
 }
 
 func (s *Server) handleDelete(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
@@ -593,10 +972,14 @@ func (s *Server) handleDelete(_ context.Context, ident Identity, payload []byte)
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return statusError, errJSON(err.Error()), nil
 	}
-	if err := s.store.Delete(req.Path, req.Name, req.Env); err != nil {
+	opts := store.DeleteOptions{Deleter: writerOf(ident), If: store.Precondition{Version: req.ExpectVersion}}
+	if err := s.sealed.Delete(req.Path, req.Name, req.Env, opts); err != nil {
 		if errors.Is(err, store.ErrSecretNotFound) {
 			return statusNotFound, errJSON("not found"), nil
 		}
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			return statusConflict, errJSON(err.Error()), nil
+		}
 		return statusError, nil, err
 	}
 	s.log.Info("kms.zap delete", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
@@ -604,6 +987,474 @@ func (s *Server) handleDelete(_ context.Context, ident Identity, payload []byte)
 	return statusOK, b, nil
 }
 
+type versionsReq struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Env  string `json:"env"`
+}
+
+type versionsResp struct {
+	// Versions is oldest first. It names who wrote each version and when;
+	// no value is ever carried.
+	Versions []secret.Version `json:"versions"`
+}
+
+func (s *Server) handleVersions(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req versionsReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	versions, err := s.sealed.Versions(req.Path, req.Name, req.Env)
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return statusNotFound, errJSON("not found"), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Debug("kms.zap versions", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
+	b, _ := json.Marshal(versionsResp{Versions: versions})
+	return statusOK, b, nil
+}
+
+type rollbackReq struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Env     string `json:"env"`
+	Version int    `json:"version"`
+	// ExpectVersion, when > 0, makes the rollback conditional on the
+	// current version.
+	ExpectVersion int `json:"expect_version,omitempty"`
+}
+
+// handleRollback promotes an old version to latest by writing it as a new
+// version; nothing is discarded from the history.
+func (s *Server) handleRollback(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req rollbackReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if req.Version <= 0 {
+		return statusError, errJSON("version is required"), nil
+	}
+	ctx = store.WithPrincipal(ctx, writerOf(ident))
+	version, err := s.sealed.RollbackContext(ctx, req.Path, req.Name, req.Env, req.Version, store.PutOptions{
+		Writer: writerOf(ident),
+		If:     store.Precondition{Version: req.ExpectVersion},
+	})
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return statusNotFound, errJSON("not found"), nil
+	}
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		return statusConflict, errJSON(err.Error()), nil
+	}
+	if errors.Is(err, store.ErrVersionNotFound) {
+		return statusNotFound, errJSON("version not found"), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap rollback", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env,
+		"from", req.Version, "version", version)
+	b, _ := json.Marshal(map[string]any{"ok": true, "version": version})
+	return statusOK, b, nil
+}
+
+// handleUndelete restores a deleted secret as it was deleted, within the
+// retention window.
+func (s *Server) handleUndelete(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req delReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	version, err := s.store.Undelete(req.Path, req.Name, req.Env)
+	if errors.Is(err, store.ErrNotDeleted) {
+		return statusNotFound, errJSON("not deleted"), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap undelete", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env, "version", version)
+	b, _ := json.Marshal(map[string]any{"ok": true, "version": version})
+	return statusOK, b, nil
+}
+
+// handlePurge removes a deleted secret and its history for good. A live
+// secret cannot be purged; it must be deleted first.
+func (s *Server) handlePurge(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req delReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if err := s.store.Purge(req.Path, req.Name, req.Env); err != nil {
+		if errors.Is(err, store.ErrNotDeleted) {
+			return statusNotFound, errJSON("not deleted"), nil
+		}
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap purge", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
+	b, _ := json.Marshal(map[string]bool{"ok": true})
+	return statusOK, b, nil
+}
+
+type deletedResp struct {
+	Deleted   []secret.Deleted `json:"deleted"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+// handleDeleted lists tombstoned coordinates under the same {path, env}
+// filter OpSecretList takes.
+func (s *Server) handleDeleted(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req listReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	deleted, truncated, err := s.store.Deleted(secret.Query{Path: req.Path, Env: req.Env})
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Debug("kms.zap deleted", "ident", ident.String(), "path", req.Path, "env", req.Env)
+	b, _ := json.Marshal(deletedResp{Deleted: deleted, Truncated: truncated})
+	return statusOK, b, nil
+}
+
+type setMetaReq struct {
+	Path          string       `json:"path"`
+	Name          string       `json:"name"`
+	Env           string       `json:"env"`
+	Meta          *secret.Meta `json:"meta"`
+	ExpectVersion int          `json:"expect_version,omitempty"`
+}
+
+// handleSetMeta replaces a secret's metadata without writing a new version.
+// An empty or omitted meta clears it.
+func (s *Server) handleSetMeta(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req setMetaReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	err := s.store.SetMeta(req.Path, req.Name, req.Env, req.Meta, store.Precondition{Version: req.ExpectVersion})
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return statusNotFound, errJSON("not found"), nil
+	}
+	if errors.Is(err, store.ErrInvalidMeta) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		return statusConflict, errJSON(err.Error()), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap set-meta", "ident", ident.String(), "path", req.Path, "name", req.Name, "env", req.Env)
+	b, _ := json.Marshal(map[string]bool{"ok": true})
+	return statusOK, b, nil
+}
+
+// batchGetReq selects the secrets of one batch read. Path is the root the
+// request is authorized for, as on every other op; with Refs, each must lie
+// under it, and without, the batch is the query {Path, Env, Labels}.
+type batchGetReq struct {
+	Path   string            `json:"path"`
+	Env    string            `json:"env,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Refs   []secret.Ref      `json:"refs,omitempty"`
+}
+
+// Per-item batch status. A missing item does not fail the batch.
+const (
+	batchOK       = "ok"
+	batchNotFound = "not_found"
+	batchExpired  = "expired"
+	batchError    = "error"
+	// batchForbidden: the value holds a ${ref:...} the caller may not read.
+	batchForbidden = "forbidden"
+)
+
+type batchItem struct {
+	secret.Ref
+	Status  string `json:"status"`
+	Value   string `json:"value,omitempty"` // base64 plaintext
+	Version int    `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type batchGetResp struct {
+	Items []batchItem `json:"items"`
+	// Truncated is true when a query matched more than the batch cap; the
+	// items are a prefix and the caller should narrow the query.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// handleBatchGet answers many gets from one verified, authorized envelope —
+// and, over ZAP with a session, one AEAD-sealed response. Items come back in
+// request order (refs) or listing order (query), each with its own status.
+func (s *Server) handleBatchGet(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req batchGetReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	ctx = store.WithPrincipal(ctx, writerOf(ident))
+	var (
+		items     []store.BatchItem
+		truncated bool
+		err       error
+	)
+	if len(req.Refs) > 0 {
+		if req.Env != "" || len(req.Labels) > 0 {
+			return statusError, errJSON("refs and a query (env, labels) are exclusive"), nil
+		}
+		for _, ref := range req.Refs {
+			if !store.UnderPath(req.Path, ref.Path) {
+				return statusError, errJSON(fmt.Sprintf("ref %s/%s@%s is outside the request path %q", ref.Path, ref.Name, ref.Env, req.Path)), nil
+			}
+		}
+		items, err = s.sealed.GetManyContext(ctx, req.Refs)
+	} else {
+		items, truncated, err = s.sealed.GetMatchingContext(ctx, secret.Query{Path: req.Path, Env: req.Env, Labels: req.Labels})
+	}
+	if errors.Is(err, store.ErrBatchTooLarge) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	resp := batchGetResp{Items: make([]batchItem, len(items)), Truncated: truncated}
+	authorize := s.refAuthorizer(ctx, ident)
+	found := 0
+	for i, it := range items {
+		out := batchItem{Ref: it.Ref, Status: batchOK}
+		switch {
+		case errors.Is(it.Err, store.ErrSecretExpired):
+			out.Status, out.Error = batchExpired, it.Err.Error()
+		case errors.Is(it.Err, store.ErrSecretNotFound):
+			out.Status = batchNotFound
+		case it.Err != nil:
+			s.log.Warn("kms.zap batch-get item failed", "path", it.Ref.Path, "name", it.Ref.Name, "env", it.Ref.Env, "err", it.Err)
+			out.Status, out.Error = batchError, "read failed"
+		default:
+			value, err := s.sealed.ExpandContext(ctx, it.Ref, it.Value, authorize)
+			switch {
+			case errors.Is(err, store.ErrRefForbidden):
+				out.Status, out.Error = batchForbidden, err.Error()
+			case errors.Is(err, store.ErrRef):
+				out.Status, out.Error = batchError, err.Error()
+			case err != nil:
+				s.log.Warn("kms.zap batch-get item failed", "path", it.Ref.Path, "name", it.Ref.Name, "env", it.Ref.Env, "err", err)
+				out.Status, out.Error = batchError, "read failed"
+			default:
+				out.Value, out.Version = base64.StdEncoding.EncodeToString(value), it.Version
+				zero(value)
+				found++
+			}
+			zero(it.Value)
+		}
+		resp.Items[i] = out
+	}
+	s.log.Debug("kms.zap batch-get", "ident", ident.String(), "path", req.Path, "items", len(items), "found", found)
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+type promoteReq struct {
+	Path   string `json:"path"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+type promoteResp struct {
+	Changes []secret.Promotion `json:"changes"`
+	DryRun  bool               `json:"dry_run"`
+}
+
+// handlePromote copies the subtree at path from one env to another in one
+// transaction (store.SealedStore.Promote). It is authorized once, as a write
+// to path, like every op; a dry run is authorized the same way because its
+// answer is the plan of that write.
+func (s *Server) handlePromote(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req promoteReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	ctx = store.WithPrincipal(ctx, writerOf(ident))
+	changes, err := s.sealed.PromoteContext(ctx, store.PromoteOptions{
+		Path: req.Path, From: req.From, To: req.To, DryRun: req.DryRun, Writer: writerOf(ident),
+	})
+	if errors.Is(err, store.ErrInvalidCoord) || errors.Is(err, store.ErrPromoteSameEnv) || errors.Is(err, store.ErrBatchTooLarge) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		return statusConflict, errJSON(err.Error()), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap promote", "ident", ident.String(), "path", req.Path, "from", req.From, "to", req.To, "dry_run", req.DryRun, "changes", len(changes))
+	b, _ := json.Marshal(promoteResp{Changes: changes, DryRun: req.DryRun})
+	return statusOK, b, nil
+}
+
+type diffReq struct {
+	Path string `json:"path"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// handleDiff compares two envs of a subtree (store.SealedStore.Diff). Beyond
+// the op itself, the caller is authorized as a get of the path — the answer
+// says something about the values it holds. Consensus authority is
+// path-scoped: it names no env, so one check covers both.
+func (s *Server) handleDiff(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req diffReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if err := s.refAuthorizer(ctx, ident)(secret.Ref{Path: req.Path}); err != nil {
+		return statusForbid, errJSON(err.Error()), nil
+	}
+	d, err := s.sealed.Diff(req.Path, req.A, req.B)
+	if errors.Is(err, store.ErrInvalidCoord) || errors.Is(err, store.ErrDiffTooLarge) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Debug("kms.zap diff", "ident", ident.String(), "path", req.Path, "a", req.A, "b", req.B)
+	b, _ := json.Marshal(d)
+	return statusOK, b, nil
+}
+
+type importReq struct {
+	Path     string `json:"path"`
+	Env      string `json:"env"`
+	Format   string `json:"format"`   // dotenv | json | yaml
+	Document string `json:"document"` // the file's text
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// handleImport parses a bundle and imports it (store.SealedStore.Import): all
+// names valid or nothing, one transaction, existing names per conflict.
+func (s *Server) handleImport(_ context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req importReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	parsed, err := bundle.Parse(req.Format, []byte(req.Document))
+	if err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	entries := make([]store.ImportEntry, len(parsed))
+	for i, e := range parsed {
+		entries[i] = store.ImportEntry{Name: e.Name, Value: []byte(e.Value)}
+	}
+	defer func() {
+		for _, e := range entries {
+			zero(e.Value)
+		}
+	}()
+	imported, err := s.sealed.Import(entries, store.ImportOptions{
+		Path: req.Path, Env: req.Env, Conflict: req.Conflict, Writer: writerOf(ident),
+	})
+	if errors.Is(err, store.ErrInvalidImport) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		return statusConflict, errJSON(err.Error()), nil
+	}
+	if err != nil {
+		return statusError, nil, err
+	}
+	s.log.Info("kms.zap import", "ident", ident.String(), "path", req.Path, "env", req.Env, "format", req.Format, "entries", len(imported))
+	b, _ := json.Marshal(map[string]any{"imported": imported})
+	return statusOK, b, nil
+}
+
+// maxWatchWait bounds how long one OpSecretWatch holds its request open. It
+// stays well inside the HTTP /v1/sdk write timeout and a client's patience;
+// a watcher simply asks again.
+const maxWatchWait = 30 * time.Second
+
+type watchReq struct {
+	Path   string            `json:"path"`
+	Env    string            `json:"env,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Cursor is where the previous answer left off; "" starts at the head.
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	// WaitMS is how long to wait for a change when there is none yet;
+	// 0 answers at once.
+	WaitMS int `json:"wait_ms,omitempty"`
+}
+
+type watchResp struct {
+	Changes []secret.Change `json:"changes"`
+	// Cursor is what the next watch passes back.
+	Cursor string `json:"cursor"`
+	// Lost is true when changes since the request's cursor are no longer
+	// held; Cursor is then the head.
+	Lost bool `json:"lost,omitempty"`
+}
+
+// handleWatch answers OpSecretWatch from the change log. The request was
+// authorized as a read of its path by wrap, as a list is; the answer names
+// coordinates and versions, never a value.
+func (s *Server) handleWatch(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	var req watchReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return statusError, errJSON(err.Error()), nil
+	}
+	if req.WaitMS < 0 {
+		return statusError, errJSON("wait_ms must not be negative"), nil
+	}
+	wait := min(time.Duration(req.WaitMS)*time.Millisecond, maxWatchWait)
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	changes, next, err := s.store.Changes().Wait(ctx, secret.Query{
+		Path: req.Path, Env: req.Env, Labels: req.Labels, Cursor: req.Cursor, Limit: req.Limit,
+	})
+	if errors.Is(err, store.ErrInvalidChangeCursor) {
+		return statusError, errJSON(err.Error()), nil
+	}
+	lost := errors.Is(err, store.ErrChangesLost)
+	if err != nil && !lost {
+		return statusError, nil, err
+	}
+	if changes == nil {
+		changes = []secret.Change{}
+	}
+	s.log.Debug("kms.zap watch", "ident", ident.String(), "path", req.Path, "env", req.Env, "changes", len(changes), "lost", lost)
+	b, _ := json.Marshal(watchResp{Changes: changes, Cursor: next, Lost: lost})
+	return statusOK, b, nil
+}
+
+// refAuthorizer authorizes each ${ref:...} a read expands as a get of the
+// referenced path by ident, through the same authorizer the request itself
+// passed, so a reference reaches nothing ident could not get directly.
+func (s *Server) refAuthorizer(ctx context.Context, ident Identity) store.RefAuthorizer {
+	return func(ref secret.Ref) error {
+		decision, err := s.authz.Authorize(ctx, ident, ref.Path, OpAuthGet)
+		if err != nil {
+			return fmt.Errorf("consensus: %s: %w", decision.Reason, err)
+		}
+		if !decision.Allow {
+			return fmt.Errorf("forbidden: %s", decision.Reason)
+		}
+		return nil
+	}
+}
+
+// refStatus is the status of a read whose expansion failed: a refused
+// reference is statusForbid, anything else about the value statusError.
+func refStatus(err error) byte {
+	if errors.Is(err, store.ErrRefForbidden) {
+		return statusForbid
+	}
+	return statusError
+}
+
+// writerOf is the identity recorded on a version written over ZAP or /v1/sdk.
+func writerOf(ident Identity) string { return "zap:" + ident.String() }
+
 // zero wipes a byte slice (best effort — caller must still avoid copies).
 func zero(b []byte) {
 	for i := range b {
@@ -0,0 +1,125 @@
+// Copyright (C) 2019-2026, Lux Industries Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// tokenize.go — the tokenization engine's ops (pkg/tokenize) on the signed
+// envelope, authorized on the path "tokenize/<key>". Tokenize needs the
+// validator (read) authority and create the operator (write) authority;
+// detokenize needs the detokenizer authority, so the services that make
+// tokens and the few that may see the values behind them are separate
+// sets. Keys are held by the SealedStore shared with the HTTP
+// /v1/kms/tokenize routes.
+
+package zapserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/luxfi/kms/pkg/store"
+	"github.com/luxfi/kms/pkg/tokenize"
+)
+
+// tokenizeAuthPath is the path a tokenization op is authorized on.
+func tokenizeAuthPath(key string) string { return "tokenize/" + key }
+
+// isTokenizeOp reports whether op names a tokenization key.
+func isTokenizeOp(op uint16) bool { return op >= OpTokenize && op <= OpTokenizeCreate }
+
+type tokenizeReq struct {
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`    // tokenize
+	Token    string `json:"token,omitempty"`    // detokenize
+	Tweak    string `json:"tweak,omitempty"`    // base64
+	Mode     string `json:"mode,omitempty"`     // create
+	Alphabet string `json:"alphabet,omitempty"` // create
+}
+
+type tokenizeResp struct {
+	Token string `json:"token,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// parseTokenize decodes a tokenization request and its tweak.
+func parseTokenize(payload []byte) (tokenizeReq, []byte, []byte) {
+	var req tokenizeReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, nil, errJSON(err.Error())
+	}
+	if req.Key == "" {
+		return req, nil, errJSON("key required")
+	}
+	tweak, err := base64.StdEncoding.DecodeString(req.Tweak)
+	if err != nil {
+		return req, nil, errJSON("tweak must be base64")
+	}
+	return req, tweak, nil
+}
+
+// tokenizeStatus maps a tokenization failure to a status: a caller's
+// mistake in-band, anything else to the transport as an internal error.
+func tokenizeStatus(err error) (byte, []byte, error) {
+	switch {
+	case errors.Is(err, store.ErrTokenizeKeyNotFound):
+		return statusNotFound, errJSON("tokenization key not found"), nil
+	case errors.Is(err, store.ErrTokenizeKeyExists):
+		return statusConflict, errJSON(err.Error()), nil
+	case errors.Is(err, tokenize.ErrInvalidKey), errors.Is(err, tokenize.ErrInvalidValue),
+		errors.Is(err, tokenize.ErrInvalidTweak):
+		return statusError, errJSON(err.Error()), nil
+	}
+	return statusError, nil, err
+}
+
+func (s *Server) handleTokenize(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, tweak, bad := parseTokenize(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var resp tokenizeResp
+	err := s.sealed.UseTokenizeKey(req.Key, func(k *tokenize.Key) error {
+		var err error
+		resp.Token, err = k.Tokenize(req.Value, tweak)
+		return err
+	})
+	if err != nil {
+		return tokenizeStatus(err)
+	}
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleDetokenize(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, tweak, bad := parseTokenize(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var resp tokenizeResp
+	err := s.sealed.UseTokenizeKey(req.Key, func(k *tokenize.Key) error {
+		var err error
+		resp.Value, err = k.Detokenize(req.Token, tweak)
+		return err
+	})
+	if err != nil {
+		return tokenizeStatus(err)
+	}
+	// Audit: who detokenized under which key — never the token or value.
+	s.log.Info("kms.sdk detokenize", "ident", ident.String(), "key", req.Key)
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTokenizeCreate(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, bad := parseTokenize(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	info, err := s.sealed.CreateTokenizeKey(req.Key, tokenize.KeyOptions{Mode: req.Mode, Alphabet: req.Alphabet})
+	if err != nil {
+		return tokenizeStatus(err)
+	}
+	s.log.Info("kms.sdk tokenize create", "ident", ident.String(), "key", info.Name, "mode", info.Mode)
+	b, _ := json.Marshal(info)
+	return statusOK, b, nil
+}
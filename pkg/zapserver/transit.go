@@ -0,0 +1,328 @@
+// Copyright (C) 2019-2026, Lux Industries Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// transit.go — the transit engine's ops (pkg/transit) on the signed
+// envelope. They ride the same verify→authorize→dispatch core as the
+// secret opcodes, authorized on the path "transit/<key>": encrypt,
+// decrypt, rewrap, datakey, hmac, verify and derive use a key and need the
+// validator (read) authority; create, rotate and the two BYOK import steps
+// change one and need the operator (write) authority. Keys are held by the SealedStore shared with the HTTP
+// /v1/kms/transit routes, so a ciphertext made on either transport
+// decrypts on the other.
+
+package zapserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/luxfi/kms/pkg/byok"
+	"github.com/luxfi/kms/pkg/store"
+	"github.com/luxfi/kms/pkg/transit"
+)
+
+// transitAuthPath is the path a transit op is authorized on.
+func transitAuthPath(key string) string { return "transit/" + key }
+
+// isTransitOp reports whether op names a key rather than a secret path.
+func isTransitOp(op uint16) bool {
+	return (op >= OpTransitEncrypt && op <= OpTransitImport) || (op >= OpTransitHMAC && op <= OpTransitDerive)
+}
+
+type transitReq struct {
+	Key            string `json:"key"`
+	Type           string `json:"type,omitempty"`            // create
+	Deterministic  bool   `json:"deterministic,omitempty"`   // create
+	Plaintext      string `json:"plaintext,omitempty"`       // encrypt, base64
+	Ciphertext     string `json:"ciphertext,omitempty"`      // decrypt, rewrap
+	AssociatedData string `json:"associated_data,omitempty"` // base64
+	Context        string `json:"context,omitempty"`         // base64; deterministic keys, derive
+	Bits           int    `json:"bits,omitempty"`            // datakey, derive
+	Input          string `json:"input,omitempty"`           // hmac, verify; base64
+	MAC            string `json:"mac,omitempty"`             // verify
+	Version        int    `json:"version,omitempty"`         // derive; 0 is the latest
+	TTLSeconds     int    `json:"ttl_seconds,omitempty"`     // import token
+	Token          string `json:"token,omitempty"`           // import
+	Algorithm      string `json:"algorithm,omitempty"`       // import: mlkem768 or rsa-oaep-3072
+	WrappedKey     string `json:"wrapped_key,omitempty"`     // import, base64
+	Wrapped        bool   `json:"wrapped,omitempty"`         // datakey: ciphertext only
+}
+
+type transitResp struct {
+	Ciphertext string `json:"ciphertext,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+	Plaintext  string `json:"plaintext,omitempty"`
+}
+
+// parseTransit decodes a transit request, its associated data and its
+// context.
+func parseTransit(payload []byte) (transitReq, []byte, []byte, []byte) {
+	var req transitReq
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, nil, nil, errJSON(err.Error())
+	}
+	if req.Key == "" {
+		return req, nil, nil, errJSON("key required")
+	}
+	aad, err := base64.StdEncoding.DecodeString(req.AssociatedData)
+	if err != nil {
+		return req, nil, nil, errJSON("associated_data must be base64")
+	}
+	keyContext, err := base64.StdEncoding.DecodeString(req.Context)
+	if err != nil {
+		return req, nil, nil, errJSON("context must be base64")
+	}
+	return req, aad, keyContext, nil
+}
+
+// transitStatus maps a transit failure to a status: a caller's mistake
+// in-band, anything else to the transport as an internal error.
+func transitStatus(err error) (byte, []byte, error) {
+	switch {
+	case errors.Is(err, store.ErrTransitKeyNotFound):
+		return statusNotFound, errJSON("transit key not found"), nil
+	case errors.Is(err, store.ErrTransitKeyExists):
+		return statusConflict, errJSON(err.Error()), nil
+	case errors.Is(err, store.ErrImportToken), errors.Is(err, byok.ErrInvalidWrap), errors.Is(err, byok.ErrInvalidTTL):
+		return statusError, errJSON(err.Error()), nil
+	case errors.Is(err, transit.ErrInvalidKey), errors.Is(err, transit.ErrInvalidCiphertext),
+		errors.Is(err, transit.ErrDecrypt), errors.Is(err, transit.ErrInvalidContext),
+		errors.Is(err, transit.ErrTooLarge):
+		return statusError, errJSON(err.Error()), nil
+	}
+	return statusError, nil, err
+}
+
+func (s *Server) handleTransitEncrypt(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, aad, keyContext, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	pt, err := base64.StdEncoding.DecodeString(req.Plaintext)
+	if err != nil {
+		return statusError, errJSON("plaintext must be base64"), nil
+	}
+	defer zero(pt)
+	var resp transitResp
+	err = s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		resp.KeyVersion = k.Latest()
+		resp.Ciphertext, err = k.Encrypt(pt, aad, keyContext)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitDecrypt(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, aad, keyContext, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var pt []byte
+	err := s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		var err error
+		pt, err = k.Decrypt(req.Ciphertext, aad, keyContext)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	defer zero(pt)
+	version, _ := transit.CiphertextVersion(req.Ciphertext)
+	// Audit: who decrypted under which key version — never the data.
+	s.log.Info("kms.sdk transit decrypt", "ident", ident.String(), "key", req.Key, "version", version)
+	b, _ := json.Marshal(transitResp{Plaintext: base64.StdEncoding.EncodeToString(pt)})
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitRewrap(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, aad, keyContext, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var resp transitResp
+	err := s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		var err error
+		resp.KeyVersion = k.Latest()
+		resp.Ciphertext, err = k.Rewrap(req.Ciphertext, aad, keyContext)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+// handleTransitDataKey makes a data key: the key and its ciphertext, or
+// with wrapped the ciphertext alone.
+func (s *Server) handleTransitDataKey(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var pt []byte
+	var resp transitResp
+	err := s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		var err error
+		resp.KeyVersion = k.Latest()
+		pt, resp.Ciphertext, err = k.DataKey(req.Bits)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	defer zero(pt)
+	if !req.Wrapped {
+		resp.Plaintext = base64.StdEncoding.EncodeToString(pt)
+	}
+	s.log.Info("kms.sdk transit datakey", "ident", ident.String(), "key", req.Key, "version", resp.KeyVersion, "wrapped", req.Wrapped)
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitCreate(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	info, err := s.sealed.CreateTransitKey(req.Key, transit.KeyOptions{Type: req.Type, Deterministic: req.Deterministic})
+	if err != nil {
+		return transitStatus(err)
+	}
+	s.log.Info("kms.sdk transit create", "ident", ident.String(), "key", info.Name, "type", info.Type, "deterministic", info.Deterministic)
+	b, _ := json.Marshal(info)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitRotate(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	info, err := s.sealed.RotateTransitKey(req.Key)
+	if err != nil {
+		return transitStatus(err)
+	}
+	s.log.Info("kms.sdk transit rotate", "ident", ident.String(), "key", info.Name, "version", info.LatestVersion)
+	b, _ := json.Marshal(info)
+	return statusOK, b, nil
+}
+
+// handleTransitImportToken makes a one-time BYOK import key for req.Key
+// and answers its public halves, for the partner to wrap material to.
+func (s *Server) handleTransitImportToken(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	pub, err := s.sealed.CreateImportToken(req.Key, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		return transitStatus(err)
+	}
+	s.log.Info("kms.sdk transit import-token", "ident", ident.String(), "key", req.Key, "expires_at", pub.ExpiresAt)
+	b, _ := json.Marshal(pub)
+	return statusOK, b, nil
+}
+
+// handleTransitImport spends an import token: the material wrapped to it
+// becomes version 1 of the transit key req.Key.
+func (s *Server) handleTransitImport(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(req.WrappedKey)
+	if err != nil {
+		return statusError, errJSON("wrapped_key must be base64"), nil
+	}
+	info, err := s.sealed.ImportTransitKey(req.Token, req.Algorithm, wrapped, req.Key, transit.KeyOptions{Type: req.Type, Deterministic: req.Deterministic})
+	if err != nil {
+		s.log.Info("kms.sdk transit import refused", "ident", ident.String(), "key", req.Key, "err", err.Error())
+		return transitStatus(err)
+	}
+	s.log.Info("kms.sdk transit import", "ident", ident.String(), "key", info.Name, "type", info.Type)
+	b, _ := json.Marshal(info)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitHMAC(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		return statusError, errJSON("input must be base64"), nil
+	}
+	var resp struct {
+		MAC        string `json:"mac"`
+		KeyVersion int    `json:"key_version"`
+	}
+	err = s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		resp.KeyVersion = k.Latest()
+		resp.MAC, err = k.HMAC(input)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	b, _ := json.Marshal(resp)
+	return statusOK, b, nil
+}
+
+func (s *Server) handleTransitVerify(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	req, _, _, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		return statusError, errJSON("input must be base64"), nil
+	}
+	var valid bool
+	err = s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		valid, err = k.VerifyHMAC(input, req.MAC)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	b, _ := json.Marshal(map[string]bool{"valid": valid})
+	return statusOK, b, nil
+}
+
+// handleTransitDerive answers the subkey for the caller's context. The
+// subkey is as secret as the root key is for that context, so it is
+// answered only sealed to the caller's session, never in the clear of a
+// transport without one.
+func (s *Server) handleTransitDerive(ctx context.Context, ident Identity, payload []byte) (byte, []byte, error) {
+	if !hasSealedSession(ctx) {
+		return statusError, errJSON("derive answers only on a sealed session: run OpClientHello first"), nil
+	}
+	req, _, keyContext, bad := parseTransit(payload)
+	if bad != nil {
+		return statusError, bad, nil
+	}
+	var derived []byte
+	var version int
+	err := s.sealed.UseTransitKey(req.Key, func(k *transit.Key) error {
+		var err error
+		derived, version, err = k.Derive(keyContext, req.Version, req.Bits)
+		return err
+	})
+	if err != nil {
+		return transitStatus(err)
+	}
+	defer zero(derived)
+	// Audit: who derived under which key version — never the context or key.
+	s.log.Info("kms.sdk transit derive", "ident", ident.String(), "key", req.Key, "version", version)
+	b, _ := json.Marshal(map[string]any{"key": base64.StdEncoding.EncodeToString(derived), "key_version": version})
+	return statusOK, b, nil
+}